@@ -102,6 +102,10 @@ type Server struct {
 	PrettyPrint     bool   `toml:"pretty_print"`
 	DefaultLimit    uint   `toml:"paging_limit"`
 	MaxLimit        uint   `toml:"paging_maxlimit"`
+	// Seconds a request may spend reading from the data provider, 0 for no limit
+	QueryTimeout int `toml:"query_timeout"`
+	// Allow creating, replacing, updating & deleting features in data sources that support it
+	Transactions bool `toml:"transactions"`
 }
 
 type Logging struct {
@@ -147,14 +151,60 @@ type Contact struct {
 }
 
 type Providers struct {
+	// A single data source, its collections are served w/o a namespace
 	Data string `toml:"data"`
+	// Named data sources served together, used instead of Data if there are any
+	Sources []Source `toml:"sources"`
+	CSV     CSV      `toml:"csv"`
+	// Limits for temporary collections (i.e. search results), 0 for the defaults.  The TTL is in
+	// seconds since last access.
+	TempCollectionTTL  int `toml:"temp_collection_ttl"`
+	MaxTempCollections int `toml:"max_temp_collections"`
+	MaxTempFeatures    int `toml:"max_temp_features"`
+	// Seconds collection extents are cached for, 0 for the default
+	ExtentCacheTTL int `toml:"extent_cache_ttl"`
+}
+
+// A named data source, its collections are served as "<name>.<collection name>"
+type Source struct {
+	Name string `toml:"name"`
+	// Same as Providers.Data
+	Data string `toml:"data"`
+}
+
+// Geometry columns of CSV data files, those not set are auto-detected
+type CSV struct {
+	LonColumn string `toml:"lon_column"`
+	LatColumn string `toml:"lat_column"`
+	WKTColumn string `toml:"wkt_column"`
+}
+
+// Settings for a collection.  If SQL is set the collection is defined by that query against a
+// GeoPackage or PostGIS data source, otherwise these apply to the data source's collection w/ Name.
+type Collection struct {
+	Name string `toml:"name"`
+	// Name of the providers.sources entry to query, empty for the single data source
+	Provider       string `toml:"provider"`
+	SQL            string `toml:"sql"`
+	GeometryColumn string `toml:"geometry_column"`
+	// Column (or property) whose values identify features, comma separated columns for a
+	// composite id.  Optional w/o SQL, the primary key is used by default.
+	IDColumn string `toml:"id_column"`
+	// Optional, looked up from the data if not set
+	SRID uint64 `toml:"srid"`
+	// Property holding the time instant of each feature, or properties holding the start & end
+	// of a time interval.  Time filters apply to these & they define the temporal extent.
+	TimeProperty      string `toml:"time_property"`
+	StartTimeProperty string `toml:"start_time_property"`
+	EndTimeProperty   string `toml:"end_time_property"`
 }
 
 type Config struct {
-	Server    Server
-	Logging   Logging
-	Metadata  Metadata
-	Providers Providers
+	Server      Server
+	Logging     Logging
+	Metadata    Metadata
+	Providers   Providers
+	Collections []Collection `toml:"collections"`
 }
 
 // LoadFromFile read YAML into configuration
@@ -0,0 +1,342 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project ast.go
+
+package cql2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-spatial/geom"
+)
+
+// Logical operators
+const (
+	OpAnd = "AND"
+	OpOr  = "OR"
+)
+
+// Comparison operators
+const (
+	OpEqual        = "="
+	OpNotEqual     = "<>"
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+)
+
+// Spatial predicates
+const (
+	SpatialIntersects = "S_INTERSECTS"
+	SpatialEquals     = "S_EQUALS"
+	SpatialDisjoint   = "S_DISJOINT"
+	SpatialTouches    = "S_TOUCHES"
+	SpatialWithin     = "S_WITHIN"
+	SpatialOverlaps   = "S_OVERLAPS"
+	SpatialCrosses    = "S_CROSSES"
+	SpatialContains   = "S_CONTAINS"
+)
+
+// Whether two geometries are within a distance in meters of each other.  Not in CQL2, but named
+// like its spatial predicates.
+const SpatialDWithin = "S_DWITHIN"
+
+// Temporal predicates
+const (
+	TemporalAfter      = "T_AFTER"
+	TemporalBefore     = "T_BEFORE"
+	TemporalContains   = "T_CONTAINS"
+	TemporalDisjoint   = "T_DISJOINT"
+	TemporalDuring     = "T_DURING"
+	TemporalEquals     = "T_EQUALS"
+	TemporalIntersects = "T_INTERSECTS"
+)
+
+var spatialOps = []string{SpatialIntersects, SpatialEquals, SpatialDisjoint, SpatialTouches, SpatialWithin,
+	SpatialOverlaps, SpatialCrosses, SpatialContains}
+var temporalOps = []string{TemporalAfter, TemporalBefore, TemporalContains, TemporalDisjoint, TemporalDuring,
+	TemporalEquals, TemporalIntersects}
+
+// A CQL2 expression, one of the types below.  Predicates (those that are true or false) are
+// Logical, Not, Comparison, Like, In, Between, IsNull, SpatialPredicate, DistancePredicate,
+// TemporalPredicate & a boolean Literal, the others are their operands.
+type Expr interface {
+	// The expression in the CQL2 text encoding
+	String() string
+}
+
+// A feature property, or its geometry as an operand of a SpatialPredicate
+type Property struct {
+	Name string
+}
+
+// A string, float64 or bool
+type Literal struct {
+	Value interface{}
+}
+
+// A TIMESTAMP() or DATE() instant, Date is true for the latter
+type Timestamp struct {
+	Time time.Time
+	Date bool
+}
+
+// An INTERVAL() between two instants, each a Timestamp or Property, nil for an open end ('..')
+type Interval struct {
+	Start, End Expr
+}
+
+// A geometry given as WKT, in lon/lat
+type Geometry struct {
+	Geometry geom.Geometry
+}
+
+// A BBOX() in lon/lat
+type Envelope struct {
+	Extent geom.Extent
+}
+
+// Two or more predicates combined by OpAnd or OpOr
+type Logical struct {
+	Op   string
+	Args []Expr
+}
+
+type Not struct {
+	Arg Expr
+}
+
+// Compares two scalars w/ one of the comparison operators
+type Comparison struct {
+	Op          string
+	Left, Right Expr
+}
+
+// Matches Arg against Pattern, where '%' matches any number of characters, '_' a single
+// character & '\' escapes either
+type Like struct {
+	Arg, Pattern Expr
+	Not          bool
+}
+
+type In struct {
+	Arg  Expr
+	List []Expr
+	Not  bool
+}
+
+// Low <= Arg <= High
+type Between struct {
+	Arg, Low, High Expr
+	Not            bool
+}
+
+type IsNull struct {
+	Arg Expr
+	Not bool
+}
+
+// One of the Spatial* predicates of two geometry operands: a Property, Geometry or Envelope
+type SpatialPredicate struct {
+	Op          string
+	Left, Right Expr
+}
+
+// S_DWITHIN of two geometry operands, as for a SpatialPredicate, & a distance in meters
+type DistancePredicate struct {
+	Left, Right Expr
+	Distance    float64
+}
+
+// One of the Temporal* predicates of two temporal operands: a Property, Timestamp or Interval
+type TemporalPredicate struct {
+	Op          string
+	Left, Right Expr
+}
+
+func (p Property) String() string {
+	if isIdentifier(p.Name) && !isKeyword(p.Name) {
+		return p.Name
+	}
+	return `"` + strings.Replace(p.Name, `"`, `""`, -1) + `"`
+}
+
+func (l Literal) String() string {
+	switch v := l.Value.(type) {
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'"
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return fmt.Sprintf("%v", l.Value)
+}
+
+func (t Timestamp) String() string {
+	if t.Date {
+		return fmt.Sprintf("DATE('%v')", t.Time.Format("2006-01-02"))
+	}
+	return fmt.Sprintf("TIMESTAMP('%v')", t.Time.Format(time.RFC3339Nano))
+}
+
+func (i Interval) String() string {
+	end := func(e Expr) string {
+		switch te := e.(type) {
+		case nil:
+			return "'..'"
+		case Timestamp:
+			// Instants in intervals are plain strings
+			if te.Date {
+				return fmt.Sprintf("'%v'", te.Time.Format("2006-01-02"))
+			}
+			return fmt.Sprintf("'%v'", te.Time.Format(time.RFC3339Nano))
+		}
+		return e.String()
+	}
+	return fmt.Sprintf("INTERVAL(%v, %v)", end(i.Start), end(i.End))
+}
+
+func (g Geometry) String() string {
+	return wktString(g.Geometry)
+}
+
+func (e Envelope) String() string {
+	return fmt.Sprintf("BBOX(%v)", joinFloats(e.Extent[:], ", "))
+}
+
+func (l Logical) String() string {
+	args := make([]string, len(l.Args))
+	for i, a := range l.Args {
+		args[i] = a.String()
+	}
+	return "(" + strings.Join(args, " "+l.Op+" ") + ")"
+}
+
+func (n Not) String() string {
+	return fmt.Sprintf("NOT (%v)", n.Arg)
+}
+
+func (c Comparison) String() string {
+	return fmt.Sprintf("%v %v %v", c.Left, c.Op, c.Right)
+}
+
+func (l Like) String() string {
+	return fmt.Sprintf("%v %vLIKE %v", l.Arg, notString(l.Not), l.Pattern)
+}
+
+func (in In) String() string {
+	list := make([]string, len(in.List))
+	for i, e := range in.List {
+		list[i] = e.String()
+	}
+	return fmt.Sprintf("%v %vIN (%v)", in.Arg, notString(in.Not), strings.Join(list, ", "))
+}
+
+func (b Between) String() string {
+	return fmt.Sprintf("%v %vBETWEEN %v AND %v", b.Arg, notString(b.Not), b.Low, b.High)
+}
+
+func (n IsNull) String() string {
+	return fmt.Sprintf("%v IS %vNULL", n.Arg, notString(n.Not))
+}
+
+func (s SpatialPredicate) String() string {
+	return fmt.Sprintf("%v(%v, %v)", s.Op, s.Left, s.Right)
+}
+
+func (d DistancePredicate) String() string {
+	return fmt.Sprintf("%v(%v, %v, %v)", SpatialDWithin, d.Left, d.Right, strconv.FormatFloat(d.Distance, 'g', -1, 64))
+}
+
+func (t TemporalPredicate) String() string {
+	return fmt.Sprintf("%v(%v, %v)", t.Op, t.Left, t.Right)
+}
+
+func notString(not bool) string {
+	if not {
+		return "NOT "
+	}
+	return ""
+}
+
+func joinFloats(fs []float64, sep string) string {
+	s := make([]string, len(fs))
+	for i, f := range fs {
+		s[i] = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strings.Join(s, sep)
+}
+
+// Names of the properties e refers to other than as geometries of spatial predicates, once each
+// in the order they first appear.
+func Properties(e Expr) []string {
+	var names []string
+	seen := make(map[string]bool)
+	var walk func(e Expr)
+	walk = func(e Expr) {
+		var args []Expr
+		switch te := e.(type) {
+		case Property:
+			if !seen[te.Name] {
+				seen[te.Name] = true
+				names = append(names, te.Name)
+			}
+		case Interval:
+			args = []Expr{te.Start, te.End}
+		case Logical:
+			args = te.Args
+		case Not:
+			args = []Expr{te.Arg}
+		case Comparison:
+			args = []Expr{te.Left, te.Right}
+		case Like:
+			args = []Expr{te.Arg, te.Pattern}
+		case In:
+			args = append([]Expr{te.Arg}, te.List...)
+		case Between:
+			args = []Expr{te.Arg, te.Low, te.High}
+		case IsNull:
+			args = []Expr{te.Arg}
+		case TemporalPredicate:
+			args = []Expr{te.Left, te.Right}
+		}
+		for _, a := range args {
+			if a != nil {
+				walk(a)
+			}
+		}
+	}
+	walk(e)
+	return names
+}
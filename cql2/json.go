@@ -0,0 +1,436 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project json.go
+
+package cql2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-spatial/geom"
+)
+
+// Returned for a filter that isn't valid CQL2 JSON
+type JSONError struct {
+	// Location of the problem in the filter, i.e. '$.args[1]'
+	Path string
+	Msg  string
+}
+
+func (e *JSONError) Error() string {
+	return fmt.Sprintf("invalid filter at %v: %v", e.Path, e.Msg)
+}
+
+// Comparison operators by their JSON names, the same as in text
+var jsonComparisonOps = map[string]bool{
+	OpEqual: true, OpNotEqual: true, OpLess: true, OpLessEqual: true, OpGreater: true, OpGreaterEqual: true,
+}
+
+// Parses a filter in the CQL2 JSON encoding, returning a *JSONError if it's invalid
+func ParseJSON(b []byte) (Expr, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	if err := d.Decode(&v); err != nil {
+		return nil, &JSONError{Path: "$", Msg: err.Error()}
+	}
+	if d.More() {
+		return nil, &JSONError{Path: "$", Msg: "unexpected data after the filter"}
+	}
+	return jsonPredicate(v, "$")
+}
+
+// A predicate: an operation object or a boolean
+func jsonPredicate(v interface{}, path string) (Expr, error) {
+	if b, ok := v.(bool); ok {
+		return Literal{Value: b}, nil
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, &JSONError{Path: path, Msg: "expected an object w/ 'op' & 'args', or a boolean"}
+	}
+	op, ok := obj["op"].(string)
+	if !ok {
+		return nil, &JSONError{Path: path, Msg: "expected an 'op' string"}
+	}
+	args, ok := obj["args"].([]interface{})
+	if !ok {
+		return nil, &JSONError{Path: path + ".args", Msg: "expected an array"}
+	}
+	argPath := func(i int) string {
+		return fmt.Sprintf("%v.args[%v]", path, i)
+	}
+	nargs := func(n int) error {
+		if len(args) != n {
+			return &JSONError{Path: path + ".args", Msg: fmt.Sprintf("'%v' takes %v arguments, found %v", op, n, len(args))}
+		}
+		return nil
+	}
+	scalars := func() ([]Expr, error) {
+		es := make([]Expr, len(args))
+		for i, a := range args {
+			var err error
+			if es[i], err = jsonScalar(a, argPath(i)); err != nil {
+				return nil, err
+			}
+		}
+		return es, nil
+	}
+
+	lop := strings.ToLower(op)
+	switch {
+	case lop == "and" || lop == "or":
+		if len(args) < 2 {
+			return nil, &JSONError{Path: path + ".args", Msg: fmt.Sprintf("'%v' takes 2 or more arguments, found %v", op, len(args))}
+		}
+		l := Logical{Op: strings.ToUpper(op), Args: make([]Expr, len(args))}
+		for i, a := range args {
+			var err error
+			if l.Args[i], err = jsonPredicate(a, argPath(i)); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+	case lop == "not":
+		if err := nargs(1); err != nil {
+			return nil, err
+		}
+		arg, err := jsonPredicate(args[0], argPath(0))
+		return Not{Arg: arg}, err
+	case jsonComparisonOps[op]:
+		if err := nargs(2); err != nil {
+			return nil, err
+		}
+		es, err := scalars()
+		if err != nil {
+			return nil, err
+		}
+		return Comparison{Op: op, Left: es[0], Right: es[1]}, nil
+	case lop == "like":
+		if err := nargs(2); err != nil {
+			return nil, err
+		}
+		es, err := scalars()
+		if err != nil {
+			return nil, err
+		}
+		return Like{Arg: es[0], Pattern: es[1]}, nil
+	case lop == "between":
+		if err := nargs(3); err != nil {
+			return nil, err
+		}
+		es, err := scalars()
+		if err != nil {
+			return nil, err
+		}
+		return Between{Arg: es[0], Low: es[1], High: es[2]}, nil
+	case lop == "in":
+		if err := nargs(2); err != nil {
+			return nil, err
+		}
+		arg, err := jsonScalar(args[0], argPath(0))
+		if err != nil {
+			return nil, err
+		}
+		list, ok := args[1].([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, &JSONError{Path: argPath(1), Msg: "expected an array of values"}
+		}
+		in := In{Arg: arg, List: make([]Expr, len(list))}
+		for i, lv := range list {
+			if in.List[i], err = jsonScalar(lv, fmt.Sprintf("%v[%v]", argPath(1), i)); err != nil {
+				return nil, err
+			}
+		}
+		return in, nil
+	case lop == "isnull":
+		if err := nargs(1); err != nil {
+			return nil, err
+		}
+		arg, err := jsonScalar(args[0], argPath(0))
+		return IsNull{Arg: arg}, err
+	}
+
+	if strings.ToUpper(op) == SpatialDWithin {
+		if err := nargs(3); err != nil {
+			return nil, err
+		}
+		l, r, err := jsonPredicateArgs(args[:2], path, isSpatialOperand, "a geometry")
+		if err != nil {
+			return nil, err
+		}
+		d, ok := args[2].(float64)
+		if !ok || d < 0 {
+			return nil, &JSONError{Path: argPath(2), Msg: "expected a distance of 0 or more"}
+		}
+		return DistancePredicate{Left: l, Right: r, Distance: d}, nil
+	}
+	for _, sop := range spatialOps {
+		if strings.ToUpper(op) == sop {
+			l, r, err := jsonPredicateArgs(args, path, isSpatialOperand, "a geometry")
+			return SpatialPredicate{Op: sop, Left: l, Right: r}, err
+		}
+	}
+	for _, top := range temporalOps {
+		if strings.ToUpper(op) == top {
+			l, r, err := jsonPredicateArgs(args, path, isTemporalOperand, "a time instant or interval")
+			return TemporalPredicate{Op: top, Left: l, Right: r}, err
+		}
+	}
+	return nil, &JSONError{Path: path + ".op", Msg: fmt.Sprintf("unsupported operator '%v'", op)}
+}
+
+// The two operands of a spatial or temporal predicate, valid according to ok
+func jsonPredicateArgs(args []interface{}, path string, ok func(Expr) bool, kind string) (l, r Expr, err error) {
+	if len(args) != 2 {
+		return nil, nil, &JSONError{Path: path + ".args", Msg: fmt.Sprintf("expected 2 arguments, found %v", len(args))}
+	}
+	es := make([]Expr, 2)
+	for i, a := range args {
+		argPath := fmt.Sprintf("%v.args[%v]", path, i)
+		if es[i], err = jsonScalar(a, argPath); err != nil {
+			return nil, nil, err
+		}
+		if !ok(es[i]) {
+			return nil, nil, &JSONError{Path: argPath, Msg: fmt.Sprintf("expected a property or %v", kind)}
+		}
+	}
+	return es[0], es[1], nil
+}
+
+// A property, literal, instant, interval, bbox or GeoJSON geometry
+func jsonScalar(v interface{}, path string) (Expr, error) {
+	switch tv := v.(type) {
+	case string, float64, bool:
+		return Literal{Value: tv}, nil
+	case map[string]interface{}:
+		switch {
+		case tv["property"] != nil:
+			name, ok := tv["property"].(string)
+			if !ok {
+				return nil, &JSONError{Path: path + ".property", Msg: "expected a string"}
+			}
+			return Property{Name: name}, nil
+		case tv["date"] != nil:
+			return jsonInstant(tv["date"], path+".date", true)
+		case tv["timestamp"] != nil:
+			return jsonInstant(tv["timestamp"], path+".timestamp", false)
+		case tv["interval"] != nil:
+			return jsonInterval(tv["interval"], path+".interval")
+		case tv["bbox"] != nil:
+			return jsonEnvelope(tv["bbox"], path+".bbox")
+		case tv["type"] != nil:
+			g, err := geojsonGeometry(tv, path)
+			return Geometry{Geometry: g}, err
+		case tv["op"] != nil:
+			return nil, &JSONError{Path: path, Msg: "functions aren't supported"}
+		}
+	}
+	return nil, &JSONError{Path: path, Msg: "expected a property or value"}
+}
+
+// A date if date is true otherwise a timestamp, from a string
+func jsonInstant(v interface{}, path string, date bool) (Timestamp, error) {
+	layout, kind := time.RFC3339, "timestamp"
+	if date {
+		layout, kind = "2006-01-02", "date"
+	}
+	s, _ := v.(string)
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return Timestamp{}, &JSONError{Path: path, Msg: fmt.Sprintf("invalid %v '%v'", kind, v)}
+	}
+	return Timestamp{Time: t, Date: date}, nil
+}
+
+// [start, end], each end a date or timestamp string, '..' or a property
+func jsonInterval(v interface{}, path string) (Expr, error) {
+	ends, ok := v.([]interface{})
+	if !ok || len(ends) != 2 {
+		return nil, &JSONError{Path: path, Msg: "expected an array of 2 instants"}
+	}
+	var i Interval
+	for n, e := range ends {
+		endPath := fmt.Sprintf("%v[%v]", path, n)
+		var ie Expr
+		switch te := e.(type) {
+		case string:
+			if te == ".." {
+				break
+			}
+			ts, err := jsonInstant(te, endPath, len(te) == len("2006-01-02"))
+			if err != nil {
+				return nil, err
+			}
+			ie = ts
+		case map[string]interface{}:
+			name, ok := te["property"].(string)
+			if !ok {
+				return nil, &JSONError{Path: endPath, Msg: "expected a date or time, '..' or a property"}
+			}
+			ie = Property{Name: name}
+		default:
+			return nil, &JSONError{Path: endPath, Msg: "expected a date or time, '..' or a property"}
+		}
+		if n == 0 {
+			i.Start = ie
+		} else {
+			i.End = ie
+		}
+	}
+	return i, nil
+}
+
+// [minx, miny, maxx, maxy] w/ any minz & maxz dropped
+func jsonEnvelope(v interface{}, path string) (Expr, error) {
+	fs, err := jsonNumbers(v, path)
+	if err != nil {
+		return nil, err
+	}
+	switch len(fs) {
+	case 4:
+		return Envelope{Extent: [4]float64{fs[0], fs[1], fs[2], fs[3]}}, nil
+	case 6:
+		return Envelope{Extent: [4]float64{fs[0], fs[1], fs[3], fs[4]}}, nil
+	}
+	return nil, &JSONError{Path: path, Msg: fmt.Sprintf("expected 4 or 6 coordinates, found %v", len(fs))}
+}
+
+func jsonNumbers(v interface{}, path string) ([]float64, error) {
+	vs, ok := v.([]interface{})
+	if !ok {
+		return nil, &JSONError{Path: path, Msg: "expected an array of numbers"}
+	}
+	fs := make([]float64, len(vs))
+	for i, n := range vs {
+		if fs[i], ok = n.(float64); !ok {
+			return nil, &JSONError{Path: fmt.Sprintf("%v[%v]", path, i), Msg: "expected a number"}
+		}
+	}
+	return fs, nil
+}
+
+// A GeoJSON geometry object.  Z coordinates are dropped.
+func geojsonGeometry(obj map[string]interface{}, path string) (geom.Geometry, error) {
+	t, _ := obj["type"].(string)
+	if t == "GeometryCollection" {
+		gs, ok := obj["geometries"].([]interface{})
+		if !ok {
+			return nil, &JSONError{Path: path + ".geometries", Msg: "expected an array of geometries"}
+		}
+		gc := make(geom.Collection, len(gs))
+		for i, g := range gs {
+			gPath := fmt.Sprintf("%v.geometries[%v]", path, i)
+			gobj, ok := g.(map[string]interface{})
+			if !ok {
+				return nil, &JSONError{Path: gPath, Msg: "expected a geometry"}
+			}
+			var err error
+			if gc[i], err = geojsonGeometry(gobj, gPath); err != nil {
+				return nil, err
+			}
+		}
+		return gc, nil
+	}
+
+	cPath := path + ".coordinates"
+	cs := obj["coordinates"]
+	switch t {
+	case "Point":
+		return geojsonPosition(cs, cPath)
+	case "MultiPoint":
+		ps, err := geojsonPositions(cs, cPath)
+		return geom.MultiPoint(ps), err
+	case "LineString":
+		ps, err := geojsonPositions(cs, cPath)
+		return geom.LineString(ps), err
+	case "MultiLineString":
+		lss, err := geojsonRings(cs, cPath)
+		return geom.MultiLineString(lss), err
+	case "Polygon":
+		rs, err := geojsonRings(cs, cPath)
+		return geom.Polygon(rs), err
+	case "MultiPolygon":
+		vs, ok := cs.([]interface{})
+		if !ok {
+			return nil, &JSONError{Path: cPath, Msg: "expected an array of polygons"}
+		}
+		mp := make(geom.MultiPolygon, len(vs))
+		for i, v := range vs {
+			var err error
+			if mp[i], err = geojsonRings(v, fmt.Sprintf("%v[%v]", cPath, i)); err != nil {
+				return nil, err
+			}
+		}
+		return mp, nil
+	}
+	return nil, &JSONError{Path: path + ".type", Msg: fmt.Sprintf("unsupported geometry type '%v'", obj["type"])}
+}
+
+func geojsonPosition(v interface{}, path string) (geom.Point, error) {
+	fs, err := jsonNumbers(v, path)
+	if err != nil {
+		return geom.Point{}, err
+	}
+	if len(fs) < 2 || len(fs) > 3 {
+		return geom.Point{}, &JSONError{Path: path, Msg: fmt.Sprintf("expected 2 or 3 coordinates, found %v", len(fs))}
+	}
+	return geom.Point{fs[0], fs[1]}, nil
+}
+
+func geojsonPositions(v interface{}, path string) ([][2]float64, error) {
+	vs, ok := v.([]interface{})
+	if !ok {
+		return nil, &JSONError{Path: path, Msg: "expected an array of positions"}
+	}
+	ps := make([][2]float64, len(vs))
+	for i, pv := range vs {
+		p, err := geojsonPosition(pv, fmt.Sprintf("%v[%v]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		ps[i] = p
+	}
+	return ps, nil
+}
+
+func geojsonRings(v interface{}, path string) ([][][2]float64, error) {
+	vs, ok := v.([]interface{})
+	if !ok {
+		return nil, &JSONError{Path: path, Msg: "expected an array of arrays of positions"}
+	}
+	rs := make([][][2]float64, len(vs))
+	for i, rv := range vs {
+		var err error
+		if rs[i], err = geojsonPositions(rv, fmt.Sprintf("%v[%v]", path, i)); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
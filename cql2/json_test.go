@@ -0,0 +1,141 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project json_test.go
+
+package cql2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJSON(t *testing.T) {
+	type tcase struct {
+		filter string
+		// The same filter in the text encoding
+		expected string
+	}
+	tcases := []tcase{
+		{filter: `{"op": ">=", "args": [{"property": "lanes"}, 2]}`, expected: "lanes >= 2"},
+		{
+			filter: `{"op": "and", "args": [
+				{"op": "=", "args": [{"property": "highway"}, "primary"]},
+				{"op": "or", "args": [
+					{"op": "<", "args": [{"property": "lanes"}, -1.5]},
+					{"op": "not", "args": [{"op": "like", "args": [{"property": "name"}, "Main%"]}]}
+				]}
+			]}`,
+			expected: "highway = 'primary' AND (lanes < -1.5 OR NOT name LIKE 'Main%')",
+		},
+		{
+			filter:   `{"op": "in", "args": [{"property": "highway"}, ["primary", "secondary"]]}`,
+			expected: "highway IN ('primary', 'secondary')",
+		},
+		{filter: `{"op": "between", "args": [{"property": "width"}, 2, 3.5]}`, expected: "width BETWEEN 2 AND 3.5"},
+		{filter: `{"op": "isNull", "args": [{"property": "name"}]}`, expected: "name IS NULL"},
+		{filter: `{"op": "=", "args": [{"property": "paved"}, true]}`, expected: "paved = TRUE"},
+		{filter: `true`, expected: "TRUE"},
+		{
+			filter:   `{"op": "t_after", "args": [{"property": "built"}, {"date": "2018-02-12"}]}`,
+			expected: "T_AFTER(built, DATE('2018-02-12'))",
+		},
+		{
+			filter:   `{"op": "t_during", "args": [{"property": "built"}, {"interval": ["2018-02-12T23:20:50Z", ".."]}]}`,
+			expected: "T_DURING(built, INTERVAL('2018-02-12T23:20:50Z', '..'))",
+		},
+		{
+			filter:   `{"op": "s_intersects", "args": [{"property": "geometry"}, {"bbox": [1, 2, 3, 4]}]}`,
+			expected: "S_INTERSECTS(geometry, BBOX(1, 2, 3, 4))",
+		},
+		{
+			filter: `{"op": "s_within", "args": [{"property": "geometry"},
+				{"type": "Polygon", "coordinates": [[[0, 0, 1], [1, 0, 1], [1, 1, 1], [0, 0, 1]]]}]}`,
+			expected: "S_WITHIN(geometry, POLYGON((0 0, 1 0, 1 1, 0 0)))",
+		},
+		{
+			filter: `{"op": "s_intersects", "args": [{"property": "geometry"},
+				{"type": "GeometryCollection", "geometries": [
+					{"type": "Point", "coordinates": [1, 2]},
+					{"type": "MultiLineString", "coordinates": [[[0, 0], [1, 1]], [[2, 2], [3, 3]]]}
+				]}]}`,
+			expected: "S_INTERSECTS(geometry, GEOMETRYCOLLECTION(POINT(1 2), MULTILINESTRING((0 0, 1 1), (2 2, 3 3))))",
+		},
+		{
+			filter:   `{"op": "s_dwithin", "args": [{"property": "geometry"}, {"type": "Point", "coordinates": [1, 2]}, 100]}`,
+			expected: "S_DWITHIN(geometry, POINT(1 2), 100)",
+		},
+	}
+	for i, tc := range tcases {
+		e, err := ParseJSON([]byte(tc.filter))
+		if err != nil {
+			t.Errorf("[%v] ParseJSON(): %v", i, err)
+			continue
+		}
+		expected, err := ParseText(tc.expected)
+		if err != nil {
+			t.Fatalf("[%v] ParseText(): %v", i, err)
+		}
+		if !reflect.DeepEqual(e, expected) {
+			t.Errorf("[%v] got %#v, wanted %#v", i, e, expected)
+		}
+	}
+}
+
+func TestParseJSONErrors(t *testing.T) {
+	type tcase struct {
+		filter       string
+		expectedPath string
+	}
+	tcases := []tcase{
+		{filter: `{"op": "=", "args": [{"property": "a"}, 1]`, expectedPath: "$"},
+		{filter: `{"op": "=", "args": [{"property": "a"}, 1]} {}`, expectedPath: "$"},
+		{filter: `"a = 1"`, expectedPath: "$"},
+		{filter: `{"args": []}`, expectedPath: "$"},
+		{filter: `{"op": "=", "args": [{"property": "a"}]}`, expectedPath: "$.args"},
+		{filter: `{"op": "and", "args": [true, {"op": "=", "args": [{"property": "a"}, null]}]}`, expectedPath: "$.args[1].args[1]"},
+		{filter: `{"op": "in", "args": [{"property": "a"}, 1]}`, expectedPath: "$.args[1]"},
+		{filter: `{"op": "t_after", "args": [{"property": "a"}, {"date": "2018-02-30"}]}`, expectedPath: "$.args[1].date"},
+		{filter: `{"op": "t_after", "args": [{"property": "a"}, 1]}`, expectedPath: "$.args[1]"},
+		{filter: `{"op": "s_intersects", "args": [{"property": "geometry"}, {"bbox": [1, 2, 3]}]}`, expectedPath: "$.args[1].bbox"},
+		{filter: `{"op": "s_intersects", "args": [{"property": "geometry"}, {"type": "Point", "coordinates": [1]}]}`, expectedPath: "$.args[1].coordinates"},
+		{filter: `{"op": "s_intersects", "args": [{"property": "geometry"}, {"type": "Circle"}]}`, expectedPath: "$.args[1].type"},
+		{filter: `{"op": "=", "args": [{"op": "upper", "args": [{"property": "a"}]}, "A"]}`, expectedPath: "$.args[0]"},
+		{filter: `{"op": "~=", "args": [{"property": "a"}, 1]}`, expectedPath: "$.op"},
+		{filter: `{"op": "s_dwithin", "args": [{"property": "geometry"}, {"bbox": [1, 2, 3, 4]}, "far"]}`, expectedPath: "$.args[2]"},
+		{filter: `{"op": "s_dwithin", "args": [{"property": "geometry"}, 1, 100]}`, expectedPath: "$.args[1]"},
+	}
+	for i, tc := range tcases {
+		_, err := ParseJSON([]byte(tc.filter))
+		je, ok := err.(*JSONError)
+		if !ok {
+			t.Errorf("[%v] got %v, wanted a *JSONError", i, err)
+			continue
+		}
+		if je.Path != tc.expectedPath {
+			t.Errorf("[%v] got path %v (%v), wanted %v", i, je.Path, je.Msg, tc.expectedPath)
+		}
+	}
+}
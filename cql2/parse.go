@@ -0,0 +1,615 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project parse.go
+
+package cql2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Returned for a filter that isn't valid CQL2
+type SyntaxError struct {
+	// 1-based character position of the problem in the filter
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid filter at position %v: %v", e.Pos, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	// Identifiers & keywords
+	tokIdent
+	// "Quoted" identifiers
+	tokQuoted
+	tokString
+	tokNumber
+	// Parentheses, commas & comparison operators
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	// Unquoted & unescaped for tokQuoted & tokString
+	text string
+	// 1-based character position
+	pos int
+}
+
+var keywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "LIKE": true, "BETWEEN": true, "IN": true, "IS": true, "NULL": true,
+	"TRUE": true, "FALSE": true, "TIMESTAMP": true, "DATE": true, "INTERVAL": true, "BBOX": true,
+	"POINT": true, "LINESTRING": true, "POLYGON": true, "MULTIPOINT": true, "MULTILINESTRING": true,
+	"MULTIPOLYGON": true, "GEOMETRYCOLLECTION": true,
+}
+
+func init() {
+	for _, op := range spatialOps {
+		keywords[op] = true
+	}
+	for _, op := range temporalOps {
+		keywords[op] = true
+	}
+}
+
+func isKeyword(s string) bool {
+	return keywords[strings.ToUpper(s)]
+}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || r == '.' || r == ':'
+}
+
+// Whether s can be written as an unquoted property name
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if (i == 0 && !isIdentStart(r)) || !isIdentPart(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func lex(s string) ([]token, error) {
+	rs := []rune(s)
+	toks := make([]token, 0, len(rs)/4+1)
+	isDigit := func(i int) bool {
+		return i < len(rs) && unicode.IsDigit(rs[i])
+	}
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case isIdentStart(r):
+			for i < len(rs) && isIdentPart(rs[i]) {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: string(rs[start:i]), pos: start + 1})
+		case r == '"' || r == '\'':
+			// Quotes are escaped by doubling them
+			var text []rune
+			for i++; ; i++ {
+				if i >= len(rs) {
+					return nil, &SyntaxError{Pos: start + 1, Msg: "unterminated quote"}
+				}
+				if rs[i] == r {
+					if i+1 < len(rs) && rs[i+1] == r {
+						i++
+					} else {
+						break
+					}
+				}
+				text = append(text, rs[i])
+			}
+			i++
+			kind := tokString
+			if r == '"' {
+				kind = tokQuoted
+			}
+			toks = append(toks, token{kind: kind, text: string(text), pos: start + 1})
+		case unicode.IsDigit(r) || ((r == '-' || r == '.') && (isDigit(i+1) || (r == '-' && i+1 < len(rs) && rs[i+1] == '.' && isDigit(i+2)))):
+			i++
+			for isDigit(i) || (i < len(rs) && rs[i] == '.') {
+				i++
+			}
+			if i < len(rs) && (rs[i] == 'e' || rs[i] == 'E') {
+				i++
+				if i < len(rs) && (rs[i] == '+' || rs[i] == '-') {
+					i++
+				}
+				for isDigit(i) {
+					i++
+				}
+			}
+			toks = append(toks, token{kind: tokNumber, text: string(rs[start:i]), pos: start + 1})
+		case r == '(' || r == ')' || r == ',' || r == '=':
+			i++
+			toks = append(toks, token{kind: tokPunct, text: string(r), pos: start + 1})
+		case r == '<' || r == '>':
+			i++
+			if i < len(rs) && (rs[i] == '=' || (r == '<' && rs[i] == '>')) {
+				i++
+			}
+			toks = append(toks, token{kind: tokPunct, text: string(rs[start:i]), pos: start + 1})
+		default:
+			return nil, &SyntaxError{Pos: start + 1, Msg: fmt.Sprintf("unexpected character '%c'", r)}
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(rs) + 1}), nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// Consumes the next token if it's keyword kw
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokIdent && strings.EqualFold(t.text, kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// Consumes the next token if it's punctuation s
+func (p *parser) punct(s string) bool {
+	if t := p.peek(); t.kind == tokPunct && t.text == s {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.punct(s) {
+		return p.unexpected(fmt.Sprintf("'%v'", s))
+	}
+	return nil
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.keyword(kw) {
+		return p.unexpected(kw)
+	}
+	return nil
+}
+
+// A SyntaxError for the next token when expecting wanted
+func (p *parser) unexpected(wanted string) error {
+	t := p.peek()
+	found := fmt.Sprintf("'%v'", t.text)
+	switch t.kind {
+	case tokEOF:
+		found = "the end of the filter"
+	case tokString:
+		found = fmt.Sprintf("string '%v'", t.text)
+	case tokQuoted:
+		found = fmt.Sprintf(`"%v"`, t.text)
+	}
+	return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected %v, found %v", wanted, found)}
+}
+
+// Parses a filter in the CQL2 text encoding.  Returns a *SyntaxError if it isn't valid.
+// @see https://docs.ogc.org/DRAFTS/21-065.html#cql2-text
+func ParseText(s string) (Expr, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	e, err := p.orExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.unexpected("AND, OR or the end of the filter")
+	}
+	return e, nil
+}
+
+func (p *parser) orExpr() (Expr, error) {
+	return p.logical(OpOr, p.andExpr)
+}
+
+func (p *parser) andExpr() (Expr, error) {
+	return p.logical(OpAnd, p.notExpr)
+}
+
+// One or more operands from operand joined by op
+func (p *parser) logical(op string, operand func() (Expr, error)) (Expr, error) {
+	e, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	args := []Expr{e}
+	for p.keyword(op) {
+		if e, err = operand(); err != nil {
+			return nil, err
+		}
+		args = append(args, e)
+	}
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	return Logical{Op: op, Args: args}, nil
+}
+
+func (p *parser) notExpr() (Expr, error) {
+	if p.keyword("NOT") {
+		e, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Arg: e}, nil
+	}
+	if p.punct("(") {
+		e, err := p.orExpr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+	return p.predicate()
+}
+
+func (p *parser) predicate() (Expr, error) {
+	if t := p.peek(); t.kind == tokIdent {
+		name := strings.ToUpper(t.text)
+		if name == SpatialDWithin {
+			p.next()
+			return p.distancePredicate()
+		}
+		for _, op := range spatialOps {
+			if name == op {
+				p.next()
+				l, r, err := p.predicateArgs(isSpatialOperand, "a geometry")
+				return SpatialPredicate{Op: op, Left: l, Right: r}, err
+			}
+		}
+		for _, op := range temporalOps {
+			if name == op {
+				p.next()
+				l, r, err := p.predicateArgs(isTemporalOperand, "a time instant or interval")
+				return TemporalPredicate{Op: op, Left: l, Right: r}, err
+			}
+		}
+		if next := p.toks[p.i+1]; next.kind == tokPunct && next.text == "(" && !keywords[name] {
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unsupported function '%v'", t.text)}
+		}
+	}
+
+	start := p.peek()
+	left, err := p.scalar()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokPunct {
+		switch t.text {
+		case OpEqual, OpNotEqual, OpLess, OpLessEqual, OpGreater, OpGreaterEqual:
+			p.next()
+			right, err := p.scalar()
+			return Comparison{Op: t.text, Left: left, Right: right}, err
+		}
+	}
+
+	if p.keyword("IS") {
+		not := p.keyword("NOT")
+		return IsNull{Arg: left, Not: not}, p.expectKeyword("NULL")
+	}
+
+	not := p.keyword("NOT")
+	switch {
+	case p.keyword("LIKE"):
+		pattern, err := p.scalar()
+		return Like{Arg: left, Pattern: pattern, Not: not}, err
+	case p.keyword("BETWEEN"):
+		low, err := p.scalar()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.scalar()
+		return Between{Arg: left, Low: low, High: high, Not: not}, err
+	case p.keyword("IN"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		in := In{Arg: left, Not: not}
+		for {
+			e, err := p.scalar()
+			if err != nil {
+				return nil, err
+			}
+			in.List = append(in.List, e)
+			if !p.punct(",") {
+				break
+			}
+		}
+		return in, p.expect(")")
+	case not:
+		return nil, p.unexpected("LIKE, BETWEEN or IN")
+	}
+
+	// TRUE & FALSE are predicates themselves
+	if l, ok := left.(Literal); ok {
+		if _, ok := l.Value.(bool); ok {
+			return left, nil
+		}
+	}
+	if start.kind == tokEOF {
+		return nil, &SyntaxError{Pos: start.pos, Msg: "expected a predicate, found the end of the filter"}
+	}
+	return nil, p.unexpected("a comparison operator, LIKE, BETWEEN, IN or IS")
+}
+
+func isSpatialOperand(e Expr) bool {
+	switch e.(type) {
+	case Property, Geometry, Envelope:
+		return true
+	}
+	return false
+}
+
+func isTemporalOperand(e Expr) bool {
+	switch e.(type) {
+	case Property, Timestamp, Interval:
+		return true
+	}
+	return false
+}
+
+// The two operands of a spatial or temporal predicate, valid according to ok
+func (p *parser) predicateArgs(ok func(Expr) bool, kind string) (l, r Expr, err error) {
+	if err := p.expect("("); err != nil {
+		return nil, nil, err
+	}
+	args := make([]Expr, 2)
+	for i := range args {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, nil, err
+			}
+		}
+		t := p.peek()
+		if args[i], err = p.scalar(); err != nil {
+			return nil, nil, err
+		}
+		if !ok(args[i]) {
+			return nil, nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected a property or %v", kind)}
+		}
+	}
+	return args[0], args[1], p.expect(")")
+}
+
+// (a, b, distance) after S_DWITHIN
+func (p *parser) distancePredicate() (Expr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var d DistancePredicate
+	for i, op := range []*Expr{&d.Left, &d.Right} {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		t := p.peek()
+		var err error
+		if *op, err = p.scalar(); err != nil {
+			return nil, err
+		}
+		if !isSpatialOperand(*op) {
+			return nil, &SyntaxError{Pos: t.pos, Msg: "expected a property or a geometry"}
+		}
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	var err error
+	if d.Distance, err = p.number(); err != nil {
+		return nil, err
+	}
+	if d.Distance < 0 {
+		return nil, &SyntaxError{Pos: t.pos, Msg: "expected a distance of 0 or more"}
+	}
+	return d, p.expect(")")
+}
+
+// A property or literal
+func (p *parser) scalar() (Expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokString:
+		p.next()
+		return Literal{Value: t.text}, nil
+	case tokNumber:
+		p.next()
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("invalid number '%v'", t.text)}
+		}
+		return Literal{Value: f}, nil
+	case tokQuoted:
+		p.next()
+		return Property{Name: t.text}, nil
+	case tokIdent:
+		name := strings.ToUpper(t.text)
+		switch name {
+		case "TRUE", "FALSE":
+			p.next()
+			return Literal{Value: name == "TRUE"}, nil
+		case "TIMESTAMP", "DATE":
+			p.next()
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			s := p.peek()
+			if s.kind != tokString {
+				return nil, p.unexpected("a quoted date or time")
+			}
+			p.next()
+			ts, err := parseInstant(s, name == "DATE")
+			if err != nil {
+				return nil, err
+			}
+			return ts, p.expect(")")
+		case "INTERVAL":
+			p.next()
+			return p.interval()
+		case "BBOX":
+			p.next()
+			return p.envelope()
+		}
+		if _, ok := wktTypes[name]; ok {
+			g, err := p.geometry()
+			return Geometry{Geometry: g}, err
+		}
+		if keywords[name] {
+			return nil, p.unexpected("a property or value")
+		}
+		p.next()
+		return Property{Name: t.text}, nil
+	}
+	return nil, p.unexpected("a property or value")
+}
+
+// The time in s, a date if date is true otherwise a timestamp
+func parseInstant(s token, date bool) (Timestamp, error) {
+	layout, kind := time.RFC3339, "timestamp"
+	if date {
+		layout, kind = "2006-01-02", "date"
+	}
+	t, err := time.Parse(layout, s.text)
+	if err != nil {
+		return Timestamp{}, &SyntaxError{Pos: s.pos, Msg: fmt.Sprintf("invalid %v '%v'", kind, s.text)}
+	}
+	return Timestamp{Time: t, Date: date}, nil
+}
+
+// INTERVAL(start, end) after the keyword, each end a quoted date, timestamp or '..' or a property
+func (p *parser) interval() (Expr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var ends [2]Expr
+	for i := range ends {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		t := p.peek()
+		switch {
+		case t.kind == tokString && t.text == "..":
+			p.next()
+		case t.kind == tokString:
+			p.next()
+			ts, err := parseInstant(t, len(t.text) == len("2006-01-02"))
+			if err != nil {
+				return nil, err
+			}
+			ends[i] = ts
+		case t.kind == tokQuoted || (t.kind == tokIdent && !isKeyword(t.text)):
+			p.next()
+			ends[i] = Property{Name: t.text}
+		default:
+			return nil, p.unexpected("a quoted date or time, '..' or a property")
+		}
+	}
+	return Interval{Start: ends[0], End: ends[1]}, p.expect(")")
+}
+
+// BBOX(minx, miny, maxx, maxy) after the keyword, w/ any minz & maxz dropped
+func (p *parser) envelope() (Expr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	start := p.peek()
+	var fs []float64
+	for {
+		f, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+		if !p.punct(",") {
+			break
+		}
+	}
+	switch len(fs) {
+	case 4:
+		return Envelope{Extent: [4]float64{fs[0], fs[1], fs[2], fs[3]}}, p.expect(")")
+	case 6:
+		return Envelope{Extent: [4]float64{fs[0], fs[1], fs[3], fs[4]}}, p.expect(")")
+	}
+	return nil, &SyntaxError{Pos: start.pos, Msg: fmt.Sprintf("expected 4 or 6 BBOX coordinates, found %v", len(fs))}
+}
+
+func (p *parser) number() (float64, error) {
+	t := p.peek()
+	if t.kind != tokNumber {
+		return 0, p.unexpected("a number")
+	}
+	p.next()
+	f, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return 0, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("invalid number '%v'", t.text)}
+	}
+	return f, nil
+}
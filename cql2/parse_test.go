@@ -0,0 +1,188 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project parse_test.go
+
+package cql2
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-spatial/geom"
+)
+
+func TestParseText(t *testing.T) {
+	type tcase struct {
+		filter   string
+		expected Expr
+	}
+	ts := time.Date(2018, 2, 12, 23, 20, 50, 0, time.UTC)
+	tcases := []tcase{
+		{
+			filter:   "lanes >= 2",
+			expected: Comparison{Op: OpGreaterEqual, Left: Property{Name: "lanes"}, Right: Literal{Value: 2.0}},
+		},
+		{
+			filter: "highway = 'primary' AND (lanes < -1.5 OR \"name\" <> 'Main''s')",
+			expected: Logical{Op: OpAnd, Args: []Expr{
+				Comparison{Op: OpEqual, Left: Property{Name: "highway"}, Right: Literal{Value: "primary"}},
+				Logical{Op: OpOr, Args: []Expr{
+					Comparison{Op: OpLess, Left: Property{Name: "lanes"}, Right: Literal{Value: -1.5}},
+					Comparison{Op: OpNotEqual, Left: Property{Name: "name"}, Right: Literal{Value: "Main's"}},
+				}},
+			}},
+		},
+		{
+			filter: "a = 1 OR b = 2 AND NOT c = 3",
+			expected: Logical{Op: OpOr, Args: []Expr{
+				Comparison{Op: OpEqual, Left: Property{Name: "a"}, Right: Literal{Value: 1.0}},
+				Logical{Op: OpAnd, Args: []Expr{
+					Comparison{Op: OpEqual, Left: Property{Name: "b"}, Right: Literal{Value: 2.0}},
+					Not{Arg: Comparison{Op: OpEqual, Left: Property{Name: "c"}, Right: Literal{Value: 3.0}}},
+				}},
+			}},
+		},
+		{
+			filter:   "name not like 'Main%'",
+			expected: Like{Arg: Property{Name: "name"}, Pattern: Literal{Value: "Main%"}, Not: true},
+		},
+		{
+			filter:   "highway IN ('primary', 'secondary')",
+			expected: In{Arg: Property{Name: "highway"}, List: []Expr{Literal{Value: "primary"}, Literal{Value: "secondary"}}},
+		},
+		{
+			filter:   "width BETWEEN 2 AND 3.5",
+			expected: Between{Arg: Property{Name: "width"}, Low: Literal{Value: 2.0}, High: Literal{Value: 3.5}},
+		},
+		{
+			filter:   "name IS NOT NULL",
+			expected: IsNull{Arg: Property{Name: "name"}, Not: true},
+		},
+		{
+			filter:   "active = TRUE",
+			expected: Comparison{Op: OpEqual, Left: Property{Name: "active"}, Right: Literal{Value: true}},
+		},
+		{
+			filter:   "t_after(built, TIMESTAMP('2018-02-12T23:20:50Z'))",
+			expected: TemporalPredicate{Op: TemporalAfter, Left: Property{Name: "built"}, Right: Timestamp{Time: ts}},
+		},
+		{
+			filter: "T_DURING(INTERVAL(start, end), INTERVAL('2018-02-12', '..'))",
+			expected: TemporalPredicate{Op: TemporalDuring,
+				Left:  Interval{Start: Property{Name: "start"}, End: Property{Name: "end"}},
+				Right: Interval{Start: Timestamp{Time: time.Date(2018, 2, 12, 0, 0, 0, 0, time.UTC), Date: true}}},
+		},
+		{
+			filter:   "S_INTERSECTS(geometry, BBOX(23.7, 37.9, 23.8, 38))",
+			expected: SpatialPredicate{Op: SpatialIntersects, Left: Property{Name: "geometry"}, Right: Envelope{Extent: geom.Extent{23.7, 37.9, 23.8, 38}}},
+		},
+		{
+			filter: "S_WITHIN(geometry, POLYGON((0 0, 1 0, 1 1, 0 0)))",
+			expected: SpatialPredicate{Op: SpatialWithin, Left: Property{Name: "geometry"},
+				Right: Geometry{Geometry: geom.Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}}},
+		},
+		{
+			filter: "S_INTERSECTS(geom, MULTIPOINT((1 2), (3 4 5)))",
+			expected: SpatialPredicate{Op: SpatialIntersects, Left: Property{Name: "geom"},
+				Right: Geometry{Geometry: geom.MultiPoint{{1, 2}, {3, 4}}}},
+		},
+		{
+			filter: "S_DWITHIN(geometry, POINT(23.7 37.9), 500)",
+			expected: DistancePredicate{Left: Property{Name: "geometry"},
+				Right: Geometry{Geometry: geom.Point{23.7, 37.9}}, Distance: 500},
+		},
+		{
+			filter:   "TRUE",
+			expected: Literal{Value: true},
+		},
+	}
+	for i, tc := range tcases {
+		e, err := ParseText(tc.filter)
+		if err != nil {
+			t.Errorf("[%v] ParseText(%v): %v", i, tc.filter, err)
+			continue
+		}
+		if !reflect.DeepEqual(e, tc.expected) {
+			t.Errorf("[%v] got %#v, wanted %#v", i, e, tc.expected)
+			continue
+		}
+		// The text encoding of the result parses to the same expression
+		e2, err := ParseText(e.String())
+		if err != nil {
+			t.Errorf("[%v] ParseText(%v): %v", i, e.String(), err)
+		} else if !reflect.DeepEqual(e2, e) {
+			t.Errorf("[%v] %v parses to %#v, wanted %#v", i, e.String(), e2, e)
+		}
+	}
+}
+
+func TestParseTextErrors(t *testing.T) {
+	type tcase struct {
+		filter      string
+		expectedPos int
+	}
+	tcases := []tcase{
+		{filter: "", expectedPos: 1},
+		{filter: "lanes >", expectedPos: 8},
+		{filter: "lanes > 2 AND", expectedPos: 14},
+		{filter: "lanes ! 2", expectedPos: 7},
+		{filter: "name = 'Main", expectedPos: 8},
+		{filter: "name", expectedPos: 5},
+		{filter: "(lanes > 2", expectedPos: 11},
+		{filter: "lanes > 2 lanes", expectedPos: 11},
+		{filter: "name NOT NULL", expectedPos: 10},
+		{filter: "built = TIMESTAMP('yesterday')", expectedPos: 19},
+		{filter: "S_INTERSECTS(geometry, 5)", expectedPos: 24},
+		{filter: "S_INTERSECTS(geometry, BBOX(1, 2, 3))", expectedPos: 29},
+		{filter: "CASEI(name) = 'main'", expectedPos: 1},
+		{filter: "S_DWITHIN(geometry, POINT(1 2))", expectedPos: 31},
+		{filter: "S_DWITHIN(geometry, POINT(1 2), -5)", expectedPos: 33},
+		{filter: "S_DWITHIN(geometry, 'a', 5)", expectedPos: 21},
+	}
+	for i, tc := range tcases {
+		_, err := ParseText(tc.filter)
+		se, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("[%v] ParseText(%v) returned %v, wanted a *SyntaxError", i, tc.filter, err)
+			continue
+		}
+		if se.Pos != tc.expectedPos {
+			t.Errorf("[%v] ParseText(%v) error at %v, wanted %v: %v", i, tc.filter, se.Pos, tc.expectedPos, se)
+		}
+	}
+}
+
+func TestProperties(t *testing.T) {
+	e, err := ParseText("a = 1 AND (b LIKE 'x%' OR NOT a IN (c, 2)) AND S_INTERSECTS(geometry, BBOX(0, 0, 1, 1)) AND T_AFTER(d, DATE('2018-01-01'))")
+	if err != nil {
+		t.Fatalf("ParseText(): %v", err)
+	}
+	expected := []string{"a", "b", "c", "d"}
+	if props := Properties(e); !reflect.DeepEqual(props, expected) {
+		t.Errorf("got %v, wanted %v", props, expected)
+	}
+}
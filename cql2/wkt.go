@@ -0,0 +1,235 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project wkt.go
+
+package cql2
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-spatial/geom"
+)
+
+// WKT geometry types & the parsers of their text after the type name
+var wktTypes map[string]func(p *parser) (geom.Geometry, error)
+
+func init() {
+	wktTypes = map[string]func(p *parser) (geom.Geometry, error){
+		"POINT": func(p *parser) (geom.Geometry, error) {
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			c, err := p.coordinate()
+			if err != nil {
+				return nil, err
+			}
+			return geom.Point(c), p.expect(")")
+		},
+		"LINESTRING": func(p *parser) (geom.Geometry, error) {
+			cs, err := p.coordinates()
+			return geom.LineString(cs), err
+		},
+		"POLYGON": func(p *parser) (geom.Geometry, error) {
+			rs, err := p.rings()
+			return geom.Polygon(rs), err
+		},
+		"MULTIPOINT": func(p *parser) (geom.Geometry, error) {
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			var mp geom.MultiPoint
+			for {
+				// Points may be in parentheses or not
+				parens := p.punct("(")
+				c, err := p.coordinate()
+				if err != nil {
+					return nil, err
+				}
+				if parens {
+					if err := p.expect(")"); err != nil {
+						return nil, err
+					}
+				}
+				mp = append(mp, c)
+				if !p.punct(",") {
+					break
+				}
+			}
+			return mp, p.expect(")")
+		},
+		"MULTILINESTRING": func(p *parser) (geom.Geometry, error) {
+			lss, err := p.rings()
+			return geom.MultiLineString(lss), err
+		},
+		"MULTIPOLYGON": func(p *parser) (geom.Geometry, error) {
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			var mp geom.MultiPolygon
+			for {
+				rs, err := p.rings()
+				if err != nil {
+					return nil, err
+				}
+				mp = append(mp, rs)
+				if !p.punct(",") {
+					break
+				}
+			}
+			return mp, p.expect(")")
+		},
+		"GEOMETRYCOLLECTION": func(p *parser) (geom.Geometry, error) {
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			var gc geom.Collection
+			for {
+				g, err := p.geometry()
+				if err != nil {
+					return nil, err
+				}
+				gc = append(gc, g)
+				if !p.punct(",") {
+					break
+				}
+			}
+			return gc, p.expect(")")
+		},
+	}
+}
+
+// A WKT geometry starting w/ its type name.  Z coordinates are dropped.
+func (p *parser) geometry() (geom.Geometry, error) {
+	t := p.peek()
+	parse, ok := wktTypes[strings.ToUpper(t.text)]
+	if t.kind != tokIdent || !ok {
+		return nil, p.unexpected("a geometry type")
+	}
+	p.next()
+	if n := p.peek(); n.kind == tokIdent && strings.EqualFold(n.text, "Z") {
+		p.next()
+	}
+	return parse(p)
+}
+
+// An x y pair, followed by an optional z
+func (p *parser) coordinate() ([2]float64, error) {
+	var c [2]float64
+	var err error
+	if c[0], err = p.number(); err != nil {
+		return c, err
+	}
+	if c[1], err = p.number(); err != nil {
+		return c, err
+	}
+	if p.peek().kind == tokNumber {
+		p.next()
+	}
+	return c, nil
+}
+
+// (x y, x y, ...)
+func (p *parser) coordinates() ([][2]float64, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var cs [][2]float64
+	for {
+		c, err := p.coordinate()
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+		if !p.punct(",") {
+			break
+		}
+	}
+	return cs, p.expect(")")
+}
+
+// ((x y, ...), (x y, ...), ...)
+func (p *parser) rings() ([][][2]float64, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var rs [][][2]float64
+	for {
+		cs, err := p.coordinates()
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, cs)
+		if !p.punct(",") {
+			break
+		}
+	}
+	return rs, p.expect(")")
+}
+
+// g in WKT
+func wktString(g geom.Geometry) string {
+	coords := func(cs [][2]float64) string {
+		s := make([]string, len(cs))
+		for i, c := range cs {
+			s[i] = joinFloats(c[:], " ")
+		}
+		return "(" + strings.Join(s, ", ") + ")"
+	}
+	rings := func(rs [][][2]float64) string {
+		s := make([]string, len(rs))
+		for i, r := range rs {
+			s[i] = coords(r)
+		}
+		return "(" + strings.Join(s, ", ") + ")"
+	}
+
+	switch tg := g.(type) {
+	case geom.Point:
+		return "POINT" + coords([][2]float64{tg})
+	case geom.MultiPoint:
+		return "MULTIPOINT" + coords(tg)
+	case geom.LineString:
+		return "LINESTRING" + coords(tg)
+	case geom.MultiLineString:
+		return "MULTILINESTRING" + rings(tg)
+	case geom.Polygon:
+		return "POLYGON" + rings(tg)
+	case geom.MultiPolygon:
+		s := make([]string, len(tg))
+		for i, p := range tg {
+			s[i] = rings(p)
+		}
+		return "MULTIPOLYGON(" + strings.Join(s, ", ") + ")"
+	case geom.Collection:
+		s := make([]string, len(tg))
+		for i, cg := range tg {
+			s[i] = wktString(cg)
+		}
+		return "GEOMETRYCOLLECTION(" + strings.Join(s, ", ") + ")"
+	}
+	return fmt.Sprintf("%v", g)
+}
@@ -0,0 +1,660 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project cql_filter.go
+
+package data_provider
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/jivan/cql2"
+)
+
+// Three-valued logic as in SQL, predicates on missing values are unknown
+type tribool int
+
+const (
+	triUnknown tribool = iota
+	triFalse
+	triTrue
+)
+
+func triBool(b bool) tribool {
+	if b {
+		return triTrue
+	}
+	return triFalse
+}
+
+// A CQL2 filter ready for matching features in memory
+type cqlFilter struct {
+	expr cql2.Expr
+	// Compiled LIKE patterns keyed by the CQL2 pattern
+	patterns map[string]*regexp.Regexp
+}
+
+// Checks e can be applied & compiles its LIKE patterns.  Returns a *BadFilter if e uses something
+// that isn't supported.
+func newCQLFilter(e cql2.Expr) (*cqlFilter, error) {
+	cf := &cqlFilter{expr: e, patterns: make(map[string]*regexp.Regexp)}
+	var check func(e cql2.Expr) error
+	check = func(e cql2.Expr) error {
+		switch te := e.(type) {
+		case cql2.Logical:
+			for _, a := range te.Args {
+				if err := check(a); err != nil {
+					return err
+				}
+			}
+		case cql2.Not:
+			return check(te.Arg)
+		case cql2.Like:
+			l, ok := te.Pattern.(cql2.Literal)
+			if !ok {
+				return &BadFilter{msg: fmt.Sprintf("LIKE needs a literal pattern: %v", te)}
+			}
+			pattern := propertyString(l.Value)
+			cf.patterns[pattern] = cqlLikePattern(pattern)
+		case cql2.SpatialPredicate, cql2.DistancePredicate:
+			if _, err := spatialOperands(te); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := check(e); err != nil {
+		return nil, err
+	}
+	return cf, nil
+}
+
+// Whether f passes the filter, predicates that are unknown because of missing values don't
+func (cf *cqlFilter) matches(f *Feature) bool {
+	return cf.eval(cf.expr, f) == triTrue
+}
+
+func (cf *cqlFilter) eval(e cql2.Expr, f *Feature) tribool {
+	switch te := e.(type) {
+	case cql2.Logical:
+		result := triBool(te.Op == cql2.OpAnd)
+		for _, a := range te.Args {
+			v := cf.eval(a, f)
+			switch {
+			case te.Op == cql2.OpAnd && v == triFalse, te.Op == cql2.OpOr && v == triTrue:
+				return v
+			case v == triUnknown:
+				result = triUnknown
+			}
+		}
+		return result
+	case cql2.Not:
+		switch cf.eval(te.Arg, f) {
+		case triTrue:
+			return triFalse
+		case triFalse:
+			return triTrue
+		}
+		return triUnknown
+	case cql2.Literal:
+		if b, ok := te.Value.(bool); ok {
+			return triBool(b)
+		}
+		return triUnknown
+	case cql2.Comparison:
+		l, r := cqlValue(te.Left, f), cqlValue(te.Right, f)
+		if l == nil || r == nil {
+			return triUnknown
+		}
+		c := compareValues(l, r)
+		switch te.Op {
+		case cql2.OpEqual:
+			return triBool(c == 0)
+		case cql2.OpNotEqual:
+			return triBool(c != 0)
+		case cql2.OpLess:
+			return triBool(c < 0)
+		case cql2.OpLessEqual:
+			return triBool(c <= 0)
+		case cql2.OpGreater:
+			return triBool(c > 0)
+		case cql2.OpGreaterEqual:
+			return triBool(c >= 0)
+		}
+	case cql2.Like:
+		v := cqlValue(te.Arg, f)
+		if v == nil {
+			return triUnknown
+		}
+		pattern := cf.patterns[propertyString(te.Pattern.(cql2.Literal).Value)]
+		return triBool(pattern.MatchString(propertyString(v)) != te.Not)
+	case cql2.In:
+		v := cqlValue(te.Arg, f)
+		if v == nil {
+			return triUnknown
+		}
+		result := triFalse
+		for _, le := range te.List {
+			lv := cqlValue(le, f)
+			switch {
+			case lv == nil:
+				result = triUnknown
+			case compareValues(v, lv) == 0:
+				return triBool(!te.Not)
+			}
+		}
+		if result == triFalse && te.Not {
+			return triTrue
+		}
+		return result
+	case cql2.Between:
+		v, low, high := cqlValue(te.Arg, f), cqlValue(te.Low, f), cqlValue(te.High, f)
+		if v == nil || low == nil || high == nil {
+			return triUnknown
+		}
+		return triBool((compareValues(v, low) >= 0 && compareValues(v, high) <= 0) != te.Not)
+	case cql2.IsNull:
+		return triBool((cqlValue(te.Arg, f) == nil) != te.Not)
+	case cql2.SpatialPredicate, cql2.DistancePredicate:
+		sf, _ := spatialOperands(te)
+		return sf.eval(f)
+	case cql2.TemporalPredicate:
+		l, lok := cqlInterval(te.Left, f)
+		r, rok := cqlInterval(te.Right, f)
+		if !lok || !rok {
+			return triUnknown
+		}
+		return triBool(temporalRelation(te.Op, l, r))
+	}
+	return triUnknown
+}
+
+// The value of scalar e for f, nil for a missing property
+func cqlValue(e cql2.Expr, f *Feature) interface{} {
+	switch te := e.(type) {
+	case cql2.Property:
+		return f.Properties[te.Name]
+	case cql2.Literal:
+		return te.Value
+	case cql2.Timestamp:
+		return te.Time
+	}
+	return nil
+}
+
+// The interval of temporal operand e for f, an instant is an interval w/ the same start & end.
+// Zero times are open ends.  False if a property doesn't have a time value.
+func cqlInterval(e cql2.Expr, f *Feature) (TimeInterval, bool) {
+	instant := func(e cql2.Expr) (time.Time, bool) {
+		switch te := e.(type) {
+		case cql2.Timestamp:
+			return te.Time, true
+		case cql2.Property:
+			return timeValue(f.Properties[te.Name])
+		}
+		return time.Time{}, false
+	}
+	switch te := e.(type) {
+	case cql2.Interval:
+		var ti TimeInterval
+		var ok bool
+		if te.Start != nil {
+			if ti.Start, ok = instant(te.Start); !ok {
+				return ti, false
+			}
+		}
+		if te.End != nil {
+			if ti.End, ok = instant(te.End); !ok {
+				return ti, false
+			}
+		}
+		return ti, true
+	default:
+		t, ok := instant(e)
+		return TimeInterval{Start: t, End: t}, ok
+	}
+}
+
+// Compares interval bounds a & b, where a zero start is before & a zero end after all times
+func compareBounds(a time.Time, aEnd bool, b time.Time, bEnd bool) int {
+	infinity := func(t time.Time, end bool) int {
+		switch {
+		case !t.IsZero():
+			return 0
+		case end:
+			return 1
+		}
+		return -1
+	}
+	ai, bi := infinity(a, aEnd), infinity(b, bEnd)
+	switch {
+	case ai != 0 || bi != 0:
+		return ai - bi
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// Whether temporal predicate op holds for intervals a & b
+func temporalRelation(op string, a, b TimeInterval) bool {
+	switch op {
+	case cql2.TemporalBefore:
+		return compareBounds(a.End, true, b.Start, false) < 0
+	case cql2.TemporalAfter:
+		return compareBounds(a.Start, false, b.End, true) > 0
+	case cql2.TemporalIntersects:
+		return compareBounds(a.Start, false, b.End, true) <= 0 && compareBounds(a.End, true, b.Start, false) >= 0
+	case cql2.TemporalDisjoint:
+		return !temporalRelation(cql2.TemporalIntersects, a, b)
+	case cql2.TemporalEquals:
+		return compareBounds(a.Start, false, b.Start, false) == 0 && compareBounds(a.End, true, b.End, true) == 0
+	case cql2.TemporalDuring:
+		return compareBounds(a.Start, false, b.Start, false) > 0 && compareBounds(a.End, true, b.End, true) < 0
+	case cql2.TemporalContains:
+		return temporalRelation(cql2.TemporalDuring, b, a)
+	}
+	return false
+}
+
+// A spatial or distance predicate as a test of a feature's geometry against a lon/lat geometry
+type spatialFilter struct {
+	// One of the predicates in spatialOpsSwapped
+	op       string
+	geometry geom.Geometry
+	// Meters, for cql2.SpatialDWithin
+	distance float64
+}
+
+// The supported spatial predicates, each w/ the predicate that applies w/ its operands swapped
+var spatialOpsSwapped = map[string]string{
+	cql2.SpatialIntersects: cql2.SpatialIntersects,
+	cql2.SpatialDisjoint:   cql2.SpatialDisjoint,
+	cql2.SpatialEquals:     cql2.SpatialEquals,
+	cql2.SpatialWithin:     cql2.SpatialContains,
+	cql2.SpatialContains:   cql2.SpatialWithin,
+	cql2.SpatialDWithin:    cql2.SpatialDWithin,
+}
+
+// e, a SpatialPredicate or DistancePredicate, w/ the feature's geometry (a property, whatever its
+// name) as its first operand.  Returns a *BadFilter if e's predicate isn't supported or it doesn't
+// compare the feature's geometry w/ a geometry or BBOX.
+func spatialOperands(e cql2.Expr) (spatialFilter, error) {
+	var sf spatialFilter
+	var l, r cql2.Expr
+	switch te := e.(type) {
+	case cql2.SpatialPredicate:
+		sf.op, l, r = te.Op, te.Left, te.Right
+	case cql2.DistancePredicate:
+		sf.op, l, r, sf.distance = cql2.SpatialDWithin, te.Left, te.Right, te.Distance
+	}
+	swapped, ok := spatialOpsSwapped[sf.op]
+	if !ok {
+		return sf, &BadFilter{msg: fmt.Sprintf("spatial predicate isn't supported: %v", e)}
+	}
+	if _, ok := l.(cql2.Property); !ok {
+		l, r = r, l
+		sf.op = swapped
+	}
+	switch tr := r.(type) {
+	case cql2.Geometry:
+		sf.geometry = tr.Geometry
+	case cql2.Envelope:
+		sf.geometry = extentPolygon(tr.Extent)
+	}
+	if _, ok := l.(cql2.Property); !ok || sf.geometry == nil {
+		return sf, &BadFilter{msg: fmt.Sprintf("spatial predicates compare the geometry w/ a geometry or BBOX: %v", e)}
+	}
+	return sf, nil
+}
+
+// Whether f's geometry passes sf, unknown w/o one
+func (sf spatialFilter) eval(f *Feature) tribool {
+	g, err := DefaultCRS.transform(f.Geometry, f.SRID)
+	if err != nil {
+		return triUnknown
+	}
+	gp := splitGeometry(g)
+	if len(gp.vertices()) == 0 {
+		return triUnknown
+	}
+	if sf.op == cql2.SpatialDWithin {
+		return triBool(geometryDistance(gp, splitGeometry(sf.geometry)) <= sf.distance)
+	}
+	// Geometries w/ separate extents are disjoint
+	if !extentsIntersect(geometryExtent(g), geometryExtent(sf.geometry)) {
+		return triBool(sf.op == cql2.SpatialDisjoint)
+	}
+	return triBool(spatialRelation(sf.op, gp, splitGeometry(sf.geometry)))
+}
+
+// Converts a CQL2 LIKE pattern, where '%' matches any number of characters & '_' a single one, to
+// an anchored regular expression
+func cqlLikePattern(pattern string) *regexp.Regexp {
+	var re bytes.Buffer
+	re.WriteString("^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			re.WriteString("(?s:.*)")
+		case r == '_':
+			re.WriteString("(?s:.)")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		re.WriteString(regexp.QuoteMeta(`\`))
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String())
+}
+
+// SQL condition for CQL2 filter e on t's rows.  Returns ErrQueryNotSupported for parts that
+// can't be done in SQL, like LIKE on a property that isn't a column, & a *BadFilter for values
+// that don't suit their property.
+func (sq *sqlQuerier) cqlCondition(t *sqlTable, e cql2.Expr, args *sqlArgs) (string, error) {
+	switch te := e.(type) {
+	case cql2.Logical:
+		cs := make([]string, len(te.Args))
+		for i, a := range te.Args {
+			c, err := sq.cqlCondition(t, a, args)
+			if err != nil {
+				return "", err
+			}
+			cs[i] = "(" + c + ")"
+		}
+		return strings.Join(cs, " "+te.Op+" "), nil
+	case cql2.Not:
+		c, err := sq.cqlCondition(t, te.Arg, args)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + c + ")", nil
+	case cql2.Literal:
+		if b, ok := te.Value.(bool); ok {
+			if b {
+				return "1 = 1", nil
+			}
+			return "1 = 0", nil
+		}
+	case cql2.Comparison:
+		l, err := sq.cqlOperand(t, te.Left, te.Right, args)
+		if err != nil {
+			return "", err
+		}
+		r, err := sq.cqlOperand(t, te.Right, te.Left, args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v %v %v", l, te.Op, r), nil
+	case cql2.Like:
+		p, ok := te.Arg.(cql2.Property)
+		pattern, pok := te.Pattern.(cql2.Literal)
+		if !ok || !pok || !t.hasColumn(p.Name) {
+			return "", ErrQueryNotSupported
+		}
+		return sq.dialect.likeCondition(quoteIdent(p.Name), propertyString(pattern.Value), te.Not, args), nil
+	case cql2.In:
+		v, err := sq.cqlOperand(t, te.Arg, nil, args)
+		if err != nil {
+			return "", err
+		}
+		list := make([]string, len(te.List))
+		for i, le := range te.List {
+			if list[i], err = sq.cqlOperand(t, le, te.Arg, args); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%v %vIN (%v)", v, sqlNot(te.Not), strings.Join(list, ", ")), nil
+	case cql2.Between:
+		v, err := sq.cqlOperand(t, te.Arg, nil, args)
+		if err != nil {
+			return "", err
+		}
+		low, err := sq.cqlOperand(t, te.Low, te.Arg, args)
+		if err != nil {
+			return "", err
+		}
+		high, err := sq.cqlOperand(t, te.High, te.Arg, args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v %vBETWEEN %v AND %v", v, sqlNot(te.Not), low, high), nil
+	case cql2.IsNull:
+		// Whether there's a value, not whether it's a time
+		if p, ok := te.Arg.(cql2.Property); ok && t.hasColumn(p.Name) {
+			return fmt.Sprintf("%v IS %vNULL", quoteIdent(p.Name), sqlNot(te.Not)), nil
+		}
+		v, err := sq.cqlOperand(t, te.Arg, nil, args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v IS %vNULL", v, sqlNot(te.Not)), nil
+	case cql2.SpatialPredicate, cql2.DistancePredicate:
+		sf, err := spatialOperands(te)
+		if err != nil {
+			return "", err
+		}
+		return sq.dialect.spatialCondition(t, sf.op, sf.geometry, sf.distance, args)
+	case cql2.TemporalPredicate:
+		return sq.temporalCondition(t, te, args)
+	}
+	return "", ErrQueryNotSupported
+}
+
+// SQL for scalar e, w/ a literal converted to the type of the column other is, if it's one.
+// Dates & times are compared as the dialect's timeValue() & timeArg() have them.  A property
+// that isn't a column is NULL.
+func (sq *sqlQuerier) cqlOperand(t *sqlTable, e, other cql2.Expr, args *sqlArgs) (string, error) {
+	switch te := e.(type) {
+	case cql2.Property:
+		if !t.hasColumn(te.Name) {
+			return "NULL", nil
+		}
+		if t.kinds[te.Name] == kindDate {
+			return sq.dialect.timeValue(t, te.Name)
+		}
+		return quoteIdent(te.Name), nil
+	case cql2.Literal:
+		if p, ok := other.(cql2.Property); ok && t.hasColumn(p.Name) {
+			v, err := filterValue(p.Name, t.kinds[p.Name], propertyString(te.Value))
+			if err != nil {
+				return "", err
+			}
+			if t.kinds[p.Name] == kindDate {
+				// filterValue() checked it parses
+				tm, _ := parse_time_string(v.(string))
+				return sq.dialect.timeArg(tm, args), nil
+			}
+			return args.add(v), nil
+		}
+		return args.add(te.Value), nil
+	case cql2.Timestamp:
+		return sq.dialect.timeArg(te.Time, args), nil
+	}
+	return "", ErrQueryNotSupported
+}
+
+// A bound of a temporal operand in SQL, a timeValue() expression or a literal time.  A zero
+// literal is an open bound, before all times at the start & after them at the end.
+type sqlTimeBound struct {
+	column string
+	tm     time.Time
+}
+
+func (b sqlTimeBound) open() bool {
+	return b.column == "" && b.tm.IsZero()
+}
+
+// The start & end of temporal operand e in SQL, an instant is an interval w/ the same start & end
+func (sq *sqlQuerier) temporalOperand(t *sqlTable, e cql2.Expr) (start, end sqlTimeBound, err error) {
+	bound := func(e cql2.Expr) (sqlTimeBound, error) {
+		switch te := e.(type) {
+		case nil:
+			return sqlTimeBound{}, nil
+		case cql2.Timestamp:
+			return sqlTimeBound{tm: te.Time}, nil
+		case cql2.Property:
+			if !t.hasColumn(te.Name) {
+				return sqlTimeBound{column: "NULL"}, nil
+			}
+			c, err := sq.dialect.timeValue(t, te.Name)
+			return sqlTimeBound{column: c}, err
+		}
+		return sqlTimeBound{}, ErrQueryNotSupported
+	}
+
+	if te, ok := e.(cql2.Interval); ok {
+		if start, err = bound(te.Start); err != nil {
+			return start, end, err
+		}
+		end, err = bound(te.End)
+		return start, end, err
+	}
+	if e == nil {
+		return start, end, ErrQueryNotSupported
+	}
+	start, err = bound(e)
+	return start, start, err
+}
+
+// SQL condition for temporal predicate p, as temporalRelation() has it.  The condition is unknown
+// for rows where a property in p doesn't hold a time, as cqlInterval() has it.
+func (sq *sqlQuerier) temporalCondition(t *sqlTable, p cql2.TemporalPredicate, args *sqlArgs) (string, error) {
+	aStart, aEnd, err := sq.temporalOperand(t, p.Left)
+	if err != nil {
+		return "", err
+	}
+	bStart, bEnd, err := sq.temporalOperand(t, p.Right)
+	if err != nil {
+		return "", err
+	}
+
+	// Compares bounds a & b w/ op, open bounds compare as in compareBounds()
+	compare := func(a sqlTimeBound, aIsEnd bool, op string, b sqlTimeBound, bIsEnd bool) string {
+		infinity := func(b sqlTimeBound, end bool) int {
+			switch {
+			case !b.open():
+				return 0
+			case end:
+				return 1
+			}
+			return -1
+		}
+		ai, bi := infinity(a, aIsEnd), infinity(b, bIsEnd)
+		if ai == 0 && bi == 0 {
+			value := func(b sqlTimeBound) string {
+				if b.column != "" {
+					return b.column
+				}
+				return sq.dialect.timeArg(b.tm, args)
+			}
+			return fmt.Sprintf("%v %v %v", value(a), op, value(b))
+		}
+		c := ai - bi
+		holds := false
+		switch op {
+		case "<":
+			holds = c < 0
+		case "<=":
+			holds = c <= 0
+		case "=":
+			holds = c == 0
+		case ">=":
+			holds = c >= 0
+		case ">":
+			holds = c > 0
+		}
+		if holds {
+			return "1 = 1"
+		}
+		return "1 = 0"
+	}
+
+	var relation func(op string, aStart, aEnd, bStart, bEnd sqlTimeBound) string
+	relation = func(op string, aStart, aEnd, bStart, bEnd sqlTimeBound) string {
+		switch op {
+		case cql2.TemporalBefore:
+			return compare(aEnd, true, "<", bStart, false)
+		case cql2.TemporalAfter:
+			return compare(aStart, false, ">", bEnd, true)
+		case cql2.TemporalIntersects:
+			return fmt.Sprintf("%v AND %v", compare(aStart, false, "<=", bEnd, true), compare(aEnd, true, ">=", bStart, false))
+		case cql2.TemporalDisjoint:
+			return fmt.Sprintf("NOT (%v)", relation(cql2.TemporalIntersects, aStart, aEnd, bStart, bEnd))
+		case cql2.TemporalEquals:
+			return fmt.Sprintf("%v AND %v", compare(aStart, false, "=", bStart, false), compare(aEnd, true, "=", bEnd, true))
+		case cql2.TemporalDuring:
+			return fmt.Sprintf("%v AND %v", compare(aStart, false, ">", bStart, false), compare(aEnd, true, "<", bEnd, true))
+		case cql2.TemporalContains:
+			return relation(cql2.TemporalDuring, bStart, bEnd, aStart, aEnd)
+		}
+		return ""
+	}
+
+	nullChecks := make([]string, 0, 4)
+NEXT_BOUND:
+	for _, b := range []sqlTimeBound{aStart, aEnd, bStart, bEnd} {
+		if b.column == "" {
+			continue
+		}
+		check := b.column + " IS NULL"
+		for _, c := range nullChecks {
+			if c == check {
+				continue NEXT_BOUND
+			}
+		}
+		nullChecks = append(nullChecks, check)
+	}
+	r := relation(p.Op, aStart, aEnd, bStart, bEnd)
+	if r == "" {
+		return "", ErrQueryNotSupported
+	}
+	if len(nullChecks) == 0 {
+		return r, nil
+	}
+	return fmt.Sprintf("CASE WHEN %v THEN NULL ELSE %v END", strings.Join(nullChecks, " OR "), r), nil
+}
+
+func sqlNot(not bool) string {
+	if not {
+		return "NOT "
+	}
+	return ""
+}
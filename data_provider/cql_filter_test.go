@@ -0,0 +1,232 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project cql_filter_test.go
+
+package data_provider
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-spatial/jivan/cql2"
+)
+
+func TestProviderCQLFilter(t *testing.T) {
+	fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), "csv"), FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+	p := Provider{Source: fs}
+
+	type tcase struct {
+		filter   string
+		expected []string
+	}
+	tcases := []tcase{
+		{filter: "visits > 5", expected: []string{"Creek A", "Pond"}},
+		{filter: "visits BETWEEN 3 AND 7", expected: []string{"Creek B", "Pond"}},
+		{filter: "name LIKE 'Creek%'", expected: []string{"Creek A", "Creek B"}},
+		{filter: "name LIKE 'Creek _'", expected: []string{"Creek A", "Creek B"}},
+		{filter: "name LIKE 'creek%'", expected: []string{}},
+		{filter: "depth IS NULL", expected: []string{"Pond"}},
+		// Unknown for Pond, which has no depth
+		{filter: "NOT depth > 1.7", expected: []string{"Creek A"}},
+		{filter: "depth > 1.7 OR visits = 7", expected: []string{"Creek B", "Pond"}},
+		{filter: "name IN ('Pond', 'Creek B')", expected: []string{"Creek B", "Pond"}},
+		{filter: "name NOT IN ('Pond')", expected: []string{"Creek A", "Creek B"}},
+		{filter: "active = FALSE", expected: []string{"Creek B"}},
+		{filter: "T_AFTER(start_time, DATE('2018-05-01'))", expected: []string{"Creek B", "Pond"}},
+		{filter: "T_DURING(start_time, INTERVAL('2018-04-01', '..'))", expected: []string{"Creek B", "Pond"}},
+		{filter: "T_BEFORE(start_time, TIMESTAMP('2018-05-20T08:30:00Z'))", expected: []string{"Creek A", "Creek B"}},
+		{filter: "S_INTERSECTS(geometry, BBOX(-77.1, 38.8, -77, 38.95))", expected: []string{"Creek A", "Pond"}},
+		{filter: "S_WITHIN(geometry, POLYGON((-77.1 38.8, -77 38.8, -77 38.9, -77.1 38.9, -77.1 38.8)))", expected: []string{"Creek A"}},
+		{filter: "S_CONTAINS(POLYGON((-77.1 38.8, -77 38.8, -77 38.9, -77.1 38.9, -77.1 38.8)), geometry)", expected: []string{"Creek A"}},
+		{filter: "S_DISJOINT(geometry, BBOX(-77.1, 38.8, -77, 38.95))", expected: []string{"Creek B"}},
+		// Creek A & the Pond are ~2.8km apart
+		{filter: "S_DWITHIN(geometry, POINT(-77.03 38.89), 3000)", expected: []string{"Creek A", "Pond"}},
+		{filter: "S_DWITHIN(geometry, POINT(-77.03 38.89), 2000)", expected: []string{"Creek A"}},
+	}
+	for i, tc := range tcases {
+		e, err := cql2.ParseText(tc.filter)
+		if err != nil {
+			t.Fatalf("[%v] ParseText(%v): %v", i, tc.filter, err)
+		}
+		mfs, _, err := p.QueryFeatures(context.Background(), Query{Collection: "sites", Filter: e})
+		if err != nil {
+			t.Errorf("[%v] QueryFeatures(%v): %v", i, tc.filter, err)
+			continue
+		}
+		names := make([]string, len(mfs))
+		for j, f := range mfs {
+			names[j], _ = f.Properties["name"].(string)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, tc.expected) {
+			t.Errorf("[%v] %v matched %v, wanted %v", i, tc.filter, names, tc.expected)
+		}
+	}
+
+	for _, filter := range []string{"altitude > 3", "S_TOUCHES(geometry, BBOX(-77.1, 38.8, -77, 38.95))",
+		"S_INTERSECTS(POINT(1 2), BBOX(0, 0, 3, 3))"} {
+		e, err := cql2.ParseText(filter)
+		if err != nil {
+			t.Fatalf("ParseText(%v): %v", filter, err)
+		}
+		if _, _, err := p.QueryFeatures(context.Background(), Query{Collection: "sites", Filter: e}); err == nil {
+			t.Errorf("expected an error for %v", filter)
+		} else if _, ok := err.(*BadFilter); !ok {
+			t.Errorf("got a %T for %v, wanted a *BadFilter", err, filter)
+		}
+	}
+}
+
+func TestCQLCondition(t *testing.T) {
+	sq := &sqlQuerier{dialect: postgisDialect{}}
+	table := &sqlTable{
+		name:       "roads",
+		geomColumn: "geom",
+		srid:       4326,
+		columns:    []string{"name", "lanes", "built"},
+		kinds:      map[string]int{"name": kindString, "lanes": kindInteger, "built": kindDate},
+	}
+
+	jan1 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type tcase struct {
+		// postgisDialect{} if nil
+		dialect      sqlDialect
+		filter       string
+		expected     string
+		expectedArgs []interface{}
+		expectedErr  error
+	}
+	tcases := []tcase{
+		{
+			filter:       "lanes >= 2 AND NOT (name LIKE 'Main%' OR name IS NULL)",
+			expected:     `("lanes" >= $1) AND (NOT ((CAST("name" AS TEXT) LIKE $2 ESCAPE '\') OR ("name" IS NULL)))`,
+			expectedArgs: []interface{}{int64(2), "Main%"},
+		},
+		{
+			filter:       "lanes NOT BETWEEN 1 AND 3 OR name IN ('a', 'b')",
+			expected:     `("lanes" NOT BETWEEN $1 AND $2) OR ("name" IN ($3, $4))`,
+			expectedArgs: []interface{}{int64(1), int64(3), "a", "b"},
+		},
+		// SQLite's LIKE ignores case
+		{
+			dialect:      gpkgDialect{},
+			filter:       `name NOT LIKE 'Main\_%'`,
+			expected:     `CAST("name" AS TEXT) NOT GLOB ?`,
+			expectedArgs: []interface{}{"Main_*"},
+		},
+		{
+			filter:       "S_INTERSECTS(geometry, BBOX(1, 2, 3, 4))",
+			expected:     `ST_Intersects("geom", ST_GeomFromText($1, 4326))`,
+			expectedArgs: []interface{}{"POLYGON((1 2, 3 2, 3 4, 1 4, 1 2))"},
+		},
+		{
+			filter:       "S_WITHIN(POINT(1 2), geometry)",
+			expected:     `ST_Contains("geom", ST_GeomFromText($1, 4326))`,
+			expectedArgs: []interface{}{"POINT(1 2)"},
+		},
+		{
+			filter:       "S_DWITHIN(geometry, POINT(1 2), 100)",
+			expected:     `ST_DWithin("geom"::geography, ST_GeomFromText($1, 4326)::geography, $2)`,
+			expectedArgs: []interface{}{"POINT(1 2)", 100.0},
+		},
+		// Dates & times are compared as times, unknown where a property doesn't hold one
+		{
+			filter:       "T_AFTER(built, DATE('2018-01-01'))",
+			expected:     `CASE WHEN "built" IS NULL THEN NULL ELSE "built" > CAST($1 AS timestamptz) END`,
+			expectedArgs: []interface{}{jan1},
+		},
+		{
+			dialect:      gpkgDialect{},
+			filter:       "T_DURING(built, INTERVAL('2018-01-01', '..'))",
+			expected:     `CASE WHEN julianday("built") IS NULL THEN NULL ELSE julianday("built") > julianday(?) AND 1 = 1 END`,
+			expectedArgs: []interface{}{"2018-01-01T00:00:00Z"},
+		},
+		{
+			dialect:      gpkgDialect{},
+			filter:       "T_INTERSECTS(INTERVAL(built, '..'), TIMESTAMP('2018-01-01T00:00:00Z'))",
+			expected:     `CASE WHEN julianday("built") IS NULL THEN NULL ELSE julianday("built") <= julianday(?) AND 1 = 1 END`,
+			expectedArgs: []interface{}{"2018-01-01T00:00:00Z"},
+		},
+		// An interval open at its start isn't after anything
+		{
+			filter:   "T_AFTER(INTERVAL('..', '2018-01-01'), built)",
+			expected: `CASE WHEN "built" IS NULL THEN NULL ELSE 1 = 0 END`,
+		},
+		{
+			filter:       "built > '2018-01-01' OR built IS NULL",
+			expected:     `("built" > CAST($1 AS timestamptz)) OR ("built" IS NULL)`,
+			expectedArgs: []interface{}{jan1},
+		},
+		{
+			dialect:      gpkgDialect{},
+			filter:       "built BETWEEN '2018-01-01' AND TIMESTAMP('2018-01-01T00:00:00Z')",
+			expected:     `julianday("built") BETWEEN julianday(?) AND julianday(?)`,
+			expectedArgs: []interface{}{"2018-01-01T00:00:00Z", "2018-01-01T00:00:00Z"},
+		},
+		// PostGIS doesn't compare text as times
+		{filter: "T_AFTER(name, DATE('2018-01-01'))", expectedErr: ErrQueryNotSupported},
+	}
+	for i, tc := range tcases {
+		e, err := cql2.ParseText(tc.filter)
+		if err != nil {
+			t.Fatalf("[%v] ParseText(%v): %v", i, tc.filter, err)
+		}
+		sq := &sqlQuerier{dialect: tc.dialect}
+		if tc.dialect == nil {
+			sq.dialect = postgisDialect{}
+		}
+		args := &sqlArgs{dialect: sq.dialect}
+		c, err := sq.cqlCondition(table, e, args)
+		if err != tc.expectedErr {
+			t.Errorf("[%v] got error %v, wanted %v", i, err, tc.expectedErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if c != tc.expected {
+			t.Errorf("[%v] got condition %v, wanted %v", i, c, tc.expected)
+		}
+		if !reflect.DeepEqual(args.values, tc.expectedArgs) {
+			t.Errorf("[%v] got args %v, wanted %v", i, args.values, tc.expectedArgs)
+		}
+	}
+
+	e, _ := cql2.ParseText("lanes > 'many'")
+	if _, err := sq.cqlCondition(table, e, &sqlArgs{dialect: sq.dialect}); err == nil {
+		t.Errorf("expected an error for a value that isn't an integer")
+	} else if _, ok := err.(*BadFilter); !ok {
+		t.Errorf("got a %T, wanted a *BadFilter", err)
+	}
+}
@@ -0,0 +1,250 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project crs.go
+
+package data_provider
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/go-spatial/geom"
+)
+
+// Identifies CRS84, WGS 84 lon/lat.  This is the CRS of GeoJSON coordinates & of the extents
+// used in queries.
+const CRS84 = "http://www.opengis.net/def/crs/OGC/1.3/CRS84"
+
+// Identifiers of the other CRSs features are converted to in-process
+const (
+	// WGS 84 w/ its official lat/lon axis order
+	EPSG4326 = "http://www.opengis.net/def/crs/EPSG/0/4326"
+	// Web mercator
+	EPSG3857 = "http://www.opengis.net/def/crs/EPSG/0/3857"
+)
+
+// Half the width of the web mercator world in meters
+const webMercatorMaxExtent = 20037508.34
+
+// Returned for a CRS that isn't known or can't be converted to
+type BadCRS struct {
+	msg string
+}
+
+func (bc *BadCRS) Error() string {
+	return bc.msg
+}
+
+// A coordinate reference system geometries are converted to or from
+type CRS struct {
+	// Identifier, see CollectionSchema.CRS
+	URI  string
+	SRID uint64
+	// Coordinates are in lat/lon (northing/easting) order rather than lon/lat
+	LatLon bool
+}
+
+// The CRS of GeoJSON, what features are served in unless another CRS is asked for
+var DefaultCRS = CRS{URI: CRS84, SRID: 4326}
+
+// Matches EPSG CRS identifiers as a URI, i.e. 'http://www.opengis.net/def/crs/EPSG/0/3857', or as
+// a (safe) CURIE, i.e. '[EPSG:3857]'
+var epsgCRS = regexp.MustCompile(`^(?:https?://www\.opengis\.net/def/crs/EPSG/0/|\[?EPSG:)(\d+)\]?$`)
+
+// The CRS identified by s, a URI or CURIE
+func ParseCRS(s string) (CRS, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case CRS84, "https://www.opengis.net/def/crs/OGC/1.3/CRS84", "[OGC:CRS84]", "OGC:CRS84":
+		return DefaultCRS, nil
+	}
+	m := epsgCRS.FindStringSubmatch(s)
+	if m == nil {
+		return CRS{}, &BadCRS{msg: fmt.Sprintf("unknown crs: '%v'", s)}
+	}
+	var srid uint64
+	fmt.Sscanf(m[1], "%d", &srid)
+	// EPSG:4326 is lat/lon, other geographic CRSs aren't supported
+	return CRS{URI: fmt.Sprintf("http://www.opengis.net/def/crs/EPSG/0/%d", srid), SRID: srid, LatLon: srid == 4326}, nil
+}
+
+// Identifiers of the CRSs a collection stored in srid can be served in, its storage CRS crs first
+// if it can't be converted.
+func supportedCRSs(srid uint64, crs string) []string {
+	switch srid {
+	case 4326, 3857:
+		return []string{CRS84, EPSG4326, EPSG3857}
+	}
+	if crs == "" {
+		return nil
+	}
+	return []string{crs}
+}
+
+// Converts the coordinates of g from those of srid to c, a copy is returned unless nothing
+// changes.  Geometries of an unknown (0) srid are returned as is.
+func (c CRS) transform(g geom.Geometry, srid uint64) (geom.Geometry, error) {
+	if g == nil || srid == 0 {
+		return g, nil
+	}
+	var project func(x, y float64) (float64, float64)
+	switch {
+	case srid == c.SRID:
+	case srid == 4326 && c.SRID == 3857:
+		project = webMercator
+	case srid == 3857 && c.SRID == 4326:
+		project = inverseWebMercator
+	default:
+		return nil, &BadCRS{msg: fmt.Sprintf("converting srid %v to '%v' isn't supported", srid, c.URI)}
+	}
+	if project == nil && !c.LatLon {
+		return g, nil
+	}
+
+	return mapPoints(g, func(pt [2]float64) [2]float64 {
+		x, y := pt[0], pt[1]
+		if project != nil {
+			x, y = project(x, y)
+		}
+		if c.LatLon {
+			return [2]float64{y, x}
+		}
+		return [2]float64{x, y}
+	})
+}
+
+// Copy of f w/ its geometry converted to c
+func (c CRS) TransformFeature(f *Feature) (*Feature, error) {
+	g, err := c.transform(f.Geometry, f.SRID)
+	if err != nil {
+		return nil, err
+	}
+	cf := *f
+	cf.Geometry = g
+	if f.SRID != 0 {
+		cf.SRID = c.SRID
+	}
+	return &cf, nil
+}
+
+// Converts the extent e in c to lon/lat, for use in a Query
+func (c CRS) LonLatExtent(e *geom.Extent) (*geom.Extent, error) {
+	ce := *e
+	if c.LatLon {
+		ce = geom.Extent{e[1], e[0], e[3], e[2]}
+	}
+	switch c.SRID {
+	case 4326:
+		return &ce, nil
+	case 3857:
+		return lonLatExtent(&ce, 3857)
+	}
+	return nil, &BadCRS{msg: fmt.Sprintf("bbox-crs '%v' isn't supported", c.URI)}
+}
+
+// The CRS identifier for an EPSG srid, "" for an unknown (0) srid
+func sridCRS(srid uint64) string {
+	switch srid {
+	case 0:
+		return ""
+	case 4326:
+		return CRS84
+	default:
+		return fmt.Sprintf("http://www.opengis.net/def/crs/EPSG/0/%d", srid)
+	}
+}
+
+// Matches the top-level EPSG AUTHORITY at the end of a WKT CRS definition
+var wktAuthority = regexp.MustCompile(`AUTHORITY\[\s*"EPSG"\s*,\s*"?(\d+)"?\s*\]\s*\]\s*$`)
+
+// Best guess at the EPSG srid of a WKT CRS definition (i.e. the contents of a shapefile's .prj),
+// 0 if it isn't recognized.  ESRI's WKT usually lacks an AUTHORITY so common CRSs are recognized by name.
+func wktSRID(wkt string) uint64 {
+	wkt = strings.TrimSpace(wkt)
+	if m := wktAuthority.FindStringSubmatch(wkt); m != nil {
+		var srid uint64
+		fmt.Sscanf(m[1], "%d", &srid)
+		return srid
+	}
+
+	switch {
+	case strings.HasPrefix(wkt, "GEOGCS[") && (strings.Contains(wkt, `"GCS_WGS_1984"`) || strings.Contains(wkt, `"WGS 84"`)):
+		return 4326
+	case strings.HasPrefix(wkt, "PROJCS[") &&
+		(strings.Contains(wkt, "Mercator_Auxiliary_Sphere") || strings.Contains(wkt, "Pseudo-Mercator") ||
+			strings.Contains(wkt, `"WGS_1984_Web_Mercator"`)):
+		return 3857
+	}
+	return 0
+}
+
+// Converts the lon/lat extent e to srid for comparison w/ geometries stored in that srid.
+// Only 4326 & 3857 are supported.
+func extentInSRID(e *geom.Extent, srid uint64) (*geom.Extent, error) {
+	switch srid {
+	case 4326:
+		return e, nil
+	case 3857:
+		minx, miny := webMercator(e[0], e[1])
+		maxx, maxy := webMercator(e[2], e[3])
+		return &geom.Extent{minx, miny, maxx, maxy}, nil
+	default:
+		return nil, fmt.Errorf("bbox filtering isn't supported for srid %v", srid)
+	}
+}
+
+// Converts the extent e of geometries stored in srid to lon/lat, the inverse of extentInSRID().
+// Only 4326 & 3857 are supported.
+func lonLatExtent(e *geom.Extent, srid uint64) (*geom.Extent, error) {
+	switch srid {
+	case 4326:
+		return e, nil
+	case 3857:
+		minLon, minLat := inverseWebMercator(e[0], e[1])
+		maxLon, maxLat := inverseWebMercator(e[2], e[3])
+		return &geom.Extent{minLon, minLat, maxLon, maxLat}, nil
+	default:
+		return nil, fmt.Errorf("converting extents to lon/lat isn't supported for srid %v", srid)
+	}
+}
+
+// Projects lon/lat to web mercator (EPSG:3857)
+func webMercator(lon, lat float64) (x, y float64) {
+	const maxLat = 85.0511287798
+	lat = math.Max(-maxLat, math.Min(maxLat, lat))
+	x = lon * webMercatorMaxExtent / 180
+	y = math.Log(math.Tan((90+lat)*math.Pi/360)) / (math.Pi / 180) * webMercatorMaxExtent / 180
+	return x, y
+}
+
+// Unprojects web mercator (EPSG:3857) to lon/lat
+func inverseWebMercator(x, y float64) (lon, lat float64) {
+	lon = x * 180 / webMercatorMaxExtent
+	lat = math.Atan(math.Exp(y*math.Pi/webMercatorMaxExtent))*360/math.Pi - 90
+	return lon, lat
+}
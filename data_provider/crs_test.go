@@ -0,0 +1,104 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project crs_test.go
+
+package data_provider
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/go-spatial/geom"
+)
+
+func TestParseCRS(t *testing.T) {
+	cases := []struct {
+		s        string
+		expected CRS
+		ok       bool
+	}{
+		{s: CRS84, expected: DefaultCRS, ok: true},
+		{s: "[OGC:CRS84]", expected: DefaultCRS, ok: true},
+		{s: EPSG4326, expected: CRS{URI: EPSG4326, SRID: 4326, LatLon: true}, ok: true},
+		{s: "EPSG:3857", expected: CRS{URI: EPSG3857, SRID: 3857}, ok: true},
+		{s: "[EPSG:2263]", expected: CRS{URI: "http://www.opengis.net/def/crs/EPSG/0/2263", SRID: 2263}, ok: true},
+		{s: "http://www.opengis.net/def/crs/EPSG/0/", ok: false},
+		{s: "WGS84", ok: false},
+	}
+	for i, c := range cases {
+		got, err := ParseCRS(c.s)
+		if (err == nil) != c.ok {
+			t.Errorf("[%v] ParseCRS('%v') error: %v", i, c.s, err)
+			continue
+		}
+		if c.ok && got != c.expected {
+			t.Errorf("[%v] ParseCRS('%v') == %+v, wanted %+v", i, c.s, got, c.expected)
+		}
+	}
+}
+
+func TestCRSTransformFeature(t *testing.T) {
+	f := &Feature{ID: "1", SRID: 4326, Geometry: geom.LineString{{-77.03, 38.89}, {-76.61, 39.29}}}
+
+	latLon, err := CRS{URI: EPSG4326, SRID: 4326, LatLon: true}.TransformFeature(f)
+	if err != nil || !reflect.DeepEqual(latLon.Geometry, geom.LineString{{38.89, -77.03}, {39.29, -76.61}}) {
+		t.Errorf("TransformFeature() to EPSG:4326 == %v, %v", latLon.Geometry, err)
+	}
+	if !reflect.DeepEqual(f.Geometry, geom.LineString{{-77.03, 38.89}, {-76.61, 39.29}}) {
+		t.Errorf("TransformFeature() changed the original geometry: %v", f.Geometry)
+	}
+
+	merc, err := CRS{URI: EPSG3857, SRID: 3857}.TransformFeature(f)
+	if err != nil || merc.SRID != 3857 {
+		t.Fatalf("TransformFeature() to EPSG:3857 == %v, %v", merc, err)
+	}
+	back, err := DefaultCRS.TransformFeature(merc)
+	if err != nil {
+		t.Fatalf("TransformFeature() to CRS84: %v", err)
+	}
+	for i, pt := range back.Geometry.(geom.LineString) {
+		orig := f.Geometry.(geom.LineString)[i]
+		if math.Abs(pt[0]-orig[0]) > 1e-9 || math.Abs(pt[1]-orig[1]) > 1e-9 {
+			t.Errorf("round trip gave %v, wanted %v", back.Geometry, f.Geometry)
+			break
+		}
+	}
+
+	if _, err := (CRS{URI: "http://www.opengis.net/def/crs/EPSG/0/2263", SRID: 2263}).TransformFeature(f); err == nil {
+		t.Errorf("expected an error converting to an unsupported srid")
+	}
+}
+
+func TestCRSLonLatExtent(t *testing.T) {
+	e, err := CRS{URI: EPSG4326, SRID: 4326, LatLon: true}.LonLatExtent(&geom.Extent{38.8, -77.1, 39.0, -76.9})
+	if err != nil || !reflect.DeepEqual(e, &geom.Extent{-77.1, 38.8, -76.9, 39.0}) {
+		t.Errorf("LonLatExtent() == %v, %v", e, err)
+	}
+	if _, err := (CRS{URI: "http://www.opengis.net/def/crs/EPSG/0/2263", SRID: 2263}).LonLatExtent(&geom.Extent{0, 0, 1, 1}); err == nil {
+		t.Errorf("expected an error for an unsupported bbox-crs")
+	}
+}
@@ -0,0 +1,275 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project csv.go
+
+package data_provider
+
+// Reading of CSV files for FileSource.
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-spatial/geom"
+)
+
+// How to find the geometry in CSV files, columns that aren't set are auto-detected.
+type CSVOptions struct {
+	// Columns holding point coordinates as decimal degrees
+	LonColumn string
+	LatColumn string
+	// Column holding geometries as WKT, used instead of lon/lat columns if set
+	WKTColumn string
+}
+
+// Header names (lower-cased) recognized when auto-detecting geometry columns, in order of preference
+var (
+	csvWKTColumns = []string{"wkt", "geometry", "geom", "the_geom", "wkt_geom"}
+	csvLonColumns = []string{"lon", "lng", "long", "longitude", "x"}
+	csvLatColumns = []string{"lat", "latitude", "y"}
+)
+
+// Date & time layouts recognized as ISO 8601 dates
+var csvDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+// Reads a CSV file w/ a header row.  Each row becomes a feature numbered from 1, w/ its geometry
+// from lon/lat or WKT columns & the other columns as properties.  A column's values are typed as
+// integers, floats, booleans or ISO dates if all of its non-empty values are of that type, and
+// are strings otherwise.  Dates are kept as strings for the time filters.
+func loadCSVFile(path string, opts FileOptions) (*fileContents, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("missing header row")
+	}
+	header := rows[0]
+	rows = rows[1:]
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	wktCol, lonCol, latCol, err := csvGeometryColumns(header, opts.CSV)
+	if err != nil {
+		return nil, err
+	}
+
+	colTypes := make([]int, len(header))
+	for i := range header {
+		colTypes[i] = csvColumnType(rows, i)
+	}
+
+	contents := &fileContents{srid: 4326, crs: CRS84, features: make([]*Feature, 0, len(rows)), kinds: make(map[string]int)}
+	for i, h := range header {
+		if i != wktCol && i != lonCol && i != latCol {
+			contents.properties = append(contents.properties, h)
+			contents.kinds[h] = colTypes[i]
+		}
+	}
+
+	for ri, row := range rows {
+		f := &Feature{ID: strconv.Itoa(ri + 1), SRID: 4326, Properties: make(map[string]interface{}, len(header))}
+		for i, h := range header {
+			if i >= len(row) || i == wktCol || i == lonCol || i == latCol {
+				continue
+			}
+			if v := csvValue(row[i], colTypes[i]); v != nil {
+				f.Properties[h] = v
+			}
+		}
+
+		g, err := csvGeometry(row, wktCol, lonCol, latCol)
+		if err != nil {
+			log.Printf("'%v' row %v: %v, leaving the feature w/o a geometry", path, ri+1, err)
+		}
+		f.Geometry = g
+
+		contents.features = append(contents.features, f)
+	}
+
+	return contents, nil
+}
+
+// Indices of the geometry columns in header, -1 for those not used
+func csvGeometryColumns(header []string, opts CSVOptions) (wktCol, lonCol, latCol int, err error) {
+	find := func(configured string, candidates []string) int {
+		for i, h := range header {
+			if configured != "" && h == configured {
+				return i
+			}
+		}
+		if configured != "" {
+			return -1
+		}
+		for _, c := range candidates {
+			for i, h := range header {
+				if strings.ToLower(strings.TrimSpace(h)) == c {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+
+	wktCol, lonCol, latCol = -1, -1, -1
+	switch {
+	case opts.WKTColumn != "":
+		if wktCol = find(opts.WKTColumn, nil); wktCol < 0 {
+			return -1, -1, -1, fmt.Errorf("wkt column '%v' not found", opts.WKTColumn)
+		}
+	case opts.LonColumn != "" || opts.LatColumn != "":
+		lonCol, latCol = find(opts.LonColumn, csvLonColumns), find(opts.LatColumn, csvLatColumns)
+		if lonCol < 0 || latCol < 0 {
+			return -1, -1, -1, fmt.Errorf("lon/lat columns '%v'/'%v' not found", opts.LonColumn, opts.LatColumn)
+		}
+	default:
+		if wktCol = find("", csvWKTColumns); wktCol >= 0 {
+			return wktCol, -1, -1, nil
+		}
+		lonCol, latCol = find("", csvLonColumns), find("", csvLatColumns)
+		if lonCol < 0 || latCol < 0 {
+			return -1, -1, -1, fmt.Errorf("no lon/lat or wkt columns found, set them in the [providers.csv] config")
+		}
+	}
+
+	return wktCol, lonCol, latCol, nil
+}
+
+func csvGeometry(row []string, wktCol, lonCol, latCol int) (geom.Geometry, error) {
+	cell := func(i int) string {
+		if i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	if wktCol >= 0 {
+		if cell(wktCol) == "" {
+			return nil, nil
+		}
+		return DecodeWKT(cell(wktCol))
+	}
+
+	if cell(lonCol) == "" && cell(latCol) == "" {
+		return nil, nil
+	}
+	lon, err := strconv.ParseFloat(cell(lonCol), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude '%v'", cell(lonCol))
+	}
+	lat, err := strconv.ParseFloat(cell(latCol), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude '%v'", cell(latCol))
+	}
+	return geom.Point{lon, lat}, nil
+}
+
+// The narrowest type all of the column's non-empty values have
+func csvColumnType(rows [][]string, col int) int {
+	candidates := map[int]bool{kindInteger: true, kindFloat: true, kindBoolean: true, kindDate: true}
+	for _, row := range rows {
+		if col >= len(row) {
+			continue
+		}
+		s := strings.TrimSpace(row[col])
+		if s == "" {
+			continue
+		}
+		for t := range candidates {
+			if !csvIsType(s, t) {
+				delete(candidates, t)
+			}
+		}
+		if len(candidates) == 0 {
+			return kindString
+		}
+	}
+
+	for _, t := range []int{kindInteger, kindFloat, kindBoolean, kindDate} {
+		if candidates[t] {
+			return t
+		}
+	}
+	return kindString
+}
+
+func csvIsType(s string, t int) bool {
+	switch t {
+	case kindInteger:
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	case kindFloat:
+		_, err := strconv.ParseFloat(s, 64)
+		return err == nil
+	case kindBoolean:
+		switch strings.ToLower(s) {
+		case "true", "false":
+			return true
+		}
+		return false
+	case kindDate:
+		for _, layout := range csvDateLayouts {
+			if _, err := time.Parse(layout, s); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Converts a cell to a property value of type t, nil for an empty cell
+func csvValue(s string, t int) interface{} {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	switch t {
+	case kindInteger:
+		v, _ := strconv.ParseInt(s, 10, 64)
+		return v
+	case kindFloat:
+		v, _ := strconv.ParseFloat(s, 64)
+		return v
+	case kindBoolean:
+		return strings.ToLower(s) == "true"
+	}
+	return s
+}
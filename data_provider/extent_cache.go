@@ -0,0 +1,94 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project extent_cache.go
+
+package data_provider
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-spatial/geom"
+)
+
+// How long collection extents are cached for when Provider.ExtentCacheTTL isn't set
+const DefaultExtentCacheTTL = 5 * time.Minute
+
+// The spatial & temporal extents of a collection, either may be nil
+type collectionExtents struct {
+	spatial  *geom.Extent
+	temporal *TimeInterval
+	expires  time.Time
+}
+
+// Holds collection extents for ttl, safe for concurrent use.  Computing an extent may mean
+// reading an entire collection.
+type extentCache struct {
+	mutex   sync.Mutex
+	entries map[string]collectionExtents
+	ttl     time.Duration
+	// The current time, replaceable for testing
+	now func() time.Time
+}
+
+func newExtentCache(ttl time.Duration) *extentCache {
+	if ttl <= 0 {
+		ttl = DefaultExtentCacheTTL
+	}
+	return &extentCache{entries: make(map[string]collectionExtents), ttl: ttl, now: time.Now}
+}
+
+// The cached extents of collection, false if there are none or they've expired
+func (c *extentCache) get(collection string) (collectionExtents, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ce, ok := c.entries[collection]
+	if !ok {
+		return ce, false
+	}
+	if !c.now().Before(ce.expires) {
+		delete(c.entries, collection)
+		return ce, false
+	}
+	return ce, true
+}
+
+func (c *extentCache) put(collection string, ce collectionExtents) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ce.expires = c.now().Add(c.ttl)
+	c.entries[collection] = ce
+}
+
+// Forgets the extents of collection, i.e. after its features change
+func (c *extentCache) drop(collection string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.entries, collection)
+}
@@ -0,0 +1,96 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project extent_cache_test.go
+
+package data_provider
+
+import (
+	"context"
+	"math"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-spatial/geom"
+)
+
+func TestExtentCache(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := newExtentCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	if _, ok := c.get("sites"); ok {
+		t.Errorf("empty cache returned extents")
+	}
+	c.put("sites", collectionExtents{spatial: &geom.Extent{1, 2, 3, 4}})
+	now = now.Add(59 * time.Second)
+	if ce, ok := c.get("sites"); !ok || !reflect.DeepEqual(ce.spatial, &geom.Extent{1, 2, 3, 4}) {
+		t.Errorf("got %v, %v, wanted the cached extent", ce.spatial, ok)
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.get("sites"); ok {
+		t.Errorf("extents should have expired")
+	}
+}
+
+func TestProviderCollectionExtent(t *testing.T) {
+	fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), "csv"), FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+	p := Provider{Source: fs, TemporalProperties: map[string]TemporalProperties{"sites": {Instant: "start_time"}}}
+
+	e, err := p.CollectionExtent(context.Background(), "sites")
+	if err != nil || !reflect.DeepEqual(e, &geom.Extent{-77.03, 38.89, -76.61, 39.29}) {
+		t.Errorf("CollectionExtent() == %v, %v", e, err)
+	}
+	te, err := p.CollectionTemporalExtent(context.Background(), "sites")
+	if err != nil || te == nil || te.Start.Month() != time.March || te.End.Month() != time.May {
+		t.Errorf("CollectionTemporalExtent() == %v, %v, wanted March to May 2018", te, err)
+	}
+}
+
+func TestLonLatExtent(t *testing.T) {
+	e := &geom.Extent{-77.1, 38.8, -76.9, 39.0}
+	projected, err := extentInSRID(e, 3857)
+	if err != nil {
+		t.Fatalf("extentInSRID(): %v", err)
+	}
+	back, err := lonLatExtent(projected, 3857)
+	if err != nil {
+		t.Fatalf("lonLatExtent(): %v", err)
+	}
+	for i := range e {
+		if math.Abs(back[i]-e[i]) > 1e-9 {
+			t.Errorf("round trip gave %v, wanted %v", back, e)
+			break
+		}
+	}
+	if _, err := lonLatExtent(e, 2263); err == nil {
+		t.Errorf("expected an error for an unsupported srid")
+	}
+}
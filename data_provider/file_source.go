@@ -0,0 +1,387 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project file_source.go
+
+package data_provider
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-spatial/geom"
+)
+
+// What a fileLoader reads from a data file
+type fileContents struct {
+	features []*Feature
+	// Property names, in file order for formats w/ a schema & otherwise sorted
+	properties []string
+	// Kind of each property's values, inferred from the values if the loader leaves it nil
+	kinds map[string]int
+	// Spatial reference id of the features' geometries, 0 if unknown
+	srid uint64
+	// CRS identifier or definition, see CollectionSchema.CRS
+	crs string
+}
+
+// Settings for reading data files
+type FileOptions struct {
+	CSV CSVOptions
+}
+
+// Reads all features from the data file at path
+type fileLoader func(path string, opts FileOptions) (*fileContents, error)
+
+// Keyed by lower-case file extension
+var fileLoaders = map[string]fileLoader{
+	".geojson": loadGeoJSONFile,
+	".json":    loadGeoJSONFile,
+	".shp":     loadShapefile,
+	".csv":     loadCSVFile,
+}
+
+// Whether path names a file FileSource will serve
+func IsDataFile(path string) bool {
+	_, ok := fileLoaders[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// Serves data files as collections, one per file named for the file w/o its extension.
+// Features are held in memory & filtered there, a file is reloaded when its modification
+// time changes.
+type FileSource struct {
+	mutex       sync.Mutex
+	options     FileOptions
+	collections map[string]*fileCollection
+}
+
+type fileCollection struct {
+	path string
+	load fileLoader
+	// Properties whose values identify features, the loader's ids are used if empty
+	idProperties []string
+	modTime      time.Time
+	fileContents
+}
+
+// A FileSource for the data file at path, or for all data files in the directory at path.
+// See fileLoaders for the supported file types.
+func NewFileSource(path string, opts FileOptions) (*FileSource, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if fi.IsDir() {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() && IsDataFile(e.Name()) {
+				paths = append(paths, filepath.Join(path, e.Name()))
+			}
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no data files found in '%v'", path)
+		}
+	} else {
+		if !IsDataFile(path) {
+			return nil, fmt.Errorf("unsupported data file type: '%v'", path)
+		}
+		paths = []string{path}
+	}
+
+	fs := &FileSource{options: opts, collections: make(map[string]*fileCollection, len(paths))}
+	for _, p := range paths {
+		name := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+		if _, ok := fs.collections[name]; ok {
+			log.Printf("collection name '%v' used by multiple files, skipping '%v'", name, p)
+			continue
+		}
+		fc := &fileCollection{path: p, load: fileLoaders[strings.ToLower(filepath.Ext(p))]}
+		if err := fc.reload(opts); err != nil {
+			return nil, fmt.Errorf("problem loading '%v': %v", p, err)
+		}
+		fs.collections[name] = fc
+	}
+
+	return fs, nil
+}
+
+// Reads the collection's file, replacing the previous contents only on success
+func (fc *fileCollection) reload(opts FileOptions) error {
+	fi, err := os.Stat(fc.path)
+	if err != nil {
+		return err
+	}
+	contents, err := fc.load(fc.path, opts)
+	if err != nil {
+		return err
+	}
+	if len(fc.idProperties) > 0 {
+		if err := setFeatureIds(contents.features, fc.idProperties); err != nil {
+			return err
+		}
+	}
+
+	if contents.kinds == nil {
+		contents.kinds = featureKinds(contents.features)
+	}
+
+	fc.modTime = fi.ModTime()
+	fc.fileContents = *contents
+	return nil
+}
+
+// The named collection, reloaded first if its file has changed
+func (fs *FileSource) collection(name string) (*fileCollection, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fc, ok := fs.collections[name]
+	if !ok {
+		return nil, fmt.Errorf("Invalid collection name: %v", name)
+	}
+
+	fi, err := os.Stat(fc.path)
+	if err != nil {
+		// Keep serving what we have
+		log.Printf("unable to check '%v' for changes: %v", fc.path, err)
+		return fc, nil
+	}
+	if !fi.ModTime().Equal(fc.modTime) {
+		// Replaced rather than updated in place as callers may still be using the old contents
+		reloaded := &fileCollection{path: fc.path, load: fc.load, idProperties: fc.idProperties}
+		if err := reloaded.reload(fs.options); err != nil {
+			log.Printf("problem reloading '%v', keeping previous contents: %v", fc.path, err)
+			return fc, nil
+		}
+		fs.collections[name] = reloaded
+		fc = reloaded
+	}
+
+	return fc, nil
+}
+
+// Identifies the features of collection by the values of properties, a composite id if there are
+// several.  Every feature must have a unique id.
+func (fs *FileSource) SetIdColumns(collection string, properties []string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fc, ok := fs.collections[collection]
+	if !ok {
+		return fmt.Errorf("Invalid collection name: %v", collection)
+	}
+	updated := &fileCollection{path: fc.path, load: fc.load, idProperties: properties}
+	if err := updated.reload(fs.options); err != nil {
+		return fmt.Errorf("problem loading '%v': %v", fc.path, err)
+	}
+	fs.collections[collection] = updated
+	return nil
+}
+
+// Sets the id of each of fs from the values of properties, these must be unique
+func setFeatureIds(fs []*Feature, properties []string) error {
+	ids := make(map[string]bool, len(fs))
+	parts := make([]string, len(properties))
+	for i, f := range fs {
+		for j, p := range properties {
+			v, ok := f.Properties[p]
+			if !ok || v == nil {
+				return fmt.Errorf("feature %v has no value for id property '%v'", i+1, p)
+			}
+			parts[j] = propertyString(v)
+		}
+		id := parts[0]
+		if len(parts) > 1 {
+			id = compositeId(parts)
+		}
+		if ids[id] {
+			return fmt.Errorf("duplicate id: '%v'", id)
+		}
+		ids[id] = true
+		f.ID = id
+	}
+	return nil
+}
+
+// The features in fc matching q, q.Extent is converted to the collection's srid.
+func (fc *fileCollection) matchingFeatures(ctx context.Context, q Query) ([]*Feature, error) {
+	if q.Extent != nil {
+		e, err := extentInSRID(q.Extent, fc.srid)
+		if err != nil {
+			return nil, err
+		}
+		q.Extent = e
+	}
+	return matchingFeatures(ctx, fc.features, q)
+}
+
+func (fs *FileSource) CollectionNames() ([]string, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	names := make([]string, 0, len(fs.collections))
+	for name := range fs.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (fs *FileSource) CollectionSchema(collection string) (*CollectionSchema, error) {
+	fc, err := fs.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	props := make([]string, len(fc.properties))
+	copy(props, fc.properties)
+	types := make(map[string]string, len(props))
+	for _, p := range props {
+		types[p] = kindPropertyType(fc.kinds[p])
+	}
+	cs := &CollectionSchema{
+		Name:          collection,
+		GeometryType:  commonGeometryType(fc.features),
+		SRID:          fc.srid,
+		CRS:           fc.crs,
+		Properties:    props,
+		PropertyTypes: types,
+	}
+	return cs, nil
+}
+
+func (fs *FileSource) QueryFeatures(ctx context.Context, q Query) ([]*Feature, error) {
+	fc, err := fs.collection(q.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	mfs, err := fc.matchingFeatures(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return pageFeatures(mfs, q), nil
+}
+
+func (fs *FileSource) CountFeatures(ctx context.Context, q Query) (uint, error) {
+	fc, err := fs.collection(q.Collection)
+	if err != nil {
+		return 0, err
+	}
+
+	mfs, err := fc.matchingFeatures(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	return uint(len(mfs)), nil
+}
+
+func (fs *FileSource) GetFeatures(ctx context.Context, collection string, ids []string) ([]*Feature, error) {
+	fc, err := fs.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	gfs := make([]*Feature, 0, len(ids))
+	for _, f := range fc.features {
+		for _, id := range ids {
+			if f.ID == id {
+				gfs = append(gfs, f)
+				break
+			}
+		}
+	}
+
+	return gfs, nil
+}
+
+func (fs *FileSource) CollectionExtent(ctx context.Context, collection string) (*geom.Extent, error) {
+	fc, err := fs.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	var extent *geom.Extent
+	for _, f := range fc.features {
+		extent = unionExtent(extent, geometryExtent(f.Geometry))
+	}
+	return extent, nil
+}
+
+// Sorted names of all properties found in fs
+func featureProperties(fs []*Feature) []string {
+	pnames := make(map[string]bool)
+	for _, f := range fs {
+		for k := range f.Properties {
+			pnames[k] = true
+		}
+	}
+
+	properties := make([]string, 0, len(pnames))
+	for k := range pnames {
+		properties = append(properties, k)
+	}
+	sort.Strings(properties)
+	return properties
+}
+
+// The narrowest kind holding all values of each property of fs, properties w/ values of
+// different kinds are strings except for a mix of integers & floats.
+func featureKinds(fs []*Feature) map[string]int {
+	kinds := make(map[string]int)
+	for _, f := range fs {
+		for k, v := range f.Properties {
+			vk, ok := valueKind(v)
+			if !ok {
+				continue
+			}
+			pk, seen := kinds[k]
+			switch {
+			case !seen || pk == vk:
+				kinds[k] = vk
+			case (pk == kindInteger || pk == kindFloat) && (vk == kindInteger || vk == kindFloat):
+				kinds[k] = kindFloat
+			default:
+				kinds[k] = kindString
+			}
+		}
+	}
+	return kinds
+}
@@ -0,0 +1,292 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+package data_provider
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/go-spatial/geom"
+)
+
+var geojsonTestPath string
+
+func init() {
+	_, thisFilePath, _, _ := runtime.Caller(0)
+	geojsonTestPath = path.Join(path.Dir(thisFilePath), "test_data/geojson")
+}
+
+func TestFileSourceGeoJSON(t *testing.T) {
+	gs, err := NewFileSource(geojsonTestPath, FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+
+	names, err := gs.CollectionNames()
+	if err != nil || len(names) != 1 || names[0] != "roads" {
+		t.Fatalf("CollectionNames() == %v, %v, wanted [roads]", names, err)
+	}
+
+	cases := []struct {
+		q        Query
+		expected []string
+		total    uint
+	}{
+		{
+			q:        Query{Collection: "roads"},
+			expected: []string{"10", "20", "30"},
+			total:    3,
+		},
+		{
+			q:        Query{Collection: "roads", Limit: 1, Offset: 1},
+			expected: []string{"20"},
+			total:    3,
+		},
+		{
+			q:        Query{Collection: "roads", Extent: &geom.Extent{-77.2, 38.7, -76.9, 39.0}},
+			expected: []string{"10", "30"},
+			total:    2,
+		},
+		{
+			q:        Query{Collection: "roads", Filters: []PropertyFilter{{Property: "kind", Op: OpEqual, Values: []string{"residential"}}}},
+			expected: []string{"20", "30"},
+			total:    2,
+		},
+		{
+			q:        Query{Collection: "roads", Time: &TimeInterval{Start: time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC)}},
+			expected: []string{"20", "30"},
+			total:    2,
+		},
+	}
+
+	for i, c := range cases {
+		fs, err := gs.QueryFeatures(context.Background(), c.q)
+		if err != nil {
+			t.Errorf("[%v] QueryFeatures(): %v", i, err)
+			continue
+		}
+		ids := make([]string, len(fs))
+		for j, f := range fs {
+			ids[j] = f.ID
+		}
+		if len(ids) != len(c.expected) {
+			t.Errorf("[%v] got ids %v, wanted %v", i, ids, c.expected)
+			continue
+		}
+		for j := range ids {
+			if ids[j] != c.expected[j] {
+				t.Errorf("[%v] got ids %v, wanted %v", i, ids, c.expected)
+				break
+			}
+		}
+
+		total, err := gs.CountFeatures(context.Background(), c.q)
+		if err != nil || total != c.total {
+			t.Errorf("[%v] CountFeatures() == %v, %v, wanted %v", i, total, err, c.total)
+		}
+	}
+}
+
+func TestFileSourceShapefile(t *testing.T) {
+	fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), "shapefile/stations.shp"), FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+
+	cs, err := fs.CollectionSchema("stations")
+	if err != nil {
+		t.Fatalf("CollectionSchema(): %v", err)
+	}
+	if cs.CRS != CRS84 || cs.SRID != 4326 {
+		t.Errorf("got CRS '%v' & SRID %v, wanted '%v' & 4326", cs.CRS, cs.SRID, CRS84)
+	}
+	if !reflect.DeepEqual(cs.Properties, []string{"name", "tracks", "open", "built"}) {
+		t.Errorf("got properties %v", cs.Properties)
+	}
+	if _, ok := cs.GeometryType.(geom.Point); !ok {
+		t.Errorf("got geometry type %T, wanted geom.Point", cs.GeometryType)
+	}
+
+	// The second record is deleted
+	fs1, err := fs.QueryFeatures(context.Background(), Query{Collection: "stations"})
+	if err != nil {
+		t.Fatalf("QueryFeatures(): %v", err)
+	}
+	if len(fs1) != 2 || fs1[0].ID != "1" || fs1[1].ID != "3" {
+		t.Fatalf("got %v features, wanted ids 1 & 3", len(fs1))
+	}
+	expected := map[string]interface{}{"name": "Union Station", "tracks": int64(22), "open": true, "built": "1907-01-01"}
+	if !reflect.DeepEqual(fs1[0].Properties, expected) {
+		t.Errorf("got properties %v, wanted %v", fs1[0].Properties, expected)
+	}
+	if !reflect.DeepEqual(fs1[0].Geometry, geom.Point{-77.03, 38.89}) {
+		t.Errorf("got geometry %v", fs1[0].Geometry)
+	}
+
+	fs2, err := fs.QueryFeatures(context.Background(), Query{Collection: "stations", Extent: &geom.Extent{-77.02, 38.9, -77.0, 38.92}})
+	if err != nil || len(fs2) != 1 || fs2[0].ID != "3" {
+		t.Errorf("bbox query got %v features, %v, wanted feature 3", len(fs2), err)
+	}
+}
+
+func TestFileSourceCSV(t *testing.T) {
+	fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), "csv"), FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+
+	names, err := fs.CollectionNames()
+	if err != nil || !reflect.DeepEqual(names, []string{"parcels", "sites"}) {
+		t.Fatalf("CollectionNames() == %v, %v, wanted [parcels sites]", names, err)
+	}
+
+	// lon/lat columns & typed properties
+	sites, err := fs.QueryFeatures(context.Background(), Query{Collection: "sites"})
+	if err != nil || len(sites) != 3 {
+		t.Fatalf("QueryFeatures() got %v features, %v, wanted 3", len(sites), err)
+	}
+	expected := map[string]interface{}{"name": "Creek A", "depth": 1.5, "active": true, "visits": int64(12), "start_time": "2018-03-01"}
+	if !reflect.DeepEqual(sites[0].Properties, expected) {
+		t.Errorf("got properties %v, wanted %v", sites[0].Properties, expected)
+	}
+	if !reflect.DeepEqual(sites[0].Geometry, geom.Point{-77.03, 38.89}) {
+		t.Errorf("got geometry %v", sites[0].Geometry)
+	}
+	if _, ok := sites[2].Properties["depth"]; ok {
+		t.Errorf("empty cell should be left out of the properties")
+	}
+
+	cases := []struct {
+		q        Query
+		expected []string
+	}{
+		{q: Query{Collection: "sites", Extent: &geom.Extent{-77.1, 38.8, -77.0, 38.95}}, expected: []string{"1", "3"}},
+		{q: Query{Collection: "sites", Filters: []PropertyFilter{{Property: "name", Op: OpEqual, Values: []string{"Pond"}}}}, expected: []string{"3"}},
+		// Features w/ only a start_time are ongoing
+		{q: Query{Collection: "sites", Time: &TimeInterval{Start: time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2018, 5, 15, 0, 0, 0, 0, time.UTC)}}, expected: []string{"1", "2"}},
+		{q: Query{Collection: "parcels", Extent: &geom.Extent{-77.05, 38.85, -77.04, 38.86}}, expected: []string{"1"}},
+	}
+	for i, c := range cases {
+		cfs, err := fs.QueryFeatures(context.Background(), c.q)
+		if err != nil {
+			t.Errorf("[%v] QueryFeatures(): %v", i, err)
+			continue
+		}
+		ids := make([]string, len(cfs))
+		for j, f := range cfs {
+			ids[j] = f.ID
+		}
+		if !reflect.DeepEqual(ids, c.expected) {
+			t.Errorf("[%v] got ids %v, wanted %v", i, ids, c.expected)
+		}
+	}
+}
+
+func TestFileSourceIdColumns(t *testing.T) {
+	fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), "csv"), FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+
+	if err := fs.SetIdColumns("sites", []string{"name"}); err != nil {
+		t.Fatalf("SetIdColumns(): %v", err)
+	}
+	gfs, err := fs.GetFeatures(context.Background(), "sites", []string{"Pond", "1"})
+	if err != nil || len(gfs) != 1 || gfs[0].Properties["visits"] != int64(7) {
+		t.Errorf("GetFeatures() got %v features, %v, wanted 'Pond'", len(gfs), err)
+	}
+
+	if err := fs.SetIdColumns("sites", []string{"name", "visits"}); err != nil {
+		t.Fatalf("SetIdColumns(): %v", err)
+	}
+	sites, err := fs.QueryFeatures(context.Background(), Query{Collection: "sites"})
+	if err != nil || len(sites) != 3 || sites[1].ID != "Creek B,3" {
+		t.Errorf("QueryFeatures() got %v features, %v, wanted 'Creek B,3' second", len(sites), err)
+	}
+
+	// Missing values
+	if err := fs.SetIdColumns("sites", []string{"depth"}); err == nil {
+		t.Errorf("SetIdColumns() w/ a property some features lack should fail")
+	}
+	if err := fs.SetIdColumns("parcels", []string{"area"}); err == nil {
+		t.Errorf("SetIdColumns() w/ an unknown property should fail")
+	}
+}
+
+func TestCompositeId(t *testing.T) {
+	parts := []string{"a,b", "100%", "%2C"}
+	id := compositeId(parts)
+	if id != "a%2Cb,100%25,%252C" {
+		t.Errorf("compositeId(%v) == '%v'", parts, id)
+	}
+	split, ok := splitCompositeId(id, 3)
+	if !ok || !reflect.DeepEqual(split, parts) {
+		t.Errorf("splitCompositeId('%v') == %v, %v, wanted %v", id, split, ok, parts)
+	}
+	if _, ok := splitCompositeId(id, 2); ok {
+		t.Errorf("splitCompositeId('%v', 2) should fail", id)
+	}
+}
+
+func TestDecodeWKT(t *testing.T) {
+	cases := []struct {
+		wkt      string
+		expected geom.Geometry
+		err      bool
+	}{
+		{wkt: "POINT (1 2)", expected: geom.Point{1, 2}},
+		{wkt: "point z (1 2 3)", expected: geom.Point{1, 2}},
+		{wkt: "SRID=4326;POINT(1 2)", expected: geom.Point{1, 2}},
+		{wkt: "POINT EMPTY", expected: nil},
+		{wkt: "MULTIPOINT ((1 2), (3 4))", expected: geom.MultiPoint{{1, 2}, {3, 4}}},
+		{wkt: "MULTIPOINT (1 2, 3 4)", expected: geom.MultiPoint{{1, 2}, {3, 4}}},
+		{wkt: "LINESTRING (1 2, 3 4)", expected: geom.LineString{{1, 2}, {3, 4}}},
+		{wkt: "POLYGON ((0 0, 1 0, 1 1, 0 0))", expected: geom.Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}},
+		{wkt: "MULTIPOLYGON (((0 0, 1 0, 1 1, 0 0)), ((5 5, 6 5, 6 6, 5 5)))",
+			expected: geom.MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}, {{{5, 5}, {6, 5}, {6, 6}, {5, 5}}}}},
+		{wkt: "GEOMETRYCOLLECTION (POINT (1 2), LINESTRING (1 2, 3 4))",
+			expected: geom.Collection{geom.Point{1, 2}, geom.LineString{{1, 2}, {3, 4}}}},
+		{wkt: "POINT (1)", err: true},
+		{wkt: "POINT (1 2", err: true},
+		{wkt: "CIRCLE (1 2)", err: true},
+		{wkt: "POINT (1 2) extra", err: true},
+	}
+
+	for i, c := range cases {
+		g, err := DecodeWKT(c.wkt)
+		if (err != nil) != c.err {
+			t.Errorf("[%v] DecodeWKT(%q) error: %v", i, c.wkt, err)
+			continue
+		}
+		if !c.err && !reflect.DeepEqual(g, c.expected) {
+			t.Errorf("[%v] DecodeWKT(%q) == %#v, wanted %#v", i, c.wkt, g, c.expected)
+		}
+	}
+}
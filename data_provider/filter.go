@@ -0,0 +1,385 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project filter.go
+
+package data_provider
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operators for PropertyFilter
+const (
+	OpEqual        = "="
+	OpNotEqual     = "<>"
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	// Matches any of the filter's values
+	OpIn = "IN"
+	// Matches a pattern where '*' matches any number of characters, '\*' matches a literal '*'
+	OpLike = "LIKE"
+)
+
+// Returned for a filter that can't be applied, i.e. an unknown operator or a value that can't be
+// converted to its property's type.
+type BadFilter struct {
+	msg string
+}
+
+func (bf *BadFilter) Error() string {
+	return bf.msg
+}
+
+// Compares a feature property w/ one or more values.
+// Values are converted to the property's type: numbers are compared numerically, booleans as
+// booleans, dates & times chronologically & anything else as strings.
+type PropertyFilter struct {
+	Property string
+	Op       string
+	// A single value except for OpIn
+	Values []string
+}
+
+func (pf PropertyFilter) validate() error {
+	switch pf.Op {
+	case OpIn:
+		if len(pf.Values) == 0 {
+			return &BadFilter{msg: fmt.Sprintf("no values for '%v' filter on '%v'", pf.Op, pf.Property)}
+		}
+	case OpEqual, OpNotEqual, OpLess, OpLessEqual, OpGreater, OpGreaterEqual, OpLike:
+		if len(pf.Values) != 1 {
+			return &BadFilter{msg: fmt.Sprintf("expecting a single value for '%v' filter on '%v', got %v", pf.Op, pf.Property, len(pf.Values))}
+		}
+	default:
+		return &BadFilter{msg: fmt.Sprintf("unknown filter operator '%v' for '%v'", pf.Op, pf.Property)}
+	}
+	return nil
+}
+
+// Whether f's value for the filter's property passes the filter, features w/o the property never do.
+func (pf PropertyFilter) matches(f *Feature) bool {
+	v, ok := f.Properties[pf.Property]
+	if !ok || v == nil {
+		return false
+	}
+
+	switch pf.Op {
+	case OpLike:
+		return likePattern(pf.Values[0]).MatchString(propertyString(v))
+	case OpIn:
+		for _, pv := range pf.Values {
+			if c, ok := compareProperty(v, pv); ok && c == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	c, ok := compareProperty(v, pf.Values[0])
+	if !ok {
+		return false
+	}
+	switch pf.Op {
+	case OpEqual:
+		return c == 0
+	case OpNotEqual:
+		return c != 0
+	case OpLess:
+		return c < 0
+	case OpLessEqual:
+		return c <= 0
+	case OpGreater:
+		return c > 0
+	case OpGreaterEqual:
+		return c >= 0
+	}
+	return false
+}
+
+// Compares property value v to s converted to v's type, returning -1, 0 or 1 as v is less than,
+// equal to or greater than s.  ok is false if s can't be converted.
+func compareProperty(v interface{}, s string) (c int, ok bool) {
+	compareFloats := func(a, b float64) int {
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+
+	if fv, isNumber := propertyFloat(v); isNumber {
+		sv, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, false
+		}
+		return compareFloats(fv, sv), true
+	}
+
+	switch tv := v.(type) {
+	case bool:
+		sv, err := strconv.ParseBool(s)
+		if err != nil {
+			return 0, false
+		}
+		switch {
+		case tv == sv:
+			return 0, true
+		case sv:
+			return -1, true
+		}
+		return 1, true
+	case time.Time:
+		st, err := parse_time_string(s)
+		if err != nil {
+			return 0, false
+		}
+		return compareFloats(float64(tv.Sub(st)), 0), true
+	case string:
+		// Dates & times held as strings compare chronologically
+		if vt, err := parse_time_string(tv); err == nil {
+			if st, err := parse_time_string(s); err == nil {
+				return compareFloats(float64(vt.Sub(st)), 0), true
+			}
+		}
+		return strings.Compare(tv, s), true
+	}
+
+	return strings.Compare(propertyString(v), s), true
+}
+
+// v as a float64 if it's a number
+func propertyFloat(v interface{}) (float64, bool) {
+	switch tv := v.(type) {
+	case int:
+		return float64(tv), true
+	case int8:
+		return float64(tv), true
+	case int16:
+		return float64(tv), true
+	case int32:
+		return float64(tv), true
+	case int64:
+		return float64(tv), true
+	case uint:
+		return float64(tv), true
+	case uint8:
+		return float64(tv), true
+	case uint16:
+		return float64(tv), true
+	case uint32:
+		return float64(tv), true
+	case uint64:
+		return float64(tv), true
+	case float32:
+		return float64(tv), true
+	case float64:
+		return tv, !math.IsNaN(tv)
+	}
+	return 0, false
+}
+
+func propertyString(v interface{}) string {
+	switch tv := v.(type) {
+	case string:
+		return tv
+	case time.Time:
+		return tv.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// Converts an OpLike pattern to an anchored regular expression
+func likePattern(pattern string) *regexp.Regexp {
+	var re bytes.Buffer
+	re.WriteString("^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			re.WriteString("(?s:.*)")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		re.WriteString(regexp.QuoteMeta(`\`))
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String())
+}
+
+// Converts an OpLike pattern to a SQL LIKE pattern w/ '\' as the escape character
+func sqlLikePattern(pattern string) string {
+	var sp bytes.Buffer
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			if r == '%' || r == '_' || r == '\\' {
+				sp.WriteRune('\\')
+			}
+			sp.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			sp.WriteRune('%')
+		case r == '%' || r == '_':
+			sp.WriteRune('\\')
+			sp.WriteRune(r)
+		default:
+			sp.WriteRune(r)
+		}
+	}
+	if escaped {
+		sp.WriteString(`\\`)
+	}
+	return sp.String()
+}
+
+// Kinds of property values, used to convert filter values for comparison w/ typed columns
+const (
+	kindString = iota
+	kindInteger
+	kindFloat
+	kindBoolean
+	kindDate
+)
+
+// Types of property values in CollectionSchema.PropertyTypes, named as in JSON Schema
+const (
+	PropertyTypeString  = "string"
+	PropertyTypeInteger = "integer"
+	PropertyTypeNumber  = "number"
+	PropertyTypeBoolean = "boolean"
+	// A string holding a date or time
+	PropertyTypeDateTime = "date-time"
+)
+
+// The PropertyType* name of kind
+func kindPropertyType(kind int) string {
+	switch kind {
+	case kindInteger:
+		return PropertyTypeInteger
+	case kindFloat:
+		return PropertyTypeNumber
+	case kindBoolean:
+		return PropertyTypeBoolean
+	case kindDate:
+		return PropertyTypeDateTime
+	}
+	return PropertyTypeString
+}
+
+// The kind of a property value, false for nil
+func valueKind(v interface{}) (int, bool) {
+	switch tv := v.(type) {
+	case nil:
+		return 0, false
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return kindInteger, true
+	case float32:
+		return kindFloat, true
+	case float64:
+		// JSON has no separate integer type
+		if tv == math.Trunc(tv) {
+			return kindInteger, true
+		}
+		return kindFloat, true
+	case bool:
+		return kindBoolean, true
+	case time.Time:
+		return kindDate, true
+	}
+	return kindString, true
+}
+
+// The kind of values in a column of SQL type t
+func sqlTypeKind(t string) int {
+	t = strings.ToUpper(t)
+	switch {
+	case strings.Contains(t, "INT"):
+		return kindInteger
+	case strings.Contains(t, "BOOL"):
+		return kindBoolean
+	case strings.Contains(t, "REAL") || strings.Contains(t, "FLOA") || strings.Contains(t, "DOUB") ||
+		strings.Contains(t, "NUMERIC") || strings.Contains(t, "DECIMAL"):
+		return kindFloat
+	case strings.Contains(t, "DATE") || strings.Contains(t, "TIME"):
+		return kindDate
+	}
+	return kindString
+}
+
+// Converts filter value s for comparison w/ values of kind
+func filterValue(property string, kind int, s string) (interface{}, error) {
+	bad := func(kindName string) error {
+		return &BadFilter{msg: fmt.Sprintf("invalid %v value for '%v': '%v'", kindName, property, s)}
+	}
+	switch kind {
+	case kindInteger:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		// i.e. lanes>=1.5
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v, nil
+		}
+		return nil, bad("integer")
+	case kindFloat:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, bad("number")
+		}
+		return v, nil
+	case kindBoolean:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, bad("boolean")
+		}
+		return v, nil
+	case kindDate:
+		if _, err := parse_time_string(s); err != nil {
+			return nil, bad("date/time")
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,195 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+package data_provider
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPropertyFilterMatches(t *testing.T) {
+	f := &Feature{Properties: map[string]interface{}{
+		"lanes":    int64(2),
+		"width":    7.5,
+		"oneway":   true,
+		"name":     "Main St",
+		"surveyed": time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC),
+		"opened":   "2018-03-01",
+	}}
+
+	cases := []struct {
+		pf       PropertyFilter
+		expected bool
+	}{
+		{PropertyFilter{Property: "lanes", Op: OpEqual, Values: []string{"2"}}, true},
+		{PropertyFilter{Property: "lanes", Op: OpEqual, Values: []string{"2.0"}}, true},
+		{PropertyFilter{Property: "lanes", Op: OpGreaterEqual, Values: []string{"2"}}, true},
+		{PropertyFilter{Property: "lanes", Op: OpGreater, Values: []string{"2"}}, false},
+		{PropertyFilter{Property: "lanes", Op: OpIn, Values: []string{"1", "3"}}, false},
+		{PropertyFilter{Property: "lanes", Op: OpIn, Values: []string{"1", "2"}}, true},
+		{PropertyFilter{Property: "lanes", Op: OpEqual, Values: []string{"two"}}, false},
+		{PropertyFilter{Property: "width", Op: OpLess, Values: []string{"10"}}, true},
+		{PropertyFilter{Property: "oneway", Op: OpEqual, Values: []string{"true"}}, true},
+		{PropertyFilter{Property: "oneway", Op: OpNotEqual, Values: []string{"true"}}, false},
+		{PropertyFilter{Property: "name", Op: OpLike, Values: []string{"Main*"}}, true},
+		{PropertyFilter{Property: "name", Op: OpLike, Values: []string{"main*"}}, false},
+		{PropertyFilter{Property: "name", Op: OpLike, Values: []string{`Main\*`}}, false},
+		{PropertyFilter{Property: "name", Op: OpGreater, Values: []string{"Elm St"}}, true},
+		{PropertyFilter{Property: "surveyed", Op: OpLess, Values: []string{"2018-03-02"}}, true},
+		{PropertyFilter{Property: "opened", Op: OpGreaterEqual, Values: []string{"2018-03-01T00:00:00Z"}}, true},
+		{PropertyFilter{Property: "missing", Op: OpNotEqual, Values: []string{"x"}}, false},
+	}
+
+	for i, c := range cases {
+		if got := c.pf.matches(f); got != c.expected {
+			t.Errorf("[%v] %v %v %v == %v, wanted %v", i, c.pf.Property, c.pf.Op, c.pf.Values, got, c.expected)
+		}
+	}
+}
+
+func TestSQLLikePattern(t *testing.T) {
+	cases := map[string]string{
+		"Main*":     "Main%",
+		`100\*`:     "100*",
+		"50%_off*":  `50\%\_off%`,
+		`back\\sl*`: `back\\sl%`,
+	}
+	for pattern, expected := range cases {
+		if got := sqlLikePattern(pattern); got != expected {
+			t.Errorf("sqlLikePattern(%q) == %q, wanted %q", pattern, got, expected)
+		}
+	}
+}
+
+func TestFeatureKinds(t *testing.T) {
+	fs := []*Feature{
+		{Properties: map[string]interface{}{"lanes": 2.0, "width": 7.0, "name": "Main St", "oneway": true, "code": 7.0}},
+		{Properties: map[string]interface{}{"lanes": 3.0, "width": 7.5, "name": nil, "oneway": false, "code": "B7"}},
+	}
+	expected := map[string]int{"lanes": kindInteger, "width": kindFloat, "name": kindString, "oneway": kindBoolean, "code": kindString}
+	if kinds := featureKinds(fs); !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("got %v, wanted %v", kinds, expected)
+	}
+}
+
+func TestProviderFilterProperties(t *testing.T) {
+	fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), "csv"), FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+	p := Provider{Source: fs}
+
+	cs, err := p.CollectionSchema("sites")
+	if err != nil {
+		t.Fatalf("CollectionSchema(): %v", err)
+	}
+	expected := map[string]string{"name": PropertyTypeString, "depth": PropertyTypeNumber, "active": PropertyTypeBoolean,
+		"visits": PropertyTypeInteger, "start_time": PropertyTypeDateTime}
+	if !reflect.DeepEqual(cs.PropertyTypes, expected) {
+		t.Errorf("got property types %v, wanted %v", cs.PropertyTypes, expected)
+	}
+
+	q := Query{Collection: "sites", Filters: []PropertyFilter{{Property: "visits", Op: OpGreater, Values: []string{"5"}}}}
+	if _, _, err := p.QueryFeatures(context.Background(), q); err != nil {
+		t.Errorf("QueryFeatures() w/ a known property: %v", err)
+	}
+	q.Filters[0].Property = "altitude"
+	if _, _, err := p.QueryFeatures(context.Background(), q); err == nil {
+		t.Errorf("expected an error for an unknown property")
+	} else if _, ok := err.(*BadFilter); !ok {
+		t.Errorf("got a %T, wanted a *BadFilter", err)
+	}
+}
+
+func TestProviderSelection(t *testing.T) {
+	fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), "csv"), FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+	p := Provider{Source: fs}
+	ctx := context.Background()
+
+	type tcase struct {
+		sel           Selection
+		expectedProps []string
+		expectedGeom  bool
+	}
+	tcases := []tcase{
+		{sel: Selection{}, expectedProps: []string{"active", "depth", "name", "start_time", "visits"}, expectedGeom: true},
+		{sel: Selection{Properties: []string{"name", "visits"}}, expectedProps: []string{"name", "visits"}, expectedGeom: true},
+		{sel: Selection{Properties: []string{}, SkipGeometry: true}, expectedProps: []string{}, expectedGeom: false},
+		{sel: Selection{SkipGeometry: true}, expectedProps: []string{"active", "depth", "name", "start_time", "visits"}, expectedGeom: false},
+	}
+	for i, tc := range tcases {
+		fs, _, err := p.QueryFeatures(ctx, Query{Collection: "sites", Select: tc.sel})
+		if err != nil {
+			t.Fatalf("[%v] QueryFeatures(): %v", i, err)
+		}
+		if len(fs) != 3 {
+			t.Fatalf("[%v] got %v features, wanted 3", i, len(fs))
+		}
+		f, err := p.GetFeature(ctx, FeatureId{Collection: "sites", FeaturePk: fs[0].ID}, tc.sel)
+		if err != nil {
+			t.Fatalf("[%v] GetFeature(): %v", i, err)
+		}
+		for _, f := range []*Feature{fs[0], f} {
+			props := make([]string, 0, len(f.Properties))
+			for k := range f.Properties {
+				props = append(props, k)
+			}
+			sort.Strings(props)
+			if !reflect.DeepEqual(props, tc.expectedProps) {
+				t.Errorf("[%v] got properties %v, wanted %v", i, props, tc.expectedProps)
+			}
+			if (f.Geometry != nil) != tc.expectedGeom {
+				t.Errorf("[%v] got geometry %v, wanted one: %v", i, f.Geometry, tc.expectedGeom)
+			}
+		}
+	}
+
+	// The source's features are left alone
+	all, _, err := p.QueryFeatures(ctx, Query{Collection: "sites"})
+	if err != nil {
+		t.Fatalf("QueryFeatures(): %v", err)
+	}
+	if all[0].Geometry == nil || len(all[0].Properties) != 5 {
+		t.Errorf("selection modified the source's feature: %v", all[0])
+	}
+
+	sel := Selection{Properties: []string{"altitude"}}
+	if _, _, err := p.QueryFeatures(ctx, Query{Collection: "sites", Select: sel}); err == nil {
+		t.Errorf("expected an error selecting an unknown property")
+	} else if _, ok := err.(*BadFilter); !ok {
+		t.Errorf("got a %T, wanted a *BadFilter", err)
+	}
+	if _, err := p.GetFeature(ctx, FeatureId{Collection: "sites", FeaturePk: all[0].ID}, sel); err == nil {
+		t.Errorf("expected an error selecting an unknown property of a feature")
+	}
+}
@@ -0,0 +1,305 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project geojson.go
+
+package data_provider
+
+// Reading of GeoJSON files for FileSource.
+// @see https://tools.ietf.org/html/rfc7946
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/go-spatial/geom"
+)
+
+type geojsonFeature struct {
+	ID         json.RawMessage        `json:"id"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// A feature's id as a string, false if it has none.  GeoJSON ids are strings or numbers.
+func geojsonId(raw json.RawMessage) (string, bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", false
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s, true
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String(), true
+	}
+	return "", false
+}
+
+// Reads a file containing a GeoJSON FeatureCollection or a single Feature.
+// The features' ids are used if they're all unique, otherwise features are numbered from 1 in
+// file order.
+func loadGeoJSONFile(path string, _ FileOptions) (*fileContents, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Type     string           `json:"type"`
+		Features []geojsonFeature `json:"features"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	switch doc.Type {
+	case "FeatureCollection":
+	case "Feature":
+		var gf geojsonFeature
+		if err := json.Unmarshal(b, &gf); err != nil {
+			return nil, err
+		}
+		doc.Features = []geojsonFeature{gf}
+	default:
+		return nil, fmt.Errorf("expecting a geojson FeatureCollection or Feature, got '%v'", doc.Type)
+	}
+
+	fs := make([]*Feature, len(doc.Features))
+	ids := make(map[string]bool, len(doc.Features))
+	docIds := make([]string, 0, len(doc.Features))
+	for i, gf := range doc.Features {
+		g, err := decodeGeoJSONGeometry(gf.Geometry)
+		if err != nil {
+			return nil, fmt.Errorf("feature %v: %v", i, err)
+		}
+		f := &Feature{ID: strconv.Itoa(i + 1), Geometry: g, SRID: 4326, Properties: gf.Properties}
+		if f.Properties == nil {
+			f.Properties = make(map[string]interface{})
+		}
+
+		if id, ok := geojsonId(gf.ID); ok && !ids[id] && len(docIds) == i {
+			ids[id] = true
+			docIds = append(docIds, id)
+		}
+		fs[i] = f
+	}
+	if len(docIds) == len(fs) {
+		for i, id := range docIds {
+			fs[i].ID = id
+		}
+	}
+
+	return &fileContents{features: fs, properties: featureProperties(fs), srid: 4326, crs: CRS84}, nil
+}
+
+// Decodes a GeoJSON Feature, i.e. one to be written through Provider, w/ lon/lat coordinates.
+// Its id is kept if it has one.  Returns a *BadFeature if b isn't a GeoJSON Feature.
+func DecodeGeoJSONFeature(b []byte) (*Feature, error) {
+	return decodeGeoJSONFeature(b, false)
+}
+
+// Decodes a patch for Provider.UpdateFeature(), a GeoJSON Feature w/ only the properties to change
+// (null to clear them) & optionally a geometry.  Its "type" may be left out.
+func DecodeGeoJSONPatch(b []byte) (*Feature, error) {
+	return decodeGeoJSONFeature(b, true)
+}
+
+func decodeGeoJSONFeature(b []byte, patch bool) (*Feature, error) {
+	var doc struct {
+		Type string `json:"type"`
+		geojsonFeature
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, &BadFeature{msg: fmt.Sprintf("invalid geojson feature: %v", err)}
+	}
+	if doc.Type != "Feature" && !(patch && doc.Type == "") {
+		return nil, &BadFeature{msg: fmt.Sprintf("expecting a geojson Feature, got '%v'", doc.Type)}
+	}
+	g, err := decodeGeoJSONGeometry(doc.Geometry)
+	if err != nil {
+		return nil, &BadFeature{msg: fmt.Sprintf("invalid geojson feature geometry: %v", err)}
+	}
+	f := &Feature{Geometry: g, SRID: 4326, Properties: doc.Properties}
+	if f.Properties == nil {
+		f.Properties = make(map[string]interface{})
+	}
+	f.ID, _ = geojsonId(doc.ID)
+	return f, nil
+}
+
+// The GeoJSON type name of g
+func geojsonType(g geom.Geometry) string {
+	switch g.(type) {
+	case geom.Point:
+		return "Point"
+	case geom.MultiPoint:
+		return "MultiPoint"
+	case geom.LineString:
+		return "LineString"
+	case geom.MultiLineString:
+		return "MultiLineString"
+	case geom.Polygon:
+		return "Polygon"
+	case geom.MultiPolygon:
+		return "MultiPolygon"
+	case geom.Collection:
+		return "GeometryCollection"
+	}
+	return fmt.Sprintf("%T", g)
+}
+
+type geojsonGeometry struct {
+	Type        string            `json:"type"`
+	Coordinates json.RawMessage   `json:"coordinates"`
+	Geometries  []json.RawMessage `json:"geometries"`
+}
+
+// Decodes a GeoJSON geometry object, a null geometry decodes to nil.
+// Any z or m values are dropped.
+func decodeGeoJSONGeometry(b []byte) (geom.Geometry, error) {
+	if len(b) == 0 || string(b) == "null" {
+		return nil, nil
+	}
+
+	var gg geojsonGeometry
+	if err := json.Unmarshal(b, &gg); err != nil {
+		return nil, err
+	}
+
+	switch gg.Type {
+	case "Point":
+		var c []float64
+		if err := json.Unmarshal(gg.Coordinates, &c); err != nil {
+			return nil, err
+		}
+		pt, err := geojsonPosition(c)
+		if err != nil {
+			return nil, err
+		}
+		return geom.Point(pt), nil
+	case "MultiPoint":
+		var c [][]float64
+		if err := json.Unmarshal(gg.Coordinates, &c); err != nil {
+			return nil, err
+		}
+		pts, err := geojsonPositions(c)
+		if err != nil {
+			return nil, err
+		}
+		return geom.MultiPoint(pts), nil
+	case "LineString":
+		var c [][]float64
+		if err := json.Unmarshal(gg.Coordinates, &c); err != nil {
+			return nil, err
+		}
+		pts, err := geojsonPositions(c)
+		if err != nil {
+			return nil, err
+		}
+		return geom.LineString(pts), nil
+	case "MultiLineString":
+		var c [][][]float64
+		if err := json.Unmarshal(gg.Coordinates, &c); err != nil {
+			return nil, err
+		}
+		lines, err := geojsonPositionLists(c)
+		if err != nil {
+			return nil, err
+		}
+		return geom.MultiLineString(lines), nil
+	case "Polygon":
+		var c [][][]float64
+		if err := json.Unmarshal(gg.Coordinates, &c); err != nil {
+			return nil, err
+		}
+		rings, err := geojsonPositionLists(c)
+		if err != nil {
+			return nil, err
+		}
+		return geom.Polygon(rings), nil
+	case "MultiPolygon":
+		var c [][][][]float64
+		if err := json.Unmarshal(gg.Coordinates, &c); err != nil {
+			return nil, err
+		}
+		polys := make(geom.MultiPolygon, len(c))
+		for i, pc := range c {
+			rings, err := geojsonPositionLists(pc)
+			if err != nil {
+				return nil, err
+			}
+			polys[i] = rings
+		}
+		return polys, nil
+	case "GeometryCollection":
+		gc := make(geom.Collection, 0, len(gg.Geometries))
+		for _, gb := range gg.Geometries {
+			g, err := decodeGeoJSONGeometry(gb)
+			if err != nil {
+				return nil, err
+			}
+			if g != nil {
+				gc = append(gc, g)
+			}
+		}
+		return gc, nil
+	default:
+		return nil, fmt.Errorf("unsupported geojson geometry type: '%v'", gg.Type)
+	}
+}
+
+func geojsonPosition(c []float64) ([2]float64, error) {
+	if len(c) < 2 {
+		return [2]float64{}, fmt.Errorf("geojson position needs at least two values, got %v", len(c))
+	}
+	return [2]float64{c[0], c[1]}, nil
+}
+
+func geojsonPositions(c [][]float64) ([][2]float64, error) {
+	pts := make([][2]float64, len(c))
+	for i, pc := range c {
+		pt, err := geojsonPosition(pc)
+		if err != nil {
+			return nil, err
+		}
+		pts[i] = pt
+	}
+	return pts, nil
+}
+
+func geojsonPositionLists(c [][][]float64) ([][][2]float64, error) {
+	lists := make([][][2]float64, len(c))
+	for i, lc := range c {
+		pts, err := geojsonPositions(lc)
+		if err != nil {
+			return nil, err
+		}
+		lists[i] = pts
+	}
+	return lists, nil
+}
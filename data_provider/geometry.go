@@ -0,0 +1,186 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project geometry.go
+
+package data_provider
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-spatial/geom"
+)
+
+// Grows e to include pts
+func extendExtent(e *geom.Extent, pts ...[2]float64) {
+	for _, pt := range pts {
+		if pt[0] < e[0] {
+			e[0] = pt[0]
+		}
+		if pt[1] < e[1] {
+			e[1] = pt[1]
+		}
+		if pt[0] > e[2] {
+			e[2] = pt[0]
+		}
+		if pt[1] > e[3] {
+			e[3] = pt[1]
+		}
+	}
+}
+
+// Bounding box of g, nil if g is nil, empty, or an unsupported geometry type
+func geometryExtent(g geom.Geometry) *geom.Extent {
+	var pts [][2]float64
+	switch tg := g.(type) {
+	case geom.Point:
+		pts = append(pts, tg)
+	case geom.MultiPoint:
+		pts = append(pts, tg...)
+	case geom.LineString:
+		pts = append(pts, tg...)
+	case geom.MultiLineString:
+		for _, ls := range tg {
+			pts = append(pts, ls...)
+		}
+	case geom.Polygon:
+		for _, r := range tg {
+			pts = append(pts, r...)
+		}
+	case geom.MultiPolygon:
+		for _, p := range tg {
+			for _, r := range p {
+				pts = append(pts, r...)
+			}
+		}
+	case geom.Collection:
+		var e *geom.Extent
+		for _, cg := range tg {
+			e = unionExtent(e, geometryExtent(cg))
+		}
+		return e
+	}
+
+	if len(pts) == 0 {
+		return nil
+	}
+	e := &geom.Extent{pts[0][0], pts[0][1], pts[0][0], pts[0][1]}
+	extendExtent(e, pts[1:]...)
+	return e
+}
+
+// Copy of g w/ fn applied to each of its points
+func mapPoints(g geom.Geometry, fn func([2]float64) [2]float64) (geom.Geometry, error) {
+	mapLine := func(pts [][2]float64) [][2]float64 {
+		mpts := make([][2]float64, len(pts))
+		for i, pt := range pts {
+			mpts[i] = fn(pt)
+		}
+		return mpts
+	}
+	mapLines := func(lines [][][2]float64) [][][2]float64 {
+		mlines := make([][][2]float64, len(lines))
+		for i, l := range lines {
+			mlines[i] = mapLine(l)
+		}
+		return mlines
+	}
+
+	switch tg := g.(type) {
+	case nil:
+		return nil, nil
+	case geom.Point:
+		return geom.Point(fn(tg)), nil
+	case geom.MultiPoint:
+		return geom.MultiPoint(mapLine(tg)), nil
+	case geom.LineString:
+		return geom.LineString(mapLine(tg)), nil
+	case geom.MultiLineString:
+		return geom.MultiLineString(mapLines(tg)), nil
+	case geom.Polygon:
+		return geom.Polygon(mapLines(tg)), nil
+	case geom.MultiPolygon:
+		mp := make(geom.MultiPolygon, len(tg))
+		for i, p := range tg {
+			mp[i] = mapLines(p)
+		}
+		return mp, nil
+	case geom.Collection:
+		c := make(geom.Collection, len(tg))
+		for i, cg := range tg {
+			mg, err := mapPoints(cg, fn)
+			if err != nil {
+				return nil, err
+			}
+			c[i] = mg
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unsupported geometry type: %T", g)
+}
+
+// Smallest extent containing a & b, either may be nil
+func unionExtent(a, b *geom.Extent) *geom.Extent {
+	switch {
+	case a == nil && b == nil:
+		return nil
+	case a == nil:
+		e := *b
+		return &e
+	case b == nil:
+		e := *a
+		return &e
+	}
+	e := *a
+	extendExtent(&e, [2]float64{b[0], b[1]}, [2]float64{b[2], b[3]})
+	return &e
+}
+
+// Whether a & b overlap, a nil extent doesn't intersect anything
+func extentsIntersect(a, b *geom.Extent) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a[0] <= b[2] && a[2] >= b[0] && a[1] <= b[3] && a[3] >= b[1]
+}
+
+// Prototype of the geometry type shared by all of fs' geometries, nil if they're mixed or there are none
+func commonGeometryType(fs []*Feature) geom.Geometry {
+	var gt geom.Geometry
+	for _, f := range fs {
+		if f.Geometry == nil {
+			continue
+		}
+		if gt != nil && reflect.TypeOf(gt) != reflect.TypeOf(f.Geometry) {
+			return nil
+		}
+		gt = f.Geometry
+	}
+	if gt == nil {
+		return nil
+	}
+	return reflect.Zero(reflect.TypeOf(gt)).Interface().(geom.Geometry)
+}
@@ -0,0 +1,431 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project gpkg_querier.go
+
+package data_provider
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/wkb"
+	"github.com/go-spatial/jivan/cql2"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Loads the SpatiaLite extension for spatial predicates & rtree triggers, where it's installed
+const spatialiteDriver = "sqlite3_spatialite"
+
+func init() {
+	sql.Register(spatialiteDriver, &sqlite3.SQLiteDriver{
+		Extensions: []string{"mod_spatialite"},
+		// SpatiaLite functions otherwise give NULL for GeoPackage geometries, i.e. ST_MinX() in the
+		// triggers maintaining rtree indexes
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			_, err := conn.Exec("SELECT EnableGpkgAmphibiousMode()", nil)
+			return err
+		},
+	})
+}
+
+type gpkgDialect struct {
+	// Whether SpatiaLite functions are available
+	spatialite bool
+}
+
+func (_ gpkgDialect) placeholder(n int) string {
+	return "?"
+}
+
+func (_ gpkgDialect) selectGeometry(t *sqlTable) string {
+	return quoteIdent(t.geomColumn)
+}
+
+// GeoPackage geometry blobs are a header followed by standard WKB.
+// @see http://www.geopackage.org/spec/#gpb_format
+func (_ gpkgDialect) decodeGeometry(b []byte) (geom.Geometry, error) {
+	if len(b) < 8 || b[0] != 'G' || b[1] != 'P' {
+		return nil, fmt.Errorf("invalid geopackage geometry header")
+	}
+	flags := b[3]
+	// Envelope contents indicator determines the header size
+	var envelopeSize int
+	switch (flags >> 1) & 0x07 {
+	case 0:
+		envelopeSize = 0
+	case 1:
+		envelopeSize = 32
+	case 2, 3:
+		envelopeSize = 48
+	case 4:
+		envelopeSize = 64
+	default:
+		return nil, fmt.Errorf("invalid geopackage envelope indicator: %v", (flags>>1)&0x07)
+	}
+	headerSize := 8 + envelopeSize
+	if len(b) < headerSize {
+		return nil, fmt.Errorf("geopackage geometry shorter than its header")
+	}
+	return wkb.DecodeBytes(b[headerSize:])
+}
+
+// Uses the rtree index GeoPackage maintains for spatially indexed tables, it's keyed by the
+// table's integer primary key which is also its rowid.
+func (_ gpkgDialect) extentCondition(t *sqlTable, e *geom.Extent, args *sqlArgs) (string, error) {
+	// Without an index or with a projected srs this is left to the tegola provider.
+	if t.rtree == "" || t.srid != 4326 {
+		return "", ErrQueryNotSupported
+	}
+	c := fmt.Sprintf("rowid IN (SELECT id FROM %v WHERE minx <= %v AND maxx >= %v AND miny <= %v AND maxy >= %v)",
+		quoteIdent(t.rtree), args.add(e[2]), args.add(e[0]), args.add(e[3]), args.add(e[1]))
+	return c, nil
+}
+
+// SpatiaLite functions for spatial predicates
+var spatialiteFuncs = map[string]string{
+	cql2.SpatialIntersects: "ST_Intersects",
+	cql2.SpatialDisjoint:   "ST_Disjoint",
+	cql2.SpatialEquals:     "ST_Equals",
+	cql2.SpatialWithin:     "ST_Within",
+	cql2.SpatialContains:   "ST_Contains",
+}
+
+// Uses SpatiaLite on lon/lat tables, w/ the rtree index narrowing down the rows to compare where
+// the table has one.  Without SpatiaLite this is left to the tegola provider.
+func (d gpkgDialect) spatialCondition(t *sqlTable, op string, g geom.Geometry, distance float64, args *sqlArgs) (string, error) {
+	if !d.spatialite || t.srid != 4326 {
+		return "", ErrQueryNotSupported
+	}
+	column := fmt.Sprintf("GeomFromGPB(%v)", quoteIdent(t.geomColumn))
+	lonLat := fmt.Sprintf("GeomFromText(%v, 4326)", args.add(cql2.Geometry{Geometry: g}.String()))
+	if op == cql2.SpatialDWithin {
+		// Meters on the spheroid for lon/lat geometries
+		return fmt.Sprintf("PtDistWithin(%v, %v, %v) = 1", column, lonLat, args.add(distance)), nil
+	}
+	fn, ok := spatialiteFuncs[op]
+	if !ok {
+		return "", ErrQueryNotSupported
+	}
+	c := fmt.Sprintf("%v(%v, %v) = 1", fn, column, lonLat)
+	// Anything but disjoint geometries have intersecting extents
+	if e := geometryExtent(g); t.rtree != "" && op != cql2.SpatialDisjoint && e != nil {
+		ec, err := d.extentCondition(t, e, args)
+		if err != nil {
+			return "", err
+		}
+		c = ec + " AND " + c
+	}
+	return c, nil
+}
+
+// GeoPackage has no KNN index, nearest features are found by the tegola provider
+func (_ gpkgDialect) nearestOrder(t *sqlTable, pt geom.Point, args *sqlArgs) (string, error) {
+	return "", ErrQueryNotSupported
+}
+
+// GeoPackage stores dates & times as ISO 8601 text, julianday() reads these as numbers & gives
+// NULL for anything else.  Columns of other types don't hold times.
+func (_ gpkgDialect) timeValue(t *sqlTable, column string) (string, error) {
+	switch t.kinds[column] {
+	case kindDate, kindString:
+		return fmt.Sprintf("julianday(%v)", quoteIdent(column)), nil
+	}
+	return "NULL", nil
+}
+
+func (_ gpkgDialect) timeArg(tm time.Time, args *sqlArgs) string {
+	return fmt.Sprintf("julianday(%v)", args.add(tm.UTC().Format("2006-01-02T15:04:05.999Z")))
+}
+
+// SQLite's LIKE ignores the case of ASCII letters, GLOB doesn't
+func (_ gpkgDialect) likeCondition(column, pattern string, not bool, args *sqlArgs) string {
+	return fmt.Sprintf("CAST(%v AS TEXT) %vGLOB %v", column, sqlNot(not), args.add(globPattern(pattern)))
+}
+
+// Converts a SQL LIKE pattern w/ '\' as the escape character to a GLOB pattern.  GLOB has no
+// escape character, its wildcards are matched literally as the only character in a bracket
+// expression.  A trailing '\' is literal, as in cqlLikePattern().
+func globPattern(pattern string) string {
+	var gp bytes.Buffer
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case !escaped && r == '\\':
+			escaped = true
+			continue
+		case !escaped && r == '%':
+			gp.WriteRune('*')
+		case !escaped && r == '_':
+			gp.WriteRune('?')
+		case r == '*' || r == '?' || r == '[':
+			gp.WriteString("[" + string(r) + "]")
+		default:
+			gp.WriteRune(r)
+		}
+		escaped = false
+	}
+	if escaped {
+		gp.WriteRune('\\')
+	}
+	return gp.String()
+}
+
+// julianday() values are days since noon UTC on November 24, 4714 BC, rounded to milliseconds
+// here as that's the precision of timeArg()
+func (_ gpkgDialect) scanTime(v interface{}) (time.Time, bool) {
+	jd, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	const unixEpoch = 2440587.5
+	ms := math.Floor((jd-unixEpoch)*86400000 + 0.5)
+	return time.Unix(0, 0).UTC().Add(time.Duration(ms) * time.Millisecond), true
+}
+
+// Geometries are converted to t's srid here, they're stored as little endian geometry blobs w/
+// an xy envelope
+func (_ gpkgDialect) geometryValue(t *sqlTable, g geom.Geometry, srid uint64, args *sqlArgs) (string, error) {
+	if g == nil {
+		return "NULL", nil
+	}
+	tg, err := CRS{URI: sridCRS(t.srid), SRID: t.srid}.transform(g, srid)
+	if err != nil {
+		return "", err
+	}
+	w, err := wkb.EncodeBytes(tg)
+	if err != nil {
+		return "", &BadFeature{msg: fmt.Sprintf("problem encoding geometry: %v", err)}
+	}
+
+	b := make([]byte, 8, 8+32+len(w))
+	b[0], b[1] = 'G', 'P'
+	binary.LittleEndian.PutUint32(b[4:8], uint32(t.srid))
+	if e := geometryExtent(tg); e != nil {
+		b[3] = 1<<1 | 0x01
+		for _, v := range []float64{e[0], e[2], e[1], e[3]} {
+			b = append(b, make([]byte, 8)...)
+			binary.LittleEndian.PutUint64(b[len(b)-8:], math.Float64bits(v))
+		}
+	} else {
+		// Empty w/o an envelope
+		b[3] = 1<<4 | 0x01
+	}
+	return args.add(append(b, w...)), nil
+}
+
+// Features are identified by the table's integer primary key, which is the rowid
+func (_ gpkgDialect) insertRow(ctx context.Context, db *sql.DB, t *sqlTable, stmt string, args []interface{}) (string, error) {
+	if t.customIds {
+		return "", ErrQueryNotSupported
+	}
+	res, err := db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+func (_ gpkgDialect) limitClause(limit, offset uint) string {
+	switch {
+	case limit == 0 && offset == 0:
+		return ""
+	case limit == 0:
+		// sqlite requires a LIMIT for an OFFSET, -1 is unlimited
+		return fmt.Sprintf(" LIMIT -1 OFFSET %d", offset)
+	default:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	}
+}
+
+// Reads the srs_id from the header of the first geometry
+func (_ gpkgDialect) geometrySRID(db *sql.DB, t *sqlTable) (uint64, error) {
+	var b []byte
+	stmt := fmt.Sprintf("SELECT %v FROM %v WHERE %v IS NOT NULL LIMIT 1",
+		quoteIdent(t.geomColumn), t.qualifiedName, quoteIdent(t.geomColumn))
+	err := db.QueryRow(stmt).Scan(&b)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(b) < 8 || b[0] != 'G' || b[1] != 'P' {
+		return 0, fmt.Errorf("invalid geopackage geometry header")
+	}
+	// Byte order flag
+	if b[3]&0x01 == 1 {
+		return uint64(binary.LittleEndian.Uint32(b[4:8])), nil
+	}
+	return uint64(binary.BigEndian.Uint32(b[4:8])), nil
+}
+
+// The extent recorded in gpkg_contents, this is informative only but as good as we can do w/o
+// reading all of t's geometries.
+func (_ gpkgDialect) extent(ctx context.Context, db *sql.DB, t *sqlTable) (*geom.Extent, error) {
+	if t.contentsExtent == nil {
+		return nil, ErrQueryNotSupported
+	}
+	e := *t.contentsExtent
+	return &e, nil
+}
+
+// Creates a Querier for the GeoPackage at gpkgPath, serving each feature table listed in
+// gpkg_geometry_columns as a collection of the same name.  The file is only opened for writing
+// if writable is set, writes fail otherwise.
+func NewGpkgQuerier(gpkgPath string, writable bool) (Querier, error) {
+	dsn := fmt.Sprintf("file:%v?mode=ro", gpkgPath)
+	if writable {
+		dsn = fmt.Sprintf("file:%v?mode=rw", gpkgPath)
+	}
+	// Spatial predicates are applied in memory w/o SpatiaLite
+	dialect := gpkgDialect{spatialite: true}
+	db, err := sql.Open(spatialiteDriver, dsn)
+	if err == nil {
+		// The extension is loaded on connecting
+		err = db.Ping()
+	}
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		log.Printf("SpatiaLite isn't available for '%v', spatial filters are applied in memory: %v", gpkgPath, err)
+		dialect.spatialite = false
+		if db, err = sql.Open("sqlite3", dsn); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT g.table_name, g.column_name, g.srs_id, c.identifier, c.description, c.min_x, c.min_y, c.max_x, c.max_y
+		FROM gpkg_geometry_columns g
+		LEFT JOIN gpkg_contents c ON c.table_name = g.table_name`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	tables := make(map[string]*sqlTable)
+	for rows.Next() {
+		t := &sqlTable{}
+		var srid int64
+		var title, description sql.NullString
+		var minx, miny, maxx, maxy sql.NullFloat64
+		err := rows.Scan(&t.name, &t.geomColumn, &srid, &title, &description, &minx, &miny, &maxx, &maxy)
+		if err != nil {
+			rows.Close()
+			db.Close()
+			return nil, err
+		}
+		t.srid = uint64(srid)
+		t.title = title.String
+		t.description = description.String
+		if minx.Valid && miny.Valid && maxx.Valid && maxy.Valid {
+			t.contentsExtent = &geom.Extent{minx.Float64, miny.Float64, maxx.Float64, maxy.Float64}
+		}
+		t.qualifiedName = quoteIdent(t.name)
+		tables[t.name] = t
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	for name, t := range tables {
+		if err := gpkgTableColumns(db, t); err != nil {
+			log.Printf("skipping direct queries for '%v': %v", name, err)
+			delete(tables, name)
+			continue
+		}
+
+		rtree := fmt.Sprintf("rtree_%v_%v", t.name, t.geomColumn)
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", rtree).Scan(&count)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		if count > 0 {
+			t.rtree = rtree
+		}
+	}
+
+	return &sqlQuerier{db: db, dialect: dialect, tables: tables}, nil
+}
+
+// Fills in t's id & property columns from the table definition
+func gpkgTableColumns(db *sql.DB, t *sqlTable) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%v)", t.qualifiedName))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	t.kinds = make(map[string]int)
+	// Primary key columns keyed by their position in the key
+	pks := make(map[int]string)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, ctype string
+		var dflt interface{}
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		switch {
+		case pk > 0:
+			pks[pk] = name
+			t.kinds[name] = sqlTypeKind(ctype)
+		case name == t.geomColumn:
+		default:
+			t.columns = append(t.columns, name)
+			t.kinds[name] = sqlTypeKind(ctype)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(pks) == 0 {
+		return fmt.Errorf("no primary key")
+	}
+	for i := 1; i <= len(pks); i++ {
+		t.idColumns = append(t.idColumns, pks[i])
+	}
+	t.pkColumns = t.idColumns
+	t.customIds = len(t.idColumns) != 1 || t.kinds[t.idColumns[0]] != kindInteger
+	return nil
+}
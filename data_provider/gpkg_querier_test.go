@@ -0,0 +1,269 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project gpkg_querier_test.go
+
+package data_provider
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/jivan/cql2"
+)
+
+// A GeoPackage w/ a point table spatially indexed by an rtree, maintained by triggers as in the
+// GeoPackage spec's RTree Spatial Indexes extension
+var rtreeGpkgStmts = []string{
+	`CREATE TABLE gpkg_contents (table_name TEXT NOT NULL PRIMARY KEY, data_type TEXT NOT NULL,
+		identifier TEXT UNIQUE, description TEXT DEFAULT '', last_change DATETIME,
+		min_x DOUBLE, min_y DOUBLE, max_x DOUBLE, max_y DOUBLE, srs_id INTEGER)`,
+	`CREATE TABLE gpkg_geometry_columns (table_name TEXT NOT NULL, column_name TEXT NOT NULL,
+		geometry_type_name TEXT NOT NULL, srs_id INTEGER NOT NULL, z TINYINT NOT NULL, m TINYINT NOT NULL)`,
+	`CREATE TABLE sites (fid INTEGER PRIMARY KEY AUTOINCREMENT, geom POINT, name TEXT, visits INTEGER)`,
+	`INSERT INTO gpkg_contents (table_name, data_type, identifier, srs_id) VALUES ('sites', 'features', 'sites', 4326)`,
+	`INSERT INTO gpkg_geometry_columns VALUES ('sites', 'geom', 'POINT', 4326, 0, 0)`,
+	`CREATE VIRTUAL TABLE rtree_sites_geom USING rtree(id, minx, maxx, miny, maxy)`,
+	`CREATE TRIGGER rtree_sites_geom_insert AFTER INSERT ON sites
+		WHEN (NEW.geom NOT NULL AND NOT ST_IsEmpty(NEW.geom))
+		BEGIN
+			INSERT OR REPLACE INTO rtree_sites_geom VALUES (NEW.fid,
+				ST_MinX(NEW.geom), ST_MaxX(NEW.geom), ST_MinY(NEW.geom), ST_MaxY(NEW.geom));
+		END`,
+	`CREATE TRIGGER rtree_sites_geom_update1 AFTER UPDATE OF geom ON sites
+		WHEN OLD.fid = NEW.fid AND (NEW.geom NOT NULL AND NOT ST_IsEmpty(NEW.geom))
+		BEGIN
+			INSERT OR REPLACE INTO rtree_sites_geom VALUES (NEW.fid,
+				ST_MinX(NEW.geom), ST_MaxX(NEW.geom), ST_MinY(NEW.geom), ST_MaxY(NEW.geom));
+		END`,
+	`CREATE TRIGGER rtree_sites_geom_update2 AFTER UPDATE OF geom ON sites
+		WHEN OLD.fid = NEW.fid AND (NEW.geom IS NULL OR ST_IsEmpty(NEW.geom))
+		BEGIN
+			DELETE FROM rtree_sites_geom WHERE id = OLD.fid;
+		END`,
+	`CREATE TRIGGER rtree_sites_geom_delete AFTER DELETE ON sites
+		WHEN OLD.geom NOT NULL
+		BEGIN
+			DELETE FROM rtree_sites_geom WHERE id = OLD.fid;
+		END`,
+}
+
+// Writes to an rtree indexed table go through its triggers, which need SpatiaLite
+func TestGpkgWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jivan")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(dir)
+	gpkgPath := path.Join(dir, "sites.gpkg")
+
+	db, err := sql.Open(spatialiteDriver, "file:"+gpkgPath)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		t.Skipf("SpatiaLite isn't available: %v", err)
+	}
+	for _, stmt := range rtreeGpkgStmts {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			t.Fatalf("problem creating GeoPackage: %v", err)
+		}
+	}
+	db.Close()
+
+	ctx := context.Background()
+	ro, err := NewGpkgQuerier(gpkgPath, false)
+	if err != nil {
+		t.Fatalf("NewGpkgQuerier(): %v", err)
+	}
+	if _, err := ro.(FeatureWriter).CreateFeature(ctx, "sites", &Feature{Geometry: geom.Point{23.7, 37.9}, SRID: 4326}); err == nil {
+		t.Errorf("expected an error writing to a GeoPackage that isn't writable")
+	}
+
+	q, err := NewGpkgQuerier(gpkgPath, true)
+	if err != nil {
+		t.Fatalf("NewGpkgQuerier(): %v", err)
+	}
+	fw := q.(FeatureWriter)
+	// The ids of the sites found by the rtree within e
+	indexed := func(e geom.Extent) []string {
+		fs, err := q.QueryFeatures(ctx, Query{Collection: "sites", Extent: &e})
+		if err != nil {
+			t.Fatalf("QueryFeatures(): %v", err)
+		}
+		var ids []string
+		for _, f := range fs {
+			ids = append(ids, f.ID)
+		}
+		return ids
+	}
+	athens := geom.Extent{23.6, 37.8, 23.8, 38.0}
+	thessaloniki := geom.Extent{22.8, 40.5, 23.0, 40.7}
+
+	id, err := fw.CreateFeature(ctx, "sites", &Feature{Geometry: geom.Point{23.7, 37.9}, SRID: 4326,
+		Properties: map[string]interface{}{"name": "Acropolis", "visits": int64(3)}})
+	if err != nil {
+		t.Fatalf("CreateFeature(): %v", err)
+	}
+	if ids := indexed(athens); len(ids) != 1 || ids[0] != id {
+		t.Errorf("got %v in Athens after creating %v, wanted it indexed", ids, id)
+	}
+
+	// Replacing the geometry moves the feature in the index
+	err = fw.ReplaceFeature(ctx, "sites", id, &Feature{Geometry: geom.Point{22.9, 40.6}, SRID: 4326,
+		Properties: map[string]interface{}{"name": "White Tower"}})
+	if err != nil {
+		t.Fatalf("ReplaceFeature(): %v", err)
+	}
+	if ids := indexed(athens); len(ids) != 0 {
+		t.Errorf("got %v in Athens after moving %v, wanted none", ids, id)
+	}
+	if ids := indexed(thessaloniki); len(ids) != 1 || ids[0] != id {
+		t.Errorf("got %v in Thessaloniki after moving %v, wanted it indexed", ids, id)
+	}
+	fs, err := q.(FeatureGetter).GetFeatures(ctx, "sites", []string{id})
+	if err != nil || len(fs) != 1 {
+		t.Fatalf("GetFeatures() got %v features, %v, wanted %v", len(fs), err, id)
+	}
+	if fs[0].Properties["name"] != "White Tower" || fs[0].Properties["visits"] != nil {
+		t.Errorf("got properties %v after replacing them, wanted the White Tower w/o visits", fs[0].Properties)
+	}
+
+	// Updating only a property leaves the geometry & its index entry as they are
+	if err := fw.ReplaceFeature(ctx, "sites", id, &Feature{Geometry: fs[0].Geometry, SRID: fs[0].SRID,
+		Properties: map[string]interface{}{"name": "White Tower", "visits": int64(8)}}); err != nil {
+		t.Fatalf("ReplaceFeature(): %v", err)
+	}
+	if ids := indexed(thessaloniki); len(ids) != 1 || ids[0] != id {
+		t.Errorf("got %v in Thessaloniki after updating %v, wanted it indexed", ids, id)
+	}
+
+	if err := fw.DeleteFeature(ctx, "sites", id); err != nil {
+		t.Fatalf("DeleteFeature(): %v", err)
+	}
+	if ids := indexed(thessaloniki); len(ids) != 0 {
+		t.Errorf("got %v in Thessaloniki after deleting %v, wanted none", ids, id)
+	}
+	if err := fw.DeleteFeature(ctx, "sites", id); err != ErrFeatureNotFound {
+		t.Errorf("got %v deleting %v again, wanted ErrFeatureNotFound", err, id)
+	}
+}
+
+func TestGlobPattern(t *testing.T) {
+	cases := map[string]string{
+		"Main%":      "Main*",
+		`Main\_St`:   "Main_St",
+		"Main_St":    "Main?St",
+		`50\%*?[`:    "50%[*][?][[]",
+		`back\\sl\`:  `back\sl\`,
+		"Main St]":   "Main St]",
+		`\%\_\\%_%_`: `%_\*?*?`,
+	}
+	for pattern, expected := range cases {
+		if got := globPattern(pattern); got != expected {
+			t.Errorf("globPattern(%q) == %q, wanted %q", pattern, got, expected)
+		}
+	}
+}
+
+// LIKE filters match the same features in SQL as in memory, case-sensitively w/ literal wildcards
+func TestGpkgLike(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jivan")
+	if err != nil {
+		t.Fatalf("TempDir(): %v", err)
+	}
+	defer os.RemoveAll(dir)
+	gpkgPath := path.Join(dir, "sites.gpkg")
+
+	db, err := sql.Open("sqlite3", "file:"+gpkgPath)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		t.Skipf("SQLite isn't available: %v", err)
+	}
+	// The tables of rtreeGpkgStmts w/o the rtree
+	for _, stmt := range rtreeGpkgStmts[:5] {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			t.Fatalf("problem creating GeoPackage: %v", err)
+		}
+	}
+	names := []string{"Main St", "main st", "MAIN ST", "Main_St", "Main%St", "Main*St", "Main?St", "Main[St]", `Main\St`, "Mainz"}
+	for _, name := range names {
+		if _, err := db.Exec("INSERT INTO sites (name) VALUES (?)", name); err != nil {
+			db.Close()
+			t.Fatalf("problem adding '%v': %v", name, err)
+		}
+	}
+	db.Close()
+
+	q, err := NewGpkgQuerier(gpkgPath, false)
+	if err != nil {
+		t.Fatalf("NewGpkgQuerier(): %v", err)
+	}
+	ctx := context.Background()
+	sel := Selection{SkipGeometry: true}
+	all, err := q.QueryFeatures(ctx, Query{Collection: "sites", Select: sel})
+	if err != nil || len(all) != len(names) {
+		t.Fatalf("QueryFeatures() got %v features, %v, wanted %v", len(all), err, len(names))
+	}
+
+	queries := make([]Query, 0, 20)
+	for _, pattern := range []string{"Main*", "main*", "Main_St", "Main%St", `Main\*St`, "Main?St", "Main[St]", `Main\\St`, "*St", "M*n*"} {
+		queries = append(queries, Query{Filters: []PropertyFilter{{Property: "name", Op: OpLike, Values: []string{pattern}}}})
+	}
+	for _, filter := range []string{"name LIKE 'Main%'", "name LIKE 'main%'", "name LIKE 'Main_St'", `name LIKE 'Main\_St'`,
+		`name LIKE 'Main\%St'`, "name LIKE 'Main*St'", "name LIKE 'Main?St'", "name LIKE 'Main[St]'", `name LIKE 'Main\\St'`,
+		"name NOT LIKE '%St'", "name LIKE 'M%n_'"} {
+		e, err := cql2.ParseText(filter)
+		if err != nil {
+			t.Fatalf("ParseText(%v): %v", filter, err)
+		}
+		queries = append(queries, Query{Filter: e})
+	}
+	for i, fq := range queries {
+		fq.Collection, fq.Select = "sites", sel
+		fs, err := q.QueryFeatures(ctx, fq)
+		if err != nil {
+			t.Errorf("[%v] QueryFeatures(): %v", i, err)
+			continue
+		}
+		mfs, err := matchingFeatures(ctx, all, fq)
+		if err != nil {
+			t.Fatalf("[%v] matchingFeatures(): %v", i, err)
+		}
+		if ids, expected := featureIds(fs), featureIds(mfs); !reflect.DeepEqual(ids, expected) {
+			t.Errorf("[%v] got %v in SQL, %v in memory", i, ids, expected)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project multi_source.go
+
+package data_provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-spatial/geom"
+)
+
+// Separates a source's name from its collection names in the collection names of a MultiSource
+const SourceSeparator = "."
+
+// Serves the collections of several named FeatureSources together.  Collections are named
+// "<source name>.<collection name>" so names from different sources can't collide.
+type MultiSource struct {
+	sources map[string]FeatureSource
+}
+
+func NewMultiSource() *MultiSource {
+	return &MultiSource{sources: make(map[string]FeatureSource)}
+}
+
+// Adds source's collections under name, which must be unique & not contain SourceSeparator
+func (ms *MultiSource) Add(name string, source FeatureSource) error {
+	if name == "" || strings.Contains(name, SourceSeparator) {
+		return fmt.Errorf("invalid source name '%v', names must be non-empty & not contain '%v'", name, SourceSeparator)
+	}
+	if _, ok := ms.sources[name]; ok {
+		return fmt.Errorf("duplicate source name '%v'", name)
+	}
+	ms.sources[name] = source
+	return nil
+}
+
+// The source serving collection along w/ the collection's name in that source
+func (ms *MultiSource) route(collection string) (FeatureSource, string, error) {
+	parts := strings.SplitN(collection, SourceSeparator, 2)
+	if len(parts) == 2 {
+		if s, ok := ms.sources[parts[0]]; ok {
+			return s, parts[1], nil
+		}
+	}
+	return nil, "", fmt.Errorf("Invalid collection name: %v", collection)
+}
+
+func (ms *MultiSource) CollectionNames() ([]string, error) {
+	names := make([]string, 0, 10)
+	for sName, s := range ms.sources {
+		cNames, err := s.CollectionNames()
+		if err != nil {
+			return nil, fmt.Errorf("problem getting collection names from '%v': %v", sName, err)
+		}
+		for _, cName := range cNames {
+			names = append(names, sName+SourceSeparator+cName)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (ms *MultiSource) CollectionSchema(collection string) (*CollectionSchema, error) {
+	s, cName, err := ms.route(collection)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := s.CollectionSchema(cName)
+	if err != nil {
+		return nil, err
+	}
+
+	nsCs := *cs
+	nsCs.Name = collection
+	return &nsCs, nil
+}
+
+func (ms *MultiSource) QueryFeatures(ctx context.Context, q Query) ([]*Feature, error) {
+	s, cName, err := ms.route(q.Collection)
+	if err != nil {
+		return nil, err
+	}
+	q.Collection = cName
+	return s.QueryFeatures(ctx, q)
+}
+
+func (ms *MultiSource) CountFeatures(ctx context.Context, q Query) (uint, error) {
+	s, cName, err := ms.route(q.Collection)
+	if err != nil {
+		return 0, err
+	}
+	q.Collection = cName
+	return s.CountFeatures(ctx, q)
+}
+
+func (ms *MultiSource) GetFeatures(ctx context.Context, collection string, ids []string) ([]*Feature, error) {
+	s, cName, err := ms.route(collection)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetFeatures(ctx, cName, ids)
+}
+
+func (ms *MultiSource) CollectionExtent(ctx context.Context, collection string) (*geom.Extent, error) {
+	s, cName, err := ms.route(collection)
+	if err != nil {
+		return nil, err
+	}
+	return s.CollectionExtent(ctx, cName)
+}
+
+func (ms *MultiSource) TemporalExtent(ctx context.Context, collection string, tp TemporalProperties) (*TimeInterval, error) {
+	s, cName, err := ms.route(collection)
+	if err != nil {
+		return nil, err
+	}
+	teg, ok := s.(TemporalExtentGetter)
+	if !ok {
+		return nil, ErrQueryNotSupported
+	}
+	return teg.TemporalExtent(ctx, cName, tp)
+}
+
+// Writes go to sources implementing FeatureWriter, collections of others are read-only
+func (ms *MultiSource) CreateFeature(ctx context.Context, collection string, f *Feature) (string, error) {
+	s, cName, err := ms.route(collection)
+	if err != nil {
+		return "", err
+	}
+	fw, ok := s.(FeatureWriter)
+	if !ok {
+		return "", ErrQueryNotSupported
+	}
+	return fw.CreateFeature(ctx, cName, f)
+}
+
+func (ms *MultiSource) ReplaceFeature(ctx context.Context, collection, id string, f *Feature) error {
+	s, cName, err := ms.route(collection)
+	if err != nil {
+		return err
+	}
+	fw, ok := s.(FeatureWriter)
+	if !ok {
+		return ErrQueryNotSupported
+	}
+	return fw.ReplaceFeature(ctx, cName, id, f)
+}
+
+func (ms *MultiSource) DeleteFeature(ctx context.Context, collection, id string) error {
+	s, cName, err := ms.route(collection)
+	if err != nil {
+		return err
+	}
+	fw, ok := s.(FeatureWriter)
+	if !ok {
+		return ErrQueryNotSupported
+	}
+	return fw.DeleteFeature(ctx, cName, id)
+}
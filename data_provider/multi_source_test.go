@@ -0,0 +1,72 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+package data_provider
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestMultiSource(t *testing.T) {
+	ms := NewMultiSource()
+	for _, name := range []string{"csv", "geojson"} {
+		fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), name), FileOptions{})
+		if err != nil {
+			t.Fatalf("NewFileSource(): %v", err)
+		}
+		if err := ms.Add(name, fs); err != nil {
+			t.Fatalf("Add(): %v", err)
+		}
+	}
+	if err := ms.Add("csv", &FileSource{}); err == nil {
+		t.Errorf("expected an error adding a duplicate source name")
+	}
+	if err := ms.Add("my.source", &FileSource{}); err == nil {
+		t.Errorf("expected an error adding a source name w/ a separator")
+	}
+
+	names, err := ms.CollectionNames()
+	expected := []string{"csv.parcels", "csv.sites", "geojson.roads"}
+	if err != nil || !reflect.DeepEqual(names, expected) {
+		t.Errorf("CollectionNames() == %v, %v, wanted %v", names, err, expected)
+	}
+
+	fs, err := ms.QueryFeatures(context.Background(), Query{Collection: "geojson.roads", Filters: []PropertyFilter{{Property: "kind", Op: OpEqual, Values: []string{"primary"}}}})
+	if err != nil || len(fs) != 1 || fs[0].ID != "10" {
+		t.Errorf("QueryFeatures() got %v features, %v, wanted feature 10", len(fs), err)
+	}
+	cs, err := ms.CollectionSchema("csv.sites")
+	if err != nil || cs.Name != "csv.sites" {
+		t.Errorf("CollectionSchema() == %v, %v, wanted the schema of 'csv.sites'", cs, err)
+	}
+	for _, name := range []string{"roads", "other.roads", "geojson.other"} {
+		if _, err := ms.GetFeatures(context.Background(), name, []string{"10"}); err == nil {
+			t.Errorf("expected an error for collection '%v'", name)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project postgis_querier.go
+
+package data_provider
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/wkb"
+	"github.com/go-spatial/jivan/cql2"
+	_ "github.com/jackc/pgx/stdlib"
+)
+
+type postgisDialect struct{}
+
+func (_ postgisDialect) placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (_ postgisDialect) selectGeometry(t *sqlTable) string {
+	return fmt.Sprintf("ST_AsBinary(%v)", quoteIdent(t.geomColumn))
+}
+
+func (_ postgisDialect) decodeGeometry(b []byte) (geom.Geometry, error) {
+	return wkb.DecodeBytes(b)
+}
+
+// Uses the && (bounding box intersection) operator so the table's spatial index can be used.
+func (_ postgisDialect) extentCondition(t *sqlTable, e *geom.Extent, args *sqlArgs) (string, error) {
+	envelope := fmt.Sprintf("ST_MakeEnvelope(%v, %v, %v, %v, 4326)", args.add(e[0]), args.add(e[1]), args.add(e[2]), args.add(e[3]))
+	if t.srid != 4326 {
+		envelope = fmt.Sprintf("ST_Transform(%v, %d)", envelope, t.srid)
+	}
+	return fmt.Sprintf("%v && %v", quoteIdent(t.geomColumn), envelope), nil
+}
+
+// PostGIS functions for spatial predicates
+var postgisSpatialFuncs = map[string]string{
+	cql2.SpatialIntersects: "ST_Intersects",
+	cql2.SpatialDisjoint:   "ST_Disjoint",
+	cql2.SpatialEquals:     "ST_Equals",
+	cql2.SpatialWithin:     "ST_Within",
+	cql2.SpatialContains:   "ST_Contains",
+}
+
+// Distances are measured on the spheroid through geography, other predicates use the table's
+// spatial index.
+func (_ postgisDialect) spatialCondition(t *sqlTable, op string, g geom.Geometry, distance float64, args *sqlArgs) (string, error) {
+	// Geometries of an unknown srid can't be compared w/ lon/lat
+	if t.srid == 0 {
+		return "", ErrQueryNotSupported
+	}
+	lonLat := fmt.Sprintf("ST_GeomFromText(%v, 4326)", args.add(cql2.Geometry{Geometry: g}.String()))
+	if op == cql2.SpatialDWithin {
+		column := quoteIdent(t.geomColumn)
+		if t.srid != 4326 {
+			column = fmt.Sprintf("ST_Transform(%v, 4326)", column)
+		}
+		return fmt.Sprintf("ST_DWithin(%v::geography, %v::geography, %v)", column, lonLat, args.add(distance)), nil
+	}
+	fn, ok := postgisSpatialFuncs[op]
+	if !ok {
+		return "", ErrQueryNotSupported
+	}
+	if t.srid != 4326 {
+		lonLat = fmt.Sprintf("ST_Transform(%v, %d)", lonLat, t.srid)
+	}
+	return fmt.Sprintf("%v(%v, %v)", fn, quoteIdent(t.geomColumn), lonLat), nil
+}
+
+// Uses the <-> KNN operator on geographies, distances along great circles, which is helped by a
+// spatial index on the geography of t's geometries where there is one.
+func (_ postgisDialect) nearestOrder(t *sqlTable, pt geom.Point, args *sqlArgs) (string, error) {
+	if t.srid == 0 {
+		return "", ErrQueryNotSupported
+	}
+	column := quoteIdent(t.geomColumn)
+	if t.srid != 4326 {
+		column = fmt.Sprintf("ST_Transform(%v, 4326)", column)
+	}
+	// NULL distances sort last
+	return fmt.Sprintf("%v::geography <-> ST_SetSRID(ST_MakePoint(%v, %v), 4326)::geography",
+		column, args.add(pt[0]), args.add(pt[1])), nil
+}
+
+// Date & timestamp columns compare w/ timestamptz, those w/o a time zone are taken to be in
+// the session's time zone.  Times held as text aren't compared in SQL as they may not parse.
+func (_ postgisDialect) timeValue(t *sqlTable, column string) (string, error) {
+	switch t.kinds[column] {
+	case kindDate:
+		return quoteIdent(column), nil
+	case kindString:
+		return "", ErrQueryNotSupported
+	}
+	return "NULL", nil
+}
+
+func (_ postgisDialect) timeArg(tm time.Time, args *sqlArgs) string {
+	return fmt.Sprintf("CAST(%v AS timestamptz)", args.add(tm))
+}
+
+func (_ postgisDialect) likeCondition(column, pattern string, not bool, args *sqlArgs) string {
+	return fmt.Sprintf(`CAST(%v AS TEXT) %vLIKE %v ESCAPE '\'`, column, sqlNot(not), args.add(pattern))
+}
+
+func (_ postgisDialect) scanTime(v interface{}) (time.Time, bool) {
+	return timeValue(v)
+}
+
+func (_ postgisDialect) geometryValue(t *sqlTable, g geom.Geometry, srid uint64, args *sqlArgs) (string, error) {
+	if g == nil {
+		return "NULL", nil
+	}
+	b, err := wkb.EncodeBytes(g)
+	if err != nil {
+		return "", &BadFeature{msg: fmt.Sprintf("problem encoding geometry: %v", err)}
+	}
+	v := fmt.Sprintf("ST_GeomFromWKB(%v, %d)", args.add(b), srid)
+	if t.srid != 0 && t.srid != srid {
+		v = fmt.Sprintf("ST_Transform(%v, %d)", v, t.srid)
+	}
+	return v, nil
+}
+
+// Any id columns w/ defaults are filled in, i.e. serial or uuid primary keys
+func (_ postgisDialect) insertRow(ctx context.Context, db *sql.DB, t *sqlTable, stmt string, args []interface{}) (string, error) {
+	vals := make([]interface{}, len(t.idColumns))
+	valPtrs := make([]interface{}, len(vals))
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+	if err := db.QueryRowContext(ctx, stmt+" RETURNING "+t.idOrder(), args...).Scan(valPtrs...); err != nil {
+		return "", err
+	}
+	return t.featureId(vals)
+}
+
+func (_ postgisDialect) limitClause(limit, offset uint) string {
+	switch {
+	case limit == 0 && offset == 0:
+		return ""
+	case limit == 0:
+		return fmt.Sprintf(" OFFSET %d", offset)
+	default:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	}
+}
+
+func (_ postgisDialect) geometrySRID(db *sql.DB, t *sqlTable) (uint64, error) {
+	var srid int64
+	stmt := fmt.Sprintf("SELECT ST_SRID(%v) FROM %v WHERE %v IS NOT NULL LIMIT 1",
+		quoteIdent(t.geomColumn), t.qualifiedName, quoteIdent(t.geomColumn))
+	err := db.QueryRow(stmt).Scan(&srid)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return uint64(srid), err
+}
+
+// Uses ST_Extent(), which reads the bounding boxes of t's geometries only
+func (_ postgisDialect) extent(ctx context.Context, db *sql.DB, t *sqlTable) (*geom.Extent, error) {
+	var minx, miny, maxx, maxy sql.NullFloat64
+	stmt := fmt.Sprintf("SELECT ST_XMin(e), ST_YMin(e), ST_XMax(e), ST_YMax(e) FROM (SELECT ST_Extent(%v) AS e FROM %v) AS x",
+		quoteIdent(t.geomColumn), t.qualifiedName)
+	if err := db.QueryRowContext(ctx, stmt).Scan(&minx, &miny, &maxx, &maxy); err != nil {
+		return nil, err
+	}
+	// NULL for an empty table
+	if !minx.Valid {
+		return nil, nil
+	}
+	return &geom.Extent{minx.Float64, miny.Float64, maxx.Float64, maxy.Float64}, nil
+}
+
+// Creates a Querier for the PostGIS database described by connStr, serving each table listed in
+// geometry_columns with a primary key as a collection named for the table.
+func NewPostGISQuerier(connStr string) (Querier, error) {
+	db, err := sql.Open("pgx", connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT f_table_schema, f_table_name, f_geometry_column, srid FROM geometry_columns")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	tables := make(map[string]*sqlTable)
+	schemas := make(map[string]string)
+	for rows.Next() {
+		t := &sqlTable{}
+		var schema string
+		var srid int64
+		if err := rows.Scan(&schema, &t.name, &t.geomColumn, &srid); err != nil {
+			rows.Close()
+			db.Close()
+			return nil, err
+		}
+		if _, ok := tables[t.name]; ok {
+			log.Printf("table name '%v' found in multiple schemas, using '%v'", t.name, schemas[t.name])
+			continue
+		}
+		t.srid = uint64(srid)
+		t.qualifiedName = fmt.Sprintf("%v.%v", quoteIdent(schema), quoteIdent(t.name))
+		tables[t.name] = t
+		schemas[t.name] = schema
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	for name, t := range tables {
+		if err := postgisTableColumns(db, schemas[name], t); err != nil {
+			log.Printf("skipping direct queries for '%v': %v", name, err)
+			delete(tables, name)
+		}
+	}
+
+	return &sqlQuerier{db: db, dialect: postgisDialect{}, tables: tables}, nil
+}
+
+// Selects the primary key columns of table $1 in the order of the key, which may differ from the
+// order of the columns
+const postgisPrimaryKeyStmt = `
+		SELECT a.attname
+		FROM pg_index i
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE i.indrelid = $1::regclass AND i.indisprimary
+		ORDER BY array_position(i.indkey::int2[], a.attnum)`
+
+// Fills in t's id & property columns from the table definition
+func postgisTableColumns(db *sql.DB, schema string, t *sqlTable) error {
+	rows, err := db.Query(postgisPrimaryKeyStmt, t.qualifiedName)
+	if err != nil {
+		return err
+	}
+	var pks []string
+	for rows.Next() {
+		var pk string
+		if err := rows.Scan(&pk); err != nil {
+			rows.Close()
+			return err
+		}
+		pks = append(pks, pk)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(pks) == 0 {
+		return fmt.Errorf("no primary key")
+	}
+	t.idColumns = pks
+	t.pkColumns = pks
+
+	colStmt := `
+		SELECT column_name, data_type
+		FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2
+		ORDER BY ordinal_position`
+	rows, err = db.Query(colStmt, schema, t.name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	t.kinds = make(map[string]int)
+	for rows.Next() {
+		var name, dataType string
+		if err := rows.Scan(&name, &dataType); err != nil {
+			return err
+		}
+		if name == t.geomColumn {
+			continue
+		}
+		t.kinds[name] = sqlTypeKind(dataType)
+		if !t.isIdColumn(name) {
+			t.columns = append(t.columns, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	t.customIds = len(t.idColumns) != 1 || t.kinds[t.idColumns[0]] != kindInteger
+	return nil
+}
@@ -27,18 +27,24 @@
 
 package data_provider
 
-// Builds upon the tegola Tiler interface to reuse data providers from tegola.
+// Serves collections from a FeatureSource, adding temporary collections built from the
+// features of others.
 // Instantiate by:
-//	p := Provider{Tiler: <my Tiler-based provider>}
+//	p := Provider{Source: <my FeatureSource>}
+// e.g. for a tegola Tiler-based provider:
+//	p := Provider{Source: &TilerSource{Tiler: <my Tiler-based provider>}}
 
 import (
 	"context"
 	"fmt"
+	"log"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-spatial/geom"
-	prv "github.com/go-spatial/tegola/provider"
+	"github.com/go-spatial/jivan/cql2"
 )
 
 type BadTimeString struct {
@@ -49,65 +55,60 @@ func (bts *BadTimeString) Error() string {
 	return bts.msg
 }
 
-type EmptyTile struct {
-	extent *geom.Extent
-	srid   uint64
-}
-
-func (_ EmptyTile) ZXY() (uint, uint, uint) {
-	return 0, 0, 0
+type Provider struct {
+	Source FeatureSource
+	// Properties time filters are applied to keyed by collection name, collections not listed
+	// use "timestamp", "start_time" & "stop_time"
+	TemporalProperties map[string]TemporalProperties
+	// Limits for temporary collections, see the Default* values for those left 0.  Temporary
+	// collections not accessed for TempCollectionTTL are dropped, as are the least recently
+	// accessed ones to keep within MaxTempCollections & MaxTempFeatures in total.
+	TempCollectionTTL  time.Duration
+	MaxTempCollections int
+	MaxTempFeatures    int
+	tempCollections    *tempCollectionStore
+	// How long collection extents are cached for, DefaultExtentCacheTTL if 0
+	ExtentCacheTTL time.Duration
+	extents        *extentCache
+	revisionCounts *revisionCounter
 }
 
-func (et EmptyTile) Extent() (extent *geom.Extent, srid uint64) {
-	if et.extent == nil {
-		max := 20037508.34
-		et.srid = 3857
-		et.extent = &geom.Extent{-max, -max, max, max}
-	}
-	return et.extent, et.srid
-}
+// Guards the creation of Provider.tempCollections, Provider.extents & Provider.revisionCounts
+var providerInitMutex sync.Mutex
 
-func (et EmptyTile) BufferedExtent() (extent *geom.Extent, srid uint64) {
-	if et.extent == nil {
-		max := 20037508.34
-		et.srid = 3857
-		et.extent = &geom.Extent{-max, -max, max, max}
+func (p *Provider) temps() *tempCollectionStore {
+	providerInitMutex.Lock()
+	defer providerInitMutex.Unlock()
+	if p.tempCollections == nil {
+		p.tempCollections = newTempCollectionStore(p.TempCollectionTTL, p.MaxTempCollections, p.MaxTempFeatures)
 	}
-	return et.extent, et.srid
-}
-
-type ErrDuplicateCollectionName struct {
-	name string
-}
-
-func (e ErrDuplicateCollectionName) Error() string {
-	return fmt.Sprintf("collection name '%v' already in use", e.name)
-}
-
-type tempCollection struct {
-	lastAccess time.Time
-	featureIds []FeatureId
-}
-
-type Provider struct {
-	Tiler           prv.Tiler
-	tempCollections map[string]*tempCollection
+	return p.tempCollections
 }
 
 type FeatureId struct {
 	Collection string
-	FeaturePk  uint64
+	// The feature's id within its collection, see Feature.ID
+	FeaturePk string
 }
 
 func parse_time_string(ts string) (t time.Time, err error) {
+	// RFC3339 parsing accepts fractional seconds w/o them in the layout.  Times w/o a zone are UTC.
 	fmtstrings := []string{
+		time.RFC3339,
 		"2006-01-02T15:04:05Z-0700",
+		"2006-01-02T15:04:05-0700",
 		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04",
 		"2006-01-02",
 	}
 
+	// ISO 8601 allows lower case 't' & 'z'
+	uts := strings.ToUpper(strings.TrimSpace(ts))
 	for _, fmts := range fmtstrings {
-		t, err = time.Parse(fmts, ts)
+		t, err = time.Parse(fmts, uts)
 		if err == nil {
 			return t, nil
 		}
@@ -115,123 +116,41 @@ func parse_time_string(ts string) (t time.Time, err error) {
 	return time.Time{}, &BadTimeString{msg: fmt.Sprintf("unable to parse time string: '%v'", ts)}
 }
 
-// Checks for any intersection of start_time - stop_time period or timestamp value
-// If the feature has none of these tags, we'll consider it non-intersecting.
-// If only one of start_time or stop_time is provided, the other will be considered
-//	infitity or negative infinity respectively.
-func feature_time_intersects_time_filter(f *prv.Feature, start_time_str, stop_time_str, timestamp_str string) (bool, error) {
-	// --- Collect any time parameters from feature's tags
-	// Feature start, feature stop, feature timestamp
-	var fstart_str, fstop_str, fts_str string
-
-	for k, v := range f.Properties {
-		switch k {
-		case "start_time":
-			fstart_str = v.(string)
-		case "stop_time":
-			fstop_str = v.(string)
-		case "timestamp":
-			fts_str = v.(string)
-		}
-	}
-
-	// --- Convert all time strings to time.Time instances
-	var start_time, stop_time, timestamp, fstart, fstop, fts time.Time
-	times := []time.Time{start_time, stop_time, timestamp, fstart, fstop, fts}
-	timestrings := []string{start_time_str, stop_time_str, timestamp_str, fstart_str, fstop_str, fts_str}
-	if len(times) != len(timestrings) {
-		panic("array length mismatch")
-	}
-	var err error
-	for i := 0; i < len(times); i++ {
-		if timestrings[i] == "" {
-			continue
-		}
-		times[i], err = parse_time_string(timestrings[i])
-		if err != nil {
-			return false, err
-		}
-	}
-
-	// if the feature doesn't have any time data, treat as a match
-	if fstart_str == "" && fstop_str == "" && fts_str == "" {
-		return true, nil
-	}
-
-	// if there's no start_time, but there's a stop_time and feature timestamp before the stop_time
-	if start_time_str == "" && stop_time_str != "" && fts_str != "" && fts.Sub(stop_time) <= 0 {
-		return true, nil
-	}
-	// if there's no start time, but there's a stop time and a feature start and/or stop time
-	if start_time_str == "" && stop_time_str != "" && (fstart_str != "" || fstop_str != "") {
-		if fstart_str != "" && fstart.Sub(stop_time) <= 0 {
-			return true, nil
-		}
-		if fstop_str != "" && fstop.Sub(stop_time) <= 0 {
-			return true, nil
-		}
-	}
-	// If there's no stop_time, but there's a start_time and feature timestamp after the start_time
-	if start_time_str != "" && stop_time_str == "" && fts_str != "" && fts.Sub(start_time) >= 0 {
-		return true, nil
-	}
-	// If there's no stop time, but there's a start time and a feature start and/or stop time
-	if start_time_str != "" && stop_time_str == "" && (fstart_str != "" || fstop_str != "") {
-		if fstart_str != "" && fstart.Sub(start_time) >= 0 {
-			return true, nil
-		}
-		if fstop_str != "" && fstop.Sub(start_time) >= 0 {
-			return true, nil
-		}
-	}
-	// If there's a start_time and stop_time {
-	if start_time_str != "" && stop_time_str != "" {
-		if fts_str != "" && fts.Sub(start_time) >= 0 && fts.Sub(stop_time) <= 0 {
-			return true, nil
-		}
-		if fstart_str != "" && fstart.Sub(start_time) >= 0 && fstart.Sub(stop_time) <= 0 {
-			return true, nil
-		}
-		if fstop_str != "" && fstop.Sub(start_time) >= 0 && fstop.Sub(stop_time) <= 0 {
-			return true, nil
-		}
-	}
-	// If there's a timestamp
-	if timestamp_str != "" {
-		if fts_str != "" && fts == timestamp {
-			return true, nil
-		}
-		if fstart_str != "" && timestamp.Sub(fstart) >= 0 {
-			if fstop_str == "" || timestamp.Sub(fstop) <= 0 {
-				return true, nil
-			}
-		}
-		if fstop_str != "" && timestamp.Sub(fstop) <= 0 {
-			if fstart_str == "" || timestamp.Sub(fstart) >= 0 {
-				return true, nil
-			}
-		}
-	}
-	return false, nil
-}
-
-// Filter out features based on params passed
-// start_time, stop_time, timestamp parameters are specifically used for timestamp filtering
-// 	@see check_time_filter().
-func (p *Provider) FilterFeatures(extent *geom.Extent, collections []string, properties map[string]string) ([]FeatureId, error) {
+// Ids of the features in collections matching q's filters, q.Collection, q.Limit, q.Offset & q.Select
+// are ignored.  All collections are searched if collections is empty.  Returns a *BadFilter if a
+// collection doesn't have a filtered property.
+func (p *Provider) FilterFeatures(ctx context.Context, collections []string, q Query) ([]FeatureId, error) {
 	if len(collections) < 1 {
 		var err error
 		collections, err = p.CollectionNames()
 		if err != nil {
 			return nil, err
 		}
+	} else {
+		// To maintain a consistent order for paging & testing
+		collections = append([]string{}, collections...)
+		sort.Strings(collections)
+	}
+
+	// Only the ids are read
+	q.Limit, q.Offset, q.Select = 0, 0, Selection{Properties: []string{}, SkipGeometry: true}
+	cqs := make([]Query, len(collections))
+	for i, col := range collections {
+		cq := q
+		cq.Collection = col
+		if err := p.checkFilterProperties(cq); err != nil {
+			return nil, err
+		}
+		if !cq.Temporal.IsSet() {
+			cq.Temporal = p.TemporalProperties[col]
+		}
+		cqs[i] = cq
 	}
-	// To maintain a consistent order for paging & testing
-	sort.Strings(collections)
 
 	fids := make([]FeatureId, 0, 100)
-	for _, col := range collections {
-		fs, err := p.CollectionFeatures(col, properties, extent)
+	for _, cq := range cqs {
+		col := cq.Collection
+		fs, err := p.Source.QueryFeatures(ctx, cq)
 		if err != nil {
 			return nil, err
 		}
@@ -243,144 +162,323 @@ func (p *Provider) FilterFeatures(extent *geom.Extent, collections []string, pro
 	return fids, nil
 }
 
-// Create a new collection given collection/pk pairs to populate it
-func (p *Provider) MakeCollection(name string, featureIds []FeatureId) (string, error) {
+// Create a new temporary collection given collection/pk pairs to populate it, returns its
+// generated id.
+func (p *Provider) MakeCollection(featureIds []FeatureId) (string, error) {
 	collectionIds, err := p.CollectionNames()
 	if err != nil {
 		return "", err
 	}
-	for _, cid := range collectionIds {
-		if name == cid {
-			e := ErrDuplicateCollectionName{name: name}
-			return "", e
-		}
+	taken := func(id string) bool {
+		i := sort.SearchStrings(collectionIds, id)
+		return i < len(collectionIds) && collectionIds[i] == id
 	}
 
-	if p.tempCollections == nil {
-		p.tempCollections = make(map[string]*tempCollection)
-	}
+	return p.temps().add(featureIds, taken)
+}
 
-	p.tempCollections[name] = &tempCollection{lastAccess: time.Now(), featureIds: featureIds}
-	return name, nil
+// Whether there's a temporary collection w/ id, temporary collections expire
+func (p *Provider) HasTempCollection(id string) bool {
+	_, ok := p.temps().get(id)
+	return ok
 }
 
-// Returns f if items from properties match the properties of f.  Otherwise returns nil.
-func property_filter(f *prv.Feature, properties map[string]string) (*prv.Feature, error) {
-	starttime := ""
-	stoptime := ""
-	timestamp := ""
-	for k, v := range properties {
-		// --- grab any time-related properties for intersection processing instead of equality testing.
-		switch k {
-		case "start_time":
-			starttime = v
-			continue
-		case "stop_time":
-			stoptime = v
-			continue
-		case "timestamp":
-			timestamp = v
-			continue
+// Get a page of features matching q along w/ the total number of features matching q.
+func (p *Provider) QueryFeatures(ctx context.Context, q Query) (fs []*Feature, featureTotal uint, err error) {
+	// return from a temp collection with this name if there is one
+	if featureIds, ok := p.temps().get(q.Collection); ok {
+		if len(q.SortBy) > 0 || q.Nearest != nil {
+			// All of the features are read to sort them
+			tfs, err := p.GetFeatures(ctx, featureIds)
+			if err != nil {
+				return nil, 0, err
+			}
+			return q.selectDistances(pageFeatures(tfs, q)), uint(len(featureIds)), nil
 		}
-
-		if v != f.Properties[k] {
-			return nil, nil
+		// Only the page's features are read, in the order they were added
+		total := uint(len(featureIds))
+		start, stop := q.Offset, total
+		if start > total {
+			start = total
+		}
+		if q.Limit > 0 && start+q.Limit < total {
+			stop = start + q.Limit
+		}
+		tfs, err := p.GetFeatures(ctx, featureIds[start:stop])
+		if err != nil {
+			return nil, 0, err
 		}
+		return q.Select.applyAll(tfs), total, nil
 	}
-	in_time_filter, err := feature_time_intersects_time_filter(f, starttime, stoptime, timestamp)
+
+	if err := p.checkFilterProperties(q); err != nil {
+		return nil, 0, err
+	}
+	if !q.Temporal.IsSet() {
+		q.Temporal = p.TemporalProperties[q.Collection]
+	}
+	fs, err = p.Source.QueryFeatures(ctx, q)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	if in_time_filter {
-		return f, nil
-	} else {
-		return nil, nil
+	// Sources that can't leave out unselected parts while reading return them all
+	fs = q.selectDistances(fs)
+
+	// A short first page already tells us the total
+	if q.Offset == 0 && (q.Limit == 0 || uint(len(fs)) < q.Limit) {
+		return fs, uint(len(fs)), nil
 	}
-}
 
-// Get all features for a particular collection
-func (p *Provider) CollectionFeatures(collectionName string, properties map[string]string, extent *geom.Extent) ([]*prv.Feature, error) {
-	// return a temp collection with this name if there is one
-	for tcn := range p.tempCollections {
-		if collectionName == tcn {
-			p.tempCollections[collectionName].lastAccess = time.Now()
-			return p.GetFeatures(p.tempCollections[collectionName].featureIds)
-		}
+	featureTotal, err = p.Source.CountFeatures(ctx, q)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	// otherwise hit the Tiler provider to get features for this collectionName
-	pFs := make([]*prv.Feature, 0, 100)
+	return fs, featureTotal, nil
+}
 
-	var err error
-	getFeatures := func(f *prv.Feature) error {
-		if properties != nil {
-			f, err = property_filter(f, properties)
-			if err != nil {
-				return err
-			}
-			if f == nil {
-				return nil
-			}
-		}
-		pFs = append(pFs, f)
-		return nil
+// Returns a *BadFilter if q filters on, sorts on or selects a property its collection doesn't have.
+// Properties in CQL2 spatial predicates are taken to be the features' geometry & not checked.
+func (p *Provider) checkFilterProperties(q Query) error {
+	pfs, err := q.propertyFilters()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(pfs)+len(q.SortBy)+len(q.Select.Properties))
+	for _, pf := range pfs {
+		names = append(names, pf.Property)
+	}
+	if q.Filter != nil {
+		names = append(names, cql2.Properties(q.Filter)...)
+	}
+	for _, k := range q.SortBy {
+		names = append(names, k.Property)
 	}
+	names = append(names, q.Select.Properties...)
+	return p.checkProperties(q.Collection, names)
+}
 
-	t := EmptyTile{extent: extent, srid: 4326}
-	err = p.Tiler.TileFeatures(context.TODO(), collectionName, t, getFeatures)
+// Returns a *BadFilter if collection doesn't have one of the properties in names.  Collections whose
+// properties aren't known aren't checked.
+func (p *Provider) checkProperties(collection string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	cs, err := p.Source.CollectionSchema(collection)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if cs.Properties == nil {
+		return nil
 	}
 
-	return pFs, nil
+	known := make(map[string]bool, len(cs.Properties))
+	for _, name := range cs.Properties {
+		known[name] = true
+	}
+	for _, name := range names {
+		if !known[name] {
+			return &BadFilter{msg: fmt.Sprintf("unknown property for collection '%v': '%v'", collection, name)}
+		}
+	}
+	return nil
 }
 
-// Get features given collection/pk pairs
-func (p *Provider) GetFeatures(featureIds []FeatureId) ([]*prv.Feature, error) {
+// Get features given collection/pk pairs, in the order of featureIds.  Features that aren't found
+// are left out.
+func (p *Provider) GetFeatures(ctx context.Context, featureIds []FeatureId) ([]*Feature, error) {
 	// Feature pks grouped by collection
-	cf := make(map[string][]uint64)
+	cf := make(map[string][]string)
 	fcount := 0
 	for _, fid := range featureIds {
 		if _, ok := cf[fid.Collection]; !ok {
-			cf[fid.Collection] = make([]uint64, 0, 100)
+			cf[fid.Collection] = make([]string, 0, 100)
 		}
 		cf[fid.Collection] = append(cf[fid.Collection], fid.FeaturePk)
 		fcount += 1
 	}
 
 	// Desired features
-	fs := make([]*prv.Feature, 0, fcount)
+	found := make(map[FeatureId]*Feature, fcount)
 	for col, fpks := range cf {
-		colFs, err := p.CollectionFeatures(col, nil, nil)
+		colFs, err := p.Source.GetFeatures(ctx, col, fpks)
 		if err != nil {
 			return nil, err
 		}
-
-		for _, colF := range colFs {
-			for _, fpk := range fpks {
-				if colF.ID == fpk {
-					fs = append(fs, colF)
-					break
-				}
-			}
+		for _, f := range colFs {
+			found[FeatureId{Collection: col, FeaturePk: f.ID}] = f
 		}
 	}
 
+	fs := make([]*Feature, 0, fcount)
+	for _, fid := range featureIds {
+		if f, ok := found[fid]; ok {
+			fs = append(fs, f)
+		}
+	}
 	return fs, nil
 }
 
+// Get a single feature by collection/pk w/ the parts selected by sel, returns a nil feature if
+// there's no such feature.
+func (p *Provider) GetFeature(ctx context.Context, fid FeatureId, sel Selection) (*Feature, error) {
+	if !p.HasTempCollection(fid.Collection) {
+		if err := p.checkProperties(fid.Collection, sel.Properties); err != nil {
+			return nil, err
+		}
+	}
+	fs, err := p.GetFeatures(ctx, []FeatureId{fid})
+	if err != nil {
+		return nil, err
+	}
+	if len(fs) == 0 {
+		return nil, nil
+	}
+	return sel.apply(fs[0]), nil
+}
+
 // Fetch a list of all collection names from provider
 func (p *Provider) CollectionNames() ([]string, error) {
-	featureTableInfo, err := p.Tiler.Layers()
+	names, err := p.Source.CollectionNames()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Describe a collection served by the provider
+func (p *Provider) CollectionSchema(name string) (*CollectionSchema, error) {
+	return p.Source.CollectionSchema(name)
+}
+
+// Identifiers of the CRSs a collection's features can be served in, the first is the default
+func (p *Provider) CollectionCRSs(name string) ([]string, error) {
+	if _, ok := p.temps().get(name); ok {
+		// Features from any collection, most can be converted
+		return supportedCRSs(4326, CRS84), nil
+	}
+	cs, err := p.Source.CollectionSchema(name)
+	if err != nil {
+		return nil, err
+	}
+	return supportedCRSs(cs.SRID, cs.CRS), nil
+}
+
+// The CRS to serve a collection's features in when requested (a CRS identifier) is asked for, or
+// the collection's default if requested is "".  A *BadCRS if the collection can't be served in it.
+func (p *Provider) OutputCRS(name, requested string) (CRS, error) {
+	crss, err := p.CollectionCRSs(name)
+	if err != nil {
+		return CRS{}, err
+	}
+
+	if requested == "" {
+		if len(crss) == 0 || crss[0] == CRS84 {
+			return DefaultCRS, nil
+		}
+		// Can only be served as stored
+		cs, err := p.Source.CollectionSchema(name)
+		if err != nil {
+			return CRS{}, err
+		}
+		return CRS{URI: crss[0], SRID: cs.SRID}, nil
+	}
+
+	c, err := ParseCRS(requested)
+	if err != nil {
+		return CRS{}, err
+	}
+	for _, uri := range crss {
+		if uri == c.URI {
+			return c, nil
+		}
+	}
+	return CRS{}, &BadCRS{msg: fmt.Sprintf("crs '%v' isn't supported for collection '%v'", requested, name)}
+}
+
+func (p *Provider) extentCache() *extentCache {
+	providerInitMutex.Lock()
+	defer providerInitMutex.Unlock()
+
+	if p.extents == nil {
+		p.extents = newExtentCache(p.ExtentCacheTTL)
+	}
+	return p.extents
+}
+
+// The lon/lat (CRS84) extent of all features in a collection, nil if the collection is empty or
+// its extent can't be converted to lon/lat.
+func (p *Provider) CollectionExtent(ctx context.Context, name string) (*geom.Extent, error) {
+	ce, err := p.collectionExtents(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ce.spatial, nil
+}
+
+// The time interval covered by a collection's features, nil if the collection has no temporal
+// properties configured or none of its features have time values.
+func (p *Provider) CollectionTemporalExtent(ctx context.Context, name string) (*TimeInterval, error) {
+	ce, err := p.collectionExtents(ctx, name)
 	if err != nil {
 		return nil, err
 	}
+	return ce.temporal, nil
+}
 
-	ftNames := make([]string, len(featureTableInfo))
-	for i, fti := range featureTableInfo {
-		ftNames[i] = fti.Name()
+// A collection's extents, from the cache if they were computed within ExtentCacheTTL
+func (p *Provider) collectionExtents(ctx context.Context, name string) (collectionExtents, error) {
+	cache := p.extentCache()
+	if ce, ok := cache.get(name); ok {
+		return ce, nil
 	}
-	sort.Strings(ftNames)
 
-	return ftNames, err
+	var ce collectionExtents
+	e, err := p.Source.CollectionExtent(ctx, name)
+	if err != nil {
+		return ce, err
+	}
+	if e != nil {
+		cs, err := p.Source.CollectionSchema(name)
+		if err != nil {
+			return ce, err
+		}
+		if ce.spatial, err = lonLatExtent(e, cs.SRID); err != nil {
+			log.Printf("leaving out the extent of '%v': %v", name, err)
+		}
+	}
+
+	if tp, ok := p.TemporalProperties[name]; ok && tp.IsSet() {
+		if ce.temporal, err = p.sourceTemporalExtent(ctx, name, tp); err != nil {
+			return ce, err
+		}
+	}
+
+	cache.put(name, ce)
+	return ce, nil
+}
+
+// The time interval covered by a collection's features according to tp, aggregated by the source
+// if it can, otherwise from the time values of all of the features.
+func (p *Provider) sourceTemporalExtent(ctx context.Context, name string, tp TemporalProperties) (*TimeInterval, error) {
+	if teg, ok := p.Source.(TemporalExtentGetter); ok {
+		te, err := teg.TemporalExtent(ctx, name, tp)
+		if err != ErrQueryNotSupported {
+			return te, err
+		}
+	}
+
+	sel := Selection{Properties: make([]string, 0, 3), SkipGeometry: true}
+	for _, pn := range []string{tp.Instant, tp.Start, tp.End} {
+		if pn != "" {
+			sel.Properties = append(sel.Properties, pn)
+		}
+	}
+	fs, err := p.Source.QueryFeatures(ctx, Query{Collection: name, Select: sel})
+	if err != nil {
+		return nil, err
+	}
+	return temporalExtent(fs, tp), nil
 }
@@ -0,0 +1,189 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project query.go
+
+package data_provider
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/jivan/cql2"
+)
+
+// Returned by a Querier when it can't handle a query itself, the caller should fall back to
+// filtering & paging in memory.
+var ErrQueryNotSupported = errors.New("query not supported by data source")
+
+// Describes a filtered page of features from a single collection.
+type Query struct {
+	Collection string
+	// Lat/lon bounding box, features not intersecting it are excluded.  nil for no spatial filter.
+	Extent *geom.Extent
+	// Property filters, features must pass all of them
+	Filters []PropertyFilter
+	// A CQL2 filter features must pass, nil for none
+	Filter cql2.Expr
+	// Time instant or interval features must intersect, nil for no time filter
+	Time *TimeInterval
+	// Properties the time filter is applied to
+	Temporal TemporalProperties
+	// Maximum number of features to return, 0 for no limit
+	Limit uint
+	// Number of matching features to skip before the first one returned
+	Offset uint
+	// Properties features are sorted on before paging, they're then sorted by id
+	SortBy []SortKey
+	// Lon/lat point features are sorted by distance from instead of by SortBy, nearest first.  Each
+	// feature has its distance in meters as DistanceProperty.  nil to not sort by distance.
+	Nearest *geom.Point
+	// The parts of features returned, all of them if not set
+	Select Selection
+}
+
+// Property holding the distance of features sorted by Query.Nearest, replacing any property of the
+// same name
+const DistanceProperty = "distance"
+
+// Copies of fs, which are the features matching q, w/ their DistanceProperty if q.Nearest is set
+// & only what q.Select selects
+func (q Query) selectDistances(fs []*Feature) []*Feature {
+	if q.Nearest == nil {
+		return q.Select.applyAll(fs)
+	}
+	sel := q.Select
+	if sel.Properties != nil {
+		sel.Properties = append(append([]string(nil), sel.Properties...), DistanceProperty)
+	}
+	return sel.applyAll(withDistances(fs, *q.Nearest))
+}
+
+// Which parts of features are returned, the id always is
+type Selection struct {
+	// Properties features are returned w/, nil for all of them
+	Properties []string
+	// Leave out geometries
+	SkipGeometry bool
+}
+
+// Whether s leaves anything out
+func (s Selection) IsSet() bool {
+	return s.Properties != nil || s.SkipGeometry
+}
+
+// Copy of f w/ only what s selects, f itself if s selects everything
+func (s Selection) apply(f *Feature) *Feature {
+	if !s.IsSet() {
+		return f
+	}
+	sf := &Feature{ID: f.ID, SRID: f.SRID, Geometry: f.Geometry, Properties: f.Properties}
+	if s.SkipGeometry {
+		sf.Geometry = nil
+	}
+	if s.Properties != nil {
+		sf.Properties = make(map[string]interface{}, len(s.Properties))
+		for _, p := range s.Properties {
+			if v, ok := f.Properties[p]; ok {
+				sf.Properties[p] = v
+			}
+		}
+	}
+	return sf
+}
+
+// Copies of fs w/ only what s selects
+func (s Selection) applyAll(fs []*Feature) []*Feature {
+	if !s.IsSet() {
+		return fs
+	}
+	sfs := make([]*Feature, len(fs))
+	for i, f := range fs {
+		sfs[i] = s.apply(f)
+	}
+	return sfs
+}
+
+// q's property filters, validated
+func (q Query) propertyFilters() ([]PropertyFilter, error) {
+	for _, pf := range q.Filters {
+		if err := pf.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return q.Filters, nil
+}
+
+// q.Filter ready for matching features in memory, nil if q has none
+func (q Query) cqlFilter() (*cqlFilter, error) {
+	if q.Filter == nil {
+		return nil, nil
+	}
+	return newCQLFilter(q.Filter)
+}
+
+// A Querier applies filtering & paging in the data backend so only the requested page is read.
+// Used by TilerSource to avoid reading entire collections through the Tiler.
+type Querier interface {
+	// The page of features matching q
+	QueryFeatures(ctx context.Context, q Query) ([]*Feature, error)
+	// Total number of features matching q, ignoring q.Limit & q.Offset
+	CountFeatures(ctx context.Context, q Query) (uint, error)
+}
+
+// A FeatureGetter looks features up by id without scanning their collection.
+// Typically implemented alongside Querier.
+type FeatureGetter interface {
+	// Features from collection w/ ids in ids, ids that aren't found are left out.
+	// Returns ErrQueryNotSupported if it can't handle collection.
+	GetFeatures(ctx context.Context, collection string, ids []string) ([]*Feature, error)
+}
+
+// A CollectionDescriber knows more about a collection's schema than can be learned from a Tiler.
+type CollectionDescriber interface {
+	// Returns ErrQueryNotSupported if it can't handle collection.
+	CollectionSchema(collection string) (*CollectionSchema, error)
+}
+
+// An ExtentGetter computes the extent of a collection more efficiently than scanning it through a
+// Tiler, or for collections a Tiler doesn't have.
+type ExtentGetter interface {
+	// Returns ErrQueryNotSupported if it can't handle collection.
+	CollectionExtent(ctx context.Context, collection string) (*geom.Extent, error)
+}
+
+// A TemporalExtentGetter computes the time interval covered by a collection's features w/o
+// reading them all.
+type TemporalExtentGetter interface {
+	// The time interval covered by collection's features according to tp, nil if none of them
+	// have time values.  Returns ErrQueryNotSupported if it can't handle collection.
+	TemporalExtent(ctx context.Context, collection string, tp TemporalProperties) (*TimeInterval, error)
+}
+
+// A SQLCollectionAdder serves collections defined by SQL queries in addition to tables.
+type SQLCollectionAdder interface {
+	AddSQLCollection(c SQLCollection) error
+}
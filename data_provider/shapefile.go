@@ -0,0 +1,377 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project shapefile.go
+
+package data_provider
+
+// Reading of ESRI shapefiles for FileSource.
+// @see https://www.esri.com/library/whitepapers/pdfs/shapefile.pdf
+// @see http://www.dbase.com/Knowledgebase/INT/db7_file_fmt.htm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-spatial/geom"
+)
+
+// A single .shp record
+type shpRecord struct {
+	number   uint64
+	geometry geom.Geometry
+}
+
+// A .dbf field descriptor
+type dbfField struct {
+	name     string
+	ftype    byte
+	length   int
+	decimals int
+}
+
+// Reads the shapefile at path (the .shp) along w/ its .dbf attributes & .prj CRS definition.
+// Features are numbered by their record number, attributes become properties.  Without a .prj
+// coordinates are assumed to be lon/lat.
+func loadShapefile(path string, _ FileOptions) (*fileContents, error) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+
+	records, err := readShp(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []dbfField
+	var attributes []map[string]interface{}
+	if dbfPath := shapefileSidecar(base, ".dbf"); dbfPath != "" {
+		fields, attributes, err = readDbf(dbfPath)
+		if err != nil {
+			return nil, fmt.Errorf("problem reading '%v': %v", dbfPath, err)
+		}
+		if len(attributes) != len(records) {
+			return nil, fmt.Errorf("'%v' has %v records but '%v' has %v", path, len(records), dbfPath, len(attributes))
+		}
+	} else {
+		log.Printf("no .dbf found for '%v', features will have no properties", path)
+	}
+
+	contents := &fileContents{srid: 4326, crs: CRS84}
+	if prjPath := shapefileSidecar(base, ".prj"); prjPath != "" {
+		prj, err := ioutil.ReadFile(prjPath)
+		if err != nil {
+			return nil, err
+		}
+		wkt := strings.TrimSpace(string(prj))
+		contents.srid = wktSRID(wkt)
+		contents.crs = sridCRS(contents.srid)
+		if contents.crs == "" {
+			// Unrecognized, publish the definition itself
+			contents.crs = wkt
+		}
+	}
+
+	contents.features = make([]*Feature, 0, len(records))
+	for i, r := range records {
+		props := make(map[string]interface{}, len(fields))
+		if attributes != nil {
+			if attributes[i] == nil {
+				// Deleted record
+				continue
+			}
+			props = attributes[i]
+		}
+		contents.features = append(contents.features,
+			&Feature{ID: strconv.FormatUint(r.number, 10), Geometry: r.geometry, SRID: contents.srid, Properties: props})
+	}
+
+	contents.properties = make([]string, len(fields))
+	contents.kinds = make(map[string]int, len(fields))
+	for i, f := range fields {
+		contents.properties[i] = f.name
+		contents.kinds[f.name] = dbfKind(f)
+	}
+
+	return contents, nil
+}
+
+// Path of the file w/ base & ext (in lower or upper case), "" if there isn't one
+func shapefileSidecar(base, ext string) string {
+	for _, e := range []string{ext, strings.ToUpper(ext)} {
+		if _, err := os.Stat(base + e); err == nil {
+			return base + e
+		}
+	}
+	return ""
+}
+
+func readShp(path string) ([]shpRecord, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 100 || binary.BigEndian.Uint32(b[0:4]) != 9994 {
+		return nil, fmt.Errorf("'%v' isn't a shapefile", path)
+	}
+
+	records := make([]shpRecord, 0, 100)
+	// Record headers are big-endian, the record contents little-endian
+	for off := 100; off+8 <= len(b); {
+		number := binary.BigEndian.Uint32(b[off:])
+		// In 16-bit words
+		length := int(binary.BigEndian.Uint32(b[off+4:])) * 2
+		off += 8
+		if off+length > len(b) {
+			return nil, fmt.Errorf("record %v is truncated", number)
+		}
+		g, err := decodeShape(b[off : off+length])
+		if err != nil {
+			return nil, fmt.Errorf("record %v: %v", number, err)
+		}
+		records = append(records, shpRecord{number: uint64(number), geometry: g})
+		off += length
+	}
+
+	return records, nil
+}
+
+// Decodes a record's shape, z & m values are dropped.
+func decodeShape(c []byte) (geom.Geometry, error) {
+	if len(c) < 4 {
+		return nil, fmt.Errorf("missing shape type")
+	}
+
+	switch st := binary.LittleEndian.Uint32(c); st {
+	case 0:
+		// Null shape
+		return nil, nil
+	case 1, 11, 21:
+		// Point, PointZ, PointM
+		pts, err := shpPoints(c, 4, 1)
+		if err != nil {
+			return nil, err
+		}
+		return geom.Point(pts[0]), nil
+	case 8, 18, 28:
+		// MultiPoint[ZM]: bbox, point count, points
+		if len(c) < 40 {
+			return nil, fmt.Errorf("truncated multipoint")
+		}
+		pts, err := shpPoints(c, 40, int(binary.LittleEndian.Uint32(c[36:])))
+		if err != nil {
+			return nil, err
+		}
+		return geom.MultiPoint(pts), nil
+	case 3, 13, 23, 5, 15, 25:
+		// PolyLine[ZM] & Polygon[ZM]: bbox, part count, point count, part start indices, points
+		if len(c) < 44 {
+			return nil, fmt.Errorf("truncated polyline/polygon")
+		}
+		numParts := int(binary.LittleEndian.Uint32(c[36:]))
+		numPoints := int(binary.LittleEndian.Uint32(c[40:]))
+		if len(c) < 44+4*numParts {
+			return nil, fmt.Errorf("truncated polyline/polygon parts")
+		}
+		pts, err := shpPoints(c, 44+4*numParts, numPoints)
+		if err != nil {
+			return nil, err
+		}
+		parts := make([][][2]float64, numParts)
+		for i := range parts {
+			start := int(binary.LittleEndian.Uint32(c[44+4*i:]))
+			end := numPoints
+			if i+1 < numParts {
+				end = int(binary.LittleEndian.Uint32(c[44+4*(i+1):]))
+			}
+			if start > end || end > numPoints {
+				return nil, fmt.Errorf("invalid part indices [%v, %v]", start, end)
+			}
+			parts[i] = pts[start:end]
+		}
+
+		if st%10 == 3 {
+			if len(parts) == 1 {
+				return geom.LineString(parts[0]), nil
+			}
+			return geom.MultiLineString(parts), nil
+		}
+		return shpPolygon(parts), nil
+	default:
+		return nil, fmt.Errorf("unsupported shape type %v", st)
+	}
+}
+
+// Reads n x/y pairs from c starting at off
+func shpPoints(c []byte, off, n int) ([][2]float64, error) {
+	if n < 0 || len(c) < off+16*n {
+		return nil, fmt.Errorf("truncated points")
+	}
+	pts := make([][2]float64, n)
+	for i := range pts {
+		pts[i][0] = math.Float64frombits(binary.LittleEndian.Uint64(c[off+16*i:]))
+		pts[i][1] = math.Float64frombits(binary.LittleEndian.Uint64(c[off+16*i+8:]))
+	}
+	return pts, nil
+}
+
+// Groups polygon rings into polygons.  Outer rings are clockwise & holes counter-clockwise, each
+// hole is taken to belong to the outer ring preceding it.
+func shpPolygon(rings [][][2]float64) geom.Geometry {
+	var polys geom.MultiPolygon
+	for _, r := range rings {
+		if ringArea(r) <= 0 || len(polys) == 0 {
+			polys = append(polys, geom.Polygon{r})
+			continue
+		}
+		polys[len(polys)-1] = append(polys[len(polys)-1], r)
+	}
+
+	if len(polys) == 1 {
+		return geom.Polygon(polys[0])
+	}
+	return polys
+}
+
+// Signed area of ring, negative if it's clockwise
+func ringArea(ring [][2]float64) float64 {
+	var a float64
+	for i := range ring {
+		j := (i + 1) % len(ring)
+		a += ring[i][0]*ring[j][1] - ring[j][0]*ring[i][1]
+	}
+	return a / 2
+}
+
+// Reads the field descriptors & records of a .dbf file.  Records are returned as a map from
+// field name to value, deleted records as nil.
+func readDbf(path string) ([]dbfField, []map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(b) < 32 {
+		return nil, nil, fmt.Errorf("truncated header")
+	}
+	numRecords := int(binary.LittleEndian.Uint32(b[4:]))
+	headerLength := int(binary.LittleEndian.Uint16(b[8:]))
+	recordLength := int(binary.LittleEndian.Uint16(b[10:]))
+
+	// 32-byte field descriptors follow the header up to a 0x0D terminator
+	var fields []dbfField
+	for off := 32; off+32 <= len(b) && off < headerLength && b[off] != 0x0D; off += 32 {
+		fd := b[off : off+32]
+		name := fd[:11]
+		if i := strings.IndexByte(string(name), 0); i >= 0 {
+			name = name[:i]
+		}
+		fields = append(fields, dbfField{
+			name: string(name), ftype: fd[11], length: int(fd[16]), decimals: int(fd[17]),
+		})
+	}
+
+	records := make([]map[string]interface{}, 0, numRecords)
+	for i := 0; i < numRecords; i++ {
+		off := headerLength + i*recordLength
+		if off+recordLength > len(b) {
+			return nil, nil, fmt.Errorf("record %v is truncated", i+1)
+		}
+		rec := b[off : off+recordLength]
+		if rec[0] == '*' {
+			records = append(records, nil)
+			continue
+		}
+
+		// Values follow the deletion flag
+		values := make(map[string]interface{}, len(fields))
+		voff := 1
+		for _, f := range fields {
+			if voff+f.length > len(rec) {
+				return nil, nil, fmt.Errorf("record %v is shorter than its fields", i+1)
+			}
+			if v := dbfValue(f, rec[voff:voff+f.length]); v != nil {
+				values[f.name] = v
+			}
+			voff += f.length
+		}
+		records = append(records, values)
+	}
+
+	return fields, records, nil
+}
+
+// The kind of the values dbfValue() gives for f
+func dbfKind(f dbfField) int {
+	switch f.ftype {
+	case 'N', 'F':
+		if f.decimals == 0 {
+			return kindInteger
+		}
+		return kindFloat
+	case 'L':
+		return kindBoolean
+	case 'D':
+		return kindDate
+	}
+	return kindString
+}
+
+// Converts a raw field value to a property value, nil for an empty or invalid value
+func dbfValue(f dbfField, raw []byte) interface{} {
+	s := strings.TrimSpace(strings.Trim(string(raw), "\x00"))
+	switch f.ftype {
+	case 'N', 'F':
+		if f.decimals == 0 {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i
+			}
+		}
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v
+		}
+		return nil
+	case 'L':
+		switch s {
+		case "T", "t", "Y", "y":
+			return true
+		case "F", "f", "N", "n":
+			return false
+		}
+		return nil
+	case 'D':
+		// YYYYMMDD, made ISO 8601 to work w/ the time filters
+		if len(s) != 8 {
+			return nil
+		}
+		return s[0:4] + "-" + s[4:6] + "-" + s[6:8]
+	default:
+		return strings.TrimRight(string(raw), " \x00")
+	}
+}
@@ -0,0 +1,129 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project sort.go
+
+package data_provider
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-spatial/geom"
+)
+
+// A property features are sorted on, in ascending order unless Descending.  Features w/o a value
+// for it come last either way.
+type SortKey struct {
+	Property   string
+	Descending bool
+}
+
+// Compares feature ids a & b, part by part for composite ids w/ parts that are both integers
+// compared numerically, as the id columns of a table are.
+func compareIds(a, b string) int {
+	aParts, bParts := strings.Split(a, ","), strings.Split(b, ",")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		c := strings.Compare(aParts[i], bParts[i])
+		ai, aErr := strconv.ParseInt(aParts[i], 10, 64)
+		bi, bErr := strconv.ParseInt(bParts[i], 10, 64)
+		if aErr == nil && bErr == nil {
+			switch {
+			case ai < bi:
+				c = -1
+			case ai > bi:
+				c = 1
+			}
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return len(aParts) - len(bParts)
+}
+
+// Compares property values a & b, returning -1, 0 or 1 as a is less than, equal to or greater
+// than b.  Values are compared according to a's type where b can be converted to it.
+func compareValues(a, b interface{}) int {
+	if c, ok := compareProperty(a, propertyString(b)); ok {
+		return c
+	}
+	return strings.Compare(propertyString(a), propertyString(b))
+}
+
+// Sorts fs by keys, then by id so the order is the same for every query
+func sortFeatures(fs []*Feature, keys []SortKey) {
+	sort.SliceStable(fs, func(i, j int) bool {
+		for _, k := range keys {
+			vi, iok := fs[i].Properties[k.Property]
+			vj, jok := fs[j].Properties[k.Property]
+			iok, jok = iok && vi != nil, jok && vj != nil
+			switch {
+			case !iok && !jok:
+				continue
+			case !iok:
+				return false
+			case !jok:
+				return true
+			}
+			c := compareValues(vi, vj)
+			if k.Descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return compareIds(fs[i].ID, fs[j].ID) < 0
+	})
+}
+
+// Sorts fs by the distance of their geometries from lon/lat point pt, nearest first w/ features
+// w/o a geometry last, then by id
+func sortByDistance(fs []*Feature, pt geom.Point) {
+	type featureDist struct {
+		f  *Feature
+		d  float64
+		ok bool
+	}
+	fds := make([]featureDist, len(fs))
+	for i, f := range fs {
+		d, ok := featureDistance(f, pt)
+		fds[i] = featureDist{f: f, d: d, ok: ok}
+	}
+	sort.SliceStable(fds, func(i, j int) bool {
+		switch {
+		case fds[i].ok != fds[j].ok:
+			return fds[i].ok
+		case fds[i].ok && fds[i].d != fds[j].d:
+			return fds[i].d < fds[j].d
+		}
+		return compareIds(fds[i].f.ID, fds[j].f.ID) < 0
+	})
+	for i, fd := range fds {
+		fs[i] = fd.f
+	}
+}
@@ -0,0 +1,192 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project sort_test.go
+
+package data_provider
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/go-spatial/geom"
+)
+
+func TestCompareIds(t *testing.T) {
+	type tcase struct {
+		a, b     string
+		expected int
+	}
+	tcases := []tcase{
+		{a: "2", b: "10", expected: -1},
+		{a: "10", b: "2", expected: 1},
+		{a: "b", b: "a", expected: 1},
+		{a: "7", b: "7", expected: 0},
+		{a: "1,9", b: "1,10", expected: -1},
+		{a: "2,a", b: "10,a", expected: -1},
+		{a: "1", b: "1,1", expected: -1},
+	}
+	for i, tc := range tcases {
+		c := compareIds(tc.a, tc.b)
+		if (c < 0) != (tc.expected < 0) || (c > 0) != (tc.expected > 0) {
+			t.Errorf("[%v] compareIds(%v, %v) = %v, wanted %v", i, tc.a, tc.b, c, tc.expected)
+		}
+	}
+}
+
+func TestSortFeatures(t *testing.T) {
+	newFs := func() []*Feature {
+		return []*Feature{
+			{ID: "10", Properties: map[string]interface{}{"name": "b", "height": 3.0}},
+			{ID: "2", Properties: map[string]interface{}{"name": "a", "height": 1.0}},
+			{ID: "3", Properties: map[string]interface{}{"name": "b"}},
+			{ID: "1", Properties: map[string]interface{}{"name": "b", "height": 12.0}},
+		}
+	}
+	ids := func(fs []*Feature) []string {
+		fids := make([]string, len(fs))
+		for i, f := range fs {
+			fids[i] = f.ID
+		}
+		return fids
+	}
+
+	type tcase struct {
+		keys     []SortKey
+		expected []string
+	}
+	tcases := []tcase{
+		{keys: nil, expected: []string{"1", "2", "3", "10"}},
+		{keys: []SortKey{{Property: "name"}}, expected: []string{"2", "1", "3", "10"}},
+		// Numbers compare numerically, features w/o a value come last
+		{keys: []SortKey{{Property: "height"}}, expected: []string{"2", "10", "1", "3"}},
+		{keys: []SortKey{{Property: "height", Descending: true}}, expected: []string{"1", "10", "2", "3"}},
+		{keys: []SortKey{{Property: "name", Descending: true}, {Property: "height"}}, expected: []string{"10", "1", "3", "2"}},
+	}
+	for i, tc := range tcases {
+		fs := newFs()
+		sortFeatures(fs, tc.keys)
+		if !reflect.DeepEqual(ids(fs), tc.expected) {
+			t.Errorf("[%v] got order %v, wanted %v", i, ids(fs), tc.expected)
+		}
+	}
+}
+
+func TestProviderSortBy(t *testing.T) {
+	fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), "csv"), FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+	p := Provider{Source: fs}
+	ctx := context.Background()
+
+	q := Query{Collection: "sites", SortBy: []SortKey{{Property: "visits", Descending: true}}, Limit: 2}
+	sfs, total, err := p.QueryFeatures(ctx, q)
+	if err != nil {
+		t.Fatalf("QueryFeatures(): %v", err)
+	}
+	if total != 3 || len(sfs) != 2 {
+		t.Fatalf("got %v of %v features, wanted 2 of 3", len(sfs), total)
+	}
+	names := []interface{}{sfs[0].Properties["name"], sfs[1].Properties["name"]}
+	if !reflect.DeepEqual(names, []interface{}{"Creek A", "Pond"}) {
+		t.Errorf("got first page %v, wanted [Creek A Pond]", names)
+	}
+
+	q.Offset = 2
+	sfs, _, err = p.QueryFeatures(ctx, q)
+	if err != nil {
+		t.Fatalf("QueryFeatures(): %v", err)
+	}
+	if len(sfs) != 1 || sfs[0].Properties["name"] != "Creek B" {
+		t.Errorf("got second page %v, wanted [Creek B]", sfs)
+	}
+
+	q.SortBy = []SortKey{{Property: "altitude"}}
+	if _, _, err := p.QueryFeatures(ctx, q); err == nil {
+		t.Errorf("expected an error sorting on an unknown property")
+	} else if _, ok := err.(*BadFilter); !ok {
+		t.Errorf("got a %T, wanted a *BadFilter", err)
+	}
+}
+
+func TestProviderNearest(t *testing.T) {
+	fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), "csv"), FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+	p := Provider{Source: fs}
+
+	// Closest to Creek B, then the Pond which is nearer to Creek B than Creek A is
+	pt := geom.Point{-76.7, 39.2}
+	q := Query{Collection: "sites", Nearest: &pt, Limit: 2, Select: Selection{Properties: []string{"name"}, SkipGeometry: true}}
+	nfs, total, err := p.QueryFeatures(context.Background(), q)
+	if err != nil {
+		t.Fatalf("QueryFeatures(): %v", err)
+	}
+	if total != 3 || len(nfs) != 2 {
+		t.Fatalf("got %v of %v features, wanted 2 of 3", len(nfs), total)
+	}
+	names := []interface{}{nfs[0].Properties["name"], nfs[1].Properties["name"]}
+	if !reflect.DeepEqual(names, []interface{}{"Creek B", "Pond"}) {
+		t.Errorf("got %v, wanted [Creek B Pond]", names)
+	}
+	for i, f := range nfs {
+		if f.Geometry != nil {
+			t.Errorf("[%v] got a geometry w/ skipGeometry", i)
+		}
+	}
+	// ~12.7km from Creek B
+	d, _ := nfs[0].Properties[DistanceProperty].(float64)
+	if d < 12500 || d > 13000 {
+		t.Errorf("got distance %v for Creek B, wanted ~12700", d)
+	}
+	if d1, _ := nfs[1].Properties[DistanceProperty].(float64); d1 <= d {
+		t.Errorf("got distance %v for the Pond, wanted more than %v", d1, d)
+	}
+}
+
+func TestNearestOrder(t *testing.T) {
+	table := &sqlTable{name: "roads", geomColumn: "geom", srid: 3857}
+	args := &sqlArgs{dialect: postgisDialect{}}
+	order, err := postgisDialect{}.nearestOrder(table, geom.Point{1, 2}, args)
+	if err != nil {
+		t.Fatalf("nearestOrder(): %v", err)
+	}
+	expected := `ST_Transform("geom", 4326)::geography <-> ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography`
+	if order != expected {
+		t.Errorf("got %v, wanted %v", order, expected)
+	}
+	if !reflect.DeepEqual(args.values, []interface{}{1.0, 2.0}) {
+		t.Errorf("got args %v, wanted [1 2]", args.values)
+	}
+
+	table.srid = 0
+	if _, err := (postgisDialect{}).nearestOrder(table, geom.Point{1, 2}, args); err != ErrQueryNotSupported {
+		t.Errorf("got %v for an unknown srid, wanted ErrQueryNotSupported", err)
+	}
+}
@@ -0,0 +1,194 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project source.go
+
+package data_provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-spatial/geom"
+)
+
+// Number of features processed in memory between checks for a cancelled context
+const ctxCheckInterval = 1000
+
+// A single feature as handed out by a FeatureSource
+type Feature struct {
+	// Identifies the feature within its collection, opaque to anything but the FeatureSource
+	ID         string
+	Geometry   geom.Geometry
+	SRID       uint64
+	Properties map[string]interface{}
+}
+
+// Describes a collection served by a FeatureSource
+type CollectionSchema struct {
+	Name string
+	// Human readable title & description from the data source, "" if it has none
+	Title       string
+	Description string
+	// Prototype of the collection's geometry type (i.e. geom.Point{}), nil if unknown or mixed
+	GeometryType geom.Geometry
+	// Spatial reference id of the collection's geometries as stored, 0 if unknown
+	SRID uint64
+	// Identifier (URI) of the collection's coordinate reference system, or a WKT definition if
+	// there's no identifier for it.  "" if unknown.
+	CRS string
+	// Names of the properties features in the collection may have, nil if unknown
+	Properties []string
+	// Type of each of Properties by name (see the PropertyType constants), nil if unknown
+	PropertyTypes map[string]string
+}
+
+// A FeatureSource is the interface between the wfs3 package and a data backend.
+// Collections are identified by name & features by their collection name & id.
+// Methods reading features stop early w/ ctx.Err() when ctx is done.
+type FeatureSource interface {
+	// Names of all collections provided
+	CollectionNames() ([]string, error)
+	CollectionSchema(collection string) (*CollectionSchema, error)
+	// The page of features described by q
+	QueryFeatures(ctx context.Context, q Query) ([]*Feature, error)
+	// Total number of features matching q, ignoring q.Limit & q.Offset
+	CountFeatures(ctx context.Context, q Query) (uint, error)
+	// Features from collection w/ ids in ids, ids that aren't found are left out.
+	GetFeatures(ctx context.Context, collection string, ids []string) ([]*Feature, error)
+	// Bounding box of all of the collection's features in their stored SRID, nil if the collection is empty
+	CollectionExtent(ctx context.Context, collection string) (*geom.Extent, error)
+}
+
+// An IdColumnSetter identifies the features of a collection by the values of the given columns
+// (properties for file formats) rather than by its primary key.
+type IdColumnSetter interface {
+	// A composite id is made from the values of several columns, see compositeId()
+	SetIdColumns(collection string, columns []string) error
+}
+
+// A FeatureWriter creates, replaces & deletes the features of collections in the data backend.
+// Geometries may be in any srid the writer can convert to that of the collection.  Methods return
+// ErrQueryNotSupported for collections they can't write to & ErrFeatureNotFound for ids that
+// aren't in the collection.
+type FeatureWriter interface {
+	// Adds f to collection, returning the id it was given.  f.ID is ignored.
+	CreateFeature(ctx context.Context, collection string, f *Feature) (string, error)
+	// Replaces the geometry & all of the properties of feature id w/ those of f, properties f
+	// doesn't have are cleared.  f.ID is ignored.
+	ReplaceFeature(ctx context.Context, collection, id string, f *Feature) error
+	DeleteFeature(ctx context.Context, collection, id string) error
+}
+
+// Returned for a feature id that isn't in its collection
+var ErrFeatureNotFound = errors.New("feature not found")
+
+// Escapes separators & escapes in the values of a composite id
+var compositeIdEscaper = strings.NewReplacer("%", "%25", ",", "%2C")
+var compositeIdUnescaper = strings.NewReplacer("%2C", ",", "%25", "%")
+
+// An id made from several values, these are separated by commas w/ any commas & percent signs
+// in them escaped as in a URL.
+func compositeId(parts []string) string {
+	escaped := make([]string, len(parts))
+	for i, p := range parts {
+		escaped[i] = compositeIdEscaper.Replace(p)
+	}
+	return strings.Join(escaped, ",")
+}
+
+// The n values in a compositeId(), false if id doesn't have n of them
+func splitCompositeId(id string, n int) ([]string, bool) {
+	parts := strings.Split(id, ",")
+	if len(parts) != n {
+		return nil, false
+	}
+	for i, p := range parts {
+		parts[i] = compositeIdUnescaper.Replace(p)
+	}
+	return parts, true
+}
+
+// Whether f passes q's extent, property & CQL2 filters, pfs are q.propertyFilters() & cf is
+// q.cqlFilter()
+func featureMatches(f *Feature, q Query, pfs []PropertyFilter, cf *cqlFilter) bool {
+	if q.Extent != nil && !extentsIntersect(geometryExtent(f.Geometry), q.Extent) {
+		return false
+	}
+	for _, pf := range pfs {
+		if !pf.matches(f) {
+			return false
+		}
+	}
+	if cf != nil && !cf.matches(f) {
+		return false
+	}
+	return q.Time == nil || featureTimeMatches(f, *q.Time, q.Temporal)
+}
+
+// The features from fs passing q's extent, property & CQL2 filters, for sources filtering in memory.
+func matchingFeatures(ctx context.Context, fs []*Feature, q Query) ([]*Feature, error) {
+	pfs, err := q.propertyFilters()
+	if err != nil {
+		return nil, err
+	}
+	cf, err := q.cqlFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	mfs := make([]*Feature, 0, len(fs))
+	for i, f := range fs {
+		if i%ctxCheckInterval == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if featureMatches(f, q, pfs, cf) {
+			mfs = append(mfs, f)
+		}
+	}
+	return mfs, nil
+}
+
+// Sorts fs, which are the features matching q, by q.Nearest or q.SortBy & applies q.Offset &
+// q.Limit to them
+func pageFeatures(fs []*Feature, q Query) []*Feature {
+	if q.Nearest != nil {
+		sortByDistance(fs, *q.Nearest)
+	} else {
+		sortFeatures(fs, q.SortBy)
+	}
+	total := uint(len(fs))
+	startIdx := q.Offset
+	if startIdx > total {
+		startIdx = total
+	}
+	stopIdx := total
+	if q.Limit > 0 && startIdx+q.Limit < total {
+		stopIdx = startIdx + q.Limit
+	}
+
+	return fs[startIdx:stopIdx]
+}
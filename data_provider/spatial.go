@@ -0,0 +1,408 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project spatial.go
+
+package data_provider
+
+import (
+	"math"
+	"sort"
+
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/cmp"
+	"github.com/go-spatial/geom/planar"
+	"github.com/go-spatial/jivan/cql2"
+)
+
+// Mean radius of the earth in meters
+const earthRadius = 6371008.8
+
+// The parts of a geometry spatial predicates work on.  As in PostGIS, geometries touching only at
+// their boundaries intersect, but one is only within another if their interiors meet, so i.e. a
+// point on a polygon's edge isn't within it.
+type geometryParts struct {
+	points [][2]float64
+	lines  [][][2]float64
+	// Each an outer ring followed by any holes
+	polygons [][][][2]float64
+}
+
+// g split into its parts, w/ collections flattened.  Unsupported geometry types are left out.
+func splitGeometry(g geom.Geometry) geometryParts {
+	var gp geometryParts
+	var add func(g geom.Geometry)
+	add = func(g geom.Geometry) {
+		switch tg := g.(type) {
+		case geom.Point:
+			gp.points = append(gp.points, tg)
+		case geom.MultiPoint:
+			gp.points = append(gp.points, tg...)
+		case geom.LineString:
+			gp.lines = append(gp.lines, tg)
+		case geom.MultiLineString:
+			gp.lines = append(gp.lines, tg...)
+		case geom.Polygon:
+			gp.polygons = append(gp.polygons, tg)
+		case geom.MultiPolygon:
+			gp.polygons = append(gp.polygons, tg...)
+		case geom.Collection:
+			for _, cg := range tg {
+				add(cg)
+			}
+		}
+	}
+	add(g)
+	return gp
+}
+
+func (gp geometryParts) vertices() [][2]float64 {
+	vs := append([][2]float64{}, gp.points...)
+	for _, l := range gp.lines {
+		vs = append(vs, l...)
+	}
+	for _, p := range gp.polygons {
+		for _, r := range p {
+			vs = append(vs, r...)
+		}
+	}
+	return vs
+}
+
+// Segments of gp's lines & polygon rings, rings are closed if they aren't already
+func (gp geometryParts) segments() [][2][2]float64 {
+	return append(gp.lineSegments(), gp.ringSegments()...)
+}
+
+func (gp geometryParts) lineSegments() [][2][2]float64 {
+	var ss [][2][2]float64
+	for _, l := range gp.lines {
+		for i := 1; i < len(l); i++ {
+			ss = append(ss, [2][2]float64{l[i-1], l[i]})
+		}
+	}
+	return ss
+}
+
+func (gp geometryParts) ringSegments() [][2][2]float64 {
+	var ss [][2][2]float64
+	for _, p := range gp.polygons {
+		for _, r := range p {
+			for i := range r {
+				if next := r[(i+1)%len(r)]; next != r[i] {
+					ss = append(ss, [2][2]float64{r[i], next})
+				}
+			}
+		}
+	}
+	return ss
+}
+
+// Whether pt is one of gp's points, on one of its lines, or in or on one of its polygons
+func (gp geometryParts) covers(pt [2]float64) bool {
+	for _, p := range gp.points {
+		if p == pt {
+			return true
+		}
+	}
+	for _, l := range gp.lines {
+		for i := 1; i < len(l); i++ {
+			if onSegment(pt, l[i-1], l[i]) {
+				return true
+			}
+		}
+	}
+	for _, p := range gp.polygons {
+		if pointInPolygon(pt, p) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether pt is in the interior of one of gp's polygons
+func (gp geometryParts) areaCovers(pt [2]float64) bool {
+	for _, p := range gp.polygons {
+		if pointInPolygon(pt, p) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether pt is in gp's interior: one of its points, on one of its lines but not at the ends of
+// one that isn't closed, or in the interior of one of its polygons
+func (gp geometryParts) interiorCovers(pt [2]float64) bool {
+	for _, p := range gp.points {
+		if p == pt {
+			return true
+		}
+	}
+	for _, l := range gp.lines {
+		if len(l) == 0 || (l[0] != l[len(l)-1] && (pt == l[0] || pt == l[len(l)-1])) {
+			continue
+		}
+		for i := 1; i < len(l); i++ {
+			if onSegment(pt, l[i-1], l[i]) {
+				return true
+			}
+		}
+	}
+	return gp.areaCovers(pt)
+}
+
+// 1 if pt is inside poly, 0 if it's on its boundary & -1 if it's outside
+func pointInPolygon(pt [2]float64, poly [][][2]float64) int {
+	inside := false
+	for _, r := range poly {
+		for i := range r {
+			a, b := r[i], r[(i+1)%len(r)]
+			if onSegment(pt, a, b) {
+				return 0
+			}
+			if (a[1] > pt[1]) != (b[1] > pt[1]) && pt[0] < (b[0]-a[0])*(pt[1]-a[1])/(b[1]-a[1])+a[0] {
+				inside = !inside
+			}
+		}
+	}
+	if inside {
+		return 1
+	}
+	return -1
+}
+
+// Whether pt is on the segment from a to b
+func onSegment(pt, a, b [2]float64) bool {
+	return planar.IsPointOnLineSegment(cmp.HiCMP, geom.Point(pt), geom.Line{a, b})
+}
+
+// Whether an end of one of segments a-b & c-d is on the other
+func segmentsTouch(a, b, c, d [2]float64) bool {
+	return onSegment(a, c, d) || onSegment(b, c, d) || onSegment(c, a, b) || onSegment(d, a, b)
+}
+
+// Whether segments a-b & c-d cross at a point in the interior of both
+func segmentsCross(a, b, c, d [2]float64) bool {
+	_, ok := planar.SegmentIntersect(geom.Line{a, b}, geom.Line{c, d})
+	return ok && !segmentsTouch(a, b, c, d)
+}
+
+// Whether segments a-b & c-d share a point.  Parallel segments only do where they touch.
+func segmentsIntersect(a, b, c, d [2]float64) bool {
+	_, ok := planar.SegmentIntersect(geom.Line{a, b}, geom.Line{c, d})
+	return ok || segmentsTouch(a, b, c, d)
+}
+
+// Whether a & b share a point
+func geometriesIntersect(a, b geometryParts) bool {
+	bs := b.segments()
+	for _, s := range a.segments() {
+		for _, t := range bs {
+			if segmentsIntersect(s[0], s[1], t[0], t[1]) {
+				return true
+			}
+		}
+	}
+	// One inside the other, or points
+	for _, v := range a.vertices() {
+		if b.covers(v) {
+			return true
+		}
+	}
+	for _, v := range b.vertices() {
+		if a.covers(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether every point of a is in b
+func geometryWithin(a, b geometryParts) bool {
+	vs := a.vertices()
+	if len(vs) == 0 || (len(a.polygons) > 0 && len(b.polygons) == 0) {
+		return false
+	}
+	for _, v := range vs {
+		if !b.covers(v) {
+			return false
+		}
+	}
+	// A's interior has to meet b's, which an area of a in b's areas always does
+	interiors := len(a.polygons) > 0
+	for _, p := range a.points {
+		interiors = interiors || b.interiorCovers(p)
+	}
+	bvs := b.vertices()
+	bs := b.segments()
+	als := a.lineSegments()
+	for i, s := range append(als, a.ringSegments()...) {
+		for _, t := range bs {
+			if segmentsCross(s[0], s[1], t[0], t[1]) {
+				return false
+			}
+		}
+		// W/o crossings s can only leave b where it touches b's vertices, check each piece between
+		ts := []float64{0, 1}
+		d := [2]float64{s[1][0] - s[0][0], s[1][1] - s[0][1]}
+		for _, v := range bvs {
+			if onSegment(v, s[0], s[1]) {
+				ts = append(ts, ((v[0]-s[0][0])*d[0]+(v[1]-s[0][1])*d[1])/(d[0]*d[0]+d[1]*d[1]))
+			}
+		}
+		sort.Float64s(ts)
+		for j := 1; j < len(ts); j++ {
+			m := (ts[j-1] + ts[j]) / 2
+			pt := [2]float64{s[0][0] + m*d[0], s[0][1] + m*d[1]}
+			if !b.covers(pt) {
+				return false
+			}
+			// Each piece is either on b's boundary or in its interior
+			interiors = interiors || (i < len(als) && b.interiorCovers(pt))
+		}
+	}
+	// b's boundary, such as a hole, can't be inside an area of a
+	for _, v := range bvs {
+		if a.areaCovers(v) {
+			return false
+		}
+	}
+	return interiors
+}
+
+// Whether a is in spatial relation op (a supported cql2 spatial predicate) w/ b
+func spatialRelation(op string, a, b geometryParts) bool {
+	switch op {
+	case cql2.SpatialIntersects:
+		return geometriesIntersect(a, b)
+	case cql2.SpatialDisjoint:
+		return !geometriesIntersect(a, b)
+	case cql2.SpatialWithin:
+		return geometryWithin(a, b)
+	case cql2.SpatialContains:
+		return geometryWithin(b, a)
+	case cql2.SpatialEquals:
+		return geometryWithin(a, b) && geometryWithin(b, a)
+	}
+	return false
+}
+
+// Distance in meters between lon/lat geometries a & b.  Between points this is along a great
+// circle, otherwise it's measured on a plane tangent to the earth at the center of b which is
+// accurate to within a fraction of a percent over tens of kilometers.
+func geometryDistance(a, b geometryParts) float64 {
+	if geometriesIntersect(a, b) {
+		return 0
+	}
+	if len(a.lines)+len(a.polygons)+len(b.lines)+len(b.polygons) == 0 {
+		d := math.Inf(1)
+		for _, ap := range a.points {
+			for _, bp := range b.points {
+				d = math.Min(d, geodesicDistance(ap, bp))
+			}
+		}
+		return d
+	}
+	e := geometryExtent(geom.MultiPoint(b.vertices()))
+	if e == nil {
+		return math.Inf(1)
+	}
+	lon0, lat0 := (e[0]+e[2])/2, (e[1]+e[3])/2
+	ky := earthRadius * math.Pi / 180
+	kx := ky * math.Cos(lat0*math.Pi/180)
+	project := func(gp geometryParts) [][2][2]float64 {
+		ss := gp.segments()
+		// Points as segments of no length
+		for _, p := range gp.points {
+			ss = append(ss, [2][2]float64{p, p})
+		}
+		for i := range ss {
+			for j := range ss[i] {
+				ss[i][j] = [2]float64{(ss[i][j][0] - lon0) * kx, (ss[i][j][1] - lat0) * ky}
+			}
+		}
+		return ss
+	}
+
+	// W/o an intersection the closest points include an end of one of the segments
+	d := math.Inf(1)
+	bs := project(b)
+	for _, s := range project(a) {
+		for _, t := range bs {
+			d = math.Min(d, math.Min(
+				math.Min(segmentDistance(s[0], t), segmentDistance(s[1], t)),
+				math.Min(segmentDistance(t[0], s), segmentDistance(t[1], s))))
+		}
+	}
+	return d
+}
+
+// Great circle distance in meters between lon/lat points a & b
+func geodesicDistance(a, b [2]float64) float64 {
+	rad := math.Pi / 180
+	sinLat, sinLon := math.Sin((b[1]-a[1])*rad/2), math.Sin((b[0]-a[0])*rad/2)
+	h := sinLat*sinLat + math.Cos(a[1]*rad)*math.Cos(b[1]*rad)*sinLon*sinLon
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Distance in meters from lon/lat point pt to f's geometry, false if f has none
+func featureDistance(f *Feature, pt geom.Point) (float64, bool) {
+	g, err := DefaultCRS.transform(f.Geometry, f.SRID)
+	if err != nil {
+		return 0, false
+	}
+	gp := splitGeometry(g)
+	if len(gp.vertices()) == 0 {
+		return 0, false
+	}
+	return geometryDistance(gp, splitGeometry(pt)), true
+}
+
+// Copies of fs w/ their distance in meters from lon/lat point pt as DistanceProperty, features
+// w/o a geometry don't get one
+func withDistances(fs []*Feature, pt geom.Point) []*Feature {
+	dfs := make([]*Feature, len(fs))
+	for i, f := range fs {
+		df := &Feature{ID: f.ID, SRID: f.SRID, Geometry: f.Geometry, Properties: make(map[string]interface{}, len(f.Properties)+1)}
+		for k, v := range f.Properties {
+			df.Properties[k] = v
+		}
+		if d, ok := featureDistance(f, pt); ok {
+			df.Properties[DistanceProperty] = d
+		}
+		dfs[i] = df
+	}
+	return dfs
+}
+
+// Planar distance from pt to segment s
+func segmentDistance(pt [2]float64, s [2][2]float64) float64 {
+	return planar.DistanceToLineSegment(geom.Point(pt), geom.Point(s[0]), geom.Point(s[1]))
+}
+
+// e as a polygon
+func extentPolygon(e geom.Extent) geom.Polygon {
+	return geom.Polygon{{{e[0], e[1]}, {e[2], e[1]}, {e[2], e[3]}, {e[0], e[3]}, {e[0], e[1]}}}
+}
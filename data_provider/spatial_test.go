@@ -0,0 +1,138 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project spatial_test.go
+
+package data_provider
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/jivan/cql2"
+)
+
+func TestSpatialRelation(t *testing.T) {
+	square := geom.Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}}}
+	// The square w/ a hole in the middle
+	frame := geom.Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}}, {{1, 1}, {3, 1}, {3, 3}, {1, 3}, {1, 1}}}
+	// A U shape, open at the top between x = 1 & x = 3
+	u := geom.Polygon{{{0, 0}, {4, 0}, {4, 4}, {3, 4}, {3, 1}, {1, 1}, {1, 4}, {0, 4}, {0, 0}}}
+
+	type tcase struct {
+		op       string
+		a, b     geom.Geometry
+		expected bool
+	}
+	tcases := []tcase{
+		{op: cql2.SpatialIntersects, a: geom.Point{2, 2}, b: square, expected: true},
+		{op: cql2.SpatialIntersects, a: geom.Point{4, 2}, b: square, expected: true},
+		{op: cql2.SpatialIntersects, a: geom.Point{5, 2}, b: square, expected: false},
+		{op: cql2.SpatialIntersects, a: geom.Point{2, 2}, b: frame, expected: false},
+		{op: cql2.SpatialIntersects, a: geom.LineString{{-1, 2}, {5, 2}}, b: square, expected: true},
+		{op: cql2.SpatialIntersects, a: geom.LineString{{2, 5}, {2, 6}}, b: square, expected: false},
+		{op: cql2.SpatialIntersects, a: geom.Polygon{{{1, 1}, {2, 1}, {2, 2}, {1, 1}}}, b: square, expected: true},
+		{op: cql2.SpatialIntersects, a: geom.MultiPoint{{9, 9}, {2, 2}}, b: square, expected: true},
+		{op: cql2.SpatialIntersects, a: geom.Collection{geom.Point{9, 9}, geom.LineString{{3, 3}, {5, 5}}}, b: square, expected: true},
+		{op: cql2.SpatialDisjoint, a: geom.Point{5, 2}, b: square, expected: true},
+		{op: cql2.SpatialWithin, a: geom.Point{2, 2}, b: square, expected: true},
+		{op: cql2.SpatialWithin, a: geom.LineString{{1, 1}, {3, 3}}, b: square, expected: true},
+		{op: cql2.SpatialWithin, a: geom.LineString{{1, 1}, {5, 5}}, b: square, expected: false},
+		// Through the gap of the U, touching it only at its vertices
+		{op: cql2.SpatialWithin, a: geom.LineString{{0, 1}, {4, 1}}, b: u, expected: true},
+		{op: cql2.SpatialWithin, a: geom.LineString{{0, 2}, {4, 2}}, b: u, expected: false},
+		{op: cql2.SpatialWithin, a: geom.LineString{{1, 4}, {3, 4}}, b: u, expected: false},
+		{op: cql2.SpatialWithin, a: geom.Polygon{{{1, 1}, {2, 1}, {2, 2}, {1, 1}}}, b: square, expected: true},
+		{op: cql2.SpatialWithin, a: square, b: frame, expected: false},
+		{op: cql2.SpatialWithin, a: square, b: geom.LineString{{0, 0}, {4, 4}}, expected: false},
+		{op: cql2.SpatialContains, a: square, b: geom.Point{2, 2}, expected: true},
+		{op: cql2.SpatialContains, a: frame, b: geom.Point{2, 2}, expected: false},
+		{op: cql2.SpatialEquals, a: square, b: geom.Polygon{{{4, 4}, {0, 4}, {0, 0}, {4, 0}, {4, 4}}}, expected: true},
+		{op: cql2.SpatialEquals, a: square, b: u, expected: false},
+		// Boundary & touching cases, expecting what PostGIS' ST_Intersects(), ST_Within() etc. give
+		{op: cql2.SpatialIntersects, a: geom.Point{4, 4}, b: square, expected: true},
+		{op: cql2.SpatialIntersects, a: geom.Point{1, 2}, b: frame, expected: true},
+		{op: cql2.SpatialIntersects, a: geom.LineString{{4, 0}, {6, 0}}, b: square, expected: true},
+		{op: cql2.SpatialIntersects, a: geom.LineString{{4.5, 0}, {4.5, 4}}, b: square, expected: false},
+		{op: cql2.SpatialIntersects, a: geom.LineString{{0, 0}, {2, 0}}, b: geom.LineString{{1, 0}, {3, 0}}, expected: true},
+		{op: cql2.SpatialIntersects, a: geom.LineString{{0, 0}, {2, 0}}, b: geom.LineString{{0, 1}, {2, 1}}, expected: false},
+		{op: cql2.SpatialIntersects, a: geom.LineString{{0, 2}, {2, 0}}, b: geom.LineString{{0, 0}, {2, 2}}, expected: true},
+		{op: cql2.SpatialIntersects, a: geom.Polygon{{{4, 0}, {8, 0}, {8, 4}, {4, 4}, {4, 0}}}, b: square, expected: true},
+		{op: cql2.SpatialIntersects, a: geom.Polygon{{{4, 4}, {6, 4}, {6, 6}, {4, 6}, {4, 4}}}, b: square, expected: true},
+		{op: cql2.SpatialDisjoint, a: geom.LineString{{4, 0}, {6, 0}}, b: square, expected: false},
+		{op: cql2.SpatialDisjoint, a: geom.Polygon{{{4, 4}, {6, 4}, {6, 6}, {4, 6}, {4, 4}}}, b: square, expected: false},
+		{op: cql2.SpatialWithin, a: geom.Point{4, 2}, b: square, expected: false},
+		{op: cql2.SpatialWithin, a: geom.Point{0, 0}, b: square, expected: false},
+		{op: cql2.SpatialWithin, a: geom.Point{1, 2}, b: frame, expected: false},
+		{op: cql2.SpatialWithin, a: geom.MultiPoint{{0, 0}, {2, 2}}, b: square, expected: true},
+		{op: cql2.SpatialWithin, a: geom.MultiPoint{{0, 0}, {4, 4}}, b: square, expected: false},
+		{op: cql2.SpatialWithin, a: geom.LineString{{0, 0}, {4, 0}}, b: square, expected: false},
+		{op: cql2.SpatialWithin, a: geom.LineString{{0, 0}, {2, 2}}, b: square, expected: true},
+		{op: cql2.SpatialWithin, a: geom.LineString{{0, 2}, {4, 2}}, b: square, expected: true},
+		{op: cql2.SpatialWithin, a: square, b: square, expected: true},
+		{op: cql2.SpatialWithin, a: geom.Polygon{{{0, 0}, {2, 0}, {2, 2}, {0, 2}, {0, 0}}}, b: square, expected: true},
+		{op: cql2.SpatialWithin, a: geom.Polygon{{{4, 0}, {8, 0}, {8, 4}, {4, 4}, {4, 0}}}, b: square, expected: false},
+		{op: cql2.SpatialWithin, a: geom.Point{0, 0}, b: geom.LineString{{0, 0}, {1, 1}}, expected: false},
+		{op: cql2.SpatialWithin, a: geom.Point{0.5, 0.5}, b: geom.LineString{{0, 0}, {1, 1}}, expected: true},
+		{op: cql2.SpatialWithin, a: geom.LineString{{0, 0}, {1, 1}}, b: geom.LineString{{0, 0}, {2, 2}}, expected: true},
+		{op: cql2.SpatialWithin, a: geom.Point{1, 1}, b: geom.Point{1, 1}, expected: true},
+		{op: cql2.SpatialContains, a: square, b: geom.Point{4, 2}, expected: false},
+		{op: cql2.SpatialContains, a: square, b: geom.LineString{{0, 0}, {4, 0}}, expected: false},
+		{op: cql2.SpatialContains, a: geom.LineString{{0, 0}, {4, 0}}, b: geom.LineString{{1, 0}, {2, 0}}, expected: true},
+		{op: cql2.SpatialEquals, a: geom.LineString{{0, 0}, {2, 2}}, b: geom.LineString{{2, 2}, {1, 1}, {0, 0}}, expected: true},
+		{op: cql2.SpatialEquals, a: geom.LineString{{0, 0}, {2, 2}}, b: geom.LineString{{0, 0}, {1, 1}}, expected: false},
+	}
+	for i, tc := range tcases {
+		if r := spatialRelation(tc.op, splitGeometry(tc.a), splitGeometry(tc.b)); r != tc.expected {
+			t.Errorf("[%v] %v(%v, %v) is %v, wanted %v", i, tc.op, tc.a, tc.b, r, tc.expected)
+		}
+	}
+}
+
+func TestGeometryDistance(t *testing.T) {
+	// Meters per degree of latitude
+	degree := earthRadius * math.Pi / 180
+
+	type tcase struct {
+		a, b     geom.Geometry
+		expected float64
+	}
+	tcases := []tcase{
+		{a: geom.Point{0, 0}, b: geom.Point{0, 1}, expected: degree},
+		{a: geom.Point{0, 1}, b: geom.LineString{{-1, 0}, {1, 0}}, expected: degree},
+		// A degree of longitude at 60° is half as long
+		{a: geom.Point{1, 60}, b: geom.Point{0, 60}, expected: degree / 2},
+		{a: geom.Point{0.5, 0.5}, b: geom.Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}, expected: 0},
+		// Longitude is scaled for the latitude of the center of b
+		{a: geom.LineString{{2, -1}, {2, 1}}, b: geom.Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}, expected: degree * math.Cos(0.5*math.Pi/180)},
+	}
+	for i, tc := range tcases {
+		d := geometryDistance(splitGeometry(tc.a), splitGeometry(tc.b))
+		if math.Abs(d-tc.expected) > 1 {
+			t.Errorf("[%v] distance from %v to %v is %v, wanted %v", i, tc.a, tc.b, d, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,825 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project sql_querier.go
+
+package data_provider
+
+// Common machinery for backends we can talk SQL to directly (GeoPackage & PostGIS).
+// The dialect-specific bits live in gpkg_querier.go & postgis_querier.go.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-spatial/geom"
+)
+
+// A feature table in a SQL backend
+type sqlTable struct {
+	// Collection name the table is served as
+	name string
+	// Quoted, possibly schema-qualified, name for use in statements
+	qualifiedName string
+	// Columns whose values identify a feature, the primary key unless set otherwise.  Several
+	// make a compositeId().
+	idColumns []string
+	// The table's primary key, which stays among columns if other id columns are set
+	pkColumns  []string
+	geomColumn string
+	srid       uint64
+	// All other columns in table order, these become feature properties
+	columns []string
+	// Kind of each column's values (see sqlTypeKind()) including the id columns, keyed by column name
+	kinds map[string]int
+	// Set when features aren't identified by a single integer primary key, which is how the
+	// Tiler identifies them
+	customIds bool
+	// Human readable title & description from the backend's metadata, if it has them
+	title       string
+	description string
+	// GeoPackage only: name of the table's rtree spatial index, empty if there isn't one
+	rtree string
+	// GeoPackage only: the table's extent according to gpkg_contents, nil if it isn't recorded
+	contentsExtent *geom.Extent
+	// Query the collection is defined by (see SQLCollection), empty for a table
+	sql string
+}
+
+// A collection defined by a SQL query rather than a table
+type SQLCollection struct {
+	Name string
+	// Must select GeometryColumn & IDColumn, all other columns become properties.
+	SQL            string
+	GeometryColumn string
+	// Must be selected & have unique (combined) values
+	IDColumns []string
+	// Spatial reference id of the geometries, if 0 it's looked up from the first geometry
+	SRID uint64
+}
+
+func (t *sqlTable) hasColumn(name string) bool {
+	for _, c := range t.columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *sqlTable) isIdColumn(name string) bool {
+	for _, c := range t.idColumns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *sqlTable) isPkColumn(name string) bool {
+	for _, c := range t.pkColumns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether t's features are read through the querier alone, w/ filters that can't be applied in
+// SQL applied in memory, rather than leaving those queries to the Tiler.
+func (t *sqlTable) querierOnly() bool {
+	return t.sql != "" || t.customIds
+}
+
+// Makes columns t's id columns, the previous id columns become properties
+func (t *sqlTable) setIdColumns(columns []string) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("no id columns given for '%v'", t.name)
+	}
+	for _, c := range columns {
+		if !t.hasColumn(c) && !t.isIdColumn(c) {
+			return fmt.Errorf("'%v' has no column '%v'", t.name, c)
+		}
+	}
+
+	all := make([]string, 0, len(t.idColumns)+len(t.columns))
+	all = append(all, t.idColumns...)
+	all = append(all, t.columns...)
+	props := make([]string, 0, len(all))
+	for _, c := range all {
+		isId := false
+		for _, idc := range columns {
+			isId = isId || c == idc
+		}
+		if !isId {
+			props = append(props, c)
+		}
+	}
+	t.columns = props
+	t.idColumns = columns
+	t.customIds = len(columns) != 1 || t.kinds[columns[0]] != kindInteger
+	return nil
+}
+
+// Expression ordering t's features by id
+func (t *sqlTable) idOrder() string {
+	cols := make([]string, len(t.idColumns))
+	for i, c := range t.idColumns {
+		cols[i] = quoteIdent(c)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// ORDER BY expressions sorting t's features by keys then id, w/ NULLs last as sortFeatures() does.
+// Returns ErrQueryNotSupported for a key that isn't one of t's columns.
+func (t *sqlTable) sortOrder(keys []SortKey) (string, error) {
+	exprs := make([]string, 0, 2*len(keys)+1)
+	for _, k := range keys {
+		if !t.hasColumn(k.Property) {
+			return "", ErrQueryNotSupported
+		}
+		dir := "ASC"
+		if k.Descending {
+			dir = "DESC"
+		}
+		exprs = append(exprs, fmt.Sprintf("%v IS NULL", quoteIdent(k.Property)), fmt.Sprintf("%v %v", quoteIdent(k.Property), dir))
+	}
+	exprs = append(exprs, t.idOrder())
+	return strings.Join(exprs, ", "), nil
+}
+
+// Condition matching t's feature w/ id, false if id can't be one of t's ids
+func (t *sqlTable) idCondition(id string, args *sqlArgs) (string, bool) {
+	parts := []string{id}
+	if len(t.idColumns) > 1 {
+		var ok bool
+		if parts, ok = splitCompositeId(id, len(t.idColumns)); !ok {
+			return "", false
+		}
+	}
+
+	vals := make([]interface{}, len(parts))
+	for i, p := range parts {
+		v, err := filterValue(t.idColumns[i], t.kinds[t.idColumns[i]], p)
+		if err != nil {
+			return "", false
+		}
+		vals[i] = v
+	}
+	conditions := make([]string, len(vals))
+	for i, v := range vals {
+		conditions[i] = fmt.Sprintf("%v = %v", quoteIdent(t.idColumns[i]), args.add(v))
+	}
+	if len(conditions) == 1 {
+		return conditions[0], true
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", true
+}
+
+// The parts of a statement that differ between SQL backends
+type sqlDialect interface {
+	// Placeholder for the n-th (1-based) statement argument
+	placeholder(n int) string
+	// Expression selecting t's geometry in a form decodeGeometry() understands
+	selectGeometry(t *sqlTable) string
+	decodeGeometry(b []byte) (geom.Geometry, error)
+	// Condition limiting rows to those intersecting the lat/lon extent e.
+	// Returns ErrQueryNotSupported if the backend can't do this for t.
+	extentCondition(t *sqlTable, e *geom.Extent, args *sqlArgs) (string, error)
+	// Condition limiting rows to those whose geometry is in spatial relation op to the lon/lat
+	// geometry g, a key of spatialOpsSwapped, within distance meters for cql2.SpatialDWithin.
+	// Returns ErrQueryNotSupported if the backend can't do this for t.
+	spatialCondition(t *sqlTable, op string, g geom.Geometry, distance float64, args *sqlArgs) (string, error)
+	// ORDER BY expression sorting rows by the distance of their geometries from lon/lat point pt,
+	// nearest first w/ NULL geometries last.  Returns ErrQueryNotSupported if the backend can't
+	// do this for t.
+	nearestOrder(t *sqlTable, pt geom.Point, args *sqlArgs) (string, error)
+	// Expression for the time held in t's column, comparable w/ timeArg() values & NULL where
+	// there isn't one.  Returns ErrQueryNotSupported if the backend can't compare the column's
+	// values as times.
+	timeValue(t *sqlTable, column string) (string, error)
+	// Expression for tm, comparable w/ timeValue() expressions
+	timeArg(tm time.Time, args *sqlArgs) string
+	// Condition matching the text of column against SQL LIKE pattern, w/ '\' as the escape
+	// character, case-sensitively as LIKE filters are matched in memory
+	likeCondition(column, pattern string, not bool, args *sqlArgs) string
+	// The time in v, a timeValue() expression or an aggregate of one as read from a row, false if
+	// v isn't a time
+	scanTime(v interface{}) (time.Time, bool)
+	// Expression for geometry g in srid as stored in t, NULL for a nil g
+	geometryValue(t *sqlTable, g geom.Geometry, srid uint64, args *sqlArgs) (string, error)
+	// Runs stmt, an INSERT of a single row into t, returning the new feature's id.  Returns
+	// ErrQueryNotSupported if the backend can't tell the id of rows added to t.
+	insertRow(ctx context.Context, db *sql.DB, t *sqlTable, stmt string, args []interface{}) (string, error)
+	// LIMIT/OFFSET clause, limit of 0 means no limit
+	limitClause(limit, offset uint) string
+	// Spatial reference id of a geometry selected from t, 0 if t has none
+	geometrySRID(db *sql.DB, t *sqlTable) (uint64, error)
+	// Extent of t's geometries in t.srid w/o reading them all, nil if t is empty.
+	// Returns ErrQueryNotSupported if the backend can't do this for t.
+	extent(ctx context.Context, db *sql.DB, t *sqlTable) (*geom.Extent, error)
+}
+
+// Collects statement arguments, handing out the matching placeholders
+type sqlArgs struct {
+	dialect sqlDialect
+	values  []interface{}
+}
+
+func (a *sqlArgs) add(v interface{}) string {
+	a.values = append(a.values, v)
+	return a.dialect.placeholder(len(a.values))
+}
+
+// Implements Querier, FeatureGetter, CollectionDescriber, ExtentGetter, SQLCollectionAdder,
+// IdColumnSetter & FeatureWriter for GeoPackage & PostGIS
+type sqlQuerier struct {
+	db      *sql.DB
+	dialect sqlDialect
+	// Keyed by collection name
+	tables map[string]*sqlTable
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// Builds the WHERE clause (including the leading " WHERE ") for q against t
+func (sq *sqlQuerier) whereClause(t *sqlTable, q Query, args *sqlArgs) (string, error) {
+	conditions := make([]string, 0, len(q.Filters)+3)
+
+	if q.Extent != nil {
+		c, err := sq.dialect.extentCondition(t, q.Extent, args)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, c)
+	}
+
+	if q.Time != nil {
+		c, err := sq.timeCondition(t, q, args)
+		if err != nil {
+			return "", err
+		}
+		if c != "" {
+			conditions = append(conditions, c)
+		}
+	}
+
+	pfs, err := q.propertyFilters()
+	if err != nil {
+		return "", err
+	}
+	for _, pf := range pfs {
+		c, err := filterCondition(t, pf, args)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, c)
+	}
+
+	if q.Filter != nil {
+		c, err := sq.cqlCondition(t, q.Filter, args)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, "("+c+")")
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), nil
+}
+
+// Condition limiting rows to those whose time instant or interval according to q.Temporal
+// intersects q.Time, as featureTimeMatches() does: an instant takes the place of the interval & a
+// row w/o time values matches.  "" if no rows are excluded.
+func (sq *sqlQuerier) timeCondition(t *sqlTable, q Query, args *sqlArgs) (string, error) {
+	start, end, err := sq.timeBounds(t, q.Temporal)
+	if err != nil {
+		return "", err
+	}
+
+	// A NULL start or end is unbounded
+	conditions := make([]string, 0, 2)
+	if !q.Time.End.IsZero() && start != "NULL" {
+		conditions = append(conditions, fmt.Sprintf("(%v IS NULL OR %v <= %v)", start, start, sq.dialect.timeArg(q.Time.End, args)))
+	}
+	if !q.Time.Start.IsZero() && end != "NULL" {
+		conditions = append(conditions, fmt.Sprintf("(%v IS NULL OR %v >= %v)", end, end, sq.dialect.timeArg(q.Time.Start, args)))
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// Expressions for the start & end of a row's time instant or interval according to tp, as
+// featureTime() has them.  "NULL" for those t has no column for.
+func (sq *sqlQuerier) timeBounds(t *sqlTable, tp TemporalProperties) (start, end string, err error) {
+	if !tp.IsSet() {
+		tp = defaultTemporalProperties
+	}
+	vals := make([]string, 3)
+	for i, c := range []string{tp.Instant, tp.Start, tp.End} {
+		vals[i] = "NULL"
+		if c == "" || !t.hasColumn(c) {
+			continue
+		}
+		v, err := sq.dialect.timeValue(t, c)
+		if err != nil {
+			return "", "", err
+		}
+		vals[i] = v
+	}
+	return sqlCoalesce(vals[0], vals[1]), sqlCoalesce(vals[0], vals[2]), nil
+}
+
+// COALESCE(a, b) w/o the NULLs it would skip
+func sqlCoalesce(a, b string) string {
+	switch {
+	case a == "NULL":
+		return b
+	case b == "NULL":
+		return a
+	}
+	return fmt.Sprintf("COALESCE(%v, %v)", a, b)
+}
+
+// Adds a collection defined by a SQL query.  Filters that can't be applied in SQL are applied
+// in memory for these as there's no Tiler to fall back to.
+func (sq *sqlQuerier) AddSQLCollection(c SQLCollection) error {
+	if _, ok := sq.tables[c.Name]; ok {
+		return fmt.Errorf("collection name '%v' already in use", c.Name)
+	}
+	// It's used as a subquery
+	c.SQL = strings.TrimRight(strings.TrimSpace(c.SQL), ";")
+	if c.SQL == "" || c.GeometryColumn == "" || len(c.IDColumns) == 0 {
+		return fmt.Errorf("collection '%v' needs a SQL query, geometry column & id column", c.Name)
+	}
+
+	t := &sqlTable{
+		name:          c.Name,
+		qualifiedName: fmt.Sprintf("(%v) AS %v", c.SQL, quoteIdent(c.Name)),
+		idColumns:     c.IDColumns,
+		geomColumn:    c.GeometryColumn,
+		srid:          c.SRID,
+		sql:           c.SQL,
+	}
+
+	// The query's columns w/o reading any rows
+	rows, err := sq.db.Query(fmt.Sprintf("SELECT * FROM %v LIMIT 0", t.qualifiedName))
+	if err != nil {
+		return fmt.Errorf("problem running the query for collection '%v': %v", c.Name, err)
+	}
+	columns, err := rows.ColumnTypes()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	t.kinds = make(map[string]int, len(columns))
+	var idCount int
+	var hasGeom bool
+	for _, col := range columns {
+		switch {
+		case t.isIdColumn(col.Name()):
+			idCount++
+			t.kinds[col.Name()] = sqlTypeKind(col.DatabaseTypeName())
+		case col.Name() == t.geomColumn:
+			hasGeom = true
+		default:
+			t.columns = append(t.columns, col.Name())
+			t.kinds[col.Name()] = sqlTypeKind(col.DatabaseTypeName())
+		}
+	}
+	if idCount != len(t.idColumns) || !hasGeom {
+		return fmt.Errorf("the query for collection '%v' must select columns '%v' & '%v'",
+			c.Name, strings.Join(c.IDColumns, "', '"), c.GeometryColumn)
+	}
+
+	if t.srid == 0 {
+		if t.srid, err = sq.dialect.geometrySRID(sq.db, t); err != nil {
+			return fmt.Errorf("problem finding the srid of collection '%v': %v", c.Name, err)
+		}
+	}
+
+	sq.tables[c.Name] = t
+	return nil
+}
+
+// Identifies the features of a table or SQL collection by the values of columns
+func (sq *sqlQuerier) SetIdColumns(collection string, columns []string) error {
+	t, ok := sq.tables[collection]
+	if !ok {
+		return fmt.Errorf("no table or SQL collection named '%v'", collection)
+	}
+	return t.setIdColumns(columns)
+}
+
+// Condition for a property filter, values are converted to the column's type
+func filterCondition(t *sqlTable, pf PropertyFilter, args *sqlArgs) (string, error) {
+	if !t.hasColumn(pf.Property) {
+		// A feature without the property never matches
+		return "1 = 0", nil
+	}
+	col := quoteIdent(pf.Property)
+	kind := t.kinds[pf.Property]
+	if pf.Op == OpLike {
+		return args.dialect.likeCondition(col, sqlLikePattern(pf.Values[0]), false, args), nil
+	}
+
+	// Dates & times compare chronologically, as compareProperty() has them
+	if kind == kindDate {
+		var err error
+		if col, err = args.dialect.timeValue(t, pf.Property); err != nil {
+			return "", err
+		}
+	}
+	value := func(s string) (string, error) {
+		v, err := filterValue(pf.Property, kind, s)
+		if err != nil {
+			return "", err
+		}
+		if kind == kindDate {
+			// filterValue() checked it parses
+			tm, _ := parse_time_string(s)
+			return args.dialect.timeArg(tm, args), nil
+		}
+		return args.add(v), nil
+	}
+
+	if pf.Op == OpIn {
+		placeholders := make([]string, len(pf.Values))
+		for i, s := range pf.Values {
+			var err error
+			if placeholders[i], err = value(s); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%v IN (%v)", col, strings.Join(placeholders, ", ")), nil
+	}
+	v, err := value(pf.Values[0])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v %v %v", col, pf.Op, v), nil
+}
+
+func (sq *sqlQuerier) QueryFeatures(ctx context.Context, q Query) ([]*Feature, error) {
+	t, ok := sq.tables[q.Collection]
+	if !ok {
+		return nil, ErrQueryNotSupported
+	}
+
+	args := &sqlArgs{dialect: sq.dialect}
+	where, err := sq.whereClause(t, q, args)
+	var order string
+	switch {
+	case err != nil:
+	case q.Nearest != nil:
+		if order, err = sq.dialect.nearestOrder(t, *q.Nearest, args); err == nil {
+			order += ", " + t.idOrder()
+		}
+	default:
+		order, err = t.sortOrder(q.SortBy)
+	}
+	if err == ErrQueryNotSupported && t.querierOnly() {
+		fs, err := sq.scanFeatures(ctx, t, q)
+		if err != nil {
+			return nil, err
+		}
+		return pageFeatures(fs, q), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sel := q.Select
+	// Distances are computed from the geometries
+	if q.Nearest != nil {
+		sel.SkipGeometry = false
+	}
+	stmt := fmt.Sprintf("%v%v ORDER BY %v%v",
+		sq.selectFeatures(t, sel), where, order, sq.dialect.limitClause(q.Limit, q.Offset))
+
+	return sq.queryFeatures(ctx, t, sel, stmt, args.values)
+}
+
+func (sq *sqlQuerier) CollectionSchema(collection string) (*CollectionSchema, error) {
+	t, ok := sq.tables[collection]
+	if !ok {
+		return nil, ErrQueryNotSupported
+	}
+
+	props := make([]string, len(t.columns))
+	copy(props, t.columns)
+	types := make(map[string]string, len(props))
+	for _, c := range props {
+		types[c] = kindPropertyType(t.kinds[c])
+	}
+	cs := &CollectionSchema{
+		Name:          t.name,
+		Title:         t.title,
+		Description:   t.description,
+		SRID:          t.srid,
+		CRS:           sridCRS(t.srid),
+		Properties:    props,
+		PropertyTypes: types,
+	}
+	return cs, nil
+}
+
+// Features from collection w/ ids in ids, using the backend's index on the id columns if it has one.
+func (sq *sqlQuerier) GetFeatures(ctx context.Context, collection string, ids []string) ([]*Feature, error) {
+	t, ok := sq.tables[collection]
+	if !ok {
+		return nil, ErrQueryNotSupported
+	}
+
+	args := &sqlArgs{dialect: sq.dialect}
+	conditions := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if c, ok := t.idCondition(id, args); ok {
+			conditions = append(conditions, c)
+		}
+	}
+	if len(conditions) == 0 {
+		return []*Feature{}, nil
+	}
+	stmt := fmt.Sprintf("%v WHERE %v ORDER BY %v",
+		sq.selectFeatures(t, Selection{}), strings.Join(conditions, " OR "), t.idOrder())
+
+	return sq.queryFeatures(ctx, t, Selection{}, stmt, args.values)
+}
+
+// t's columns selected by sel, in table order
+func (t *sqlTable) selectedColumns(sel Selection) []string {
+	if sel.Properties == nil {
+		return t.columns
+	}
+	cols := make([]string, 0, len(sel.Properties))
+	for _, c := range t.columns {
+		for _, p := range sel.Properties {
+			if c == p {
+				cols = append(cols, c)
+				break
+			}
+		}
+	}
+	return cols
+}
+
+// "SELECT <ids...>, <geometry>, <columns...> FROM <table>" in the form scanFeature() expects, w/
+// only the geometry & columns selected by sel.
+func (sq *sqlQuerier) selectFeatures(t *sqlTable, sel Selection) string {
+	cols := t.selectedColumns(sel)
+	selectCols := make([]string, 0, len(t.idColumns)+len(cols)+1)
+	for _, c := range t.idColumns {
+		selectCols = append(selectCols, quoteIdent(c))
+	}
+	if !sel.SkipGeometry {
+		selectCols = append(selectCols, sq.dialect.selectGeometry(t))
+	}
+	for _, c := range cols {
+		selectCols = append(selectCols, quoteIdent(c))
+	}
+	return fmt.Sprintf("SELECT %v FROM %v", strings.Join(selectCols, ", "), t.qualifiedName)
+}
+
+// Features from stmt, which selects what sel does in the form of selectFeatures()
+func (sq *sqlQuerier) queryFeatures(ctx context.Context, t *sqlTable, sel Selection, stmt string, args []interface{}) ([]*Feature, error) {
+	rows, err := sq.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fs := make([]*Feature, 0, 10)
+	for rows.Next() {
+		f, err := sq.scanFeature(t, sel, rows)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+
+	return fs, rows.Err()
+}
+
+func (sq *sqlQuerier) CountFeatures(ctx context.Context, q Query) (uint, error) {
+	t, ok := sq.tables[q.Collection]
+	if !ok {
+		return 0, ErrQueryNotSupported
+	}
+
+	args := &sqlArgs{dialect: sq.dialect}
+	where, err := sq.whereClause(t, q, args)
+	if err == ErrQueryNotSupported && t.querierOnly() {
+		fs, err := sq.scanFeatures(ctx, t, q)
+		if err != nil {
+			return 0, err
+		}
+		return uint(len(fs)), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	stmt := fmt.Sprintf("SELECT COUNT(*) FROM %v%v", t.qualifiedName, where)
+	if err := sq.db.QueryRowContext(ctx, stmt, args.values...).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return uint(count), nil
+}
+
+// All features of t matching q's filters, applied in memory.
+func (sq *sqlQuerier) scanFeatures(ctx context.Context, t *sqlTable, q Query) ([]*Feature, error) {
+	stmt := fmt.Sprintf("%v ORDER BY %v", sq.selectFeatures(t, Selection{}), t.idOrder())
+	fs, err := sq.queryFeatures(ctx, t, Selection{}, stmt, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Extent != nil {
+		if q.Extent, err = extentInSRID(q.Extent, t.srid); err != nil {
+			return nil, err
+		}
+	}
+	return matchingFeatures(ctx, fs, q)
+}
+
+// Extent of a collection from the backend's metadata or an aggregate, otherwise computed from
+// all of its features for a collection defined by SQL.  Returns ErrQueryNotSupported for tables
+// w/o the former, the Tiler handles those.
+func (sq *sqlQuerier) CollectionExtent(ctx context.Context, collection string) (*geom.Extent, error) {
+	t, ok := sq.tables[collection]
+	if !ok {
+		return nil, ErrQueryNotSupported
+	}
+	e, err := sq.dialect.extent(ctx, sq.db, t)
+	if err != ErrQueryNotSupported || t.sql == "" {
+		return e, err
+	}
+
+	fs, err := sq.scanFeatures(ctx, t, Query{Collection: collection})
+	if err != nil {
+		return nil, err
+	}
+	var extent *geom.Extent
+	for _, f := range fs {
+		extent = unionExtent(extent, geometryExtent(f.Geometry))
+	}
+	return extent, nil
+}
+
+// The time interval covered by a collection's rows according to tp, as temporalExtent() computes
+// it, from aggregates of their time values.  Returns ErrQueryNotSupported if those can't be
+// compared in SQL.
+func (sq *sqlQuerier) TemporalExtent(ctx context.Context, collection string, tp TemporalProperties) (*TimeInterval, error) {
+	t, ok := sq.tables[collection]
+	if !ok {
+		return nil, ErrQueryNotSupported
+	}
+	start, end, err := sq.timeBounds(t, tp)
+	if err != nil {
+		return nil, err
+	}
+	if start == "NULL" && end == "NULL" {
+		return nil, nil
+	}
+
+	// Only rows w/ time values count, those w/o a start or end leave the extent open at that end
+	minStart, startCount, maxEnd, endCount := "NULL", "0", "NULL", "0"
+	conditions := make([]string, 0, 2)
+	if start != "NULL" {
+		minStart, startCount = fmt.Sprintf("MIN(%v)", start), fmt.Sprintf("COUNT(%v)", start)
+		conditions = append(conditions, start+" IS NOT NULL")
+	}
+	if end != "NULL" {
+		maxEnd, endCount = fmt.Sprintf("MAX(%v)", end), fmt.Sprintf("COUNT(%v)", end)
+		conditions = append(conditions, end+" IS NOT NULL")
+	}
+	stmt := fmt.Sprintf("SELECT COUNT(*), %v, %v, %v, %v FROM %v WHERE %v",
+		minStart, startCount, maxEnd, endCount, t.qualifiedName, strings.Join(conditions, " OR "))
+
+	var total, starts, ends int64
+	var minVal, maxVal interface{}
+	if err := sq.db.QueryRowContext(ctx, stmt).Scan(&total, &minVal, &starts, &maxVal, &ends); err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, nil
+	}
+	te := &TimeInterval{}
+	if starts == total {
+		te.Start, _ = sq.dialect.scanTime(minVal)
+	}
+	if ends == total {
+		te.End, _ = sq.dialect.scanTime(maxVal)
+	}
+	return te, nil
+}
+
+// The id of the feature whose id columns have values vals
+func (t *sqlTable) featureId(vals []interface{}) (string, error) {
+	idParts := make([]string, len(t.idColumns))
+	for i, c := range t.idColumns {
+		switch id := vals[i].(type) {
+		case nil:
+			return "", fmt.Errorf("null value in id column '%v' of '%v'", c, t.name)
+		case []byte:
+			idParts[i] = string(id)
+		default:
+			idParts[i] = propertyString(id)
+		}
+	}
+	if len(idParts) == 1 {
+		return idParts[0], nil
+	}
+	return compositeId(idParts), nil
+}
+
+// Converts a row selected as (ids..., geometry, columns...) to a feature, w/ only the geometry &
+// columns selected by sel.
+func (sq *sqlQuerier) scanFeature(t *sqlTable, sel Selection, rows *sql.Rows) (*Feature, error) {
+	geomCount := 1
+	if sel.SkipGeometry {
+		geomCount = 0
+	}
+	vals := make([]interface{}, len(t.idColumns)+geomCount+len(t.selectedColumns(sel)))
+	valPtrs := make([]interface{}, len(vals))
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+	if err := rows.Scan(valPtrs...); err != nil {
+		return nil, err
+	}
+	return sq.rowFeature(t, sel, vals)
+}
+
+// The feature from the values of a row scanned by scanFeature()
+func (sq *sqlQuerier) rowFeature(t *sqlTable, sel Selection, vals []interface{}) (*Feature, error) {
+	idCount := len(t.idColumns)
+	cols := t.selectedColumns(sel)
+	geomCount := 1
+	if sel.SkipGeometry {
+		geomCount = 0
+	}
+
+	f := &Feature{SRID: t.srid, Properties: make(map[string]interface{}, len(cols))}
+
+	var err error
+	if f.ID, err = t.featureId(vals[:idCount]); err != nil {
+		return nil, err
+	}
+
+	// There's no geometry value when it's skipped
+	if !sel.SkipGeometry {
+		if gb, ok := vals[idCount].([]byte); ok && gb != nil {
+			g, err := sq.dialect.decodeGeometry(gb)
+			if err != nil {
+				return nil, fmt.Errorf("problem decoding geometry for '%v' feature %v: %v", t.name, f.ID, err)
+			}
+			f.Geometry = g
+		}
+	}
+
+	for i, c := range cols {
+		switch v := vals[i+idCount+geomCount].(type) {
+		case nil:
+		case []byte:
+			f.Properties[c] = string(v)
+		case time.Time:
+			f.Properties[c] = v.Format(time.RFC3339)
+		default:
+			f.Properties[c] = v
+		}
+	}
+
+	return f, nil
+}
@@ -0,0 +1,682 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project sql_querier_test.go
+
+package data_provider
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/encoding/wkb"
+)
+
+// A database/sql driver recording the statements run through it w/o a database behind it.
+// Queries return rows, which each hold a value for every selected column.
+type recordingDriver struct {
+	stmts []string
+	args  [][]driver.Value
+	rows  [][]driver.Value
+}
+
+var recorder = &recordingDriver{}
+
+func init() {
+	sql.Register("recording", recorder)
+}
+
+// A db recording to recorder, whose queries return rows
+func recordingDB(t *testing.T, rows [][]driver.Value) *sql.DB {
+	recorder.stmts, recorder.args, recorder.rows = nil, nil, rows
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatalf("sql.Open(): %v", err)
+	}
+	return db
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return recordingConn{d: d}, nil
+}
+
+type recordingConn struct {
+	d *recordingDriver
+}
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{d: c.d, query: query}, nil
+}
+
+func (c recordingConn) Close() error {
+	return nil
+}
+
+func (c recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions aren't recorded")
+}
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (s recordingStmt) Close() error {
+	return nil
+}
+
+func (s recordingStmt) NumInput() int {
+	return -1
+}
+
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.stmts = append(s.d.stmts, s.query)
+	s.d.args = append(s.d.args, args)
+	return driver.RowsAffected(len(s.d.rows)), nil
+}
+
+func (s recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.stmts = append(s.d.stmts, s.query)
+	s.d.args = append(s.d.args, args)
+	return &recordingRows{rows: s.d.rows}, nil
+}
+
+type recordingRows struct {
+	rows [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *recordingRows) Close() error {
+	return nil
+}
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// Tables as the GeoPackage & PostGIS queriers find them
+var (
+	gpkgRoads = &sqlTable{
+		name:          "roads",
+		qualifiedName: `"roads"`,
+		idColumns:     []string{"fid"},
+		geomColumn:    "geom",
+		srid:          4326,
+		columns:       []string{"name", "highway"},
+		kinds:         map[string]int{"fid": kindInteger, "name": kindString, "highway": kindString},
+		rtree:         "rtree_roads_geom",
+	}
+	postgisParcels = &sqlTable{
+		name:          "parcels",
+		qualifiedName: `"public"."parcels"`,
+		idColumns:     []string{"gid"},
+		geomColumn:    "geom",
+		srid:          3857,
+		columns:       []string{"owner", "area"},
+		kinds:         map[string]int{"gid": kindInteger, "owner": kindString, "area": kindFloat},
+	}
+)
+
+func TestWhereClause(t *testing.T) {
+	e := &geom.Extent{23.7, 37.9, 23.8, 38.0}
+	unindexed := *gpkgRoads
+	unindexed.rtree = ""
+	surveyed := *gpkgRoads
+	surveyed.columns = []string{"name", "surveyed"}
+	surveyed.kinds = map[string]int{"fid": kindInteger, "name": kindString, "surveyed": kindDate}
+	march := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	type tcase struct {
+		dialect  sqlDialect
+		table    *sqlTable
+		q        Query
+		expected string
+		args     []interface{}
+		err      error
+	}
+	tcases := []tcase{
+		{dialect: gpkgDialect{}, table: gpkgRoads, q: Query{}, expected: ""},
+		// Properties are compared as their columns' types
+		{
+			dialect:  gpkgDialect{},
+			table:    gpkgRoads,
+			q:        Query{Filters: []PropertyFilter{{Property: "highway", Op: OpEqual, Values: []string{"primary"}}, {Property: "name", Op: OpEqual, Values: []string{"Main St"}}}},
+			expected: ` WHERE "highway" = ? AND "name" = ?`,
+			args:     []interface{}{"primary", "Main St"},
+		},
+		{
+			dialect:  postgisDialect{},
+			table:    gpkgRoads,
+			q:        Query{Filters: []PropertyFilter{{Property: "highway", Op: OpEqual, Values: []string{"primary"}}, {Property: "name", Op: OpEqual, Values: []string{"Main St"}}}},
+			expected: ` WHERE "highway" = $1 AND "name" = $2`,
+			args:     []interface{}{"primary", "Main St"},
+		},
+		{
+			dialect: gpkgDialect{},
+			table:   gpkgRoads,
+			q: Query{Filters: []PropertyFilter{
+				{Property: "highway", Op: OpIn, Values: []string{"primary", "secondary"}},
+				{Property: "name", Op: OpLike, Values: []string{`Main*_\*`}},
+			}},
+			expected: ` WHERE "highway" IN (?, ?) AND CAST("name" AS TEXT) GLOB ?`,
+			args:     []interface{}{"primary", "secondary", `Main*_[*]`},
+		},
+		{
+			dialect:  postgisDialect{},
+			table:    gpkgRoads,
+			q:        Query{Filters: []PropertyFilter{{Property: "name", Op: OpLike, Values: []string{`Main*_\*`}}}},
+			expected: ` WHERE CAST("name" AS TEXT) LIKE $1 ESCAPE '\'`,
+			args:     []interface{}{`Main%\_*`},
+		},
+		{
+			dialect:  postgisDialect{},
+			table:    postgisParcels,
+			q:        Query{Filters: []PropertyFilter{{Property: "area", Op: OpGreaterEqual, Values: []string{"250"}}, {Property: "owner", Op: OpNotEqual, Values: []string{"city"}}}},
+			expected: ` WHERE "area" >= $1 AND "owner" <> $2`,
+			args:     []interface{}{250.0, "city"},
+		},
+		// Dates compare as times
+		{
+			dialect: gpkgDialect{},
+			table:   &surveyed,
+			q: Query{Filters: []PropertyFilter{
+				{Property: "surveyed", Op: OpGreaterEqual, Values: []string{"2018-03-01"}},
+				{Property: "surveyed", Op: OpIn, Values: []string{"2018-03-01", "2018-03-01 12:00:00"}},
+			}},
+			expected: ` WHERE julianday("surveyed") >= julianday(?) AND julianday("surveyed") IN (julianday(?), julianday(?))`,
+			args:     []interface{}{"2018-03-01T00:00:00Z", "2018-03-01T00:00:00Z", "2018-03-01T12:00:00Z"},
+		},
+		{
+			dialect:  postgisDialect{},
+			table:    &surveyed,
+			q:        Query{Filters: []PropertyFilter{{Property: "surveyed", Op: OpLess, Values: []string{"2018-03-01"}}}},
+			expected: ` WHERE "surveyed" < CAST($1 AS timestamptz)`,
+			args:     []interface{}{march},
+		},
+		// A feature w/o the property never matches
+		{
+			dialect:  postgisDialect{},
+			table:    postgisParcels,
+			q:        Query{Filters: []PropertyFilter{{Property: "lanes", Op: OpEqual, Values: []string{"2"}}}},
+			expected: ` WHERE 1 = 0`,
+		},
+		{
+			dialect:  gpkgDialect{},
+			table:    gpkgRoads,
+			q:        Query{Extent: e, Filters: []PropertyFilter{{Property: "highway", Op: OpEqual, Values: []string{"primary"}}}},
+			expected: ` WHERE rowid IN (SELECT id FROM "rtree_roads_geom" WHERE minx <= ? AND maxx >= ? AND miny <= ? AND maxy >= ?) AND "highway" = ?`,
+			args:     []interface{}{23.8, 23.7, 38.0, 37.9, "primary"},
+		},
+		{
+			dialect:  postgisDialect{},
+			table:    gpkgRoads,
+			q:        Query{Extent: e},
+			expected: ` WHERE "geom" && ST_MakeEnvelope($1, $2, $3, $4, 4326)`,
+			args:     []interface{}{23.7, 37.9, 23.8, 38.0},
+		},
+		{
+			dialect:  postgisDialect{},
+			table:    postgisParcels,
+			q:        Query{Extent: e},
+			expected: ` WHERE "geom" && ST_Transform(ST_MakeEnvelope($1, $2, $3, $4, 4326), 3857)`,
+			args:     []interface{}{23.7, 37.9, 23.8, 38.0},
+		},
+		// Left to the Tiler
+		{dialect: gpkgDialect{}, table: &unindexed, q: Query{Extent: e}, err: ErrQueryNotSupported},
+	}
+	for i, tc := range tcases {
+		sq := &sqlQuerier{dialect: tc.dialect}
+		args := &sqlArgs{dialect: tc.dialect}
+		where, err := sq.whereClause(tc.table, tc.q, args)
+		if err != tc.err {
+			t.Errorf("[%v] got error %v, wanted %v", i, err, tc.err)
+			continue
+		}
+		if where != tc.expected {
+			t.Errorf("[%v] got '%v', wanted '%v'", i, where, tc.expected)
+		}
+		if !reflect.DeepEqual(args.values, tc.args) {
+			t.Errorf("[%v] got args %v, wanted %v", i, args.values, tc.args)
+		}
+	}
+}
+
+func TestLimitClause(t *testing.T) {
+	type tcase struct {
+		dialect       sqlDialect
+		limit, offset uint
+		expected      string
+	}
+	tcases := []tcase{
+		{dialect: gpkgDialect{}, expected: ""},
+		{dialect: gpkgDialect{}, limit: 10, expected: " LIMIT 10 OFFSET 0"},
+		{dialect: gpkgDialect{}, limit: 10, offset: 20, expected: " LIMIT 10 OFFSET 20"},
+		// sqlite needs a LIMIT for an OFFSET
+		{dialect: gpkgDialect{}, offset: 20, expected: " LIMIT -1 OFFSET 20"},
+		{dialect: postgisDialect{}, expected: ""},
+		{dialect: postgisDialect{}, limit: 10, offset: 20, expected: " LIMIT 10 OFFSET 20"},
+		{dialect: postgisDialect{}, offset: 20, expected: " OFFSET 20"},
+	}
+	for i, tc := range tcases {
+		if lc := tc.dialect.limitClause(tc.limit, tc.offset); lc != tc.expected {
+			t.Errorf("[%v] got '%v', wanted '%v'", i, lc, tc.expected)
+		}
+	}
+}
+
+func TestSelectFeatures(t *testing.T) {
+	type tcase struct {
+		dialect  sqlDialect
+		table    *sqlTable
+		sel      Selection
+		expected string
+	}
+	tcases := []tcase{
+		{dialect: gpkgDialect{}, table: gpkgRoads, expected: `SELECT "fid", "geom", "name", "highway" FROM "roads"`},
+		{dialect: postgisDialect{}, table: gpkgRoads, expected: `SELECT "fid", ST_AsBinary("geom"), "name", "highway" FROM "roads"`},
+		// Columns stay in table order
+		{
+			dialect:  postgisDialect{},
+			table:    postgisParcels,
+			sel:      Selection{Properties: []string{"area", "owner"}, SkipGeometry: true},
+			expected: `SELECT "gid", "owner", "area" FROM "public"."parcels"`,
+		},
+		{
+			dialect:  gpkgDialect{},
+			table:    gpkgRoads,
+			sel:      Selection{Properties: []string{"highway", "lanes"}},
+			expected: `SELECT "fid", "geom", "highway" FROM "roads"`,
+		},
+		{dialect: gpkgDialect{}, table: gpkgRoads, sel: Selection{Properties: []string{}, SkipGeometry: true}, expected: `SELECT "fid" FROM "roads"`},
+	}
+	for i, tc := range tcases {
+		sq := &sqlQuerier{dialect: tc.dialect}
+		if stmt := sq.selectFeatures(tc.table, tc.sel); stmt != tc.expected {
+			t.Errorf("[%v] got '%v', wanted '%v'", i, stmt, tc.expected)
+		}
+	}
+}
+
+func TestSQLQuerierStatements(t *testing.T) {
+	db := recordingDB(t, [][]driver.Value{{int64(7), nil, []byte("Main St"), "primary"}})
+	defer db.Close()
+	sq := &sqlQuerier{db: db, dialect: postgisDialect{}, tables: map[string]*sqlTable{"roads": gpkgRoads}}
+
+	q := Query{Collection: "roads", Filters: []PropertyFilter{{Property: "highway", Op: OpEqual, Values: []string{"primary"}}}, Limit: 10, Offset: 20}
+	fs, err := sq.QueryFeatures(context.Background(), q)
+	if err != nil {
+		t.Fatalf("QueryFeatures(): %v", err)
+	}
+	expected := `SELECT "fid", ST_AsBinary("geom"), "name", "highway" FROM "roads" WHERE "highway" = $1 ORDER BY "fid" LIMIT 10 OFFSET 20`
+	if len(recorder.stmts) != 1 || recorder.stmts[0] != expected {
+		t.Errorf("got statements %v, wanted %v", recorder.stmts, expected)
+	} else if !reflect.DeepEqual(recorder.args[0], []driver.Value{"primary"}) {
+		t.Errorf("got args %v, wanted [primary]", recorder.args[0])
+	}
+	if len(fs) != 1 || fs[0].ID != "7" || fs[0].Geometry != nil || !reflect.DeepEqual(fs[0].Properties, map[string]interface{}{"name": "Main St", "highway": "primary"}) {
+		t.Errorf("got features %v, wanted feature 7 on Main St", fs)
+	}
+
+	recorder.stmts, recorder.rows = nil, [][]driver.Value{{int64(31)}}
+	count, err := sq.CountFeatures(context.Background(), q)
+	if err != nil || count != 31 {
+		t.Errorf("CountFeatures() == %v, %v, wanted 31", count, err)
+	}
+	expected = `SELECT COUNT(*) FROM "roads" WHERE "highway" = $1`
+	if len(recorder.stmts) != 1 || recorder.stmts[0] != expected {
+		t.Errorf("got statements %v, wanted %v", recorder.stmts, expected)
+	}
+
+	if _, err := sq.QueryFeatures(context.Background(), Query{Collection: "buildings"}); err != ErrQueryNotSupported {
+		t.Errorf("got %v for a collection w/o a table, wanted ErrQueryNotSupported", err)
+	}
+}
+
+func TestSQLGetFeatures(t *testing.T) {
+	db := recordingDB(t, [][]driver.Value{{int64(3), nil, []byte("Main St"), nil}, {int64(7), nil, nil, "primary"}})
+	defer db.Close()
+	sq := &sqlQuerier{db: db, dialect: gpkgDialect{}, tables: map[string]*sqlTable{"roads": gpkgRoads}}
+
+	// "x" can't be an integer id
+	fs, err := sq.GetFeatures(context.Background(), "roads", []string{"7", "x", "3", "12"})
+	if err != nil {
+		t.Fatalf("GetFeatures(): %v", err)
+	}
+	expected := `SELECT "fid", "geom", "name", "highway" FROM "roads" WHERE "fid" = ? OR "fid" = ? OR "fid" = ? ORDER BY "fid"`
+	if len(recorder.stmts) != 1 || recorder.stmts[0] != expected {
+		t.Errorf("got statements %v, wanted %v", recorder.stmts, expected)
+	} else if !reflect.DeepEqual(recorder.args[0], []driver.Value{int64(7), int64(3), int64(12)}) {
+		t.Errorf("got args %v, wanted [7 3 12]", recorder.args[0])
+	}
+	if len(fs) != 2 || fs[0].ID != "3" || fs[1].ID != "7" {
+		t.Errorf("got features %v, wanted 3 & 7", fs)
+	}
+
+	// Nothing to look up
+	recorder.stmts = nil
+	if fs, err := sq.GetFeatures(context.Background(), "roads", []string{"x"}); err != nil || len(fs) != 0 || len(recorder.stmts) != 0 {
+		t.Errorf("GetFeatures() == %v, %v w/ statements %v, wanted no features or statements", fs, err, recorder.stmts)
+	}
+	if _, err := sq.GetFeatures(context.Background(), "buildings", []string{"1"}); err != ErrQueryNotSupported {
+		t.Errorf("got %v for a collection w/o a table, wanted ErrQueryNotSupported", err)
+	}
+}
+
+func TestSQLReplaceFeature(t *testing.T) {
+	// Parcels identified by code, their primary key gid is a property
+	parcels := &sqlTable{
+		name:          "parcels",
+		qualifiedName: `"public"."parcels"`,
+		idColumns:     []string{"code"},
+		pkColumns:     []string{"gid"},
+		geomColumn:    "geom",
+		srid:          3857,
+		columns:       []string{"gid", "owner", "area"},
+		kinds:         map[string]int{"gid": kindInteger, "code": kindString, "owner": kindString, "area": kindFloat},
+	}
+	db := recordingDB(t, [][]driver.Value{{int64(1)}})
+	defer db.Close()
+	sq := &sqlQuerier{db: db, dialect: postgisDialect{}, tables: map[string]*sqlTable{"parcels": parcels}}
+
+	for _, props := range []map[string]interface{}{{"owner": "Jo"}, {"gid": int64(9), "owner": "Jo"}} {
+		recorder.stmts, recorder.args = nil, nil
+		if err := sq.ReplaceFeature(context.Background(), "parcels", "A-12", &Feature{Properties: props}); err != nil {
+			t.Fatalf("ReplaceFeature(): %v", err)
+		}
+		expected := `UPDATE "public"."parcels" SET "geom" = NULL, "owner" = $1, "area" = $2 WHERE "code" = $3`
+		if len(recorder.stmts) != 1 || recorder.stmts[0] != expected {
+			t.Errorf("replacing w/ %v got statements %v, wanted %v", props, recorder.stmts, expected)
+		} else if !reflect.DeepEqual(recorder.args[0], []driver.Value{"Jo", nil, "A-12"}) {
+			t.Errorf("replacing w/ %v got args %v, wanted [Jo <nil> A-12]", props, recorder.args[0])
+		}
+	}
+}
+
+func TestIdCondition(t *testing.T) {
+	roads := &sqlTable{idColumns: []string{"fid"}, kinds: map[string]int{"fid": kindInteger}}
+	parcels := &sqlTable{idColumns: []string{"year", "code"}, kinds: map[string]int{"year": kindInteger, "code": kindString}}
+
+	type tcase struct {
+		dialect  sqlDialect
+		table    *sqlTable
+		id       string
+		expected string
+		args     []interface{}
+		ok       bool
+	}
+	tcases := []tcase{
+		{dialect: gpkgDialect{}, table: roads, id: "7", expected: `"fid" = ?`, args: []interface{}{int64(7)}, ok: true},
+		{dialect: postgisDialect{}, table: roads, id: "7", expected: `"fid" = $1`, args: []interface{}{int64(7)}, ok: true},
+		{dialect: gpkgDialect{}, table: roads, id: "seven"},
+		{
+			dialect:  postgisDialect{},
+			table:    parcels,
+			id:       "2018,A%2C12",
+			expected: `("year" = $1 AND "code" = $2)`,
+			args:     []interface{}{int64(2018), "A,12"},
+			ok:       true,
+		},
+		{dialect: postgisDialect{}, table: parcels, id: "2018"},
+		{dialect: gpkgDialect{}, table: parcels, id: "A12,2018"},
+	}
+	for i, tc := range tcases {
+		args := &sqlArgs{dialect: tc.dialect}
+		c, ok := tc.table.idCondition(tc.id, args)
+		if ok != tc.ok {
+			t.Errorf("[%v] got ok %v for '%v', wanted %v", i, ok, tc.id, tc.ok)
+			continue
+		}
+		if c != tc.expected || !reflect.DeepEqual(args.values, tc.args) {
+			t.Errorf("[%v] got %v w/ args %v, wanted %v w/ %v", i, c, args.values, tc.expected, tc.args)
+		}
+	}
+}
+
+func TestRowFeature(t *testing.T) {
+	sq := &sqlQuerier{dialect: postgisDialect{}}
+	roads := &sqlTable{name: "roads", idColumns: []string{"fid"}, geomColumn: "geom", srid: 4326, columns: []string{"name", "lanes"}}
+	bare := &sqlTable{name: "points", idColumns: []string{"fid"}, geomColumn: "geom", srid: 4326}
+	pt, err := wkb.EncodeBytes(geom.Point{1, 2})
+	if err != nil {
+		t.Fatalf("EncodeBytes(): %v", err)
+	}
+
+	type tcase struct {
+		table    *sqlTable
+		sel      Selection
+		vals     []interface{}
+		expected *Feature
+	}
+	tcases := []tcase{
+		{
+			table:    roads,
+			vals:     []interface{}{int64(7), pt, []byte("Main St"), int64(2)},
+			expected: &Feature{ID: "7", SRID: 4326, Geometry: geom.Point{1, 2}, Properties: map[string]interface{}{"name": "Main St", "lanes": int64(2)}},
+		},
+		{
+			table:    roads,
+			sel:      Selection{Properties: []string{"lanes"}},
+			vals:     []interface{}{int64(7), nil, nil},
+			expected: &Feature{ID: "7", SRID: 4326, Properties: map[string]interface{}{}},
+		},
+		// Only the ids are selected
+		{
+			table:    roads,
+			sel:      Selection{Properties: []string{}, SkipGeometry: true},
+			vals:     []interface{}{int64(7)},
+			expected: &Feature{ID: "7", SRID: 4326, Properties: map[string]interface{}{}},
+		},
+		{
+			table:    bare,
+			sel:      Selection{SkipGeometry: true},
+			vals:     []interface{}{int64(3)},
+			expected: &Feature{ID: "3", SRID: 4326, Properties: map[string]interface{}{}},
+		},
+	}
+	for i, tc := range tcases {
+		f, err := sq.rowFeature(tc.table, tc.sel, tc.vals)
+		if err != nil {
+			t.Errorf("[%v] rowFeature(): %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(f, tc.expected) {
+			t.Errorf("[%v] got %+v, wanted %+v", i, f, tc.expected)
+		}
+	}
+
+	if _, err := sq.rowFeature(roads, Selection{SkipGeometry: true}, []interface{}{nil, nil, nil}); err == nil {
+		t.Errorf("expected an error for a null id")
+	}
+}
+
+func TestTimeCondition(t *testing.T) {
+	start := time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2018, 5, 15, 12, 30, 0, 0, time.UTC)
+	visits := &sqlTable{
+		name:    "visits",
+		columns: []string{"observed", "start_time", "stop_time", "note", "count"},
+		kinds:   map[string]int{"observed": kindDate, "start_time": kindDate, "stop_time": kindDate, "note": kindString, "count": kindInteger},
+	}
+
+	type tcase struct {
+		dialect  sqlDialect
+		q        Query
+		expected string
+		args     []interface{}
+		err      error
+	}
+	tcases := []tcase{
+		{
+			dialect:  gpkgDialect{},
+			q:        Query{Time: &TimeInterval{Start: start, End: end}, Temporal: TemporalProperties{Instant: "observed"}},
+			expected: `(julianday("observed") IS NULL OR julianday("observed") <= julianday(?)) AND (julianday("observed") IS NULL OR julianday("observed") >= julianday(?))`,
+			args:     []interface{}{"2018-05-15T12:30:00Z", "2018-04-01T00:00:00Z"},
+		},
+		// "timestamp", "start_time" & "stop_time" by default, "timestamp" isn't a column
+		{
+			dialect:  gpkgDialect{},
+			q:        Query{Time: &TimeInterval{Start: start}},
+			expected: `(julianday("stop_time") IS NULL OR julianday("stop_time") >= julianday(?))`,
+			args:     []interface{}{"2018-04-01T00:00:00Z"},
+		},
+		{
+			dialect:  postgisDialect{},
+			q:        Query{Time: &TimeInterval{End: end}, Temporal: TemporalProperties{Instant: "observed", Start: "start_time", End: "stop_time"}},
+			expected: `(COALESCE("observed", "start_time") IS NULL OR COALESCE("observed", "start_time") <= CAST($1 AS timestamptz))`,
+			args:     []interface{}{end},
+		},
+		{
+			dialect:  postgisDialect{},
+			q:        Query{Time: &TimeInterval{Start: start, End: end}, Temporal: TemporalProperties{Start: "start_time"}},
+			expected: `("start_time" IS NULL OR "start_time" <= CAST($1 AS timestamptz))`,
+			args:     []interface{}{end},
+		},
+		// Text is only compared as times by GeoPackage
+		{
+			dialect:  gpkgDialect{},
+			q:        Query{Time: &TimeInterval{Start: start, End: end}, Temporal: TemporalProperties{Instant: "note"}},
+			expected: `(julianday("note") IS NULL OR julianday("note") <= julianday(?)) AND (julianday("note") IS NULL OR julianday("note") >= julianday(?))`,
+			args:     []interface{}{"2018-05-15T12:30:00Z", "2018-04-01T00:00:00Z"},
+		},
+		{
+			dialect: postgisDialect{},
+			q:       Query{Time: &TimeInterval{Start: start, End: end}, Temporal: TemporalProperties{Instant: "note"}},
+			err:     ErrQueryNotSupported,
+		},
+		// Neither holds times, so every row matches
+		{
+			dialect: postgisDialect{},
+			q:       Query{Time: &TimeInterval{Start: start, End: end}, Temporal: TemporalProperties{Instant: "count", Start: "no_such_column"}},
+		},
+	}
+	for i, tc := range tcases {
+		sq := &sqlQuerier{dialect: tc.dialect}
+		args := &sqlArgs{dialect: tc.dialect}
+		c, err := sq.timeCondition(visits, tc.q, args)
+		if err != tc.err {
+			t.Errorf("[%v] got error %v, wanted %v", i, err, tc.err)
+			continue
+		}
+		if c != tc.expected {
+			t.Errorf("[%v] got %v, wanted %v", i, c, tc.expected)
+		}
+		if !reflect.DeepEqual(args.values, tc.args) {
+			t.Errorf("[%v] got args %v, wanted %v", i, args.values, tc.args)
+		}
+	}
+}
+
+func TestSQLTemporalExtent(t *testing.T) {
+	visits := &sqlTable{
+		name:          "visits",
+		qualifiedName: `"visits"`,
+		columns:       []string{"observed", "start_time", "stop_time", "note"},
+		kinds:         map[string]int{"observed": kindDate, "start_time": kindDate, "stop_time": kindDate, "note": kindString},
+	}
+	march := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	may := time.Date(2018, 5, 15, 12, 30, 0, 0, time.UTC)
+
+	type tcase struct {
+		dialect  sqlDialect
+		tp       TemporalProperties
+		row      []driver.Value
+		stmt     string
+		expected *TimeInterval
+		err      error
+	}
+	tcases := []tcase{
+		// julianday() values for March 1st & May 15th 12:30
+		{
+			dialect:  gpkgDialect{},
+			tp:       TemporalProperties{Start: "start_time", End: "stop_time"},
+			row:      []driver.Value{int64(3), 2458178.5, int64(3), 2458254.0208333335, int64(3)},
+			stmt:     `SELECT COUNT(*), MIN(julianday("start_time")), COUNT(julianday("start_time")), MAX(julianday("stop_time")), COUNT(julianday("stop_time")) FROM "visits" WHERE julianday("start_time") IS NOT NULL OR julianday("stop_time") IS NOT NULL`,
+			expected: &TimeInterval{Start: march, End: may},
+		},
+		// A row w/o an end leaves the extent open
+		{
+			dialect:  postgisDialect{},
+			tp:       TemporalProperties{Instant: "observed", Start: "start_time", End: "stop_time"},
+			row:      []driver.Value{int64(3), march, int64(3), may, int64(2)},
+			stmt:     `SELECT COUNT(*), MIN(COALESCE("observed", "start_time")), COUNT(COALESCE("observed", "start_time")), MAX(COALESCE("observed", "stop_time")), COUNT(COALESCE("observed", "stop_time")) FROM "visits" WHERE COALESCE("observed", "start_time") IS NOT NULL OR COALESCE("observed", "stop_time") IS NOT NULL`,
+			expected: &TimeInterval{Start: march},
+		},
+		{
+			dialect:  postgisDialect{},
+			tp:       TemporalProperties{End: "stop_time"},
+			row:      []driver.Value{int64(2), nil, int64(0), may, int64(2)},
+			stmt:     `SELECT COUNT(*), NULL, 0, MAX("stop_time"), COUNT("stop_time") FROM "visits" WHERE "stop_time" IS NOT NULL`,
+			expected: &TimeInterval{End: may},
+		},
+		// No rows w/ time values
+		{
+			dialect: gpkgDialect{},
+			tp:      TemporalProperties{Instant: "observed"},
+			row:     []driver.Value{int64(0), nil, int64(0), nil, int64(0)},
+			stmt:    `SELECT COUNT(*), MIN(julianday("observed")), COUNT(julianday("observed")), MAX(julianday("observed")), COUNT(julianday("observed")) FROM "visits" WHERE julianday("observed") IS NOT NULL OR julianday("observed") IS NOT NULL`,
+		},
+		// No columns holding times
+		{dialect: gpkgDialect{}, tp: TemporalProperties{Instant: "no_such_column"}},
+		{dialect: postgisDialect{}, tp: TemporalProperties{Instant: "note"}, err: ErrQueryNotSupported},
+	}
+	for i, tc := range tcases {
+		db := recordingDB(t, [][]driver.Value{tc.row})
+		sq := &sqlQuerier{db: db, dialect: tc.dialect, tables: map[string]*sqlTable{"visits": visits}}
+		te, err := sq.TemporalExtent(context.Background(), "visits", tc.tp)
+		db.Close()
+		if err != tc.err {
+			t.Errorf("[%v] got error %v, wanted %v", i, err, tc.err)
+			continue
+		}
+		var stmts []string
+		if tc.stmt != "" {
+			stmts = []string{tc.stmt}
+		}
+		if !reflect.DeepEqual(recorder.stmts, stmts) {
+			t.Errorf("[%v] got statements %v, wanted %v", i, recorder.stmts, stmts)
+		}
+		if !reflect.DeepEqual(te, tc.expected) {
+			t.Errorf("[%v] got %v, wanted %v", i, te, tc.expected)
+		}
+	}
+}
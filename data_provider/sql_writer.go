@@ -0,0 +1,141 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project sql_writer.go
+
+package data_provider
+
+// Writing features to the tables of a sqlQuerier, collections defined by SQL can't be written to.
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// The table collection is served from if its features may be written, ErrQueryNotSupported otherwise
+func (sq *sqlQuerier) writableTable(collection string) (*sqlTable, error) {
+	t, ok := sq.tables[collection]
+	if !ok || t.sql != "" {
+		return nil, ErrQueryNotSupported
+	}
+	return t, nil
+}
+
+// Quoted columns of t & the expressions for their values in f, w/ the values added to args.  All
+// of t's columns are included if all is set w/ those f doesn't have set to NULL, except for its
+// primary key which stays that of the row being replaced.  Otherwise only f's properties are.
+// Returns a *BadFeature if f has a property t doesn't.
+func (sq *sqlQuerier) rowValues(t *sqlTable, f *Feature, all bool, args *sqlArgs) (cols, vals []string, err error) {
+	for k := range f.Properties {
+		if !t.hasColumn(k) {
+			return nil, nil, &BadFeature{msg: fmt.Sprintf("collection '%v' has no property '%v'", t.name, k)}
+		}
+	}
+
+	gv, err := sq.dialect.geometryValue(t, f.Geometry, f.SRID, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	cols = append(cols, quoteIdent(t.geomColumn))
+	vals = append(vals, gv)
+	for _, c := range t.columns {
+		v, ok := f.Properties[c]
+		if (!ok && !all) || (all && t.isPkColumn(c)) {
+			continue
+		}
+		cols = append(cols, quoteIdent(c))
+		vals = append(vals, args.add(v))
+	}
+	return cols, vals, nil
+}
+
+// Columns f doesn't have a property for are left to their defaults
+func (sq *sqlQuerier) CreateFeature(ctx context.Context, collection string, f *Feature) (string, error) {
+	t, err := sq.writableTable(collection)
+	if err != nil {
+		return "", err
+	}
+	args := &sqlArgs{dialect: sq.dialect}
+	cols, vals, err := sq.rowValues(t, f, false, args)
+	if err != nil {
+		return "", err
+	}
+	stmt := fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v)",
+		t.qualifiedName, strings.Join(cols, ", "), strings.Join(vals, ", "))
+	return sq.dialect.insertRow(ctx, sq.db, t, stmt, args.values)
+}
+
+func (sq *sqlQuerier) ReplaceFeature(ctx context.Context, collection, id string, f *Feature) error {
+	t, err := sq.writableTable(collection)
+	if err != nil {
+		return err
+	}
+	args := &sqlArgs{dialect: sq.dialect}
+	cols, vals, err := sq.rowValues(t, f, true, args)
+	if err != nil {
+		return err
+	}
+	sets := make([]string, len(cols))
+	for i, c := range cols {
+		sets[i] = fmt.Sprintf("%v = %v", c, vals[i])
+	}
+	// After the SET values, placeholders may be positional
+	cond, ok := t.idCondition(id, args)
+	if !ok {
+		return ErrFeatureNotFound
+	}
+	stmt := fmt.Sprintf("UPDATE %v SET %v WHERE %v", t.qualifiedName, strings.Join(sets, ", "), cond)
+	return sq.execRow(ctx, stmt, args.values)
+}
+
+func (sq *sqlQuerier) DeleteFeature(ctx context.Context, collection, id string) error {
+	t, err := sq.writableTable(collection)
+	if err != nil {
+		return err
+	}
+	args := &sqlArgs{dialect: sq.dialect}
+	cond, ok := t.idCondition(id, args)
+	if !ok {
+		return ErrFeatureNotFound
+	}
+	return sq.execRow(ctx, fmt.Sprintf("DELETE FROM %v WHERE %v", t.qualifiedName, cond), args.values)
+}
+
+// Runs stmt, which changes the row of a single feature, ErrFeatureNotFound if there's no such row
+func (sq *sqlQuerier) execRow(ctx context.Context, stmt string, args []interface{}) error {
+	res, err := sq.db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrFeatureNotFound
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project temp_collections.go
+
+package data_provider
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults for the Provider settings limiting temporary collections
+const (
+	DefaultTempCollectionTTL  = 30 * time.Minute
+	DefaultMaxTempCollections = 100
+	DefaultMaxTempFeatures    = 1000000
+)
+
+// Returned when a temporary collection would have more features than allowed in total
+type ErrTempCollectionTooLarge struct {
+	count, max int
+}
+
+func (e ErrTempCollectionTooLarge) Error() string {
+	return fmt.Sprintf("temporary collection of %v features exceeds the limit of %v", e.count, e.max)
+}
+
+type tempCollection struct {
+	lastAccess time.Time
+	featureIds []FeatureId
+}
+
+// Holds temporary collections, safe for concurrent use.  Collections not accessed for ttl are
+// dropped, as are the least recently accessed ones when there would be more than maxCollections
+// or more than maxFeatures features in all of them.
+type tempCollectionStore struct {
+	mutex          sync.Mutex
+	collections    map[string]*tempCollection
+	featureCount   int
+	ttl            time.Duration
+	maxCollections int
+	maxFeatures    int
+	// The current time, replaceable for testing
+	now func() time.Time
+}
+
+func newTempCollectionStore(ttl time.Duration, maxCollections, maxFeatures int) *tempCollectionStore {
+	if ttl <= 0 {
+		ttl = DefaultTempCollectionTTL
+	}
+	if maxCollections <= 0 {
+		maxCollections = DefaultMaxTempCollections
+	}
+	if maxFeatures <= 0 {
+		maxFeatures = DefaultMaxTempFeatures
+	}
+	return &tempCollectionStore{
+		collections:    make(map[string]*tempCollection),
+		ttl:            ttl,
+		maxCollections: maxCollections,
+		maxFeatures:    maxFeatures,
+		now:            time.Now,
+	}
+}
+
+// Adds a collection of featureIds under a newly generated id, which is returned.  taken reports
+// ids that are already in use elsewhere & can't be used.
+func (s *tempCollectionStore) add(featureIds []FeatureId, taken func(id string) bool) (string, error) {
+	if len(featureIds) > s.maxFeatures {
+		return "", ErrTempCollectionTooLarge{count: len(featureIds), max: s.maxFeatures}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.evict(len(featureIds))
+
+	var id string
+	for id == "" || s.collections[id] != nil || taken(id) {
+		var err error
+		if id, err = newTempCollectionId(); err != nil {
+			return "", err
+		}
+	}
+	s.collections[id] = &tempCollection{lastAccess: s.now(), featureIds: featureIds}
+	s.featureCount += len(featureIds)
+	return id, nil
+}
+
+// The feature ids in collection id, ok is false if there's no such collection
+func (s *tempCollectionStore) get(id string) (featureIds []FeatureId, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.evict(-1)
+	tc, ok := s.collections[id]
+	if !ok {
+		return nil, false
+	}
+	tc.lastAccess = s.now()
+	return tc.featureIds, true
+}
+
+// Drops expired collections, then the least recently accessed ones until there's room for
+// another w/ newFeatures features, -1 if one isn't being added.  Call w/ the mutex held.
+func (s *tempCollectionStore) evict(newFeatures int) {
+	expiry := s.now().Add(-s.ttl)
+	ids := make([]string, 0, len(s.collections))
+	for id, tc := range s.collections {
+		if tc.lastAccess.Before(expiry) {
+			s.remove(id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if newFeatures < 0 {
+		return
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return s.collections[ids[i]].lastAccess.Before(s.collections[ids[j]].lastAccess)
+	})
+	for _, id := range ids {
+		if len(s.collections) < s.maxCollections && s.featureCount+newFeatures <= s.maxFeatures {
+			break
+		}
+		s.remove(id)
+	}
+}
+
+func (s *tempCollectionStore) remove(id string) {
+	s.featureCount -= len(s.collections[id].featureIds)
+	delete(s.collections, id)
+}
+
+// A random id, unique in practice
+func newTempCollectionId() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "tmp-" + hex.EncodeToString(b), nil
+}
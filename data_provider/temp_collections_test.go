@@ -0,0 +1,168 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project temp_collections_test.go
+
+package data_provider
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-spatial/geom"
+)
+
+func TestTempCollectionStore(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := newTempCollectionStore(time.Minute, 2, 5)
+	s.now = func() time.Time { return now }
+	notTaken := func(string) bool { return false }
+	fids := func(n int) []FeatureId { return make([]FeatureId, n) }
+
+	a, err := s.add(fids(2), notTaken)
+	if err != nil {
+		t.Fatalf("add(): %v", err)
+	}
+	now = now.Add(10 * time.Second)
+	b, err := s.add(fids(2), notTaken)
+	if err != nil {
+		t.Fatalf("add(): %v", err)
+	}
+	if a == b {
+		t.Errorf("expected unique ids, got '%v' twice", a)
+	}
+
+	// A third collection drops the least recently accessed
+	now = now.Add(10 * time.Second)
+	if _, ok := s.get(a); !ok {
+		t.Errorf("collection '%v' missing", a)
+	}
+	c, _ := s.add(fids(1), notTaken)
+	if _, ok := s.get(b); ok {
+		t.Errorf("collection '%v' should have been dropped for the collection limit", b)
+	}
+
+	// So does exceeding the feature limit
+	now = now.Add(10 * time.Second)
+	s.get(c)
+	s.add(fids(3), notTaken)
+	if _, ok := s.get(a); ok {
+		t.Errorf("collection '%v' should have been dropped for the feature limit", a)
+	}
+	if _, ok := s.get(c); !ok {
+		t.Errorf("collection '%v' missing", c)
+	}
+
+	// Expiry
+	now = now.Add(2 * time.Minute)
+	if _, ok := s.get(c); ok {
+		t.Errorf("collection '%v' should have expired", c)
+	}
+	if s.featureCount != 0 {
+		t.Errorf("featureCount == %v after all collections expired", s.featureCount)
+	}
+
+	if _, err := s.add(fids(6), notTaken); err == nil {
+		t.Errorf("expected an error for a collection over the feature limit")
+	}
+}
+
+func TestTempCollectionStoreConcurrency(t *testing.T) {
+	s := newTempCollectionStore(0, 10, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				id, err := s.add([]FeatureId{{Collection: "roads", FeaturePk: strconv.Itoa(j)}}, func(string) bool { return false })
+				if err != nil {
+					t.Errorf("add(): %v", err)
+					return
+				}
+				s.get(id)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(s.collections) > 10 {
+		t.Errorf("%v collections held, limit is 10", len(s.collections))
+	}
+}
+
+func TestProviderSearch(t *testing.T) {
+	fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), "csv"), FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+	p := Provider{Source: fs}
+
+	fids, err := p.FilterFeatures(context.Background(), nil, Query{Extent: &geom.Extent{-77.1, 38.8, -77.0, 38.95}})
+	if err != nil {
+		t.Fatalf("FilterFeatures(): %v", err)
+	}
+	expected := []FeatureId{{"parcels", "1"}, {"sites", "1"}, {"sites", "3"}}
+	if len(fids) != len(expected) {
+		t.Fatalf("FilterFeatures() == %v, wanted %v", fids, expected)
+	}
+	for i := range fids {
+		if fids[i] != expected[i] {
+			t.Fatalf("FilterFeatures() == %v, wanted %v", fids, expected)
+		}
+	}
+
+	fids, err = p.FilterFeatures(context.Background(), []string{"sites"}, Query{Filters: []PropertyFilter{{Property: "name", Op: OpEqual, Values: []string{"Pond"}}}})
+	if err != nil || len(fids) != 1 || fids[0] != (FeatureId{"sites", "3"}) {
+		t.Errorf("FilterFeatures() == %v, %v, wanted [{sites 3}]", fids, err)
+	}
+	// parcels doesn't have a name
+	_, err = p.FilterFeatures(context.Background(), nil, Query{Filters: []PropertyFilter{{Property: "name", Op: OpEqual, Values: []string{"Pond"}}}})
+	if _, ok := err.(*BadFilter); !ok {
+		t.Errorf("FilterFeatures() got error %v for an unknown property, wanted a *BadFilter", err)
+	}
+
+	fids, err = p.FilterFeatures(context.Background(), nil, Query{Extent: &geom.Extent{-77.1, 38.8, -77.0, 38.95}})
+	if err != nil {
+		t.Fatalf("FilterFeatures(): %v", err)
+	}
+	id, err := p.MakeCollection(fids)
+	if err != nil {
+		t.Fatalf("MakeCollection(): %v", err)
+	}
+	if !p.HasTempCollection(id) {
+		t.Errorf("HasTempCollection(%v) == false", id)
+	}
+	page, total, err := p.QueryFeatures(context.Background(), Query{Collection: id, Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatalf("QueryFeatures(): %v", err)
+	}
+	if total != 3 || len(page) != 2 || page[0].Properties["name"] != "Creek A" || page[1].Properties["name"] != "Pond" {
+		t.Errorf("QueryFeatures() == %v features of %v, wanted 'Creek A' & 'Pond' of 3", len(page), total)
+	}
+}
@@ -0,0 +1,265 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project temporal.go
+
+package data_provider
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A time instant or interval.  An instant has equal Start & End, a zero Start or End leaves the
+// interval unbounded at that end.
+type TimeInterval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Whether ti & o have any time in common, bounds are inclusive
+func (ti TimeInterval) Intersects(o TimeInterval) bool {
+	if !ti.End.IsZero() && !o.Start.IsZero() && o.Start.After(ti.End) {
+		return false
+	}
+	if !ti.Start.IsZero() && !o.End.IsZero() && o.End.Before(ti.Start) {
+		return false
+	}
+	return true
+}
+
+// Parses an OGC datetime parameter value: an ISO 8601 instant, or an interval of two separated by
+// '/' where either end may be ".." or empty to leave it open, or an ISO 8601 duration (i.e. "P1M")
+// relative to the other end.  Returns a *BadTimeString if s isn't valid.
+func ParseTimeInterval(s string) (*TimeInterval, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	switch len(parts) {
+	case 1:
+		t, err := parse_time_string(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		return &TimeInterval{Start: t, End: t}, nil
+	case 2:
+	default:
+		return nil, &BadTimeString{msg: fmt.Sprintf("'%v' contains more than two time values ('/' separator)", s)}
+	}
+
+	ti := &TimeInterval{}
+	var err error
+	startDuration, endDuration := isDuration(parts[0]), isDuration(parts[1])
+	if startDuration && endDuration {
+		return nil, &BadTimeString{msg: fmt.Sprintf("'%v' needs a time at one end of the interval", s)}
+	}
+	if !isOpenEnd(parts[0]) && !startDuration {
+		if ti.Start, err = parse_time_string(parts[0]); err != nil {
+			return nil, err
+		}
+	}
+	if !isOpenEnd(parts[1]) && !endDuration {
+		if ti.End, err = parse_time_string(parts[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if startDuration || endDuration {
+		if ti.Start.IsZero() && ti.End.IsZero() {
+			return nil, &BadTimeString{msg: fmt.Sprintf("'%v' has a duration w/o a time at the other end", s)}
+		}
+		if startDuration {
+			d, err := parseDuration(parts[0])
+			if err != nil {
+				return nil, err
+			}
+			ti.Start = d.addTo(ti.End, -1)
+		} else {
+			d, err := parseDuration(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			ti.End = d.addTo(ti.Start, 1)
+		}
+	}
+
+	if !ti.Start.IsZero() && !ti.End.IsZero() && ti.Start.After(ti.End) {
+		return nil, &BadTimeString{msg: fmt.Sprintf("'%v' ends before it starts", s)}
+	}
+	return ti, nil
+}
+
+func isOpenEnd(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s == ".."
+}
+
+func isDuration(s string) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(s)), "P")
+}
+
+// An ISO 8601 duration, calendar parts are kept separate as their length depends on the date
+// they're added to.
+type duration struct {
+	years, months, days int
+	clock               time.Duration
+}
+
+var durationRe = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:[.,]\d+)?)S)?)?$`)
+
+func parseDuration(s string) (duration, error) {
+	var d duration
+	us := strings.ToUpper(strings.TrimSpace(s))
+	m := durationRe.FindStringSubmatch(us)
+	if m == nil || us == "P" || strings.HasSuffix(us, "T") {
+		return d, &BadTimeString{msg: fmt.Sprintf("unable to parse duration: '%v'", s)}
+	}
+
+	n := func(s string) int {
+		// Digits only per the regexp, so the only possible error is overflow
+		i, _ := strconv.Atoi(s)
+		return i
+	}
+	d.years = n(m[1])
+	d.months = n(m[2])
+	d.days = 7*n(m[3]) + n(m[4])
+	d.clock = time.Duration(n(m[5]))*time.Hour + time.Duration(n(m[6]))*time.Minute
+	if m[7] != "" {
+		secs, err := strconv.ParseFloat(strings.Replace(m[7], ",", ".", 1), 64)
+		if err != nil {
+			return d, &BadTimeString{msg: fmt.Sprintf("unable to parse duration: '%v'", s)}
+		}
+		d.clock += time.Duration(secs * float64(time.Second))
+	}
+	return d, nil
+}
+
+// t moved by d forward (sign 1) or backward (sign -1)
+func (d duration) addTo(t time.Time, sign int) time.Time {
+	return t.AddDate(sign*d.years, sign*d.months, sign*d.days).Add(time.Duration(sign) * d.clock)
+}
+
+// Names the properties holding the time instant or interval a collection's features cover.
+// Properties not set are ignored, if none are set "timestamp", "start_time" & "stop_time" are used.
+type TemporalProperties struct {
+	// Property holding a feature's time instant, i.e. "observed_at"
+	Instant string
+	// Properties holding the start & end of a feature's time interval, i.e. "valid_from" & "valid_to".
+	// A feature w/ only one of them is unbounded at the other end.
+	Start string
+	End   string
+}
+
+var defaultTemporalProperties = TemporalProperties{Instant: "timestamp", Start: "start_time", End: "stop_time"}
+
+// Whether any of the properties are set
+func (tp TemporalProperties) IsSet() bool {
+	return tp.Instant != "" || tp.Start != "" || tp.End != ""
+}
+
+// The time instant or interval f covers, ok is false if f has no time values
+func (tp TemporalProperties) featureTime(f *Feature) (ti TimeInterval, ok bool) {
+	if !tp.IsSet() {
+		tp = defaultTemporalProperties
+	}
+	if t, ok := timeValue(f.Properties[tp.Instant]); tp.Instant != "" && ok {
+		return TimeInterval{Start: t, End: t}, true
+	}
+	start, startOk := timeValue(f.Properties[tp.Start])
+	end, endOk := timeValue(f.Properties[tp.End])
+	if (tp.Start == "" || !startOk) && (tp.End == "" || !endOk) {
+		return TimeInterval{}, false
+	}
+	if tp.Start != "" && startOk {
+		ti.Start = start
+	}
+	if tp.End != "" && endOk {
+		ti.End = end
+	}
+	return ti, true
+}
+
+// v as a time if it's a time or date value, or a string holding one.  Anything else, including
+// strings that don't parse as times, isn't a time value.
+func timeValue(v interface{}) (time.Time, bool) {
+	switch tv := v.(type) {
+	case time.Time:
+		return tv, !tv.IsZero()
+	case *time.Time:
+		if tv != nil {
+			return *tv, !tv.IsZero()
+		}
+	case string:
+		if t, err := parse_time_string(tv); err == nil {
+			return t, true
+		}
+	case []byte:
+		if t, err := parse_time_string(string(tv)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Whether f's time instant or interval according to tp intersects tf.  A feature w/o any time
+// values is considered a match.
+func featureTimeMatches(f *Feature, tf TimeInterval, tp TemporalProperties) bool {
+	ft, ok := tp.featureTime(f)
+	if !ok {
+		return true
+	}
+	return ft.Intersects(tf)
+}
+
+// The time interval covered by fs according to tp, nil if none of fs have time values
+func temporalExtent(fs []*Feature, tp TemporalProperties) *TimeInterval {
+	var extent *TimeInterval
+	var openStart, openEnd bool
+	for _, f := range fs {
+		ft, ok := tp.featureTime(f)
+		if !ok {
+			continue
+		}
+		if extent == nil {
+			extent = &TimeInterval{Start: ft.Start, End: ft.End}
+		}
+		openStart = openStart || ft.Start.IsZero()
+		openEnd = openEnd || ft.End.IsZero()
+		if ft.Start.Before(extent.Start) || extent.Start.IsZero() {
+			extent.Start = ft.Start
+		}
+		if ft.End.After(extent.End) {
+			extent.End = ft.End
+		}
+	}
+	if extent != nil && openStart {
+		extent.Start = time.Time{}
+	}
+	if extent != nil && openEnd {
+		extent.End = time.Time{}
+	}
+	return extent
+}
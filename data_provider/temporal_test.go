@@ -0,0 +1,139 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project temporal_test.go
+
+package data_provider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeatureTimeMatches(t *testing.T) {
+	observed := TemporalProperties{Instant: "observed_at"}
+	valid := TemporalProperties{Start: "valid_from", End: "valid_to"}
+	day := func(d int) time.Time { return time.Date(2018, 3, d, 0, 0, 0, 0, time.UTC) }
+	march := TimeInterval{Start: day(1), End: day(31)}
+
+	cases := []struct {
+		props    map[string]interface{}
+		tp       TemporalProperties
+		tf       TimeInterval
+		expected bool
+	}{
+		// native time values
+		{map[string]interface{}{"observed_at": day(10)}, observed, march, true},
+		{map[string]interface{}{"observed_at": day(10)}, observed, TimeInterval{Start: day(11)}, false},
+		{map[string]interface{}{"observed_at": day(10)}, observed, TimeInterval{End: day(10)}, true},
+		// date & timestamp strings, compared in their timezones
+		{map[string]interface{}{"observed_at": "2018-04-01"}, observed, march, false},
+		{map[string]interface{}{"observed_at": "2018-03-01T01:00:00+02:00"}, observed, march, false},
+		{map[string]interface{}{"observed_at": "2018-04-01T01:00:00+02:00"}, observed, TimeInterval{Start: day(31), End: day(31)}, false},
+		{map[string]interface{}{"observed_at": "2018-03-31T01:00:00+02:00"}, observed, TimeInterval{End: day(31)}, true},
+		// values that aren't times are ignored rather than causing a panic
+		{map[string]interface{}{"observed_at": int64(12)}, observed, march, true},
+		{map[string]interface{}{"observed_at": "soon"}, observed, march, true},
+		// intervals, including ones enclosing the filter & w/ an open end
+		{map[string]interface{}{"valid_from": day(1), "valid_to": day(5)}, valid, TimeInterval{Start: day(6), End: day(9)}, false},
+		{map[string]interface{}{"valid_from": "2018-01-01", "valid_to": "2018-12-31"}, valid, TimeInterval{Start: day(6), End: day(6)}, true},
+		{map[string]interface{}{"valid_from": day(1)}, valid, TimeInterval{Start: day(20), End: day(21)}, true},
+		{map[string]interface{}{"valid_to": day(1)}, valid, TimeInterval{Start: day(20), End: day(21)}, false},
+		// the default properties are used w/o any configured
+		{map[string]interface{}{"timestamp": "2018-03-05", "observed_at": "2018-05-05"}, TemporalProperties{}, march, true},
+		{map[string]interface{}{"timestamp": "2018-03-05", "observed_at": "2018-05-05"}, observed, march, false},
+	}
+
+	for i, c := range cases {
+		if got := featureTimeMatches(&Feature{Properties: c.props}, c.tf, c.tp); got != c.expected {
+			t.Errorf("[%v] featureTimeMatches() == %v, wanted %v", i, got, c.expected)
+		}
+	}
+}
+
+func TestTemporalExtent(t *testing.T) {
+	tp := TemporalProperties{Start: "valid_from", End: "valid_to"}
+	fs := []*Feature{
+		{Properties: map[string]interface{}{"valid_from": "2018-02-01", "valid_to": "2018-03-01"}},
+		{Properties: map[string]interface{}{"valid_from": time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC), "valid_to": "2018-01-01"}},
+		{Properties: map[string]interface{}{"name": "no times"}},
+	}
+
+	te := temporalExtent(fs, tp)
+	if te == nil {
+		t.Fatalf("temporalExtent() == nil")
+	}
+	if !te.Start.Equal(time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)) || !te.End.Equal(time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("temporalExtent() == %v - %v", te.Start, te.End)
+	}
+
+	fs = append(fs, &Feature{Properties: map[string]interface{}{"valid_from": "2018-06-01"}})
+	if te := temporalExtent(fs, tp); te == nil || !te.End.IsZero() {
+		t.Errorf("expected an open ended temporal extent, got %v", te)
+	}
+
+	if te := temporalExtent(fs[2:3], tp); te != nil {
+		t.Errorf("expected no temporal extent, got %v", te)
+	}
+}
+
+func TestParseTimeInterval(t *testing.T) {
+	utc := func(y int, m time.Month, d, h, min, s, ns int) time.Time {
+		return time.Date(y, m, d, h, min, s, ns, time.UTC)
+	}
+	cases := []struct {
+		s        string
+		expected TimeInterval
+	}{
+		{"2018-02-12T23:20:50Z", TimeInterval{Start: utc(2018, 2, 12, 23, 20, 50, 0), End: utc(2018, 2, 12, 23, 20, 50, 0)}},
+		{"2018-02-12t23:20:50.25z", TimeInterval{Start: utc(2018, 2, 12, 23, 20, 50, 250000000), End: utc(2018, 2, 12, 23, 20, 50, 250000000)}},
+		{"2018-02-12T23:20:50+02:00", TimeInterval{Start: utc(2018, 2, 12, 21, 20, 50, 0), End: utc(2018, 2, 12, 21, 20, 50, 0)}},
+		{"2018-02-12", TimeInterval{Start: utc(2018, 2, 12, 0, 0, 0, 0), End: utc(2018, 2, 12, 0, 0, 0, 0)}},
+		{"2018-02-12/2018-03-18T12:31:12Z", TimeInterval{Start: utc(2018, 2, 12, 0, 0, 0, 0), End: utc(2018, 3, 18, 12, 31, 12, 0)}},
+		{"2018-02-12T00:00:00Z/..", TimeInterval{Start: utc(2018, 2, 12, 0, 0, 0, 0)}},
+		{"../2018-03-18", TimeInterval{End: utc(2018, 3, 18, 0, 0, 0, 0)}},
+		{"/2018-03-18", TimeInterval{End: utc(2018, 3, 18, 0, 0, 0, 0)}},
+		{"2018-01-31/P1M", TimeInterval{Start: utc(2018, 1, 31, 0, 0, 0, 0), End: utc(2018, 3, 3, 0, 0, 0, 0)}},
+		{"2018-01-01/P1DT12H30M1.5S", TimeInterval{Start: utc(2018, 1, 1, 0, 0, 0, 0), End: utc(2018, 1, 2, 12, 30, 1, 500000000)}},
+		{"P2W/2018-01-15", TimeInterval{Start: utc(2018, 1, 1, 0, 0, 0, 0), End: utc(2018, 1, 15, 0, 0, 0, 0)}},
+	}
+	for i, c := range cases {
+		ti, err := ParseTimeInterval(c.s)
+		if err != nil {
+			t.Errorf("[%v] ParseTimeInterval(%q): %v", i, c.s, err)
+			continue
+		}
+		if !ti.Start.Equal(c.expected.Start) || !ti.End.Equal(c.expected.End) {
+			t.Errorf("[%v] ParseTimeInterval(%q) == %v / %v, wanted %v / %v", i, c.s, ti.Start, ti.End, c.expected.Start, c.expected.End)
+		}
+	}
+
+	for _, s := range []string{"2018-02-30", "..", "2018-01-01/2018-01-02/2018-01-03", "P1M/P1D", "../P1M", "2018-01-01/P", "2018-01-01/PT", "2018-01-01/P1X", "2018-03-01/2018-02-01"} {
+		_, err := ParseTimeInterval(s)
+		if _, ok := err.(*BadTimeString); !ok {
+			t.Errorf("ParseTimeInterval(%q) error == %v, wanted a *BadTimeString", s, err)
+		}
+	}
+}
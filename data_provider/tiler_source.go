@@ -0,0 +1,364 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project tiler_source.go
+
+package data_provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/go-spatial/geom"
+	prv "github.com/go-spatial/tegola/provider"
+	"github.com/go-spatial/tegola/provider/gpkg"
+	"github.com/go-spatial/tegola/provider/postgis"
+)
+
+// Used to ask a Tiler for all features in a collection (or those within an extent)
+type EmptyTile struct {
+	extent *geom.Extent
+	srid   uint64
+}
+
+func (_ EmptyTile) ZXY() (uint, uint, uint) {
+	return 0, 0, 0
+}
+
+// The whole web mercator world if et has no extent
+func (et EmptyTile) Extent() (extent *geom.Extent, srid uint64) {
+	if et.extent == nil {
+		max := webMercatorMaxExtent
+		return &geom.Extent{-max, -max, max, max}, 3857
+	}
+	return et.extent, et.srid
+}
+
+func (et EmptyTile) BufferedExtent() (extent *geom.Extent, srid uint64) {
+	return et.Extent()
+}
+
+// Adapts a tegola Tiler to the FeatureSource interface.
+// The Tiler is only able to enumerate all of a collection's features, so if Querier is set
+// it's used for anything it can handle, with filtering & paging done in memory otherwise.
+type TilerSource struct {
+	Tiler prv.Tiler
+	// Optional, if it also implements FeatureGetter, CollectionDescriber, ExtentGetter and/or
+	// FeatureWriter those are used too.
+	Querier Querier
+	// Names of collections added by AddSQLCollection(), these are served by Querier alone.
+	sqlCollections map[string]bool
+}
+
+// Adds a collection defined by a SQL query, this requires a Querier implementing SQLCollectionAdder.
+func (ts *TilerSource) AddSQLCollection(c SQLCollection) error {
+	adder, ok := ts.Querier.(SQLCollectionAdder)
+	if !ok {
+		return fmt.Errorf("data source doesn't support collections defined by SQL")
+	}
+	if err := adder.AddSQLCollection(c); err != nil {
+		return err
+	}
+
+	if ts.sqlCollections == nil {
+		ts.sqlCollections = make(map[string]bool)
+	}
+	ts.sqlCollections[c.Name] = true
+	return nil
+}
+
+// Identifies the features of collection by the values of columns, this requires a Querier
+// implementing IdColumnSetter.  The Querier then serves collection alone as the Tiler knows
+// features by primary key.
+func (ts *TilerSource) SetIdColumns(collection string, columns []string) error {
+	setter, ok := ts.Querier.(IdColumnSetter)
+	if !ok {
+		return fmt.Errorf("data source doesn't support setting id columns")
+	}
+	return setter.SetIdColumns(collection, columns)
+}
+
+// Features are written by a Querier implementing FeatureWriter, w/o one collections are read-only
+func (ts *TilerSource) CreateFeature(ctx context.Context, collection string, f *Feature) (string, error) {
+	fw, ok := ts.Querier.(FeatureWriter)
+	if !ok {
+		return "", ErrQueryNotSupported
+	}
+	return fw.CreateFeature(ctx, collection, f)
+}
+
+func (ts *TilerSource) ReplaceFeature(ctx context.Context, collection, id string, f *Feature) error {
+	fw, ok := ts.Querier.(FeatureWriter)
+	if !ok {
+		return ErrQueryNotSupported
+	}
+	return fw.ReplaceFeature(ctx, collection, id, f)
+}
+
+func (ts *TilerSource) DeleteFeature(ctx context.Context, collection, id string) error {
+	fw, ok := ts.Querier.(FeatureWriter)
+	if !ok {
+		return ErrQueryNotSupported
+	}
+	return fw.DeleteFeature(ctx, collection, id)
+}
+
+// A TilerSource for the GeoPackage at gpkgPath using tegola's gpkg provider, its tables may be
+// written to if writable is set.
+func NewGpkgSource(gpkgPath string, writable bool) (*TilerSource, error) {
+	gpkgConfig, err := gpkg.AutoConfig(gpkgPath)
+	if err != nil {
+		return nil, fmt.Errorf("data provider auto-config failure for '%v': %v", gpkgPath, err)
+	}
+	tiler, err := gpkg.NewTileProvider(gpkgConfig)
+	if err != nil {
+		return nil, fmt.Errorf("data provider creation error for '%v': %v", gpkgPath, err)
+	}
+
+	// Not fatal, without a Querier filtering & paging are done in memory.
+	querier, err := NewGpkgQuerier(gpkgPath, writable)
+	if err != nil {
+		log.Printf("unable to query '%v' directly, paging will be done in memory: %v", gpkgPath, err)
+	}
+
+	return &TilerSource{Tiler: tiler, Querier: querier}, nil
+}
+
+// A TilerSource for the PostGIS database described by connStr using tegola's postgis provider
+func NewPostGISSource(connStr string) (*TilerSource, error) {
+	pgConfig, err := postgis.AutoConfig(connStr)
+	if err != nil {
+		return nil, fmt.Errorf("data provider auto-config failure for '%v': %v", connStr, err)
+	}
+	tiler, err := postgis.NewTileProvider(pgConfig)
+	if err != nil {
+		return nil, fmt.Errorf("data provider creation error for '%v': %v", connStr, err)
+	}
+
+	// Not fatal, without a Querier filtering & paging are done in memory.
+	querier, err := NewPostGISQuerier(connStr)
+	if err != nil {
+		log.Printf("unable to query '%v' directly, paging will be done in memory: %v", connStr, err)
+	}
+
+	return &TilerSource{Tiler: tiler, Querier: querier}, nil
+}
+
+func (ts *TilerSource) CollectionNames() ([]string, error) {
+	featureTableInfo, err := ts.Tiler.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	ftNames := make([]string, 0, len(featureTableInfo)+len(ts.sqlCollections))
+	for _, fti := range featureTableInfo {
+		ftNames = append(ftNames, fti.Name())
+	}
+	for name := range ts.sqlCollections {
+		ftNames = append(ftNames, name)
+	}
+	sort.Strings(ftNames)
+
+	return ftNames, nil
+}
+
+func (ts *TilerSource) CollectionSchema(collection string) (*CollectionSchema, error) {
+	if ts.sqlCollections[collection] {
+		return ts.Querier.(CollectionDescriber).CollectionSchema(collection)
+	}
+
+	featureTableInfo, err := ts.Tiler.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	var cs *CollectionSchema
+	for _, fti := range featureTableInfo {
+		if fti.Name() == collection {
+			cs = &CollectionSchema{Name: collection, GeometryType: fti.GeomType(), SRID: fti.SRID(), CRS: sridCRS(fti.SRID())}
+			break
+		}
+	}
+	if cs == nil {
+		return nil, fmt.Errorf("Invalid collection name: %v", collection)
+	}
+
+	// The Tiler doesn't tell us anything about properties or titles
+	if cd, ok := ts.Querier.(CollectionDescriber); ok {
+		qcs, err := cd.CollectionSchema(collection)
+		switch err {
+		case nil:
+			cs.Title = qcs.Title
+			cs.Description = qcs.Description
+			cs.Properties = qcs.Properties
+			cs.PropertyTypes = qcs.PropertyTypes
+		case ErrQueryNotSupported:
+		default:
+			return nil, err
+		}
+	}
+
+	return cs, nil
+}
+
+func (ts *TilerSource) QueryFeatures(ctx context.Context, q Query) ([]*Feature, error) {
+	if ts.Querier != nil {
+		fs, err := ts.Querier.QueryFeatures(ctx, q)
+		if err != ErrQueryNotSupported {
+			return fs, err
+		}
+	}
+
+	fs, err := ts.collectionFeatures(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return pageFeatures(fs, q), nil
+}
+
+func (ts *TilerSource) CountFeatures(ctx context.Context, q Query) (uint, error) {
+	if ts.Querier != nil {
+		c, err := ts.Querier.CountFeatures(ctx, q)
+		if err != ErrQueryNotSupported {
+			return c, err
+		}
+	}
+
+	fs, err := ts.collectionFeatures(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	return uint(len(fs)), nil
+}
+
+func (ts *TilerSource) GetFeatures(ctx context.Context, collection string, ids []string) ([]*Feature, error) {
+	if getter, ok := ts.Querier.(FeatureGetter); ok {
+		fs, err := getter.GetFeatures(ctx, collection, ids)
+		if err != ErrQueryNotSupported {
+			return fs, err
+		}
+	}
+
+	// No keyed access, scan the collection for the features wanted
+	colFs, err := ts.collectionFeatures(ctx, Query{Collection: collection})
+	if err != nil {
+		return nil, err
+	}
+
+	fs := make([]*Feature, 0, len(ids))
+	for _, colF := range colFs {
+		for _, id := range ids {
+			if colF.ID == id {
+				fs = append(fs, colF)
+				break
+			}
+		}
+	}
+
+	return fs, nil
+}
+
+// The Tiler has no way to aggregate time values, this requires a Querier implementing
+// TemporalExtentGetter
+func (ts *TilerSource) TemporalExtent(ctx context.Context, collection string, tp TemporalProperties) (*TimeInterval, error) {
+	teg, ok := ts.Querier.(TemporalExtentGetter)
+	if !ok {
+		return nil, ErrQueryNotSupported
+	}
+	return teg.TemporalExtent(ctx, collection, tp)
+}
+
+func (ts *TilerSource) CollectionExtent(ctx context.Context, collection string) (*geom.Extent, error) {
+	if eg, ok := ts.Querier.(ExtentGetter); ok {
+		e, err := eg.CollectionExtent(ctx, collection)
+		if err != ErrQueryNotSupported {
+			return e, err
+		}
+	}
+
+	var extent *geom.Extent
+	err := ts.Tiler.TileFeatures(ctx, collection, EmptyTile{}, func(f *prv.Feature) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		extent = unionExtent(extent, geometryExtent(f.Geometry))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return extent, nil
+}
+
+// Get all features for a particular collection from the Tiler matching q's filters, ignoring
+// q.Limit & q.Offset.
+func (ts *TilerSource) collectionFeatures(ctx context.Context, q Query) ([]*Feature, error) {
+	pfs, err := q.propertyFilters()
+	if err != nil {
+		return nil, err
+	}
+	cf, err := q.cqlFilter()
+	if err != nil {
+		return nil, err
+	}
+	// The Tiler takes care of the extent
+	pq := q
+	pq.Extent = nil
+
+	fs := make([]*Feature, 0, 100)
+	getFeatures := func(pf *prv.Feature) error {
+		// The Tiler may not stop reading when ctx is done
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		f := tilerFeature(pf)
+		if featureMatches(f, pq, pfs, cf) {
+			fs = append(fs, f)
+		}
+		return nil
+	}
+
+	t := EmptyTile{extent: q.Extent, srid: 4326}
+	err = ts.Tiler.TileFeatures(ctx, q.Collection, t, getFeatures)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// Converts a feature from the Tiler, which identifies features by their integer primary key
+func tilerFeature(pf *prv.Feature) *Feature {
+	return &Feature{
+		ID:         strconv.FormatUint(pf.ID, 10),
+		Geometry:   pf.Geometry,
+		SRID:       pf.SRID,
+		Properties: pf.Properties,
+	}
+}
@@ -0,0 +1,231 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project tiler_source_test.go
+
+package data_provider
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/go-spatial/geom"
+	prv "github.com/go-spatial/tegola/provider"
+)
+
+// A Tiler serving features held in memory by layer, those w/ points outside a tile's lon/lat
+// extent are left out.
+type memTiler map[string][]*prv.Feature
+
+type memLayer string
+
+func (l memLayer) Name() string {
+	return string(l)
+}
+
+func (l memLayer) GeomType() geom.Geometry {
+	return geom.Point{}
+}
+
+func (l memLayer) SRID() uint64 {
+	return 4326
+}
+
+func (mt memTiler) Layers() ([]prv.LayerInfo, error) {
+	names := make([]string, 0, len(mt))
+	for name := range mt {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lis := make([]prv.LayerInfo, len(names))
+	for i, name := range names {
+		lis[i] = memLayer(name)
+	}
+	return lis, nil
+}
+
+func (mt memTiler) TileFeatures(ctx context.Context, layer string, tile prv.Tile, fn func(f *prv.Feature) error) error {
+	fs, ok := mt[layer]
+	if !ok {
+		return fmt.Errorf("no layer named '%v'", layer)
+	}
+	e, srid := tile.Extent()
+	for _, f := range fs {
+		if pt, ok := f.Geometry.(geom.Point); ok && srid == 4326 && (pt[0] < e[0] || pt[0] > e[2] || pt[1] < e[1] || pt[1] > e[3]) {
+			continue
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Features w/ ids from 1, each a point a tenth of a degree east of the last from (23.7, 37.9)
+func memFeatures(n int, props map[string]interface{}) []*prv.Feature {
+	fs := make([]*prv.Feature, n)
+	for i := range fs {
+		fs[i] = &prv.Feature{ID: uint64(i + 1), Geometry: geom.Point{23.7 + 0.1*float64(i), 37.9}, SRID: 4326, Properties: props}
+	}
+	return fs
+}
+
+// The ids of fs in order
+func featureIds(fs []*Feature) []string {
+	ids := make([]string, len(fs))
+	for i, f := range fs {
+		ids[i] = f.ID
+	}
+	return ids
+}
+
+func TestTilerSourceQueryFeatures(t *testing.T) {
+	ts := &TilerSource{Tiler: memTiler{"roads": memFeatures(5, map[string]interface{}{"highway": "primary"})}}
+
+	type tcase struct {
+		q        Query
+		expected []string
+		total    uint
+	}
+	tcases := []tcase{
+		{q: Query{}, expected: []string{"1", "2", "3", "4", "5"}, total: 5},
+		{q: Query{Limit: 2}, expected: []string{"1", "2"}, total: 5},
+		{q: Query{Limit: 2, Offset: 4}, expected: []string{"5"}, total: 5},
+		{q: Query{Offset: 7}, expected: []string{}, total: 5},
+		// Points at 23.8 & 23.9
+		{q: Query{Extent: &geom.Extent{23.75, 37.8, 23.95, 38.0}}, expected: []string{"2", "3"}, total: 2},
+		{q: Query{Extent: &geom.Extent{23.75, 37.8, 23.95, 38.0}, Offset: 1}, expected: []string{"3"}, total: 2},
+		{q: Query{Extent: &geom.Extent{-77.1, 38.8, -77.0, 38.9}}, expected: []string{}, total: 0},
+		{q: Query{Filters: []PropertyFilter{{Property: "highway", Op: OpEqual, Values: []string{"primary"}}}, Limit: 1}, expected: []string{"1"}, total: 5},
+		{q: Query{Filters: []PropertyFilter{{Property: "highway", Op: OpEqual, Values: []string{"secondary"}}}}, expected: []string{}, total: 0},
+	}
+	for i, tc := range tcases {
+		tc.q.Collection = "roads"
+		fs, err := ts.QueryFeatures(context.Background(), tc.q)
+		if err != nil {
+			t.Errorf("[%v] QueryFeatures(): %v", i, err)
+			continue
+		}
+		if ids := featureIds(fs); !reflect.DeepEqual(ids, tc.expected) {
+			t.Errorf("[%v] got features %v, wanted %v", i, ids, tc.expected)
+		}
+		if total, err := ts.CountFeatures(context.Background(), tc.q); err != nil || total != tc.total {
+			t.Errorf("[%v] CountFeatures() == %v, %v, wanted %v", i, total, err, tc.total)
+		}
+	}
+
+	if _, err := ts.QueryFeatures(context.Background(), Query{Collection: "rivers"}); err == nil {
+		t.Errorf("expected an error for a collection the Tiler doesn't have")
+	}
+}
+
+// The Querier is used for the collections it has tables for, the Tiler for the rest
+func TestTilerSourceQuerier(t *testing.T) {
+	db := recordingDB(t, [][]driver.Value{{int64(2), nil, nil, "secondary"}})
+	defer db.Close()
+	ts := &TilerSource{
+		Tiler:   memTiler{"roads": memFeatures(3, nil), "buildings": memFeatures(2, nil)},
+		Querier: &sqlQuerier{db: db, dialect: gpkgDialect{}, tables: map[string]*sqlTable{"roads": gpkgRoads}},
+	}
+
+	fs, err := ts.QueryFeatures(context.Background(), Query{Collection: "roads", Limit: 1, Offset: 1})
+	if err != nil || len(fs) != 1 || fs[0].Properties["highway"] != "secondary" || len(recorder.stmts) != 1 {
+		t.Errorf("QueryFeatures() == %v, %v w/ statements %v, wanted road 2 from the Querier", fs, err, recorder.stmts)
+	}
+	// The Querier can't use the unindexed extent
+	unindexed := *gpkgRoads
+	unindexed.rtree = ""
+	ts.Querier.(*sqlQuerier).tables["roads"] = &unindexed
+	recorder.stmts = nil
+	fs, err = ts.QueryFeatures(context.Background(), Query{Collection: "roads", Extent: &geom.Extent{23.75, 37.8, 23.95, 38.0}})
+	if ids := featureIds(fs); err != nil || !reflect.DeepEqual(ids, []string{"2", "3"}) || len(recorder.stmts) != 0 {
+		t.Errorf("QueryFeatures() == %v, %v w/ statements %v, wanted roads 2 & 3 from the Tiler", ids, err, recorder.stmts)
+	}
+	fs, err = ts.QueryFeatures(context.Background(), Query{Collection: "buildings"})
+	if ids := featureIds(fs); err != nil || !reflect.DeepEqual(ids, []string{"1", "2"}) || len(recorder.stmts) != 0 {
+		t.Errorf("QueryFeatures() == %v, %v w/ statements %v, wanted buildings 1 & 2 from the Tiler", ids, err, recorder.stmts)
+	}
+}
+
+func TestTilerSourceCollections(t *testing.T) {
+	ts := &TilerSource{Tiler: memTiler{"roads": memFeatures(3, nil), "buildings": memFeatures(2, nil)}}
+
+	names, err := ts.CollectionNames()
+	if err != nil || !reflect.DeepEqual(names, []string{"buildings", "roads"}) {
+		t.Errorf("CollectionNames() == %v, %v, wanted buildings & roads", names, err)
+	}
+	cs, err := ts.CollectionSchema("roads")
+	if err != nil || cs.Name != "roads" || cs.SRID != 4326 || cs.Properties != nil {
+		t.Errorf("CollectionSchema() == %+v, %v, wanted roads in 4326 w/o known properties", cs, err)
+	}
+	if _, err := ts.CollectionSchema("rivers"); err == nil {
+		t.Errorf("expected an error for a collection the Tiler doesn't have")
+	}
+	e, err := ts.CollectionExtent(context.Background(), "roads")
+	if err != nil || e == nil || e[1] != 37.9 || e[3] != 37.9 || e[0] != 23.7 {
+		t.Errorf("CollectionExtent() == %v, %v, wanted the extent of the road points", e, err)
+	}
+}
+
+func TestGetFeature(t *testing.T) {
+	ts := &TilerSource{Tiler: memTiler{
+		"roads":     memFeatures(3, map[string]interface{}{"highway": "primary"}),
+		"buildings": memFeatures(2, nil),
+	}}
+	p := Provider{Source: ts}
+
+	// Collections are scanned w/o a FeatureGetter
+	f, err := p.GetFeature(context.Background(), FeatureId{Collection: "roads", FeaturePk: "2"}, Selection{})
+	if err != nil || f == nil || f.ID != "2" {
+		t.Errorf("GetFeature() == %v, %v, wanted roads feature 2", f, err)
+	}
+	if f, err := p.GetFeature(context.Background(), FeatureId{Collection: "roads", FeaturePk: "9"}, Selection{}); err != nil || f != nil {
+		t.Errorf("GetFeature() == %v, %v, wanted no feature", f, err)
+	}
+
+	// Looked up by primary key in the Querier, which doesn't have a table for buildings
+	db := recordingDB(t, [][]driver.Value{{int64(2), nil, nil, "secondary"}})
+	defer db.Close()
+	ts.Querier = &sqlQuerier{db: db, dialect: gpkgDialect{}, tables: map[string]*sqlTable{"roads": gpkgRoads}}
+	f, err = p.GetFeature(context.Background(), FeatureId{Collection: "roads", FeaturePk: "2"}, Selection{})
+	if err != nil || f == nil || f.Properties["highway"] != "secondary" {
+		t.Errorf("GetFeature() == %v, %v, wanted roads feature 2 from the Querier", f, err)
+	}
+	if len(recorder.stmts) != 1 {
+		t.Errorf("got statements %v, wanted a single lookup", recorder.stmts)
+	}
+	f, err = p.GetFeature(context.Background(), FeatureId{Collection: "buildings", FeaturePk: "1"}, Selection{})
+	if err != nil || f == nil || f.ID != "1" {
+		t.Errorf("GetFeature() == %v, %v, wanted buildings feature 1 from the Tiler", f, err)
+	}
+	recorder.rows = nil
+	if f, err := p.GetFeature(context.Background(), FeatureId{Collection: "roads", FeaturePk: "9"}, Selection{}); err != nil || f != nil {
+		t.Errorf("GetFeature() == %v, %v, wanted no feature", f, err)
+	}
+}
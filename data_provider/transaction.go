@@ -0,0 +1,260 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project transaction.go
+
+package data_provider
+
+// Creating, replacing, updating & deleting features through a FeatureSource implementing
+// FeatureWriter, after checking them against their collection's schema.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// Returned for a feature that doesn't fit the schema of its collection
+type BadFeature struct {
+	msg string
+}
+
+func (bf *BadFeature) Error() string {
+	return bf.msg
+}
+
+// Returned for writes to a collection its source can't write to, including temporary collections
+var ErrReadOnly = errors.New("collection is read-only")
+
+// Counts the writes made to each collection, safe for concurrent use
+type revisionCounter struct {
+	mutex  sync.Mutex
+	counts map[string]uint64
+}
+
+func (p *Provider) revisions() *revisionCounter {
+	providerInitMutex.Lock()
+	defer providerInitMutex.Unlock()
+	if p.revisionCounts == nil {
+		p.revisionCounts = &revisionCounter{counts: make(map[string]uint64)}
+	}
+	return p.revisionCounts
+}
+
+// Number of writes made to collection through p, content read before & after a write differs in this
+func (p *Provider) CollectionRevision(collection string) uint64 {
+	rc := p.revisions()
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.counts[collection]
+}
+
+// The FeatureWriter writing to collection, ErrReadOnly if there's none
+func (p *Provider) featureWriter(collection string) (FeatureWriter, error) {
+	fw, ok := p.Source.(FeatureWriter)
+	if !ok || p.HasTempCollection(collection) {
+		return nil, ErrReadOnly
+	}
+	return fw, nil
+}
+
+// Accounts for a write to collection that returned err, which is returned as ErrReadOnly if the
+// source couldn't write to collection
+func (p *Provider) written(collection string, err error) error {
+	switch err {
+	case nil:
+	case ErrQueryNotSupported:
+		return ErrReadOnly
+	default:
+		return err
+	}
+	p.extentCache().drop(collection)
+	rc := p.revisions()
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.counts[collection]++
+	return nil
+}
+
+// Adds f to collection after checking it against the collection's schema, returning its new id
+func (p *Provider) CreateFeature(ctx context.Context, collection string, f *Feature) (string, error) {
+	fw, err := p.featureWriter(collection)
+	if err != nil {
+		return "", err
+	}
+	cf, err := p.checkFeature(collection, f)
+	if err != nil {
+		return "", err
+	}
+	id, err := fw.CreateFeature(ctx, collection, cf)
+	return id, p.written(collection, err)
+}
+
+// Replaces the geometry & all of the properties of feature fid w/ those of f after checking it
+// against the collection's schema, properties f doesn't have are cleared.
+func (p *Provider) ReplaceFeature(ctx context.Context, fid FeatureId, f *Feature) error {
+	fw, err := p.featureWriter(fid.Collection)
+	if err != nil {
+		return err
+	}
+	cf, err := p.checkFeature(fid.Collection, f)
+	if err != nil {
+		return err
+	}
+	return p.written(fid.Collection, fw.ReplaceFeature(ctx, fid.Collection, fid.FeaturePk, cf))
+}
+
+// Sets the properties of feature fid in patch, clearing those whose values are nil, & its
+// geometry if patch has one.  Its other properties are left as they are.  The feature is read
+// & then replaced, so concurrent updates of the same feature may overwrite each other.
+func (p *Provider) UpdateFeature(ctx context.Context, fid FeatureId, patch *Feature) error {
+	fw, err := p.featureWriter(fid.Collection)
+	if err != nil {
+		return err
+	}
+	f, err := p.GetFeature(ctx, fid, Selection{})
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return ErrFeatureNotFound
+	}
+
+	uf := &Feature{ID: f.ID, Geometry: f.Geometry, SRID: f.SRID, Properties: make(map[string]interface{}, len(f.Properties))}
+	for k, v := range f.Properties {
+		uf.Properties[k] = v
+	}
+	for k, v := range patch.Properties {
+		if v == nil {
+			delete(uf.Properties, k)
+		} else {
+			uf.Properties[k] = v
+		}
+	}
+	if patch.Geometry != nil {
+		uf.Geometry, uf.SRID = patch.Geometry, patch.SRID
+	}
+
+	cf, err := p.checkFeature(fid.Collection, uf)
+	if err != nil {
+		return err
+	}
+	return p.written(fid.Collection, fw.ReplaceFeature(ctx, fid.Collection, fid.FeaturePk, cf))
+}
+
+func (p *Provider) DeleteFeature(ctx context.Context, fid FeatureId) error {
+	fw, err := p.featureWriter(fid.Collection)
+	if err != nil {
+		return err
+	}
+	return p.written(fid.Collection, fw.DeleteFeature(ctx, fid.Collection, fid.FeaturePk))
+}
+
+// Copy of f w/ its property values converted to the types of its collection's properties.
+// Returns a *BadFeature if f has a property or geometry type the collection doesn't, collections
+// whose properties or geometry type aren't known aren't checked for those.
+func (p *Provider) checkFeature(collection string, f *Feature) (*Feature, error) {
+	cs, err := p.Source.CollectionSchema(collection)
+	if err != nil {
+		return nil, err
+	}
+	if f.Geometry != nil && cs.GeometryType != nil && reflect.TypeOf(f.Geometry) != reflect.TypeOf(cs.GeometryType) {
+		return nil, &BadFeature{msg: fmt.Sprintf("collection '%v' has %v geometries, not %v",
+			collection, geojsonType(cs.GeometryType), geojsonType(f.Geometry))}
+	}
+
+	cf := &Feature{ID: f.ID, Geometry: f.Geometry, SRID: f.SRID, Properties: make(map[string]interface{}, len(f.Properties))}
+	for k, v := range f.Properties {
+		if cs.Properties != nil {
+			known := false
+			for _, name := range cs.Properties {
+				known = known || name == k
+			}
+			if !known {
+				return nil, &BadFeature{msg: fmt.Sprintf("collection '%v' has no property '%v'", collection, k)}
+			}
+		}
+		pt, ok := cs.PropertyTypes[k]
+		if !ok {
+			cf.Properties[k] = v
+			continue
+		}
+		if cf.Properties[k], ok = propertyValue(v, pt); !ok {
+			return nil, &BadFeature{msg: fmt.Sprintf("invalid %v value for '%v': %v", pt, k, v)}
+		}
+	}
+	return cf, nil
+}
+
+// v, a property value decoded from JSON or read from a source, as a value of type pt (see the
+// PropertyType constants).  false if it isn't one.
+func propertyValue(v interface{}, pt string) (interface{}, bool) {
+	if v == nil {
+		return nil, true
+	}
+	var n float64
+	isNumber := true
+	switch tv := v.(type) {
+	case float64:
+		n = tv
+	case int64:
+		n = float64(tv)
+	case int:
+		n = float64(tv)
+	default:
+		isNumber = false
+	}
+
+	switch pt {
+	case PropertyTypeInteger:
+		if !isNumber || n != math.Trunc(n) {
+			return nil, false
+		}
+		return int64(n), true
+	case PropertyTypeNumber:
+		return n, isNumber
+	case PropertyTypeBoolean:
+		// Stored as integers w/o a boolean type
+		if isNumber && (n == 0 || n == 1) {
+			return n == 1, true
+		}
+		b, ok := v.(bool)
+		return b, ok
+	case PropertyTypeDateTime:
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		_, err := parse_time_string(s)
+		return s, err == nil
+	case PropertyTypeString:
+		s, ok := v.(string)
+		return s, ok
+	}
+	return v, true
+}
@@ -0,0 +1,172 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project transaction_test.go
+
+package data_provider
+
+import (
+	"context"
+	"encoding/binary"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/go-spatial/geom"
+)
+
+// A FileSource recording the features written to it
+type recordingWriter struct {
+	*FileSource
+	written map[string]*Feature
+}
+
+func (rw *recordingWriter) CreateFeature(ctx context.Context, collection string, f *Feature) (string, error) {
+	rw.written["new"] = f
+	return "new", nil
+}
+
+func (rw *recordingWriter) ReplaceFeature(ctx context.Context, collection, id string, f *Feature) error {
+	rw.written[id] = f
+	return nil
+}
+
+func (rw *recordingWriter) DeleteFeature(ctx context.Context, collection, id string) error {
+	rw.written[id] = nil
+	return nil
+}
+
+func TestProviderWrites(t *testing.T) {
+	fs, err := NewFileSource(path.Join(path.Dir(geojsonTestPath), "csv"), FileOptions{})
+	if err != nil {
+		t.Fatalf("NewFileSource(): %v", err)
+	}
+	ctx := context.Background()
+	if _, err := (&Provider{Source: fs}).CreateFeature(ctx, "sites", &Feature{}); err != ErrReadOnly {
+		t.Errorf("got %v writing to a FileSource, wanted ErrReadOnly", err)
+	}
+
+	rw := &recordingWriter{FileSource: fs, written: make(map[string]*Feature)}
+	p := Provider{Source: rw}
+	f, err := DecodeGeoJSONFeature([]byte(`{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-77, 38.9]},
+		"properties": {"name": "Spring", "visits": 3, "depth": 0.5, "active": true, "start_time": "2018-06-01T10:00:00Z"}}`))
+	if err != nil {
+		t.Fatalf("DecodeGeoJSONFeature(): %v", err)
+	}
+	id, err := p.CreateFeature(ctx, "sites", f)
+	if err != nil || id != "new" {
+		t.Fatalf("CreateFeature() == %v, %v, wanted new", id, err)
+	}
+	// JSON numbers are converted to the property's type
+	if v := rw.written["new"].Properties["visits"]; v != int64(3) {
+		t.Errorf("got visits %#v, wanted int64(3)", v)
+	}
+	if p.CollectionRevision("sites") != 1 {
+		t.Errorf("got revision %v after a write, wanted 1", p.CollectionRevision("sites"))
+	}
+
+	sites, _, err := p.QueryFeatures(ctx, Query{Collection: "sites", Filters: []PropertyFilter{{Property: "name", Op: OpEqual, Values: []string{"Creek A"}}}})
+	if err != nil || len(sites) != 1 {
+		t.Fatalf("QueryFeatures() got %v features, %v, wanted Creek A", len(sites), err)
+	}
+	fid := FeatureId{Collection: "sites", FeaturePk: sites[0].ID}
+	patch := &Feature{Properties: map[string]interface{}{"visits": 12.0, "depth": nil}}
+	if err := p.UpdateFeature(ctx, fid, patch); err != nil {
+		t.Fatalf("UpdateFeature(): %v", err)
+	}
+	uf := rw.written[fid.FeaturePk]
+	if uf == nil || uf.Properties["visits"] != int64(12) || uf.Properties["name"] != "Creek A" || uf.Geometry == nil {
+		t.Errorf("got updated feature %v, wanted Creek A w/ 12 visits", uf)
+	} else if _, ok := uf.Properties["depth"]; ok {
+		t.Errorf("got depth %v, wanted it cleared", uf.Properties["depth"])
+	}
+	if err := p.UpdateFeature(ctx, FeatureId{Collection: "sites", FeaturePk: "missing"}, patch); err != ErrFeatureNotFound {
+		t.Errorf("got %v updating a missing feature, wanted ErrFeatureNotFound", err)
+	}
+
+	for i, bad := range []*Feature{
+		{Properties: map[string]interface{}{"altitude": 3.0}},
+		{Properties: map[string]interface{}{"visits": 1.5}},
+		{Properties: map[string]interface{}{"active": "yes"}},
+		{Properties: map[string]interface{}{"start_time": "June"}},
+		{Geometry: geom.LineString{{0, 0}, {1, 1}}, SRID: 4326},
+	} {
+		if err := p.ReplaceFeature(ctx, fid, bad); err == nil {
+			t.Errorf("[%v] expected an error", i)
+		} else if _, ok := err.(*BadFeature); !ok {
+			t.Errorf("[%v] got a %T, wanted a *BadFeature", i, err)
+		}
+	}
+}
+
+func TestDecodeGeoJSONFeature(t *testing.T) {
+	f, err := DecodeGeoJSONFeature([]byte(`{"type": "Feature", "id": 7, "geometry": null, "properties": null}`))
+	if err != nil {
+		t.Fatalf("DecodeGeoJSONFeature(): %v", err)
+	}
+	expected := &Feature{ID: "7", SRID: 4326, Properties: map[string]interface{}{}}
+	if !reflect.DeepEqual(f, expected) {
+		t.Errorf("got %#v, wanted %#v", f, expected)
+	}
+
+	if _, err := DecodeGeoJSONFeature([]byte(`{"properties": {"name": "a"}}`)); err == nil {
+		t.Errorf("expected an error for a feature w/o a type")
+	}
+	if p, err := DecodeGeoJSONPatch([]byte(`{"properties": {"name": "a"}}`)); err != nil || p.Properties["name"] != "a" {
+		t.Errorf("DecodeGeoJSONPatch() == %v, %v, wanted a patch of name", p, err)
+	}
+
+	for _, doc := range []string{`{"type": "FeatureCollection", "features": []}`, `{"type": "Feature", "geometry": {"type": "Curve"}}`, `[]`} {
+		if _, err := DecodeGeoJSONFeature([]byte(doc)); err == nil {
+			t.Errorf("expected an error for %v", doc)
+		} else if _, ok := err.(*BadFeature); !ok {
+			t.Errorf("got a %T for %v, wanted a *BadFeature", err, doc)
+		}
+	}
+}
+
+func TestGpkgGeometryValue(t *testing.T) {
+	table := &sqlTable{name: "sites", geomColumn: "geom", srid: 3857}
+	args := &sqlArgs{dialect: gpkgDialect{}}
+	if _, err := (gpkgDialect{}).geometryValue(table, geom.Point{1, 2}, 4326, args); err != nil {
+		t.Fatalf("geometryValue(): %v", err)
+	}
+	b, _ := args.values[0].([]byte)
+	if len(b) < 40 || b[0] != 'G' || b[1] != 'P' || b[3] != 0x03 {
+		t.Fatalf("got header %v, wanted a little endian GeoPackage header w/ an xy envelope", b)
+	}
+	if srid := binary.LittleEndian.Uint32(b[4:8]); srid != 3857 {
+		t.Errorf("got srs_id %v, wanted 3857", srid)
+	}
+
+	v, err := (gpkgDialect{}).geometryValue(table, nil, 4326, args)
+	if err != nil || v != "NULL" {
+		t.Errorf("geometryValue(nil) == %v, %v, wanted NULL", v, err)
+	}
+	table.srid = 2154
+	if _, err := (gpkgDialect{}).geometryValue(table, geom.Point{1, 2}, 4326, args); err == nil {
+		t.Errorf("expected an error converting to srid 2154")
+	}
+}
@@ -0,0 +1,286 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+// jivan project wkt.go
+
+package data_provider
+
+// Decoding of Well-Known Text geometries into go-spatial geometries.
+// @see http://www.opengeospatial.org/standards/sfa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-spatial/geom"
+)
+
+// Decodes a WKT geometry, an EMPTY point decodes to nil.  z & m values are dropped, an EWKT
+// "SRID=<n>;" prefix is ignored.
+func DecodeWKT(s string) (geom.Geometry, error) {
+	if strings.HasPrefix(strings.ToUpper(s), "SRID=") {
+		if i := strings.IndexByte(s, ';'); i >= 0 {
+			s = s[i+1:]
+		}
+	}
+
+	p := &wktParser{s: s}
+	g, err := p.geometry()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected '%v'", p.s[p.pos:])
+	}
+	return g, nil
+}
+
+type wktParser struct {
+	s   string
+	pos int
+}
+
+func (p *wktParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid wkt at position %v: %v", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *wktParser) skipSpace() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// The next non-space character, 0 at the end of input
+func (p *wktParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *wktParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expecting '%c'", c)
+	}
+	p.pos++
+	return nil
+}
+
+// The next word, upper-cased, "" if the next token isn't one
+func (p *wktParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && (p.s[p.pos] >= 'A' && p.s[p.pos] <= 'Z' || p.s[p.pos] >= 'a' && p.s[p.pos] <= 'z') {
+		p.pos++
+	}
+	return strings.ToUpper(p.s[start:p.pos])
+}
+
+// Whether the next token is EMPTY, consuming it if so
+func (p *wktParser) empty() bool {
+	start := p.pos
+	if p.word() == "EMPTY" {
+		return true
+	}
+	p.pos = start
+	return false
+}
+
+func (p *wktParser) number() (float64, bool) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte("0123456789+-.eE", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+	if err != nil {
+		p.pos = start
+		return 0, false
+	}
+	return v, true
+}
+
+// x y [z [m]]
+func (p *wktParser) position() ([2]float64, error) {
+	var pt [2]float64
+	var ok bool
+	for i := range pt {
+		if pt[i], ok = p.number(); !ok {
+			return pt, p.errorf("expecting a coordinate")
+		}
+	}
+	// Drop z & m
+	for p.peek() != ',' && p.peek() != ')' && p.peek() != 0 {
+		if _, ok := p.number(); !ok {
+			return pt, p.errorf("expecting a coordinate")
+		}
+	}
+	return pt, nil
+}
+
+// ( position, ... ), MultiPoint positions may also be individually parenthesized
+func (p *wktParser) positions() ([][2]float64, error) {
+	if p.empty() {
+		return [][2]float64{}, nil
+	}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	var pts [][2]float64
+	for {
+		parenthesized := p.peek() == '('
+		if parenthesized {
+			p.pos++
+		}
+		pt, err := p.position()
+		if err != nil {
+			return nil, err
+		}
+		if parenthesized {
+			if err := p.expect(')'); err != nil {
+				return nil, err
+			}
+		}
+		pts = append(pts, pt)
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	return pts, p.expect(')')
+}
+
+// ( ( position, ... ), ... )
+func (p *wktParser) positionLists() ([][][2]float64, error) {
+	if p.empty() {
+		return [][][2]float64{}, nil
+	}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	var lists [][][2]float64
+	for {
+		pts, err := p.positions()
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, pts)
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	return lists, p.expect(')')
+}
+
+func (p *wktParser) geometry() (geom.Geometry, error) {
+	start := p.pos
+	gtype := p.word()
+	// Dimension qualifier
+	dimStart := p.pos
+	switch p.word() {
+	case "Z", "M", "ZM":
+	default:
+		p.pos = dimStart
+	}
+
+	switch gtype {
+	case "POINT":
+		if p.empty() {
+			return nil, nil
+		}
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		pt, err := p.position()
+		if err != nil {
+			return nil, err
+		}
+		return geom.Point(pt), p.expect(')')
+	case "MULTIPOINT":
+		pts, err := p.positions()
+		return geom.MultiPoint(pts), err
+	case "LINESTRING":
+		pts, err := p.positions()
+		return geom.LineString(pts), err
+	case "MULTILINESTRING":
+		lines, err := p.positionLists()
+		return geom.MultiLineString(lines), err
+	case "POLYGON":
+		rings, err := p.positionLists()
+		return geom.Polygon(rings), err
+	case "MULTIPOLYGON":
+		mp := geom.MultiPolygon{}
+		if p.empty() {
+			return mp, nil
+		}
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		for {
+			rings, err := p.positionLists()
+			if err != nil {
+				return nil, err
+			}
+			mp = append(mp, rings)
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+		return mp, p.expect(')')
+	case "GEOMETRYCOLLECTION":
+		gc := geom.Collection{}
+		if p.empty() {
+			return gc, nil
+		}
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		for {
+			g, err := p.geometry()
+			if err != nil {
+				return nil, err
+			}
+			if g != nil {
+				gc = append(gc, g)
+			}
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+		return gc, p.expect(')')
+	default:
+		p.pos = start
+		return nil, p.errorf("unsupported geometry type '%v'", gtype)
+	}
+}
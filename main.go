@@ -31,16 +31,14 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/go-spatial/jivan/config"
 	"github.com/go-spatial/jivan/data_provider"
 	"github.com/go-spatial/jivan/server"
 	"github.com/go-spatial/jivan/util"
 	"github.com/go-spatial/jivan/wfs3"
-	"github.com/go-spatial/tegola/dict"
-	tegola_provider "github.com/go-spatial/tegola/provider"
-	"github.com/go-spatial/tegola/provider/gpkg"
-	"github.com/go-spatial/tegola/provider/postgis"
 )
 
 func main() {
@@ -54,7 +52,7 @@ func main() {
 	flag.StringVar(&bindIp, "b", "127.0.0.1", "IP address for the server to listen on")
 	flag.IntVar(&bindPort, "p", 9000, "port for the server to listen on")
 	flag.StringVar(&serveAddress, "s", "", "IP:Port that result urls will be constructed with (defaults to the IP:Port used in request)")
-	flag.StringVar(&dataSource, "d", "", "data source (path to .gpkg file or connection string to PostGIS database i.e 'user={user} password={password} dbname={dbname} host={host} port={port}')")
+	flag.StringVar(&dataSource, "d", "", "data source (path to .gpkg file, .geojson, .shp or .csv file or a directory of them, or connection string to PostGIS database i.e 'user={user} password={password} dbname={dbname} host={host} port={port}')")
 	flag.StringVar(&configFile, "c", "", "config (path to .toml file)")
 
 	flag.Parse()
@@ -65,6 +63,8 @@ func main() {
 	// 3. if other command line arguments are passed, they override previous settings
 	// 4. If no data provider is supplied by any of these means, the working directory
 	//    is scanned for .gpkg files, then the 'data/' and 'test_data/' directories.
+	// A -d data source is served on its own, otherwise the config file's [[providers.sources]]
+	// are served together if there are any, then the config file's providers.data.
 
 	if configFile != "" { // load config from command line
 		config.Configuration, err = config.LoadConfigFromFile(configFile)
@@ -80,40 +80,157 @@ func main() {
 		config.Configuration.Server.URLHostPort = serveAddress
 	}
 
-	var autoconfig func(ds string) (dict.Dicter, error)
-	var ntp func(config dict.Dicter) (tegola_provider.Tiler, error)
-	if dataSource != "" {
-		// Is this a PostGIS conn string or GeoPackage path?
-		if _, err := os.Stat(config.Configuration.Providers.Data); os.IsNotExist(err) {
-			autoconfig = postgis.AutoConfig
-			ntp = postgis.NewTileProvider
-		} else {
-			autoconfig = gpkg.AutoConfig
-			ntp = gpkg.NewTileProvider
+	var source data_provider.FeatureSource
+	if dataSource == "" && len(config.Configuration.Providers.Sources) > 0 {
+		source, err = newMultiSource(config.Configuration.Providers.Sources)
+	} else {
+		if dataSource == "" {
+			dataSource = config.Configuration.Providers.Data
+		}
+		if dataSource == "" {
+			dataSource = util.DefaultGpkg()
+		}
+		if dataSource == "" {
+			panic("no datasource")
+		}
+		config.Configuration.Providers.Data = dataSource
+		source, err = newSource(dataSource)
+		if err == nil {
+			err = configureCollections(source, "")
 		}
 	}
-	if dataSource == "" {
-		dataSource = util.DefaultGpkg()
-		autoconfig = gpkg.AutoConfig
-		ntp = gpkg.NewTileProvider
+	if err != nil {
+		panic(err.Error())
 	}
-	if dataSource == "" {
-		panic("no datasource")
+
+	pc := config.Configuration.Providers
+	p := data_provider.Provider{
+		Source:             source,
+		TemporalProperties: temporalProperties(),
+		TempCollectionTTL:  time.Duration(pc.TempCollectionTTL) * time.Second,
+		MaxTempCollections: pc.MaxTempCollections,
+		MaxTempFeatures:    pc.MaxTempFeatures,
+		ExtentCacheTTL:     time.Duration(pc.ExtentCacheTTL) * time.Second,
 	}
-	config.Configuration.Providers.Data = dataSource
+	wfs3.GenerateOpenAPIDocument()
 
-	dataConfig, err := autoconfig(dataSource)
-	if err != nil {
-		panic(fmt.Sprintf("data provider auto-config failure for '%v': %v", dataSource, err))
+	server.StartServer(p)
+}
+
+// Picks the kind of FeatureSource for dataSource: a GeoJSON, shapefile or CSV file, or a
+// directory of them, a GeoPackage, or failing those a PostGIS connection string.
+func newSource(dataSource string) (data_provider.FeatureSource, error) {
+	fi, err := os.Stat(dataSource)
+	switch {
+	case os.IsNotExist(err):
+		return data_provider.NewPostGISSource(dataSource)
+	case err != nil:
+		return nil, err
+	case fi.IsDir() || data_provider.IsDataFile(dataSource):
+		csv := config.Configuration.Providers.CSV
+		opts := data_provider.FileOptions{
+			CSV: data_provider.CSVOptions{LonColumn: csv.LonColumn, LatColumn: csv.LatColumn, WKTColumn: csv.WKTColumn},
+		}
+		return data_provider.NewFileSource(dataSource, opts)
+	default:
+		return data_provider.NewGpkgSource(dataSource, config.Configuration.Server.Transactions)
 	}
+}
 
-	dataProvider, err := ntp(dataConfig)
-	if err != nil {
-		panic(fmt.Sprintf("data provider creation error for '%v': %v", dataSource, err))
+// A MultiSource serving each of sources under its name
+func newMultiSource(sources []config.Source) (data_provider.FeatureSource, error) {
+	ms := data_provider.NewMultiSource()
+	for _, s := range sources {
+		source, err := newSource(s.Data)
+		if err != nil {
+			return nil, fmt.Errorf("problem creating data source '%v': %v", s.Name, err)
+		}
+		if err := configureCollections(source, s.Name); err != nil {
+			return nil, err
+		}
+		if err := ms.Add(s.Name, source); err != nil {
+			return nil, err
+		}
 	}
 
-	p := data_provider.Provider{Tiler: dataProvider}
-	wfs3.GenerateOpenAPIDocument()
+	for _, c := range config.Configuration.Collections {
+		found := false
+		for _, s := range sources {
+			found = found || c.Provider == s.Name
+		}
+		if !found {
+			return nil, fmt.Errorf("collection '%v' has an unknown provider: '%v'", c.Name, c.Provider)
+		}
+	}
 
-	server.StartServer(p)
+	return ms, nil
+}
+
+// Adds the config file's [[collections]] w/ provider & sql to source & sets the id columns of
+// those w/o sql, provider is "" for a single data source.
+func configureCollections(source data_provider.FeatureSource, provider string) error {
+	for _, c := range config.Configuration.Collections {
+		if c.Provider != provider {
+			if provider == "" {
+				return fmt.Errorf("collection '%v' has provider '%v' but there's a single data source", c.Name, c.Provider)
+			}
+			continue
+		}
+		if c.SQL == "" {
+			if c.IDColumn == "" {
+				continue
+			}
+			setter, ok := source.(data_provider.IdColumnSetter)
+			if !ok {
+				return fmt.Errorf("the data source for collection '%v' doesn't support setting id columns", c.Name)
+			}
+			if err := setter.SetIdColumns(c.Name, idColumns(c.IDColumn)); err != nil {
+				return fmt.Errorf("problem setting the id columns of collection '%v': %v", c.Name, err)
+			}
+			continue
+		}
+		adder, ok := source.(data_provider.SQLCollectionAdder)
+		if !ok {
+			return fmt.Errorf("the data source for collection '%v' doesn't support collections defined by SQL", c.Name)
+		}
+		err := adder.AddSQLCollection(data_provider.SQLCollection{
+			Name:           c.Name,
+			SQL:            c.SQL,
+			GeometryColumn: c.GeometryColumn,
+			IDColumns:      idColumns(c.IDColumn),
+			SRID:           c.SRID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The column names in a comma separated id_column setting
+func idColumns(setting string) []string {
+	var cols []string
+	for _, c := range strings.Split(setting, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// The temporal properties of the config file's [[collections]] keyed by served collection name
+func temporalProperties() map[string]data_provider.TemporalProperties {
+	tps := make(map[string]data_provider.TemporalProperties)
+	for _, c := range config.Configuration.Collections {
+		tp := data_provider.TemporalProperties{Instant: c.TimeProperty, Start: c.StartTimeProperty, End: c.EndTimeProperty}
+		if !tp.IsSet() {
+			continue
+		}
+		name := c.Name
+		if c.Provider != "" {
+			name = c.Provider + data_provider.SourceSeparator + name
+		}
+		tps[name] = tp
+	}
+	return tps
 }
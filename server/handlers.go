@@ -28,17 +28,22 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-spatial/geom"
 	"github.com/go-spatial/jivan/config"
+	"github.com/go-spatial/jivan/cql2"
 	"github.com/go-spatial/jivan/data_provider"
 	"github.com/go-spatial/jivan/wfs3"
 	"github.com/julienschmidt/httprouter"
@@ -48,13 +53,22 @@ import (
 const DEFAULT_RESULT_LIMIT = 10
 
 const (
-	HTTPStatusOk          = 200
-	HTTPStatusNotModified = 304
-	HTTPStatusServerError = 500
-	HTTPStatusClientError = 400
-
-	HTTPMethodGET  = "GET"
-	HTTPMethodHEAD = "HEAD"
+	HTTPStatusOk                 = 200
+	HTTPStatusCreated            = 201
+	HTTPStatusNoContent          = 204
+	HTTPStatusNotModified        = 304
+	HTTPStatusServerError        = 500
+	HTTPStatusServiceUnavailable = 503
+	HTTPStatusClientError        = 400
+	HTTPStatusNotFound           = 404
+	HTTPStatusMethodNotAllowed   = 405
+
+	HTTPMethodGET    = "GET"
+	HTTPMethodHEAD   = "HEAD"
+	HTTPMethodPOST   = "POST"
+	HTTPMethodPUT    = "PUT"
+	HTTPMethodPATCH  = "PATCH"
+	HTTPMethodDELETE = "DELETE"
 )
 
 type HandlerError struct {
@@ -128,6 +142,30 @@ func jsonError(w http.ResponseWriter, code string, msg string, status int) {
 	}
 }
 
+// A context for reading data in response to r, done when r's is or after the configured
+// query timeout.
+func queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := config.Configuration.Server.QueryTimeout
+	if timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
+}
+
+// If ctx is done, responds w/ an error when it timed out & returns true.  The error that ended
+// the request is of no interest then, it's most likely a result of ctx being done.
+func contextDone(w http.ResponseWriter, r *http.Request, ctx context.Context) bool {
+	switch ctx.Err() {
+	case nil:
+		return false
+	case context.DeadlineExceeded:
+		jsonError(w, "ServiceUnavailable", "Timed out reading feature data", HTTPStatusServiceUnavailable)
+	default:
+		log.Printf("request for %v cancelled: %v", r.URL, ctx.Err())
+	}
+	return true
+}
+
 // Provides a link for the given content type
 func ctLink(baselink, contentType string) string {
 	if !supportedContentType(contentType) {
@@ -348,8 +386,13 @@ func collectionMetaData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	md, contentId, err := wfs3.CollectionMetaData(cName, &Provider, serveSchemeHostPortBase(r), false)
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	md, contentId, err := wfs3.CollectionMetaData(ctx, cName, &Provider, serveSchemeHostPortBase(r), false)
 	if err != nil {
+		if contextDone(w, r, ctx) {
+			return
+		}
 		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
 		return
 	}
@@ -376,6 +419,12 @@ func collectionMetaData(w http.ResponseWriter, r *http.Request) {
 	for _, act := range altcts {
 		plinks = append(plinks, &wfs3.Link{Rel: "item", Href: ctLink(collectionDataUrlBase, act), Type: act})
 	}
+	// And to the properties the data may be filtered on
+	queryablesUrl := fmt.Sprintf("%v/queryables", collectionMdUrlBase)
+	plinks = append(plinks, &wfs3.Link{Rel: RelQueryables, Href: ctLink(queryablesUrl, ct), Type: ct})
+	// & sorted on
+	sortablesUrl := fmt.Sprintf("%v/sortables", collectionMdUrlBase)
+	plinks = append(plinks, &wfs3.Link{Rel: RelSortables, Href: ctLink(sortablesUrl, ct), Type: ct})
 	md.Links = append(plinks, md.Links...)
 
 	w.Header().Set("ETag", contentId)
@@ -424,13 +473,176 @@ func collectionMetaData(w http.ResponseWriter, r *http.Request) {
 	w.Write(encodedContent)
 }
 
+// Link relation of a collection's queryables
+const RelQueryables = "http://www.opengis.net/def/rel/ogc/1.0/queryables"
+
+// --- Lists the properties the features of a collection may be filtered on at /collections/{name}/queryables
+func collectionQueryables(w http.ResponseWriter, r *http.Request) {
+	cqPath := "/collections/{name}/queryables"
+	overrideContent := r.Context().Value("overrideContent")
+
+	ct := contentType(r)
+	ps := httprouter.ParamsFromContext(r.Context())
+
+	cName := ps.ByName("name")
+	if cName == "" {
+		jsonError(w, "MissingParameterValue", "No {name} provided", HTTPStatusClientError)
+		return
+	}
+
+	qs, contentId, err := wfs3.CollectionQueryables(cName, &Provider, serveSchemeHostPortBase(r), false)
+	if err != nil {
+		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
+		return
+	}
+
+	collectionUrl := fmt.Sprintf("%v/collections/%v", serveSchemeHostPortBase(r), cName)
+	qs.Id = fmt.Sprintf("%v/queryables", collectionUrl)
+	for _, sct := range config.SupportedContentTypes {
+		rel := "alternate"
+		if sct == ct {
+			rel = "self"
+		}
+		qs.Links = append(qs.Links, &wfs3.Link{Rel: rel, Href: ctLink(qs.Id, sct), Type: sct})
+	}
+	qs.Links = append(qs.Links, &wfs3.Link{Rel: "collection", Href: ctLink(collectionUrl, ct), Type: ct})
+
+	w.Header().Set("ETag", contentId)
+	if r.Method == HTTPMethodHEAD {
+		if r.Header.Get("ETag") == contentId {
+			w.WriteHeader(HTTPStatusNotModified)
+		} else {
+			w.WriteHeader(HTTPStatusOk)
+		}
+		return
+	}
+
+	var encodedContent []byte
+	if ct == config.JSONContentType {
+		encodedContent, err = json.Marshal(qs)
+	} else if ct == config.HTMLContentType {
+		encodedContent, err = qs.MarshalHTML(config.Configuration)
+	} else {
+		jsonError(w, "InvalidParameterValue", "Content-Type: ''"+ct+"'' not supported.", HTTPStatusServerError)
+		return
+	}
+
+	if err != nil {
+		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ct)
+
+	if overrideContent != nil {
+		encodedContent = overrideContent.([]byte)
+	}
+
+	if ct == config.JSONContentType {
+		respBodyRC := ioutil.NopCloser(bytes.NewReader(encodedContent))
+		err = wfs3.ValidateJSONResponse(r, cqPath, HTTPStatusOk, w.Header(), respBodyRC)
+		if err != nil {
+			log.Printf("%v", err)
+			jsonError(w, "NoApplicableCode", "response doesn't match schema", HTTPStatusServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(HTTPStatusOk)
+	w.Write(encodedContent)
+}
+
+// Link relation of a collection's sortables
+const RelSortables = "http://www.opengis.net/def/rel/ogc/1.0/sortables"
+
+// --- Lists the properties the features of a collection may be sorted on at /collections/{name}/sortables
+func collectionSortables(w http.ResponseWriter, r *http.Request) {
+	csPath := "/collections/{name}/sortables"
+	overrideContent := r.Context().Value("overrideContent")
+
+	ct := contentType(r)
+	ps := httprouter.ParamsFromContext(r.Context())
+
+	cName := ps.ByName("name")
+	if cName == "" {
+		jsonError(w, "MissingParameterValue", "No {name} provided", HTTPStatusClientError)
+		return
+	}
+
+	ss, contentId, err := wfs3.CollectionSortables(cName, &Provider, serveSchemeHostPortBase(r), false)
+	if err != nil {
+		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
+		return
+	}
+
+	collectionUrl := fmt.Sprintf("%v/collections/%v", serveSchemeHostPortBase(r), cName)
+	ss.Id = fmt.Sprintf("%v/sortables", collectionUrl)
+	for _, sct := range config.SupportedContentTypes {
+		rel := "alternate"
+		if sct == ct {
+			rel = "self"
+		}
+		ss.Links = append(ss.Links, &wfs3.Link{Rel: rel, Href: ctLink(ss.Id, sct), Type: sct})
+	}
+	ss.Links = append(ss.Links, &wfs3.Link{Rel: "collection", Href: ctLink(collectionUrl, ct), Type: ct})
+
+	w.Header().Set("ETag", contentId)
+	if r.Method == HTTPMethodHEAD {
+		if r.Header.Get("ETag") == contentId {
+			w.WriteHeader(HTTPStatusNotModified)
+		} else {
+			w.WriteHeader(HTTPStatusOk)
+		}
+		return
+	}
+
+	var encodedContent []byte
+	if ct == config.JSONContentType {
+		encodedContent, err = json.Marshal(ss)
+	} else if ct == config.HTMLContentType {
+		encodedContent, err = ss.MarshalHTML(config.Configuration)
+	} else {
+		jsonError(w, "InvalidParameterValue", "Content-Type: ''"+ct+"'' not supported.", HTTPStatusServerError)
+		return
+	}
+
+	if err != nil {
+		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ct)
+
+	if overrideContent != nil {
+		encodedContent = overrideContent.([]byte)
+	}
+
+	if ct == config.JSONContentType {
+		respBodyRC := ioutil.NopCloser(bytes.NewReader(encodedContent))
+		err = wfs3.ValidateJSONResponse(r, csPath, HTTPStatusOk, w.Header(), respBodyRC)
+		if err != nil {
+			log.Printf("%v", err)
+			jsonError(w, "NoApplicableCode", "response doesn't match schema", HTTPStatusServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(HTTPStatusOk)
+	w.Write(encodedContent)
+}
+
 func collectionsMetaData(w http.ResponseWriter, r *http.Request) {
 	cmdPath := "/collections"
 	overrideContent := r.Context().Value("overrideContent")
 
 	ct := contentType(r)
-	md, contentId, err := wfs3.CollectionsMetaData(&Provider, serveSchemeHostPortBase(r), false)
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	md, contentId, err := wfs3.CollectionsMetaData(ctx, &Provider, serveSchemeHostPortBase(r), false)
 	if err != nil {
+		if contextDone(w, r, ctx) {
+			return
+		}
 		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
 		return
 	}
@@ -523,155 +735,179 @@ func collectionsMetaData(w http.ResponseWriter, r *http.Request) {
 	w.Write(encodedContent)
 }
 
+// --- The k features of a collection nearest a point at /collections/{name}/nearest?point=lon,lat&k=n,
+// nearest first w/ their distance in meters.  The same as /collections/{name}/items?near=lon,lat&limit=n,
+// which the other items parameters can be combined w/.  Its paging links are to that items request.
+func collectionNearest(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	for _, p := range []string{"near", "page", "limit"} {
+		if _, ok := q[p]; ok {
+			jsonError(w, "InvalidParameterValue", fmt.Sprintf("'%v' parameter isn't supported, use 'point' & 'k'", p), HTTPStatusClientError)
+			return
+		}
+	}
+	if len(q["point"]) == 0 {
+		jsonError(w, "InvalidParameterValue", "'point' parameter is required", HTTPStatusClientError)
+		return
+	}
+	q["near"] = q["point"]
+	delete(q, "point")
+	if k, ok := q["k"]; ok {
+		q["limit"] = k
+		delete(q, "k")
+	}
+
+	nr := new(http.Request)
+	*nr = *r
+	nr.URL = new(url.URL)
+	*nr.URL = *r.URL
+	nr.URL.RawQuery = q.Encode()
+	collectionData(w, nr)
+}
+
 // --- Provide paged access to data for all features at /collections/{name}/items/{feature_id}
+// A POST to /collections/{name}/items gives a filter in its body, see itemsRequest.
 func collectionData(w http.ResponseWriter, r *http.Request) {
 	ct := contentType(r)
 	overrideContent := r.Context().Value("overrideContent")
 
 	urlParams := httprouter.ParamsFromContext(r.Context())
 	cName := urlParams.ByName("name")
-	fidStr := urlParams.ByName("feature_id")
-	var fid uint64
-	var err error
-	if fidStr != "" {
-		cid, err := strconv.Atoi(fidStr)
-		if err != nil {
-			jsonError(w, "InvalidParameterValue", "Invalid feature_id: "+fidStr, HTTPStatusClientError)
-		}
-		fid = uint64(cid)
-	}
+	// Feature ids are opaque strings, it's up to the provider whether there's such a feature
+	fid := urlParams.ByName("feature_id")
 
 	q := r.URL.Query()
-	reservedQParams := []string{"f", "page", "limit", "time", "bbox"}
-	var limit, pageNum uint
-	var timeprops map[string]string
+	reservedQParams := []string{"f", "page", "limit", "datetime", "time", "bbox", "bbox-crs", "crs", "properties", "skipGeometry", "sortby", "filter", "filter-lang", "filter-crs", "near"}
+	limit, pageNum, err := pagingParams(q)
+	if err != nil {
+		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusClientError)
+		return
+	}
 
-	qPageSize := q["limit"]
-	if len(qPageSize) != 1 {
-		limit = DEFAULT_RESULT_LIMIT
-	} else {
-		ps, err := strconv.ParseUint(qPageSize[0], 10, 64)
-		if err != nil {
-			jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusClientError)
-			return
-		}
-		if ps > uint64(config.Configuration.Server.MaxLimit) {
-			ps = uint64(config.Configuration.Server.MaxLimit)
-		}
-		limit = uint(ps)
+	bbox, err := bboxParam(q)
+	if err == nil {
+		bbox, err = lonLatBbox(q, bbox)
+	}
+	if err != nil {
+		jsonError(w, "InvalidParameterValue", err.Error(), HTTPStatusClientError)
+		return
 	}
 
-	qPageNum := q["page"]
-	if len(qPageNum) != 1 {
-		pageNum = 0
-	} else {
-		pn, err := strconv.ParseUint(qPageNum[0], 10, 64)
-		if err != nil {
-			jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusClientError)
-			return
-		}
-		pageNum = uint(pn)
+	timeFilter, err := timeParam(q)
+	if err != nil {
+		jsonError(w, "InvalidParameterValue", err.Error(), HTTPStatusClientError)
+		return
 	}
 
-	qBBox := q["bbox"]
-	var bbox *geom.Extent
-	if len(qBBox) > 0 {
-		if len(qBBox) > 1 {
-			jsonError(w, "InvalidParameterValue", "'bbox' parameter provided more than once", HTTPStatusClientError)
-			return
-		}
+	sel, err := selectionParams(q)
+	if err != nil {
+		jsonError(w, "InvalidParameterValue", err.Error(), HTTPStatusClientError)
+		return
+	}
 
-		bbox_items := strings.Split(qBBox[0], ",")
-		if len(bbox_items) != 4 {
-			msg := fmt.Sprintf("'bbox' parameter has %v items, expecting 4: '%v'", len(bbox_items), qBBox[0])
-			jsonError(w, "InvalidParameterValue", msg, HTTPStatusClientError)
-			return
-		} else {
-			bbox = &geom.Extent{}
-			for i, p := range bbox_items {
-				if bbox[i], err = strconv.ParseFloat(p, 64); err != nil {
-					msg := fmt.Sprintf("'bbox' parameter has invalid format for item %v/4: '%v' / '%v'", i+1, p, qBBox[0])
-					jsonError(w, "InvalidParameterValue", msg, HTTPStatusClientError)
-					return
-				}
-			}
-		}
+	sortBy, err := sortbyParam(q)
+	if err != nil {
+		jsonError(w, "InvalidParameterValue", err.Error(), HTTPStatusClientError)
+		return
 	}
 
-	qTime := q["time"]
-	if len(qTime) > 0 {
-		if len(qTime) > 1 {
-			jsonError(w, "InvalidParameterValue", "'time' parameter provided more than once'", HTTPStatusClientError)
-			return
-		}
-		ts := strings.Split(qTime[0], "/")
-		timeprops = make(map[string]string)
-		if len(ts) == 1 {
-			timeprops["timestamp"] = ts[0]
-		} else if len(ts) == 2 {
-			timeprops["start_time"] = ts[0]
-			timeprops["stop_time"] = ts[1]
-		} else {
-			jsonError(w, "InvalidParameterValue", "'time' parameter contains more than two time values ('/' separator)", HTTPStatusClientError)
-			return
-		}
+	nearest, err := nearParam(q)
+	if err != nil {
+		jsonError(w, "InvalidParameterValue", err.Error(), HTTPStatusClientError)
+		return
 	}
 
-	// Collect additional property filters
-	properties := make(map[string]string)
-NEXT_QUERY_PARAM:
-	for k, v := range q {
-		for _, rqp := range reservedQParams {
-			if k == rqp {
-				continue NEXT_QUERY_PARAM
-			}
+	var filter cql2.Expr
+	if r.Method == HTTPMethodPOST {
+		var filterParams url.Values
+		filter, filterParams, err = filterBody(r)
+		// Paging links are GETs w/ the filter in the URL
+		for k, vs := range filterParams {
+			q[k] = vs
 		}
-
-		properties[k] = v[0]
+	} else {
+		filter, err = filterParam(q)
+	}
+	if err != nil {
+		jsonError(w, "InvalidParameterValue", err.Error(), HTTPStatusClientError)
+		return
 	}
 
-	// Add time-specific properties
-	for k, v := range timeprops {
-		properties[k] = v
+	crs, err := Provider.OutputCRS(cName, q.Get("crs"))
+	if err != nil {
+		if _, ok := err.(*data_provider.BadCRS); ok {
+			jsonError(w, "InvalidParameterValue", err.Error(), HTTPStatusClientError)
+			return
+		}
+		// Anything else, i.e. an unknown collection, is reported when collecting the data
+		crs = data_provider.DefaultCRS
 	}
 
+	// Collect additional property filters
+	filters := propertyFilters(q, reservedQParams)
+
 	var data interface{}
 	var jsonSchema string
 	// Hex string hash of content
 	var contentId string
 	// Indicates if there is more data available from stopIdx onward
 	var featureTotal uint
+	ctx, cancel := queryContext(r)
+	defer cancel()
 	// If a feature_id was provided, get a single feature, otherwise get a feature collection
 	//	containing all of the collection's features
-	if fidStr != "" {
-		data, contentId, err = wfs3.FeatureData(cName, fid, &Provider, false)
+	if fid != "" {
+		data, contentId, err = wfs3.FeatureData(ctx, cName, fid, crs, sel, &Provider, false)
 		jsonSchema = wfs3.FeatureJSONSchema
 	} else {
-		// First index we're interested in
-		startIdx := limit * pageNum
-		// Last index we're interested in +1
-		stopIdx := startIdx + limit
-
-		data, featureTotal, contentId, err = wfs3.FeatureCollectionData(cName, bbox, startIdx, stopIdx, properties, &Provider, false)
+		fq := data_provider.Query{
+			Collection: cName,
+			Extent:     bbox,
+			Time:       timeFilter,
+			Filters:    filters,
+			Filter:     filter,
+			// First index we're interested in
+			Offset:  limit * pageNum,
+			Limit:   limit,
+			SortBy:  sortBy,
+			Nearest: nearest,
+			Select:  sel,
+		}
+		data, featureTotal, contentId, err = wfs3.FeatureCollectionData(ctx, fq, crs, &Provider, false)
 		jsonSchema = wfs3.FeatureCollectionJSONSchema
 	}
 
 	if err != nil {
+		if contextDone(w, r, ctx) {
+			return
+		}
+		code := "InvalidParameterValue"
 		var sc int
 		var msg string
 		switch e := err.(type) {
 		case *data_provider.BadTimeString:
 			msg = e.Error()
 			sc = HTTPStatusClientError
+		case *data_provider.BadFilter:
+			msg = e.Error()
+			sc = HTTPStatusClientError
+		case *data_provider.BadCRS:
+			msg = e.Error()
+			sc = HTTPStatusClientError
+		case *wfs3.FeatureNotFound:
+			code = "NotFound"
+			msg = e.Error()
+			sc = HTTPStatusNotFound
 		default:
 			msg = fmt.Sprintf("Problem collecting feature data: %v", e)
 			sc = HTTPStatusServerError
 		}
-		jsonError(w, "InvalidParameterValue", msg, sc)
+		jsonError(w, code, msg, sc)
 		return
 	}
 
 	w.Header().Set("ETag", contentId)
+	w.Header().Set("Content-Crs", fmt.Sprintf("<%v>", crs.URI))
 	if r.Method == HTTPMethodHEAD {
 		if r.Header.Get("ETag") == contentId {
 			w.WriteHeader(HTTPStatusNotModified)
@@ -681,20 +917,11 @@ NEXT_QUERY_PARAM:
 		return
 	}
 
-	// Alternate content types
-	var altcts []string
-	switch ct {
-	case config.JSONContentType:
-		altcts = append(altcts, config.HTMLContentType)
-	case config.HTMLContentType:
-		altcts = append(altcts, config.JSONContentType)
-	}
-
 	var encodedContent []byte
 	switch d := data.(type) {
 	case *wfs3.Feature:
 		// Generate links
-		shref := fmt.Sprintf("%v/collections/%v/items/%v", serveSchemeHostPortBase(r), cName, fid)
+		shref := fmt.Sprintf("%v/collections/%v/items/%v", serveSchemeHostPortBase(r), cName, url.PathEscape(fid))
 		for _, sct := range config.SupportedContentTypes {
 			rel := "alternate"
 			if sct == ct {
@@ -715,45 +942,13 @@ NEXT_QUERY_PARAM:
 		}
 	case *wfs3.FeatureCollection:
 		// Generate self, previous, and next links
-		self := fmt.Sprintf(
-			"%v/collections/%v/items?page=%v&limit=%v", serveSchemeHostPortBase(r), cName, pageNum, limit)
-		var prev string
-		var next string
-		if pageNum > 0 {
-			prev = fmt.Sprintf(
-				"%v/collections/%v/items?page=%v&limit=%v", serveSchemeHostPortBase(r), cName, pageNum-1, limit)
-			purl, err := url.Parse(prev)
-			if err != nil {
-				jsonError(w, "NoApplicableCode", "problem parsing generated 'prev' link", 500)
-				return
-			}
-			purl.RawQuery = purl.Query().Encode()
-			prev = purl.String()
-		}
-		if featureTotal > (limit * (pageNum + 1)) {
-			next = fmt.Sprintf(
-				"%v/collections/%v/items?page=%v&limit=%v", serveSchemeHostPortBase(r), cName, pageNum+1, limit)
-			nurl, err := url.Parse(next)
-			if err != nil {
-				jsonError(w, "NoApplicableCode", "problem parsing generated 'next' link", 500)
-				return
-			}
-			nurl.RawQuery = nurl.Query().Encode()
-			next = nurl.String()
-		}
-
-		d.Links = append(d.Links, &wfs3.Link{Rel: "self", Href: ctLink(self, ct), Type: ct})
-		var alts = []*wfs3.Link{}
-		for _, act := range altcts {
-			alts = append(alts, &wfs3.Link{Rel: "alternate", Href: ctLink(self, act), Type: act})
-		}
-		d.Links = append(d.Links, alts...)
-		if prev != "" {
-			d.Links = append(d.Links, &wfs3.Link{Rel: "prev", Href: prev, Type: ct})
-		}
-		if next != "" {
-			d.Links = append(d.Links, &wfs3.Link{Rel: "next", Href: next, Type: ct})
+		href := fmt.Sprintf("%v/collections/%v/items", serveSchemeHostPortBase(r), cName)
+		links, lerr := featurePageLinks(href, q, pageNum, limit, featureTotal, ct)
+		if lerr != nil {
+			jsonError(w, "NoApplicableCode", lerr.Error(), HTTPStatusServerError)
+			return
 		}
+		d.Links = append(d.Links, links...)
 		d.NumberMatched = featureTotal
 		d.NumberReturned = uint(len(d.Features))
 
@@ -795,67 +990,421 @@ NEXT_QUERY_PARAM:
 	w.Write(encodedContent)
 }
 
-// --- Create temporary collection w/ filtered features.
-// Returns a collection id for inspecting the resulting features.
-func filteredFeatures(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
-	extentParam := q["extent"]
-	collectionParam := q["collection"]
-
-	// Grab any params besides "extent" & "collection" as property filters.
-	propParams := make(map[string]string, len(q))
-	for k, v := range r.URL.Query() {
-		if k == "extent" || k == "collection" {
-			continue
+// The 'limit' & 'page' parameters, limit defaults to DEFAULT_RESULT_LIMIT & is capped at the
+// configured maximum.
+func pagingParams(q url.Values) (limit, pageNum uint, err error) {
+	qPageSize := q["limit"]
+	if len(qPageSize) != 1 {
+		limit = DEFAULT_RESULT_LIMIT
+	} else {
+		ps, err := strconv.ParseUint(qPageSize[0], 10, 64)
+		if err != nil {
+			return 0, 0, err
 		}
-		propParams[k] = v[0]
-		if len(v) > 1 {
-			log.Printf("Got multiple values for property filter, will only use the first '%v': %v", k, v)
+		// A Query w/o a limit is unlimited
+		if ps < 1 {
+			return 0, 0, fmt.Errorf("'limit' parameter must be at least 1: '%v'", qPageSize[0])
 		}
+		if ps > uint64(config.Configuration.Server.MaxLimit) {
+			ps = uint64(config.Configuration.Server.MaxLimit)
+		}
+		limit = uint(ps)
 	}
 
-	var collectionNames []string
-	if len(collectionParam) > 0 {
-		collectionNames = collectionParam
-	} else {
-		var err error
-		collectionNames, err = Provider.CollectionNames()
+	qPageNum := q["page"]
+	if len(qPageNum) == 1 {
+		pn, err := strconv.ParseUint(qPageNum[0], 10, 64)
 		if err != nil {
-			jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
+			return 0, 0, err
+		}
+		pageNum = uint(pn)
+	}
+
+	return limit, pageNum, nil
+}
+
+// The 'bbox' parameter, nil if there isn't one
+func bboxParam(q url.Values) (*geom.Extent, error) {
+	qBBox := q["bbox"]
+	if len(qBBox) == 0 {
+		return nil, nil
+	}
+	if len(qBBox) > 1 {
+		return nil, fmt.Errorf("'bbox' parameter provided more than once")
+	}
+
+	bbox_items := strings.Split(qBBox[0], ",")
+	if len(bbox_items) != 4 {
+		return nil, fmt.Errorf("'bbox' parameter has %v items, expecting 4: '%v'", len(bbox_items), qBBox[0])
+	}
+	bbox := &geom.Extent{}
+	for i, p := range bbox_items {
+		var err error
+		if bbox[i], err = strconv.ParseFloat(p, 64); err != nil {
+			return nil, fmt.Errorf("'bbox' parameter has invalid format for item %v/4: '%v' / '%v'", i+1, p, qBBox[0])
 		}
 	}
+	return bbox, nil
+}
 
-	var extent geom.Extent
-	if len(extentParam) > 0 {
-		// lat/lon bounding box arranged as [<minx>, <miny>, <maxx>, <maxy>]
-		var llbbox [4]float64
-		err := json.Unmarshal([]byte(extentParam[0]), &llbbox)
+// The parts of features to return from the 'properties' (a comma separated list, empty for none) &
+// 'skipGeometry' parameters
+func selectionParams(q url.Values) (data_provider.Selection, error) {
+	sel := data_provider.Selection{}
+	if qProps, ok := q["properties"]; ok {
+		if len(qProps) > 1 {
+			return sel, fmt.Errorf("'properties' parameter provided more than once")
+		}
+		sel.Properties = []string{}
+		for _, p := range strings.Split(qProps[0], ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				sel.Properties = append(sel.Properties, p)
+			}
+		}
+	}
+	if qSkip, ok := q["skipGeometry"]; ok {
+		if len(qSkip) > 1 {
+			return sel, fmt.Errorf("'skipGeometry' parameter provided more than once")
+		}
+		skip, err := strconv.ParseBool(qSkip[0])
 		if err != nil {
-			jsonError(w, "NoApplicableCode", fmt.Sprintf("unable to unmarshal extent (%v) due to error: %v", extentParam[0], err), HTTPStatusClientError)
-			return
+			return sel, fmt.Errorf("'skipGeometry' parameter isn't true or false: '%v'", qSkip[0])
+		}
+		sel.SkipGeometry = skip
+	}
+	return sel, nil
+}
+
+// Sort keys from the 'sortby' parameter, a comma separated list of property names each prefixed
+// by '+' (the default, which arrives as a space when not escaped) or '-' for descending order.
+func sortbyParam(q url.Values) ([]data_provider.SortKey, error) {
+	qSortBy := q["sortby"]
+	if len(qSortBy) == 0 {
+		return nil, nil
+	}
+	if len(qSortBy) > 1 {
+		return nil, fmt.Errorf("'sortby' parameter provided more than once")
+	}
+
+	items := strings.Split(qSortBy[0], ",")
+	keys := make([]data_provider.SortKey, len(items))
+	for i, item := range items {
+		item = strings.TrimSpace(item)
+		switch {
+		case strings.HasPrefix(item, "-"):
+			keys[i].Descending = true
+			item = item[1:]
+		case strings.HasPrefix(item, "+"):
+			item = item[1:]
 		}
-		extent = geom.Extent{llbbox[0], llbbox[1], llbbox[2], llbbox[3]}
-		// TODO: filter by extent
-		if len(extentParam) > 1 {
-			log.Printf("Multiple extent filters, will only use the first '%v'", extentParam)
+		if item == "" {
+			return nil, fmt.Errorf("'sortby' parameter has no property for item %v: '%v'", i+1, qSortBy[0])
 		}
+		keys[i].Property = item
 	}
+	return keys, nil
+}
 
-	fids, err := Provider.FilterFeatures(&extent, collectionNames, propParams)
-	newCol, err := Provider.MakeCollection("tempcol", fids)
+// The lon/lat point from the 'near' parameter, 'lon,lat', features are sorted by distance from.
+// nil w/o one.
+func nearParam(q url.Values) (*geom.Point, error) {
+	qNear := q["near"]
+	if len(qNear) == 0 {
+		return nil, nil
+	}
+	if len(qNear) > 1 {
+		return nil, fmt.Errorf("'near' parameter provided more than once")
+	}
 
+	items := strings.Split(qNear[0], ",")
+	if len(items) != 2 {
+		return nil, fmt.Errorf("'near' parameter has %v items, expecting 2: '%v'", len(items), qNear[0])
+	}
+	pt := &geom.Point{}
+	for i, p := range items {
+		var err error
+		if pt[i], err = strconv.ParseFloat(strings.TrimSpace(p), 64); err != nil {
+			return nil, fmt.Errorf("'near' parameter has invalid format for item %v/2: '%v' / '%v'", i+1, p, qNear[0])
+		}
+	}
+	if math.Abs(pt[0]) > 180 || math.Abs(pt[1]) > 90 {
+		return nil, fmt.Errorf("'near' parameter isn't a lon/lat point: '%v'", qNear[0])
+	}
+	return pt, nil
+}
+
+// The JSON body of a POST to /collections/{name}/items, a filter too long for the URL.  Other
+// parameters are given in the URL as for a GET.
+type itemsRequest struct {
+	// 'cql2-json' if empty, or 'cql2-text' for a filter that's a string
+	FilterLang string          `json:"filter-lang"`
+	FilterCRS  string          `json:"filter-crs"`
+	Filter     json.RawMessage `json:"filter"`
+}
+
+// The CQL2 filter from the 'filter' parameter, nil w/o one.  'filter-lang' may be 'cql2-text'
+// (the default) or 'cql2-json' & 'filter-crs' only CRS84, the CRS of geometries in the filter.
+func filterParam(q url.Values) (cql2.Expr, error) {
+	for _, p := range []string{"filter", "filter-lang", "filter-crs"} {
+		if len(q[p]) > 1 {
+			return nil, fmt.Errorf("'%v' parameter provided more than once", p)
+		}
+	}
+	if err := checkFilterCRS(q.Get("filter-crs")); err != nil {
+		return nil, err
+	}
+	lang := q.Get("filter-lang")
+	if lang == "" {
+		lang = "cql2-text"
+	}
+	qFilter, ok := q["filter"]
+	if !ok {
+		return nil, checkFilterLang(lang)
+	}
+	return parseFilter(lang, qFilter[0])
+}
+
+// The CQL2 filter from the JSON body of a POST, see itemsRequest, along w/ the 'filter',
+// 'filter-lang' & 'filter-crs' parameters giving it in a GET
+func filterBody(r *http.Request) (cql2.Expr, url.Values, error) {
+	var ir itemsRequest
+	if err := json.NewDecoder(r.Body).Decode(&ir); err != nil {
+		return nil, nil, fmt.Errorf("invalid request body: %v", err)
+	}
+	if err := checkFilterCRS(ir.FilterCRS); err != nil {
+		return nil, nil, err
+	}
+	if ir.FilterLang == "" {
+		ir.FilterLang = "cql2-json"
+	}
+	if len(ir.Filter) == 0 || string(ir.Filter) == "null" {
+		return nil, nil, checkFilterLang(ir.FilterLang)
+	}
+
+	params := url.Values{"filter-lang": {ir.FilterLang}}
+	if ir.FilterCRS != "" {
+		params.Set("filter-crs", ir.FilterCRS)
+	}
+	var filter cql2.Expr
+	var err error
+	if ir.FilterLang == "cql2-text" {
+		var text string
+		if err := json.Unmarshal(ir.Filter, &text); err != nil {
+			return nil, nil, fmt.Errorf("'filter' isn't a string for 'filter-lang' 'cql2-text'")
+		}
+		filter, err = parseFilter(ir.FilterLang, text)
+		params.Set("filter", text)
+	} else {
+		filter, err = parseFilter(ir.FilterLang, string(ir.Filter))
+		// It was decoded from the body so it's valid JSON
+		compact := new(bytes.Buffer)
+		json.Compact(compact, ir.Filter)
+		params.Set("filter", compact.String())
+	}
 	if err != nil {
-		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
-		return
+		return nil, nil, err
+	}
+	return filter, params, nil
+}
+
+// Parses filter in lang, 'cql2-text' or 'cql2-json'
+func parseFilter(lang, filter string) (cql2.Expr, error) {
+	if err := checkFilterLang(lang); err != nil {
+		return nil, err
+	}
+	if lang == "cql2-json" {
+		return cql2.ParseJSON([]byte(filter))
+	}
+	return cql2.ParseText(filter)
+}
+
+func checkFilterLang(lang string) error {
+	if lang != "cql2-text" && lang != "cql2-json" {
+		return fmt.Errorf("'filter-lang' isn't supported: '%v'", lang)
 	}
+	return nil
+}
 
-	resp, err := json.Marshal(struct {
-		Collection   string
-		FeatureCount int
-	}{Collection: newCol, FeatureCount: len(fids)})
+// Checks the CRS of a filter's geometries is CRS84, which it is when not given
+func checkFilterCRS(fc string) error {
+	if fc == "" {
+		return nil
+	}
+	c, err := data_provider.ParseCRS(fc)
 	if err != nil {
-		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
+		return err
 	}
-	w.WriteHeader(HTTPStatusOk)
-	w.Write(resp)
+	if c.URI != data_provider.CRS84 {
+		return fmt.Errorf("'filter-crs' isn't supported: '%v'", fc)
+	}
+	return nil
+}
+
+// Converts bbox from the CRS given by the 'bbox-crs' parameter to lon/lat, as is w/o one
+func lonLatBbox(q url.Values, bbox *geom.Extent) (*geom.Extent, error) {
+	bc := q.Get("bbox-crs")
+	if bbox == nil || bc == "" {
+		return bbox, nil
+	}
+	c, err := data_provider.ParseCRS(bc)
+	if err != nil {
+		return nil, err
+	}
+	return c.LonLatExtent(bbox)
+}
+
+// The time filter from the 'datetime' parameter, the OGC name for it, or 'time' which is still
+// accepted.  nil if there isn't one.
+func timeParam(q url.Values) (*data_provider.TimeInterval, error) {
+	var timeFilter *data_provider.TimeInterval
+	for _, tp := range []string{"datetime", "time"} {
+		qTime := q[tp]
+		if len(qTime) == 0 {
+			continue
+		}
+		if len(qTime) > 1 || timeFilter != nil {
+			return nil, fmt.Errorf("time filter ('datetime' or 'time' parameter) provided more than once")
+		}
+		var err error
+		if timeFilter, err = data_provider.ParseTimeInterval(qTime[0]); err != nil {
+			return nil, err
+		}
+	}
+	return timeFilter, nil
+}
+
+// The self & alternate links for page pageNum of the features at href, along w/ prev & next links
+// where there are such pages.  The links have the parameters in q, i.e. the request's filters,
+// w/ only the page & limit changed.
+func featurePageLinks(href string, q url.Values, pageNum, limit, featureTotal uint, ct string) ([]*wfs3.Link, error) {
+	// Alternate content types
+	var altcts []string
+	switch ct {
+	case config.JSONContentType:
+		altcts = append(altcts, config.HTMLContentType)
+	case config.HTMLContentType:
+		altcts = append(altcts, config.JSONContentType)
+	}
+
+	u, err := url.Parse(href)
+	if err != nil {
+		return nil, fmt.Errorf("problem parsing generated link '%v'", href)
+	}
+	pageHref := func(n uint) string {
+		pq := make(url.Values, len(q)+2)
+		for k, vs := range q {
+			pq[k] = vs
+		}
+		// The content type is set by ctLink()
+		delete(pq, "f")
+		pq.Set("page", fmt.Sprintf("%v", n))
+		pq.Set("limit", fmt.Sprintf("%v", limit))
+		pu := *u
+		pu.RawQuery = pq.Encode()
+		return pu.String()
+	}
+
+	self := pageHref(pageNum)
+	var prev string
+	var next string
+	if pageNum > 0 {
+		prev = pageHref(pageNum - 1)
+	}
+	if featureTotal > (limit * (pageNum + 1)) {
+		next = pageHref(pageNum + 1)
+	}
+
+	links := []*wfs3.Link{{Rel: "self", Href: ctLink(self, ct), Type: ct}}
+	for _, act := range altcts {
+		links = append(links, &wfs3.Link{Rel: "alternate", Href: ctLink(self, act), Type: act})
+	}
+	if prev != "" {
+		links = append(links, &wfs3.Link{Rel: "prev", Href: ctLink(prev, ct), Type: ct})
+	}
+	if next != "" {
+		links = append(links, &wfs3.Link{Rel: "next", Href: ctLink(next, ct), Type: ct})
+	}
+	return links, nil
+}
+
+// Property filters from the query parameters other than those in reservedQParams:
+// 'name=value' for equality, where '*' in value is a wildcard & '\*' a literal '*',
+// 'name=v1&name=v2' for any of the values, and 'name!=value', 'name<value', 'name<=value',
+// 'name>value' & 'name>=value' for comparisons.
+// A range is given by two comparisons, i.e. 'lanes>=2&lanes<=4'.
+func propertyFilters(q url.Values, reservedQParams []string) []data_provider.PropertyFilter {
+	// Sorted so filters are applied in a consistent order
+	keys := make([]string, 0, len(q))
+NEXT_QUERY_PARAM:
+	for k := range q {
+		for _, rqp := range reservedQParams {
+			if k == rqp {
+				continue NEXT_QUERY_PARAM
+			}
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	filters := make([]data_provider.PropertyFilter, 0, len(keys))
+	for _, k := range keys {
+		vs := q[k]
+		i := strings.IndexAny(k, "<>!")
+		if i < 0 {
+			switch {
+			case len(vs) > 1:
+				filters = append(filters, data_provider.PropertyFilter{Property: k, Op: data_provider.OpIn, Values: vs})
+			case hasWildcard(vs[0]):
+				filters = append(filters, data_provider.PropertyFilter{Property: k, Op: data_provider.OpLike, Values: vs})
+			default:
+				filters = append(filters, data_provider.PropertyFilter{Property: k, Op: data_provider.OpEqual, Values: []string{unescapeWildcards(vs[0])}})
+			}
+			continue
+		}
+
+		// 'lanes>=2' arrives as 'lanes>' = '2', 'lanes>2' as 'lanes>2' = ''
+		name, rest := k[:i], k[i:]
+		for _, v := range vs {
+			var op, value string
+			switch rest {
+			case "<", ">":
+				op, value = rest+"=", v
+			case "!":
+				op, value = data_provider.OpNotEqual, v
+			default:
+				opLen := 1
+				if strings.HasPrefix(rest, "<>") {
+					opLen = 2
+				}
+				op, value = rest[:opLen], rest[opLen:]
+				if v != "" {
+					value += "=" + v
+				}
+			}
+			filters = append(filters, data_provider.PropertyFilter{Property: name, Op: op, Values: []string{value}})
+		}
+	}
+
+	return filters
+}
+
+// Whether s has a '*' that isn't escaped by a '\'
+func hasWildcard(s string) bool {
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			return true
+		}
+	}
+	return false
+}
+
+// Removes the escaping from '\*' in a value w/o wildcards
+func unescapeWildcards(s string) string {
+	return strings.Replace(s, `\*`, "*", -1)
 }
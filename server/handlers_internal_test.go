@@ -40,6 +40,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"path"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
@@ -49,7 +50,6 @@ import (
 	"github.com/go-spatial/jivan/config"
 	"github.com/go-spatial/jivan/data_provider"
 	"github.com/go-spatial/jivan/wfs3"
-	"github.com/go-spatial/tegola/provider/gpkg"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -59,15 +59,11 @@ func init() {
 	// Instantiate a provider from the codebase's testing gpkg.
 	_, thisFilePath, _, _ := runtime.Caller(0)
 	gpkgPath := path.Join(path.Dir(thisFilePath), "..", "test_data/athens-osm-20170921.gpkg")
-	gpkgConfig, err := gpkg.AutoConfig(gpkgPath)
+	gpkgSource, err := data_provider.NewGpkgSource(gpkgPath, false)
 	if err != nil {
 		panic(err.Error())
 	}
-	gpkgTiler, err := gpkg.NewTileProvider(gpkgConfig)
-	if err != nil {
-		panic(err.Error())
-	}
-	testingProvider = data_provider.Provider{Tiler: gpkgTiler}
+	testingProvider = data_provider.Provider{Source: gpkgSource}
 
 	// This is the provider the server will use for data
 	Provider = testingProvider
@@ -479,12 +475,21 @@ func TestCollectionsMetaData(t *testing.T) {
 		collectionUrlHtml := fmt.Sprintf("http://%v/collections/%v?f=text%%2Fhtml", serveAddress, cn)
 		itemUrl := fmt.Sprintf("http://%v/collections/%v/items", serveAddress, cn)
 		itemUrlHtml := fmt.Sprintf("http://%v/collections/%v/items?f=text%%2Fhtml", serveAddress, cn)
-		cInfo := wfs3.CollectionInfo{Name: cn, Title: cn, Links: []*wfs3.Link{
+		cs, err := testingProvider.CollectionSchema(cn)
+		if err != nil {
+			t.Fatalf("Problem describing collection '%v': %v", cn, err)
+		}
+		cInfo := wfs3.CollectionInfo{Name: cn, Title: cs.Title, Description: cs.Description, Links: []*wfs3.Link{
 			{Rel: "self", Href: collectionUrl, Type: config.JSONContentType},
 			{Rel: "alternate", Href: collectionUrlHtml, Type: config.HTMLContentType},
 			{Rel: "item", Href: itemUrl, Type: config.JSONContentType},
 			{Rel: "item", Href: itemUrlHtml, Type: config.HTMLContentType},
 		}}
+		if cInfo.Crs, err = testingProvider.CollectionCRSs(cn); err != nil {
+			t.Fatalf("Problem listing crss of collection '%v': %v", cn, err)
+		}
+		cInfo.StorageCrs = cs.CRS
+		cInfo.Extent = testingExtent(t, cn)
 
 		csInfo.Collections = append(csInfo.Collections, &cInfo)
 	}
@@ -569,9 +574,26 @@ func TestCollectionsMetaData(t *testing.T) {
 	}
 }
 
+// The extent CollectionMetaData() is expected to report for collection
+func testingExtent(t *testing.T, collection string) *wfs3.Bbox {
+	e, err := testingProvider.CollectionExtent(context.Background(), collection)
+	if err != nil {
+		t.Fatalf("Problem getting extent of collection '%v': %v", collection, err)
+	}
+	if e == nil {
+		return nil
+	}
+	return &wfs3.Bbox{Crs: data_provider.CRS84, Bbox: []float64{e[0], e[1], e[2], e[3]}}
+}
+
 func TestSingleCollectionMetaData(t *testing.T) {
 	serveAddress := "testthis.com"
 
+	cs, err := testingProvider.CollectionSchema("roads_lines")
+	if err != nil {
+		t.Fatalf("Problem describing collection 'roads_lines': %v", err)
+	}
+
 	type TestCase struct {
 		requestMethod      string
 		goContent          interface{}
@@ -587,8 +609,9 @@ func TestSingleCollectionMetaData(t *testing.T) {
 		{
 			requestMethod: HTTPMethodGET,
 			goContent: wfs3.CollectionInfo{
-				Name:  "roads_lines",
-				Title: "roads_lines",
+				Name:        "roads_lines",
+				Title:       cs.Title,
+				Description: cs.Description,
 				Links: []*wfs3.Link{
 					{
 						Rel:  "self",
@@ -607,8 +630,19 @@ func TestSingleCollectionMetaData(t *testing.T) {
 						Rel:  "item",
 						Href: fmt.Sprintf("http://%v/collections/%v/items?f=text%%2Fhtml", serveAddress, "roads_lines"),
 						Type: config.HTMLContentType,
+					}, {
+						Rel:  RelQueryables,
+						Href: fmt.Sprintf("http://%v/collections/%v/queryables", serveAddress, "roads_lines"),
+						Type: config.JSONContentType,
+					}, {
+						Rel:  RelSortables,
+						Href: fmt.Sprintf("http://%v/collections/%v/sortables", serveAddress, "roads_lines"),
+						Type: config.JSONContentType,
 					},
 				},
+				Crs:        []string{data_provider.CRS84, data_provider.EPSG4326, data_provider.EPSG3857},
+				StorageCrs: data_provider.CRS84,
+				Extent:     testingExtent(t, "roads_lines"),
 			},
 			contentOverride:    nil,
 			contentType:        config.JSONContentType,
@@ -677,8 +711,545 @@ func TestSingleCollectionMetaData(t *testing.T) {
 	}
 }
 
-func uint64ptr(i uint64) *uint64 {
-	return &i
+func TestCollectionQueryables(t *testing.T) {
+	serveAddress := "testthis.com"
+
+	cs, err := testingProvider.CollectionSchema("roads_lines")
+	if err != nil {
+		t.Fatalf("Problem describing collection 'roads_lines': %v", err)
+	}
+	if len(cs.Properties) == 0 {
+		t.Fatalf("expected properties for 'roads_lines'")
+	}
+
+	responseWriter := httptest.NewRecorder()
+	url := fmt.Sprintf("http://%v/collections/roads_lines/queryables", serveAddress)
+	request := httptest.NewRequest(HTTPMethodGET, url, bytes.NewBufferString(""))
+	hrParams := httprouter.Params{{Key: "name", Value: "roads_lines"}}
+	request = request.WithContext(context.WithValue(request.Context(), httprouter.ParamsKey, hrParams))
+
+	collectionQueryables(responseWriter, request)
+	resp := responseWriter.Result()
+	if resp.StatusCode != HTTPStatusOk {
+		t.Fatalf("Status code %v != %v", resp.StatusCode, HTTPStatusOk)
+	}
+	var qs wfs3.Queryables
+	if err := json.NewDecoder(resp.Body).Decode(&qs); err != nil {
+		t.Fatalf("Problem decoding queryables: %v", err)
+	}
+
+	if qs.Id != url || qs.Type != "object" {
+		t.Errorf("got $id '%v' & type '%v', wanted '%v' & 'object'", qs.Id, qs.Type, url)
+	}
+	if len(qs.Properties) != len(cs.Properties) {
+		t.Errorf("got %v properties, wanted %v", len(qs.Properties), len(cs.Properties))
+	}
+	for _, pn := range cs.Properties {
+		qp, ok := qs.Properties[pn]
+		if !ok {
+			t.Errorf("property '%v' missing", pn)
+			continue
+		}
+		expectedType := cs.PropertyTypes[pn]
+		if expectedType == data_provider.PropertyTypeDateTime {
+			expectedType = "string"
+		}
+		if qp.Type != expectedType {
+			t.Errorf("property '%v' has type '%v', wanted '%v'", pn, qp.Type, expectedType)
+		}
+	}
+}
+
+func TestCollectionSortables(t *testing.T) {
+	serveAddress := "testthis.com"
+
+	cs, err := testingProvider.CollectionSchema("roads_lines")
+	if err != nil {
+		t.Fatalf("Problem describing collection 'roads_lines': %v", err)
+	}
+
+	responseWriter := httptest.NewRecorder()
+	url := fmt.Sprintf("http://%v/collections/roads_lines/sortables", serveAddress)
+	request := httptest.NewRequest(HTTPMethodGET, url, bytes.NewBufferString(""))
+	hrParams := httprouter.Params{{Key: "name", Value: "roads_lines"}}
+	request = request.WithContext(context.WithValue(request.Context(), httprouter.ParamsKey, hrParams))
+
+	collectionSortables(responseWriter, request)
+	resp := responseWriter.Result()
+	if resp.StatusCode != HTTPStatusOk {
+		t.Fatalf("Status code %v != %v", resp.StatusCode, HTTPStatusOk)
+	}
+	var ss wfs3.Sortables
+	if err := json.NewDecoder(resp.Body).Decode(&ss); err != nil {
+		t.Fatalf("Problem decoding sortables: %v", err)
+	}
+
+	if ss.Id != url || ss.Type != "object" {
+		t.Errorf("got $id '%v' & type '%v', wanted '%v' & 'object'", ss.Id, ss.Type, url)
+	}
+	for _, pn := range cs.Properties {
+		if _, ok := ss.Properties[pn]; !ok {
+			t.Errorf("property '%v' missing", pn)
+		}
+	}
+}
+
+func TestSortbyParam(t *testing.T) {
+	type TestCase struct {
+		rawQuery    string
+		expected    []data_provider.SortKey
+		expectedErr bool
+	}
+
+	testCases := []TestCase{
+		{rawQuery: "limit=5", expected: nil},
+		// An unescaped '+' arrives as a space
+		{rawQuery: "sortby=+name,-height", expected: []data_provider.SortKey{{Property: "name"}, {Property: "height", Descending: true}}},
+		{rawQuery: "sortby=%2Bname", expected: []data_provider.SortKey{{Property: "name"}}},
+		{rawQuery: "sortby=name", expected: []data_provider.SortKey{{Property: "name"}}},
+		{rawQuery: "sortby=name,", expectedErr: true},
+		{rawQuery: "sortby=-", expectedErr: true},
+		{rawQuery: "sortby=name&sortby=height", expectedErr: true},
+	}
+
+	for i, tc := range testCases {
+		q, err := url.ParseQuery(tc.rawQuery)
+		if err != nil {
+			t.Fatalf("[%v] Problem parsing query: %v", i, err)
+		}
+		keys, err := sortbyParam(q)
+		if tc.expectedErr {
+			if err == nil {
+				t.Errorf("[%v] expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%v] sortbyParam(): %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(keys, tc.expected) {
+			t.Errorf("[%v] got %v, wanted %v", i, keys, tc.expected)
+		}
+	}
+}
+
+func TestNearParam(t *testing.T) {
+	type TestCase struct {
+		rawQuery    string
+		expected    *geom.Point
+		expectedErr bool
+	}
+
+	testCases := []TestCase{
+		{rawQuery: "limit=5", expected: nil},
+		{rawQuery: "near=-77.03,38.89", expected: &geom.Point{-77.03, 38.89}},
+		{rawQuery: "near=-77.03, 38.89", expected: &geom.Point{-77.03, 38.89}},
+		{rawQuery: "near=-77.03", expectedErr: true},
+		{rawQuery: "near=-77.03,north", expectedErr: true},
+		{rawQuery: "near=38.89,-200", expectedErr: true},
+		{rawQuery: "near=1,2&near=3,4", expectedErr: true},
+	}
+
+	for i, tc := range testCases {
+		q, err := url.ParseQuery(tc.rawQuery)
+		if err != nil {
+			t.Fatalf("[%v] Problem parsing query: %v", i, err)
+		}
+		pt, err := nearParam(q)
+		if tc.expectedErr {
+			if err == nil {
+				t.Errorf("[%v] expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%v] nearParam(): %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(pt, tc.expected) {
+			t.Errorf("[%v] got %v, wanted %v", i, pt, tc.expected)
+		}
+	}
+}
+
+func TestPagingParams(t *testing.T) {
+	type TestCase struct {
+		rawQuery      string
+		expectedLimit uint
+		expectedPage  uint
+		expectedErr   bool
+	}
+
+	testCases := []TestCase{
+		{rawQuery: "", expectedLimit: DEFAULT_RESULT_LIMIT},
+		{rawQuery: "limit=5&page=2", expectedLimit: 5, expectedPage: 2},
+		{rawQuery: "limit=1", expectedLimit: 1},
+		{rawQuery: "limit=0", expectedErr: true},
+		{rawQuery: "limit=-1", expectedErr: true},
+		{rawQuery: "limit=five", expectedErr: true},
+		{rawQuery: "limit=5&page=-1", expectedErr: true},
+	}
+
+	for i, tc := range testCases {
+		q, err := url.ParseQuery(tc.rawQuery)
+		if err != nil {
+			t.Fatalf("[%v] Problem parsing query: %v", i, err)
+		}
+		limit, pageNum, err := pagingParams(q)
+		if tc.expectedErr {
+			if err == nil {
+				t.Errorf("[%v] expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%v] pagingParams(): %v", i, err)
+			continue
+		}
+		if limit != tc.expectedLimit || pageNum != tc.expectedPage {
+			t.Errorf("[%v] got limit %v & page %v, wanted %v & %v", i, limit, pageNum, tc.expectedLimit, tc.expectedPage)
+		}
+	}
+}
+
+func TestCollectionNearestParams(t *testing.T) {
+	for i, rawQuery := range []string{"k=5", "point=-77.03,38.89&limit=5", "point=-77.03,38.89&page=1", "point=1,2&near=1,2"} {
+		r := httptest.NewRequest(HTTPMethodGET, "http://test.com/collections/roads/nearest?"+rawQuery, nil)
+		rsp := httptest.NewRecorder()
+		collectionNearest(rsp, r)
+		if rsp.Code != HTTPStatusClientError {
+			t.Errorf("[%v] got status %v for '%v', wanted %v", i, rsp.Code, rawQuery, HTTPStatusClientError)
+		}
+	}
+}
+
+func TestCollectionNearestLinks(t *testing.T) {
+	serveAddress := "nearest.test"
+	params := httprouter.Params{{Key: "name", Value: "aviation_polygons"}}
+	get := func(handler http.HandlerFunc, url string) *wfs3.FeatureCollection {
+		rsp := httptest.NewRecorder()
+		r := httptest.NewRequest(HTTPMethodGET, url, nil)
+		handler(rsp, r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params)))
+		if rsp.Code != HTTPStatusOk {
+			t.Fatalf("got status %v for %v", rsp.Code, url)
+		}
+		var fc wfs3.FeatureCollection
+		if err := json.NewDecoder(rsp.Body).Decode(&fc); err != nil {
+			t.Fatalf("problem decoding response to %v: %v", url, err)
+		}
+		return &fc
+	}
+
+	fc := get(collectionNearest, fmt.Sprintf("http://%v/collections/aviation_polygons/nearest?point=23.74,37.885&k=3", serveAddress))
+	var next string
+	for _, l := range fc.Links {
+		if l.Rel == "next" {
+			next = l.Href
+		}
+	}
+	expectedNext := fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&near=23.74%%2C37.885&page=1", serveAddress)
+	if next != expectedNext {
+		t.Fatalf("got next link '%v', wanted '%v'", next, expectedNext)
+	}
+	if len(fc.Features) != 3 {
+		t.Fatalf("got %v features, wanted 3", len(fc.Features))
+	}
+
+	// The next page carries on from the furthest feature of the first
+	last, _ := fc.Features[2].Properties[data_provider.DistanceProperty].(float64)
+	page := get(collectionData, next)
+	if len(page.Features) == 0 {
+		t.Fatalf("got no features following %v", next)
+	}
+	for i, f := range page.Features {
+		d, ok := f.Properties[data_provider.DistanceProperty].(float64)
+		if !ok || d < last {
+			t.Errorf("[%v] got distance %v on the next page, wanted at least %v", i, f.Properties[data_provider.DistanceProperty], last)
+		}
+	}
+}
+
+func TestFeaturePageLinks(t *testing.T) {
+	q := url.Values{
+		"filter":       {"name LIKE 'A%'"},
+		"bbox":         {"23.7,37.9,23.8,38.0"},
+		"skipGeometry": {"true"},
+		"f":            {config.HTMLContentType},
+		"page":         {"1"},
+		"limit":        {"9"},
+	}
+	links, err := featurePageLinks("http://test.com/collections/roads/items", q, 1, 2, 10, config.JSONContentType)
+	if err != nil {
+		t.Fatalf("featurePageLinks(): %v", err)
+	}
+	href := "http://test.com/collections/roads/items?bbox=23.7%2C37.9%2C23.8%2C38.0&"
+	filter := "filter=name+LIKE+%27A%25%27&"
+	expected := []*wfs3.Link{
+		{Rel: "self", Href: href + filter + "limit=2&page=1&skipGeometry=true", Type: config.JSONContentType},
+		{Rel: "alternate", Href: href + "f=text%2Fhtml&" + filter + "limit=2&page=1&skipGeometry=true", Type: config.HTMLContentType},
+		{Rel: "prev", Href: href + filter + "limit=2&page=0&skipGeometry=true", Type: config.JSONContentType},
+		{Rel: "next", Href: href + filter + "limit=2&page=2&skipGeometry=true", Type: config.JSONContentType},
+	}
+	if len(links) != len(expected) {
+		t.Fatalf("got %v links, wanted %v", len(links), len(expected))
+	}
+	for i, l := range links {
+		if !reflect.DeepEqual(l, expected[i]) {
+			t.Errorf("[%v] got %+v, wanted %+v", i, l, expected[i])
+		}
+	}
+	// The request's parameters aren't changed
+	if q.Get("page") != "1" || q.Get("f") != config.HTMLContentType {
+		t.Errorf("featurePageLinks() changed its parameters: %v", q)
+	}
+}
+
+func TestFeatureTransactionDisabled(t *testing.T) {
+	config.Configuration.Server.Transactions = false
+	feature := `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [1, 2]}, "properties": {}}`
+	type TestCase struct {
+		method      string
+		url         string
+		body        string
+		contentType string
+	}
+	testCases := []TestCase{
+		{method: HTTPMethodPOST, url: "http://test.com/collections/roads/items", body: feature},
+		{method: HTTPMethodPOST, url: "http://test.com/collections/roads/items", body: "{}", contentType: GeoJSONContentType},
+		{method: HTTPMethodPUT, url: "http://test.com/collections/roads/items/1", body: feature},
+		{method: HTTPMethodPATCH, url: "http://test.com/collections/roads/items/1", body: feature},
+		{method: HTTPMethodDELETE, url: "http://test.com/collections/roads/items/1"},
+		{method: HTTPMethodGET, url: "http://test.com/collections/roads/items/1"},
+	}
+
+	for i, tc := range testCases {
+		r := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			r.Header.Set("Content-Type", tc.contentType)
+		}
+		rsp := httptest.NewRecorder()
+		if tc.method == HTTPMethodPOST {
+			collectionItemsPost(rsp, r)
+		} else {
+			featureTransaction(rsp, r)
+		}
+		if rsp.Code != HTTPStatusMethodNotAllowed {
+			t.Errorf("[%v] got status %v for %v %v, wanted %v", i, rsp.Code, tc.method, tc.url, HTTPStatusMethodNotAllowed)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	defer func(tx bool) { config.Configuration.Server.Transactions = tx }(config.Configuration.Server.Transactions)
+
+	type TestCase struct {
+		transactions  bool
+		preflight     string
+		expectedAllow string
+	}
+	testCases := []TestCase{
+		{expectedAllow: "GET, HEAD"},
+		{transactions: true, expectedAllow: "GET, HEAD, PUT, PATCH, DELETE"},
+		// Preflights only allow writes w/ transactions enabled
+		{preflight: HTTPMethodPUT, expectedAllow: ""},
+		{transactions: true, preflight: HTTPMethodPUT, expectedAllow: HTTPMethodPUT},
+		{preflight: HTTPMethodPOST, expectedAllow: HTTPMethodPOST},
+	}
+
+	for i, tc := range testCases {
+		config.Configuration.Server.Transactions = tc.transactions
+		r := httptest.NewRequest("OPTIONS", "http://test.com/collections/roads/items/1", nil)
+		if tc.preflight != "" {
+			r.Header.Set("Origin", "http://other.com")
+			r.Header.Set("Access-Control-Request-Method", tc.preflight)
+		}
+		rsp := httptest.NewRecorder()
+		newCORS().Handler(options(append([]string{"GET", "HEAD"}, writeMethods()...)...)).ServeHTTP(rsp, r)
+		if tc.preflight != "" {
+			if got := rsp.Header().Get("Access-Control-Allow-Methods"); got != tc.expectedAllow {
+				t.Errorf("[%v] got allowed methods '%v' for a %v preflight, wanted '%v'", i, got, tc.preflight, tc.expectedAllow)
+			}
+			continue
+		}
+		if rsp.Code != HTTPStatusNoContent || rsp.Header().Get("Allow") != tc.expectedAllow {
+			t.Errorf("[%v] got %v w/ Allow '%v', wanted %v w/ '%v'", i, rsp.Code, rsp.Header().Get("Allow"), HTTPStatusNoContent, tc.expectedAllow)
+		}
+	}
+}
+
+func TestTrimAngleBrackets(t *testing.T) {
+	for i, tc := range [][2]string{
+		{"<http://www.opengis.net/def/crs/OGC/1.3/CRS84>", "http://www.opengis.net/def/crs/OGC/1.3/CRS84"},
+		{"http://www.opengis.net/def/crs/OGC/1.3/CRS84", "http://www.opengis.net/def/crs/OGC/1.3/CRS84"},
+		{"<", "<"},
+		{"", ""},
+	} {
+		if got := trimAngleBrackets(tc[0]); got != tc[1] {
+			t.Errorf("[%v] got '%v', wanted '%v'", i, got, tc[1])
+		}
+	}
+}
+
+func TestFilterParam(t *testing.T) {
+	type TestCase struct {
+		rawQuery    string
+		expected    string
+		expectedErr bool
+	}
+
+	testCases := []TestCase{
+		{rawQuery: "limit=5", expected: ""},
+		{rawQuery: "filter=height%20%3E%2010", expected: "height > 10"},
+		{rawQuery: "filter=name%20LIKE%20'A%25'&filter-lang=cql2-text", expected: "name LIKE 'A%'"},
+		{rawQuery: "filter=height%20%3E%2010&filter-crs=http://www.opengis.net/def/crs/OGC/1.3/CRS84", expected: "height > 10"},
+		{rawQuery: "filter=height%20%3E", expectedErr: true},
+		{rawQuery: "filter=%7B%22op%22%3A%22%3E%22%2C%22args%22%3A%5B%7B%22property%22%3A%22height%22%7D%2C10%5D%7D&filter-lang=cql2-json", expected: "height > 10"},
+		{rawQuery: "filter=height%20%3E%2010&filter-lang=cql2-json", expectedErr: true},
+		{rawQuery: "filter=height%20%3E%2010&filter-lang=ecql", expectedErr: true},
+		{rawQuery: "filter-lang=ecql", expectedErr: true},
+		{rawQuery: "filter=height%20%3E%2010&filter-crs=EPSG:3857", expectedErr: true},
+		{rawQuery: "filter=a%3D1&filter=b%3D2", expectedErr: true},
+	}
+
+	for i, tc := range testCases {
+		q, err := url.ParseQuery(tc.rawQuery)
+		if err != nil {
+			t.Fatalf("[%v] Problem parsing query: %v", i, err)
+		}
+		filter, err := filterParam(q)
+		if tc.expectedErr {
+			if err == nil {
+				t.Errorf("[%v] expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%v] filterParam(): %v", i, err)
+			continue
+		}
+		var got string
+		if filter != nil {
+			got = filter.String()
+		}
+		if got != tc.expected {
+			t.Errorf("[%v] got '%v', wanted '%v'", i, got, tc.expected)
+		}
+	}
+}
+
+func TestFilterBody(t *testing.T) {
+	type TestCase struct {
+		body        string
+		expected    string
+		expectedErr bool
+	}
+
+	testCases := []TestCase{
+		{body: `{}`, expected: ""},
+		{body: `{"filter": {"op": ">", "args": [{"property": "height"}, 10]}}`, expected: "height > 10"},
+		{
+			body:     `{"filter-lang": "cql2-json", "filter-crs": "http://www.opengis.net/def/crs/OGC/1.3/CRS84", "filter": {"op": "isNull", "args": [{"property": "name"}]}}`,
+			expected: "name IS NULL",
+		},
+		{body: `{"filter-lang": "cql2-text", "filter": "height > 10"}`, expected: "height > 10"},
+		{body: `{"filter-lang": "cql2-text", "filter": {"op": ">", "args": [{"property": "height"}, 10]}}`, expectedErr: true},
+		{body: `{"filter": {"op": ">", "args": [{"property": "height"}]}}`, expectedErr: true},
+		{body: `{"filter-lang": "ecql", "filter": "height > 10"}`, expectedErr: true},
+		{body: `{"filter-crs": "EPSG:3857", "filter": {"op": ">", "args": [{"property": "height"}, 10]}}`, expectedErr: true},
+		{body: `{"filter": `, expectedErr: true},
+	}
+
+	for i, tc := range testCases {
+		r := httptest.NewRequest(HTTPMethodPOST, "http://test.com/collections/roads/items", strings.NewReader(tc.body))
+		filter, params, err := filterBody(r)
+		if tc.expectedErr {
+			if err == nil {
+				t.Errorf("[%v] expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%v] filterBody(): %v", i, err)
+			continue
+		}
+		var got string
+		if filter != nil {
+			got = filter.String()
+		}
+		if got != tc.expected {
+			t.Errorf("[%v] got '%v', wanted '%v'", i, got, tc.expected)
+		}
+
+		// The parameters give the same filter in a GET
+		pf, err := filterParam(params)
+		if err != nil {
+			t.Errorf("[%v] filterParam(%v): %v", i, params, err)
+			continue
+		}
+		var pgot string
+		if pf != nil {
+			pgot = pf.String()
+		}
+		if pgot != tc.expected {
+			t.Errorf("[%v] got '%v' from parameters %v, wanted '%v'", i, pgot, params, tc.expected)
+		}
+	}
+}
+
+func TestFilterBodyLinks(t *testing.T) {
+	serveAddress := "filter.test"
+	params := httprouter.Params{{Key: "name", Value: "aviation_polygons"}}
+	serve := func(method, url, body string) *wfs3.FeatureCollection {
+		rsp := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		collectionData(rsp, r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params)))
+		if rsp.Code != HTTPStatusOk {
+			t.Fatalf("got status %v for %v %v", rsp.Code, method, url)
+		}
+		var fc wfs3.FeatureCollection
+		if err := json.NewDecoder(rsp.Body).Decode(&fc); err != nil {
+			t.Fatalf("problem decoding response to %v %v: %v", method, url, err)
+		}
+		return &fc
+	}
+	nextLink := func(fc *wfs3.FeatureCollection) string {
+		for _, l := range fc.Links {
+			if l.Rel == "next" {
+				return l.Href
+			}
+		}
+		return ""
+	}
+
+	itemsUrl := fmt.Sprintf("http://%v/collections/aviation_polygons/items", serveAddress)
+	fc := serve(HTTPMethodPOST, itemsUrl+"?limit=1", `{"filter": {"op": "=", "args": [{"property": "aeroway"}, "terminal"]}}`)
+	if fc.NumberMatched < 2 {
+		t.Fatalf("got %v matches, wanted several", fc.NumberMatched)
+	}
+	expectedNext := itemsUrl + "?filter=%7B%22op%22%3A%22%3D%22%2C%22args%22%3A%5B%7B%22property%22%3A%22aeroway%22%7D%2C%22terminal%22%5D%7D&filter-lang=cql2-json&limit=1&page=1"
+	next := nextLink(fc)
+	if next != expectedNext {
+		t.Fatalf("got next link '%v', wanted '%v'", next, expectedNext)
+	}
+
+	// Following the links pages through the matches
+	seen := map[string]bool{fc.Features[0].ID: true}
+	for next != "" {
+		page := serve(HTTPMethodGET, next, "")
+		if page.NumberMatched != fc.NumberMatched || len(page.Features) != 1 {
+			t.Fatalf("got %v of %v matches following %v, wanted 1 of %v", len(page.Features), page.NumberMatched, next, fc.NumberMatched)
+		}
+		f := page.Features[0]
+		if f.Properties["aeroway"] != "terminal" || seen[f.ID] {
+			t.Errorf("got feature %v (%v) following %v, wanted another terminal", f.ID, f.Properties["aeroway"], next)
+		}
+		seen[f.ID] = true
+		next = nextLink(page)
+	}
+	if uint(len(seen)) != fc.NumberMatched {
+		t.Errorf("paged through %v features, wanted %v", len(seen), fc.NumberMatched)
+	}
 }
 
 func TestCollectionFeatures(t *testing.T) {
@@ -708,11 +1279,10 @@ func TestCollectionFeatures(t *testing.T) {
 				},
 				NumberMatched:  8,
 				NumberReturned: 3,
-				// Populate the embedded geojson FeatureCollection
-				FeatureCollection: geojson.FeatureCollection{
-					Features: []geojson.Feature{
-						{
-							ID: uint64ptr(4),
+				Features: []wfs3.Feature{
+					{
+						ID: "4",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -734,8 +1304,10 @@ func TestCollectionFeatures(t *testing.T) {
 								"osm_way_id": "191315126",
 							},
 						},
-						{
-							ID: uint64ptr(5),
+					},
+					{
+						ID: "5",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -757,8 +1329,10 @@ func TestCollectionFeatures(t *testing.T) {
 								"osm_way_id": "191315130",
 							},
 						},
-						{
-							ID: uint64ptr(6),
+					},
+					{
+						ID: "6",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -786,7 +1360,7 @@ func TestCollectionFeatures(t *testing.T) {
 			},
 			contentOverride:    nil,
 			contentType:        config.JSONContentType,
-			expectedETag:       "953ff7048ec325ce",
+			expectedETag:       "52fd79bfc4ddf2a6",
 			expectedStatusCode: 200,
 			urlParams: map[string]string{
 				"name": "aviation_polygons",
@@ -803,18 +1377,17 @@ func TestCollectionFeatures(t *testing.T) {
 			requestMethod: HTTPMethodGET,
 			goContent: wfs3.FeatureCollection{
 				Links: []*wfs3.Link{
-					{Rel: "self", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=1", serveAddress), Type: "application/json"},
-					{Rel: "alternate", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?f=text%%2Fhtml&limit=3&page=1", serveAddress), Type: "text/html"},
-					{Rel: "prev", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=0", serveAddress), Type: "application/json"},
-					{Rel: "next", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=2", serveAddress), Type: "application/json"},
+					{Rel: "self", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=1&time=2018-04-12T16%%3A29%%3A00Z-0600", serveAddress), Type: "application/json"},
+					{Rel: "alternate", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?f=text%%2Fhtml&limit=3&page=1&time=2018-04-12T16%%3A29%%3A00Z-0600", serveAddress), Type: "text/html"},
+					{Rel: "prev", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=0&time=2018-04-12T16%%3A29%%3A00Z-0600", serveAddress), Type: "application/json"},
+					{Rel: "next", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=2&time=2018-04-12T16%%3A29%%3A00Z-0600", serveAddress), Type: "application/json"},
 				},
 				NumberMatched:  8,
 				NumberReturned: 3,
-				// Populate the embedded geojson FeatureCollection
-				FeatureCollection: geojson.FeatureCollection{
-					Features: []geojson.Feature{
-						{
-							ID: uint64ptr(4),
+				Features: []wfs3.Feature{
+					{
+						ID: "4",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -836,8 +1409,10 @@ func TestCollectionFeatures(t *testing.T) {
 								"osm_way_id": "191315126",
 							},
 						},
-						{
-							ID: uint64ptr(5),
+					},
+					{
+						ID: "5",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -859,8 +1434,10 @@ func TestCollectionFeatures(t *testing.T) {
 								"osm_way_id": "191315130",
 							},
 						},
-						{
-							ID: uint64ptr(6),
+					},
+					{
+						ID: "6",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -888,7 +1465,7 @@ func TestCollectionFeatures(t *testing.T) {
 			},
 			contentOverride:    nil,
 			contentType:        config.JSONContentType,
-			expectedETag:       "953ff7048ec325ce",
+			expectedETag:       "b187fa80b089515b",
 			expectedStatusCode: 200,
 			urlParams: map[string]string{
 				"name": "aviation_polygons",
@@ -906,18 +1483,17 @@ func TestCollectionFeatures(t *testing.T) {
 			requestMethod: HTTPMethodGET,
 			goContent: wfs3.FeatureCollection{
 				Links: []*wfs3.Link{
-					{Rel: "self", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=1", serveAddress), Type: "application/json"},
-					{Rel: "alternate", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?f=text%%2Fhtml&limit=3&page=1", serveAddress), Type: "text/html"},
-					{Rel: "prev", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=0", serveAddress), Type: "application/json"},
-					{Rel: "next", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=2", serveAddress), Type: "application/json"},
+					{Rel: "self", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=1&time=2018-04-12T16%%3A29%%3A00", serveAddress), Type: "application/json"},
+					{Rel: "alternate", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?f=text%%2Fhtml&limit=3&page=1&time=2018-04-12T16%%3A29%%3A00", serveAddress), Type: "text/html"},
+					{Rel: "prev", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=0&time=2018-04-12T16%%3A29%%3A00", serveAddress), Type: "application/json"},
+					{Rel: "next", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=2&time=2018-04-12T16%%3A29%%3A00", serveAddress), Type: "application/json"},
 				},
 				NumberMatched:  8,
 				NumberReturned: 3,
-				// Populate the embedded geojson FeatureCollection
-				FeatureCollection: geojson.FeatureCollection{
-					Features: []geojson.Feature{
-						{
-							ID: uint64ptr(4),
+				Features: []wfs3.Feature{
+					{
+						ID: "4",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -939,8 +1515,10 @@ func TestCollectionFeatures(t *testing.T) {
 								"osm_way_id": "191315126",
 							},
 						},
-						{
-							ID: uint64ptr(5),
+					},
+					{
+						ID: "5",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -962,8 +1540,10 @@ func TestCollectionFeatures(t *testing.T) {
 								"osm_way_id": "191315130",
 							},
 						},
-						{
-							ID: uint64ptr(6),
+					},
+					{
+						ID: "6",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -991,7 +1571,7 @@ func TestCollectionFeatures(t *testing.T) {
 			},
 			contentOverride:    nil,
 			contentType:        config.JSONContentType,
-			expectedETag:       "953ff7048ec325ce",
+			expectedETag:       "dfb8348cc69cd8f1",
 			expectedStatusCode: 200,
 			urlParams: map[string]string{
 				"name": "aviation_polygons",
@@ -1009,18 +1589,17 @@ func TestCollectionFeatures(t *testing.T) {
 			requestMethod: HTTPMethodGET,
 			goContent: wfs3.FeatureCollection{
 				Links: []*wfs3.Link{
-					{Rel: "self", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=1", serveAddress), Type: "application/json"},
-					{Rel: "alternate", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?f=text%%2Fhtml&limit=3&page=1", serveAddress), Type: "text/html"},
-					{Rel: "prev", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=0", serveAddress), Type: "application/json"},
-					{Rel: "next", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=2", serveAddress), Type: "application/json"},
+					{Rel: "self", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=1&time=2018-04-12", serveAddress), Type: "application/json"},
+					{Rel: "alternate", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?f=text%%2Fhtml&limit=3&page=1&time=2018-04-12", serveAddress), Type: "text/html"},
+					{Rel: "prev", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=0&time=2018-04-12", serveAddress), Type: "application/json"},
+					{Rel: "next", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=2&time=2018-04-12", serveAddress), Type: "application/json"},
 				},
 				NumberMatched:  8,
 				NumberReturned: 3,
-				// Populate the embedded geojson FeatureCollection
-				FeatureCollection: geojson.FeatureCollection{
-					Features: []geojson.Feature{
-						{
-							ID: uint64ptr(4),
+				Features: []wfs3.Feature{
+					{
+						ID: "4",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -1042,8 +1621,10 @@ func TestCollectionFeatures(t *testing.T) {
 								"osm_way_id": "191315126",
 							},
 						},
-						{
-							ID: uint64ptr(5),
+					},
+					{
+						ID: "5",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -1065,8 +1646,10 @@ func TestCollectionFeatures(t *testing.T) {
 								"osm_way_id": "191315130",
 							},
 						},
-						{
-							ID: uint64ptr(6),
+					},
+					{
+						ID: "6",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -1094,7 +1677,7 @@ func TestCollectionFeatures(t *testing.T) {
 			},
 			contentOverride:    nil,
 			contentType:        config.JSONContentType,
-			expectedETag:       "953ff7048ec325ce",
+			expectedETag:       "58901c274349731",
 			expectedStatusCode: 200,
 			urlParams: map[string]string{
 				"name": "aviation_polygons",
@@ -1127,12 +1710,50 @@ func TestCollectionFeatures(t *testing.T) {
 				"time":  "2018-04-12_broken",
 			},
 		},
+		// Bad GET request due to an invalid duration in a datetime filter
+		{
+			requestMethod: HTTPMethodGET,
+			goContent: map[string]string{
+				"code":        "InvalidParameterValue",
+				"description": "unable to parse duration: 'P1X'",
+			},
+			contentOverride:    nil,
+			contentType:        config.JSONContentType,
+			expectedETag:       "",
+			expectedStatusCode: HTTPStatusClientError,
+			urlParams: map[string]string{
+				"name": "aviation_polygons",
+			},
+			queryParams: map[string]string{
+				"page":     "1",
+				"limit":    "3",
+				"datetime": "2018-04-12/P1X",
+			},
+		},
+		// Bad GET request due to a filter on a property the collection doesn't have
+		{
+			requestMethod: HTTPMethodGET,
+			goContent: map[string]string{
+				"code":        "InvalidParameterValue",
+				"description": "unknown property for collection 'aviation_polygons': 'runway_length'",
+			},
+			contentOverride:    nil,
+			contentType:        config.JSONContentType,
+			expectedETag:       "",
+			expectedStatusCode: HTTPStatusClientError,
+			urlParams: map[string]string{
+				"name": "aviation_polygons",
+			},
+			queryParams: map[string]string{
+				"runway_length>": "1000",
+			},
+		},
 		// Happy-path HEAD request
 		{
 			requestMethod:      HTTPMethodHEAD,
 			goContent:          nil,
 			contentOverride:    nil,
-			expectedETag:       "953ff7048ec325ce",
+			expectedETag:       "52fd79bfc4ddf2a6",
 			expectedStatusCode: HTTPStatusOk,
 			urlParams: map[string]string{
 				"name": "aviation_polygons",
@@ -1143,17 +1764,16 @@ func TestCollectionFeatures(t *testing.T) {
 			requestMethod: HTTPMethodGET,
 			goContent: wfs3.FeatureCollection{
 				Links: []*wfs3.Link{
-					{Rel: "self", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=1", serveAddress), Type: "application/json"},
-					{Rel: "alternate", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?f=text%%2Fhtml&limit=3&page=1", serveAddress), Type: "text/html"},
-					{Rel: "prev", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=0", serveAddress), Type: "application/json"},
+					{Rel: "self", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?bbox=23.73901%%2C37.88372%%2C23.74178%%2C37.88587&limit=3&page=1", serveAddress), Type: "application/json"},
+					{Rel: "alternate", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?bbox=23.73901%%2C37.88372%%2C23.74178%%2C37.88587&f=text%%2Fhtml&limit=3&page=1", serveAddress), Type: "text/html"},
+					{Rel: "prev", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?bbox=23.73901%%2C37.88372%%2C23.74178%%2C37.88587&limit=3&page=0", serveAddress), Type: "application/json"},
 				},
 				NumberMatched:  5,
 				NumberReturned: 2,
-				// Populate the embedded geojson FeatureCollection
-				FeatureCollection: geojson.FeatureCollection{
-					Features: []geojson.Feature{
-						{
-							ID: uint64ptr(5),
+				Features: []wfs3.Feature{
+					{
+						ID: "5",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -1175,8 +1795,10 @@ func TestCollectionFeatures(t *testing.T) {
 								"osm_way_id": "191315130",
 							},
 						},
-						{
-							ID: uint64ptr(6),
+					},
+					{
+						ID: "6",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -1204,7 +1826,7 @@ func TestCollectionFeatures(t *testing.T) {
 			},
 			contentOverride:    nil,
 			contentType:        config.JSONContentType,
-			expectedETag:       "953ff7048ec325ce",
+			expectedETag:       "59e600bb0c031449",
 			expectedStatusCode: 200,
 			urlParams: map[string]string{
 				"name": "aviation_polygons",
@@ -1252,16 +1874,15 @@ func TestCollectionFeatures(t *testing.T) {
 			requestMethod: HTTPMethodGET,
 			goContent: wfs3.FeatureCollection{
 				Links: []*wfs3.Link{
-					{Rel: "self", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?limit=3&page=0", serveAddress), Type: "application/json"},
-					{Rel: "alternate", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?f=text%%2Fhtml&limit=3&page=0", serveAddress), Type: "text/html"},
+					{Rel: "self", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?aeroway=helipad&limit=3&page=0", serveAddress), Type: "application/json"},
+					{Rel: "alternate", Href: fmt.Sprintf("http://%v/collections/aviation_polygons/items?aeroway=helipad&f=text%%2Fhtml&limit=3&page=0", serveAddress), Type: "text/html"},
 				},
 				NumberMatched:  1,
 				NumberReturned: 1,
-				// Populate the embedded geojson FeatureCollection
-				FeatureCollection: geojson.FeatureCollection{
-					Features: []geojson.Feature{
-						{
-							ID: uint64ptr(8),
+				Features: []wfs3.Feature{
+					{
+						ID: "8",
+						Feature: geojson.Feature{
 							Geometry: geojson.Geometry{
 								Geometry: geom.Polygon{
 									{
@@ -1299,7 +1920,7 @@ func TestCollectionFeatures(t *testing.T) {
 			},
 			contentOverride:    nil,
 			contentType:        config.JSONContentType,
-			expectedETag:       "953ff7048ec325ce",
+			expectedETag:       "9ddfd38bf8d91c41",
 			expectedStatusCode: 200,
 			urlParams: map[string]string{
 				"name": "aviation_polygons",
@@ -1382,7 +2003,6 @@ func TestSingleFeature(t *testing.T) {
 		urlParams          map[string]string
 	}
 
-	var i18 uint64 = 18
 	testCases := []TestCase{
 		// Happy-path GET request
 		{
@@ -1399,9 +2019,9 @@ func TestSingleFeature(t *testing.T) {
 						Href: fmt.Sprintf("http://%v/collections/roads_lines", serveAddress),
 					},
 				},
+				ID: "18",
 				// Populate embedded geojson Feature
 				Feature: geojson.Feature{
-					ID: &i18,
 					Geometry: geojson.Geometry{
 						Geometry: geom.LineString{
 							{23.708656, 37.9137612},
@@ -1438,6 +2058,38 @@ func TestSingleFeature(t *testing.T) {
 				"feature_id": "18",
 			},
 		},
+		// Unknown feature id, ids are strings so this isn't a bad request
+		{
+			requestMethod: HTTPMethodGET,
+			goContent: map[string]string{
+				"code":        "NotFound",
+				"description": "Invalid collection/fid: roads_lines/no-such-road",
+			},
+			contentOverride:    nil,
+			contentType:        config.JSONContentType,
+			expectedETag:       "",
+			expectedStatusCode: HTTPStatusNotFound,
+			urlParams: map[string]string{
+				"name":       "roads_lines",
+				"feature_id": "no-such-road",
+			},
+		},
+		// Unknown collection
+		{
+			requestMethod: HTTPMethodGET,
+			goContent: map[string]string{
+				"code":        "NotFound",
+				"description": "Invalid collection/fid: no_such_collection/18",
+			},
+			contentOverride:    nil,
+			contentType:        config.JSONContentType,
+			expectedETag:       "",
+			expectedStatusCode: HTTPStatusNotFound,
+			urlParams: map[string]string{
+				"name":       "no_such_collection",
+				"feature_id": "18",
+			},
+		},
 	}
 
 	for i, tc := range testCases {
@@ -1557,3 +2209,214 @@ func addQueryParams(req *http.Request, queryParams map[string]string) error {
 	}
 	return nil
 }
+
+func TestFeatureCRS(t *testing.T) {
+	serveAddress := "tdd.net"
+
+	type TestCase struct {
+		rawQuery           string
+		expectedStatusCode int
+		expectedCrs        string
+		// First coordinate of feature 18's geometry
+		expectedCoord [2]float64
+	}
+
+	testCases := []TestCase{
+		{rawQuery: "", expectedStatusCode: HTTPStatusOk, expectedCrs: data_provider.CRS84, expectedCoord: [2]float64{23.708656, 37.9137612}},
+		// EPSG:4326 has lat/lon axis order
+		{rawQuery: "crs=http%3A%2F%2Fwww.opengis.net%2Fdef%2Fcrs%2FEPSG%2F0%2F4326", expectedStatusCode: HTTPStatusOk,
+			expectedCrs: data_provider.EPSG4326, expectedCoord: [2]float64{37.9137612, 23.708656}},
+		{rawQuery: "crs=http%3A%2F%2Fwww.opengis.net%2Fdef%2Fcrs%2FEPSG%2F0%2F2263", expectedStatusCode: HTTPStatusClientError},
+		{rawQuery: "crs=not-a-crs", expectedStatusCode: HTTPStatusClientError},
+	}
+
+	for i, tc := range testCases {
+		url := fmt.Sprintf("http://%v/collections/roads_lines/items/18?%v", serveAddress, tc.rawQuery)
+		responseWriter := httptest.NewRecorder()
+		request := httptest.NewRequest(HTTPMethodGET, url, bytes.NewBufferString(""))
+		hrParams := httprouter.Params{{Key: "name", Value: "roads_lines"}, {Key: "feature_id", Value: "18"}}
+		request = request.WithContext(context.WithValue(request.Context(), httprouter.ParamsKey, hrParams))
+
+		collectionData(responseWriter, request)
+		resp := responseWriter.Result()
+		if resp.StatusCode != tc.expectedStatusCode {
+			t.Errorf("[%v] Status code %v != %v", i, resp.StatusCode, tc.expectedStatusCode)
+			continue
+		}
+		if tc.expectedStatusCode != HTTPStatusOk {
+			continue
+		}
+
+		if resp.Header.Get("Content-Crs") != "<"+tc.expectedCrs+">" {
+			t.Errorf("[%v] Content-Crs %v, wanted <%v>", i, resp.Header.Get("Content-Crs"), tc.expectedCrs)
+		}
+		var f struct {
+			Geometry struct {
+				Coordinates [][2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&f); err != nil {
+			t.Errorf("[%v] Problem decoding feature: %v", i, err)
+			continue
+		}
+		if len(f.Geometry.Coordinates) == 0 || f.Geometry.Coordinates[0] != tc.expectedCoord {
+			t.Errorf("[%v] got coordinates %v, wanted %v first", i, f.Geometry.Coordinates, tc.expectedCoord)
+		}
+	}
+}
+
+func TestSelectionParams(t *testing.T) {
+	type TestCase struct {
+		rawQuery    string
+		expected    data_provider.Selection
+		expectedErr bool
+	}
+
+	testCases := []TestCase{
+		{rawQuery: "limit=5", expected: data_provider.Selection{}},
+		{rawQuery: "properties=name,highway", expected: data_provider.Selection{Properties: []string{"name", "highway"}}},
+		{rawQuery: "properties=", expected: data_provider.Selection{Properties: []string{}}},
+		{rawQuery: "skipGeometry=true", expected: data_provider.Selection{SkipGeometry: true}},
+		{rawQuery: "skipGeometry=false&properties=name", expected: data_provider.Selection{Properties: []string{"name"}}},
+		{rawQuery: "skipGeometry=yes", expectedErr: true},
+		{rawQuery: "properties=name&properties=highway", expectedErr: true},
+	}
+
+	for i, tc := range testCases {
+		q, err := url.ParseQuery(tc.rawQuery)
+		if err != nil {
+			t.Fatalf("[%v] Problem parsing query: %v", i, err)
+		}
+		sel, err := selectionParams(q)
+		if tc.expectedErr {
+			if err == nil {
+				t.Errorf("[%v] expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%v] selectionParams(): %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(sel, tc.expected) {
+			t.Errorf("[%v] got %#v, wanted %#v", i, sel, tc.expected)
+		}
+	}
+}
+
+func TestPropertyFilters(t *testing.T) {
+	type TestCase struct {
+		rawQuery string
+		expected []data_provider.PropertyFilter
+	}
+
+	testCases := []TestCase{
+		{
+			rawQuery: "highway=primary&limit=5",
+			expected: []data_provider.PropertyFilter{{Property: "highway", Op: "=", Values: []string{"primary"}}},
+		},
+		{
+			rawQuery: "highway=primary&highway=secondary",
+			expected: []data_provider.PropertyFilter{{Property: "highway", Op: "IN", Values: []string{"primary", "secondary"}}},
+		},
+		{
+			rawQuery: "name=Main*",
+			expected: []data_provider.PropertyFilter{{Property: "name", Op: "LIKE", Values: []string{"Main*"}}},
+		},
+		{
+			rawQuery: `name=100\*`,
+			expected: []data_provider.PropertyFilter{{Property: "name", Op: "=", Values: []string{"100*"}}},
+		},
+		{
+			rawQuery: "lanes>=2&lanes<4",
+			expected: []data_provider.PropertyFilter{
+				{Property: "lanes", Op: "<", Values: []string{"4"}},
+				{Property: "lanes", Op: ">=", Values: []string{"2"}},
+			},
+		},
+		{
+			rawQuery: "lanes!=2&width<=3.5&width>1",
+			expected: []data_provider.PropertyFilter{
+				{Property: "lanes", Op: "<>", Values: []string{"2"}},
+				{Property: "width", Op: "<=", Values: []string{"3.5"}},
+				{Property: "width", Op: ">", Values: []string{"1"}},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		q, err := url.ParseQuery(tc.rawQuery)
+		if err != nil {
+			t.Fatalf("[%v] problem parsing query: %v", i, err)
+		}
+		got := propertyFilters(q, []string{"f", "page", "limit", "time", "bbox"})
+		gotJSON, _ := json.Marshal(got)
+		expectedJSON, _ := json.Marshal(tc.expected)
+		if string(gotJSON) != string(expectedJSON) {
+			t.Errorf("[%v] got %s, wanted %s", i, gotJSON, expectedJSON)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	serveAddress := "search.test"
+
+	// Runs handler & decodes the feature collection it responds with
+	serve := func(handler http.HandlerFunc, method, url, body string, urlParams httprouter.Params) (int, *wfs3.FeatureCollection) {
+		responseWriter := httptest.NewRecorder()
+		request := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		rctx := context.WithValue(request.Context(), httprouter.ParamsKey, urlParams)
+		handler(responseWriter, request.WithContext(rctx))
+		resp := responseWriter.Result()
+		if resp.StatusCode != HTTPStatusOk {
+			return resp.StatusCode, nil
+		}
+		var fc wfs3.FeatureCollection
+		if err := json.NewDecoder(resp.Body).Decode(&fc); err != nil {
+			t.Fatalf("problem decoding response to %v %v: %v", method, url, err)
+		}
+		return resp.StatusCode, &fc
+	}
+
+	searchUrl := fmt.Sprintf("http://%v/search", serveAddress)
+	_, fc := serve(search, HTTPMethodGET, searchUrl+"?collections=aviation_polygons&limit=3", "", nil)
+	if fc == nil || fc.ResultSetId == "" || fc.NumberMatched != 8 || fc.NumberReturned != 3 {
+		t.Fatalf("unexpected GET search response: %+v", fc)
+	}
+	expectedNext := fmt.Sprintf("%v/%v?limit=3&page=1", searchUrl, fc.ResultSetId)
+	foundNext := false
+	for _, l := range fc.Links {
+		foundNext = foundNext || (l.Rel == "next" && l.Href == expectedNext)
+	}
+	if !foundNext {
+		t.Errorf("missing next link %v in %v", expectedNext, fc.Links)
+	}
+
+	_, fc = serve(search, HTTPMethodPOST, searchUrl+"?limit=3", `{"collections": ["aviation_polygons"], "properties": {"aeroway": "helipad"}}`, nil)
+	if fc == nil || fc.ResultSetId == "" || fc.NumberMatched == 0 || fc.NumberMatched >= 8 {
+		t.Fatalf("unexpected POST search response: %+v", fc)
+	}
+
+	// Paging through a result set
+	_, fc = serve(search, HTTPMethodGET, searchUrl+"?collections=aviation_polygons&limit=3", "", nil)
+	if fc == nil {
+		t.Fatalf("unexpected GET search response")
+	}
+	params := httprouter.Params{{Key: "resultSetId", Value: fc.ResultSetId}}
+	_, page := serve(searchResults, HTTPMethodGET, fmt.Sprintf("%v/%v?limit=3&page=2", searchUrl, fc.ResultSetId), "", params)
+	if page == nil || page.NumberMatched != 8 || page.NumberReturned != 2 {
+		t.Errorf("unexpected result set page: %+v", page)
+	}
+
+	// Errors
+	if sc, _ := serve(search, HTTPMethodGET, searchUrl+"?collections=no_such_collection", "", nil); sc != HTTPStatusClientError {
+		t.Errorf("status %v for an unknown collection, wanted %v", sc, HTTPStatusClientError)
+	}
+	if sc, _ := serve(search, HTTPMethodPOST, searchUrl, `{"bbox": [1, 2, 3]}`, nil); sc != HTTPStatusClientError {
+		t.Errorf("status %v for an invalid bbox, wanted %v", sc, HTTPStatusClientError)
+	}
+	params = httprouter.Params{{Key: "resultSetId", Value: "tmp-nosuchresults"}}
+	if sc, _ := serve(searchResults, HTTPMethodGET, searchUrl+"/tmp-nosuchresults", "", params); sc != HTTPStatusNotFound {
+		t.Errorf("status %v for an unknown result set, wanted %v", sc, HTTPStatusNotFound)
+	}
+}
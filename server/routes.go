@@ -30,16 +30,16 @@ package server
 
 import (
 	"net/http"
+	"strings"
 
+	"github.com/go-spatial/jivan/config"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/cors"
 )
 
 func setUpRoutes() http.Handler {
 	r := httprouter.New()
-	c := cors.New(cors.Options{
-		AllowedMethods: []string{"GET", "HEAD"},
-	})
+	c := newCORS()
 
 	r.Handler("GET", "/", c.Handler(http.HandlerFunc(root)))
 	r.Handler("HEAD", "/", c.Handler(http.HandlerFunc(root)))
@@ -52,10 +52,55 @@ func setUpRoutes() http.Handler {
 	r.Handler("HEAD", "/collections", c.Handler(http.HandlerFunc(collectionsMetaData)))
 	r.Handler("GET", "/collections/:name", c.Handler(http.HandlerFunc(collectionMetaData)))
 	r.Handler("HEAD", "/collections/:name", c.Handler(http.HandlerFunc(collectionMetaData)))
+	r.Handler("GET", "/collections/:name/queryables", c.Handler(http.HandlerFunc(collectionQueryables)))
+	r.Handler("HEAD", "/collections/:name/queryables", c.Handler(http.HandlerFunc(collectionQueryables)))
+	r.Handler("GET", "/collections/:name/sortables", c.Handler(http.HandlerFunc(collectionSortables)))
+	r.Handler("HEAD", "/collections/:name/sortables", c.Handler(http.HandlerFunc(collectionSortables)))
 	r.Handler("GET", "/collections/:name/items", c.Handler(http.HandlerFunc(collectionData)))
 	r.Handler("HEAD", "/collections/:name/items", c.Handler(http.HandlerFunc(collectionData)))
+	// A filter in the body, see itemsRequest, or a feature to create
+	r.Handler("POST", "/collections/:name/items", c.Handler(http.HandlerFunc(collectionItemsPost)))
+	// CORS preflights are answered by the cors handler, other OPTIONS requests by options()
+	r.Handler("OPTIONS", "/collections/:name/items", c.Handler(options("GET", "HEAD", "POST")))
+	r.Handler("GET", "/collections/:name/nearest", c.Handler(http.HandlerFunc(collectionNearest)))
+	r.Handler("HEAD", "/collections/:name/nearest", c.Handler(http.HandlerFunc(collectionNearest)))
 	r.Handler("GET", "/collections/:name/items/:feature_id", c.Handler(http.HandlerFunc(collectionData)))
 	r.Handler("HEAD", "/collections/:name/items/:feature_id", c.Handler(http.HandlerFunc(collectionData)))
+	r.Handler("PUT", "/collections/:name/items/:feature_id", c.Handler(http.HandlerFunc(featureTransaction)))
+	r.Handler("PATCH", "/collections/:name/items/:feature_id", c.Handler(http.HandlerFunc(featureTransaction)))
+	r.Handler("DELETE", "/collections/:name/items/:feature_id", c.Handler(http.HandlerFunc(featureTransaction)))
+	r.Handler("OPTIONS", "/collections/:name/items/:feature_id", c.Handler(options(append([]string{"GET", "HEAD"}, writeMethods()...)...)))
+
+	r.Handler("GET", "/search", c.Handler(http.HandlerFunc(search)))
+	r.Handler("POST", "/search", c.Handler(http.HandlerFunc(search)))
+	// CORS preflights for POSTs w/ a JSON body are answered by the cors handler, other OPTIONS
+	// requests by options()
+	r.Handler("OPTIONS", "/search", c.Handler(options("GET", "POST")))
+	r.Handler("GET", "/search/:resultSetId", c.Handler(http.HandlerFunc(searchResults)))
+	r.Handler("HEAD", "/search/:resultSetId", c.Handler(http.HandlerFunc(searchResults)))
 
 	return r
 }
+
+// Methods writing features, allowed when transactions are enabled
+func writeMethods() []string {
+	if !config.Configuration.Server.Transactions {
+		return nil
+	}
+	return []string{"PUT", "PATCH", "DELETE"}
+}
+
+func newCORS() *cors.Cors {
+	return cors.New(cors.Options{
+		AllowedMethods: append([]string{"GET", "HEAD", "POST"}, writeMethods()...),
+	})
+}
+
+// Answers an OPTIONS request w/ the methods allowed
+func options(methods ...string) http.Handler {
+	allow := strings.Join(methods, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(HTTPStatusNoContent)
+	})
+}
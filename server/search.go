@@ -0,0 +1,272 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/jivan/config"
+	"github.com/go-spatial/jivan/data_provider"
+	"github.com/go-spatial/jivan/wfs3"
+	"github.com/julienschmidt/httprouter"
+)
+
+// The JSON body of a POST to /search, the same filters as the GET parameters
+type searchRequest struct {
+	// Names of the collections to search, all collections if empty
+	Collections []string  `json:"collections"`
+	Bbox        []float64 `json:"bbox"`
+	Datetime    string    `json:"datetime"`
+	// Property name to value, or a list of values for any of them.  '*' in a string value is a
+	// wildcard & '\*' a literal '*'.
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// --- Search several collections at /search, the matching features are kept as a result set that
+// can be paged through at /search/{resultSetId}.  Responds w/ the first page.
+func search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _, err := pagingParams(q)
+	if err != nil {
+		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusClientError)
+		return
+	}
+
+	var collections []string
+	var fq data_provider.Query
+	if r.Method == HTTPMethodPOST {
+		collections, fq, err = searchBody(r)
+	} else {
+		collections, fq, err = searchParams(q)
+	}
+	if err != nil {
+		jsonError(w, "InvalidParameterValue", err.Error(), HTTPStatusClientError)
+		return
+	}
+
+	cNames, err := Provider.CollectionNames()
+	if err != nil {
+		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
+		return
+	}
+NEXT_COLLECTION:
+	for _, c := range collections {
+		for _, cn := range cNames {
+			if c == cn {
+				continue NEXT_COLLECTION
+			}
+		}
+		jsonError(w, "InvalidParameterValue", fmt.Sprintf("Invalid collection name: %v", c), HTTPStatusClientError)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	fids, err := Provider.FilterFeatures(ctx, collections, fq)
+	if err != nil {
+		if contextDone(w, r, ctx) {
+			return
+		}
+		switch err.(type) {
+		case *data_provider.BadTimeString, *data_provider.BadFilter:
+			jsonError(w, "InvalidParameterValue", err.Error(), HTTPStatusClientError)
+		default:
+			jsonError(w, "NoApplicableCode", fmt.Sprintf("Problem collecting feature data: %v", err), HTTPStatusServerError)
+		}
+		return
+	}
+	resultSetId, err := Provider.MakeCollection(fids)
+	if err != nil {
+		sc := HTTPStatusServerError
+		if _, ok := err.(data_provider.ErrTempCollectionTooLarge); ok {
+			sc = HTTPStatusClientError
+		}
+		jsonError(w, "NoApplicableCode", err.Error(), sc)
+		return
+	}
+
+	resultSetPage(w, r, resultSetId, limit, 0)
+}
+
+// --- Provide paged access to a search result set at /search/{resultSetId}
+func searchResults(w http.ResponseWriter, r *http.Request) {
+	resultSetId := httprouter.ParamsFromContext(r.Context()).ByName("resultSetId")
+	limit, pageNum, err := pagingParams(r.URL.Query())
+	if err != nil {
+		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusClientError)
+		return
+	}
+
+	if !Provider.HasTempCollection(resultSetId) {
+		jsonError(w, "NotFound", fmt.Sprintf("Invalid or expired result set: %v", resultSetId), HTTPStatusNotFound)
+		return
+	}
+
+	resultSetPage(w, r, resultSetId, limit, pageNum)
+}
+
+// The search filters from GET parameters: 'collections' (comma separated), 'bbox', 'datetime' &
+// property filters as for /collections/{name}/items
+func searchParams(q url.Values) (collections []string, fq data_provider.Query, err error) {
+	for _, cs := range q["collections"] {
+		for _, c := range strings.Split(cs, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				collections = append(collections, c)
+			}
+		}
+	}
+
+	if fq.Extent, err = bboxParam(q); err != nil {
+		return nil, fq, err
+	}
+	if fq.Time, err = timeParam(q); err != nil {
+		return nil, fq, err
+	}
+
+	reservedQParams := []string{"f", "page", "limit", "datetime", "time", "bbox", "collections"}
+	fq.Filters = propertyFilters(q, reservedQParams)
+
+	return collections, fq, nil
+}
+
+// The search filters from the JSON body of a POST, see searchRequest
+func searchBody(r *http.Request) (collections []string, fq data_provider.Query, err error) {
+	var sr searchRequest
+	if err := json.NewDecoder(r.Body).Decode(&sr); err != nil {
+		return nil, fq, fmt.Errorf("invalid search request body: %v", err)
+	}
+
+	if sr.Bbox != nil {
+		if len(sr.Bbox) != 4 {
+			return nil, fq, fmt.Errorf("'bbox' has %v items, expecting 4", len(sr.Bbox))
+		}
+		fq.Extent = &geom.Extent{sr.Bbox[0], sr.Bbox[1], sr.Bbox[2], sr.Bbox[3]}
+	}
+
+	if sr.Datetime != "" {
+		if fq.Time, err = data_provider.ParseTimeInterval(sr.Datetime); err != nil {
+			return nil, fq, err
+		}
+	}
+
+	// Same as the equivalent GET parameters
+	pq := make(url.Values, len(sr.Properties))
+	for k, v := range sr.Properties {
+		switch tv := v.(type) {
+		case nil:
+			return nil, fq, fmt.Errorf("property '%v' has a null value", k)
+		case []interface{}:
+			for _, lv := range tv {
+				pq.Add(k, fmt.Sprint(lv))
+			}
+		case map[string]interface{}:
+			return nil, fq, fmt.Errorf("property '%v' has an object value", k)
+		default:
+			pq.Add(k, fmt.Sprint(tv))
+		}
+	}
+	fq.Filters = propertyFilters(pq, nil)
+
+	return sr.Collections, fq, nil
+}
+
+// Responds w/ page pageNum of result set resultSetId
+func resultSetPage(w http.ResponseWriter, r *http.Request, resultSetId string, limit, pageNum uint) {
+	ct := contentType(r)
+	overrideContent := r.Context().Value("overrideContent")
+
+	fq := data_provider.Query{Collection: resultSetId, Offset: limit * pageNum, Limit: limit}
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	fc, featureTotal, contentId, err := wfs3.FeatureCollectionData(ctx, fq, data_provider.DefaultCRS, &Provider, false)
+	if err != nil {
+		if contextDone(w, r, ctx) {
+			return
+		}
+		jsonError(w, "InvalidParameterValue", fmt.Sprintf("Problem collecting feature data: %v", err), HTTPStatusServerError)
+		return
+	}
+
+	w.Header().Set("ETag", contentId)
+	if r.Method == HTTPMethodHEAD {
+		if r.Header.Get("ETag") == contentId {
+			w.WriteHeader(HTTPStatusNotModified)
+		} else {
+			w.WriteHeader(HTTPStatusOk)
+		}
+		return
+	}
+
+	href := fmt.Sprintf("%v/search/%v", serveSchemeHostPortBase(r), resultSetId)
+	links, err := featurePageLinks(href, nil, pageNum, limit, featureTotal, ct)
+	if err != nil {
+		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
+		return
+	}
+	fc.ResultSetId = resultSetId
+	fc.Links = links
+	fc.NumberMatched = featureTotal
+	fc.NumberReturned = uint(len(fc.Features))
+
+	var encodedContent []byte
+	switch ct {
+	case config.JSONContentType:
+		encodedContent, err = json.Marshal(fc)
+	case config.HTMLContentType:
+		encodedContent, err = fc.MarshalHTML(config.Configuration)
+	default:
+		jsonError(w, "InvalidParameterValue", "Content-Type: '"+ct+"' not supported.", HTTPStatusServerError)
+		return
+	}
+	if err != nil {
+		jsonError(w, "NoApplicableCode", fmt.Sprintf("Problem marshalling feature data: %v", err), HTTPStatusServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ct)
+
+	if overrideContent != nil {
+		encodedContent = overrideContent.([]byte)
+	}
+
+	if ct == config.JSONContentType {
+		err = wfs3.ValidateJSONResponseAgainstJSONSchema(encodedContent, wfs3.FeatureCollectionJSONSchema)
+		if err != nil {
+			log.Printf("%v", err)
+			jsonError(w, "NoApplicableCode", "response doesn't match schema", HTTPStatusServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(HTTPStatusOk)
+	w.Write(encodedContent)
+}
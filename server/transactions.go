@@ -0,0 +1,210 @@
+///////////////////////////////////////////////////////////////////////////////
+//
+// The MIT License (MIT)
+// Copyright (c) 2018 Jivan Amara
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to
+// deal in the Software without restriction, including without limitation the
+// rights to use, copy, modify, merge, publish, distribute, sublicense, and/or
+// sell copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR
+// OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE
+// USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+///////////////////////////////////////////////////////////////////////////////
+
+package server
+
+// Creating, replacing, updating & deleting features as in OGC API - Features - Part 4, when
+// enabled by the 'transactions' server setting.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/go-spatial/jivan/config"
+	"github.com/go-spatial/jivan/data_provider"
+	"github.com/julienschmidt/httprouter"
+)
+
+const GeoJSONContentType = "application/geo+json"
+
+// --- POSTs to /collections/{name}/items create a feature from a GeoJSON Feature, sent as such or
+// w/ a Content-Type of application/geo+json.  Anything else is a filter for collectionData().
+func collectionItemsPost(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		jsonError(w, "InvalidParameterValue", fmt.Sprintf("problem reading request body: %v", err), HTTPStatusClientError)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var doc struct {
+		Type string `json:"type"`
+	}
+	// A body that isn't JSON is reported by either
+	json.Unmarshal(body, &doc)
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if doc.Type == "Feature" || mt == GeoJSONContentType {
+		createFeature(w, r, body)
+		return
+	}
+	collectionData(w, r)
+}
+
+// Adds the feature in body to the collection, responding w/ its location
+func createFeature(w http.ResponseWriter, r *http.Request, body []byte) {
+	cName, ok := transactionCollection(w, r)
+	if !ok {
+		return
+	}
+	f, err := data_provider.DecodeGeoJSONFeature(body)
+	if err != nil {
+		transactionError(w, r, err)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	id, err := Provider.CreateFeature(ctx, cName, f)
+	if err != nil {
+		if contextDone(w, r, ctx) {
+			return
+		}
+		transactionError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%v/collections/%v/items/%v", serveSchemeHostPortBase(r), cName, url.PathEscape(id)))
+	w.WriteHeader(HTTPStatusCreated)
+}
+
+// --- Replaces (PUT), updates (PATCH) or deletes (DELETE) the feature at /collections/{name}/items/{feature_id}.
+// PUT takes a GeoJSON Feature, PATCH one w/ only the properties to change (null to clear them)
+// & optionally a geometry.
+func featureTransaction(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case HTTPMethodPUT, HTTPMethodPATCH, HTTPMethodDELETE:
+	default:
+		jsonError(w, "OperationNotSupported", fmt.Sprintf("method %v isn't supported", r.Method), HTTPStatusMethodNotAllowed)
+		return
+	}
+	cName, ok := transactionCollection(w, r)
+	if !ok {
+		return
+	}
+	fid := data_provider.FeatureId{Collection: cName, FeaturePk: httprouter.ParamsFromContext(r.Context()).ByName("feature_id")}
+
+	var f *data_provider.Feature
+	var err error
+	switch r.Method {
+	case HTTPMethodPUT:
+		var body []byte
+		if body, err = ioutil.ReadAll(r.Body); err == nil {
+			f, err = data_provider.DecodeGeoJSONFeature(body)
+		}
+	case HTTPMethodPATCH:
+		var body []byte
+		if body, err = ioutil.ReadAll(r.Body); err == nil {
+			f, err = data_provider.DecodeGeoJSONPatch(body)
+		}
+	}
+	if err != nil {
+		transactionError(w, r, err)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	switch r.Method {
+	case HTTPMethodPUT:
+		err = Provider.ReplaceFeature(ctx, fid, f)
+	case HTTPMethodPATCH:
+		err = Provider.UpdateFeature(ctx, fid, f)
+	case HTTPMethodDELETE:
+		err = Provider.DeleteFeature(ctx, fid)
+	}
+	if err != nil {
+		if contextDone(w, r, ctx) {
+			return
+		}
+		transactionError(w, r, err)
+		return
+	}
+	w.WriteHeader(HTTPStatusNoContent)
+}
+
+// The name of the collection r writes to, false after responding w/ an error if transactions
+// aren't enabled, there's no such collection or r's geometries aren't in CRS84
+func transactionCollection(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if !config.Configuration.Server.Transactions {
+		jsonError(w, "OperationNotSupported", "transactions aren't enabled", HTTPStatusMethodNotAllowed)
+		return "", false
+	}
+
+	cName := httprouter.ParamsFromContext(r.Context()).ByName("name")
+	cNames, err := Provider.CollectionNames()
+	if err != nil {
+		jsonError(w, "NoApplicableCode", err.Error(), HTTPStatusServerError)
+		return "", false
+	}
+	found := false
+	for _, cn := range cNames {
+		found = found || cn == cName
+	}
+	if !found {
+		jsonError(w, "NotFound", fmt.Sprintf("Invalid collection name: %v", cName), HTTPStatusNotFound)
+		return "", false
+	}
+
+	// GeoJSON coordinates are lon/lat
+	if cc := r.Header.Get("Content-Crs"); cc != "" {
+		crs, err := data_provider.ParseCRS(trimAngleBrackets(cc))
+		if err != nil || crs.URI != data_provider.CRS84 {
+			jsonError(w, "InvalidParameterValue", fmt.Sprintf("Content-Crs '%v' isn't supported, only CRS84", cc), HTTPStatusClientError)
+			return "", false
+		}
+	}
+	return cName, true
+}
+
+// Strips the angle brackets around a CRS URI in a Content-Crs header
+func trimAngleBrackets(s string) string {
+	if len(s) > 1 && s[0] == '<' && s[len(s)-1] == '>' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Responds to r w/ err from a write, a 4xx for a bad feature, one that isn't found or a
+// collection that can't be written to
+func transactionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch e := err.(type) {
+	case *data_provider.BadFeature, *data_provider.BadCRS:
+		jsonError(w, "InvalidParameterValue", e.Error(), HTTPStatusClientError)
+		return
+	}
+	switch err {
+	case data_provider.ErrFeatureNotFound:
+		jsonError(w, "NotFound", fmt.Sprintf("feature '%v' not found", httprouter.ParamsFromContext(r.Context()).ByName("feature_id")), HTTPStatusNotFound)
+	case data_provider.ErrReadOnly:
+		jsonError(w, "OperationNotSupported", err.Error(), HTTPStatusMethodNotAllowed)
+	default:
+		jsonError(w, "NoApplicableCode", fmt.Sprintf("Problem writing feature data: %v", err), HTTPStatusServerError)
+	}
+}
@@ -28,33 +28,36 @@
 package wfs3
 
 import (
+	"context"
 	"fmt"
 	"hash/fnv"
 	"log"
+	"time"
 
 	"github.com/go-spatial/jivan/data_provider"
 )
 
-func CollectionsMetaData(p *data_provider.Provider, serveAddress string, checkOnly bool) (content *CollectionsInfo, contentId string, err error) {
-	// TODO: This calculation of contentId assumes an unchanging data set.
-	// 	When a changing data set is needed this will have to be updated, hopefully after data providers can tell us
-	// 	something about updates.
+func CollectionsMetaData(ctx context.Context, p *data_provider.Provider, serveAddress string, checkOnly bool) (content *CollectionsInfo, contentId string, err error) {
+	// TODO: This calculation of contentId only sees changes made through the provider (see hashRevision()).
+	// 	Changes made directly to the data backend will need data providers to tell us something about updates.
+	cNames, err := p.CollectionNames()
+	if err != nil {
+		// TODO: Log error
+		return nil, "", err
+	}
 	hasher := fnv.New64()
 	hasher.Write([]byte(fmt.Sprintf("%v", serveAddress)))
+	for _, cn := range cNames {
+		hashRevision(hasher, p, cn)
+	}
 	contentId = fmt.Sprintf("%x", hasher.Sum64())
 	if checkOnly {
 		return nil, contentId, nil
 	}
 
-	cNames, err := p.CollectionNames()
-	if err != nil {
-		// TODO: Log error
-		return nil, "", err
-	}
-
 	csInfo := CollectionsInfo{Links: []*Link{}, Collections: []*CollectionInfo{}}
 	for _, cn := range cNames {
-		cInfo, _, err := CollectionMetaData(cn, p, serveAddress, checkOnly)
+		cInfo, _, err := CollectionMetaData(ctx, cn, p, serveAddress, checkOnly)
 		if err != nil {
 			return nil, "", err
 		}
@@ -64,12 +67,12 @@ func CollectionsMetaData(p *data_provider.Provider, serveAddress string, checkOn
 	return &csInfo, contentId, nil
 }
 
-func CollectionMetaData(name string, p *data_provider.Provider, serveAddress string, checkOnly bool) (content *CollectionInfo, contentId string, err error) {
-	// TODO: This calculation of contentId assumes an unchanging data set.
-	// 	When a changing data set is needed this will have to be updated, hopefully after data providers can tell us
-	// 	something about updates.
+func CollectionMetaData(ctx context.Context, name string, p *data_provider.Provider, serveAddress string, checkOnly bool) (content *CollectionInfo, contentId string, err error) {
+	// TODO: This calculation of contentId only sees changes made through the provider (see hashRevision()).
+	// 	Changes made directly to the data backend will need data providers to tell us something about updates.
 	hasher := fnv.New64()
 	hasher.Write([]byte(fmt.Sprintf("%v%v", serveAddress, name)))
+	hashRevision(hasher, p, name)
 	contentId = fmt.Sprintf("%x", hasher.Sum64())
 	if checkOnly {
 		return nil, contentId, nil
@@ -92,7 +95,112 @@ func CollectionMetaData(name string, p *data_provider.Provider, serveAddress str
 		return nil, "", fmt.Errorf("Invalid collection name: %v", name)
 	}
 
-	cInfo := CollectionInfo{Name: name, Title: name, Links: []*Link{}}
+	cs, err := p.CollectionSchema(name)
+	if err != nil {
+		log.Printf("problem describing collection '%v': %v", name, err)
+		return nil, "", err
+	}
+	cInfo := CollectionInfo{Name: name, Title: cs.Title, Description: cs.Description, Links: []*Link{}}
+	cInfo.StorageCrs = cs.CRS
+	if cInfo.Crs, err = p.CollectionCRSs(name); err != nil {
+		log.Printf("problem listing crss of collection '%v': %v", name, err)
+		return nil, "", err
+	}
+
+	e, err := p.CollectionExtent(ctx, name)
+	if err != nil {
+		log.Printf("problem getting extent of collection '%v': %v", name, err)
+		return nil, "", err
+	}
+	if e != nil {
+		cInfo.Extent = &Bbox{Crs: data_provider.CRS84, Bbox: []float64{e[0], e[1], e[2], e[3]}}
+	}
+
+	te, err := p.CollectionTemporalExtent(ctx, name)
+	if err != nil {
+		log.Printf("problem getting temporal extent of collection '%v': %v", name, err)
+		return nil, "", err
+	}
+	if te != nil {
+		if cInfo.Extent == nil {
+			cInfo.Extent = &Bbox{}
+		}
+		cInfo.Extent.Trs = TrsGregorian
+		cInfo.Extent.Temporal = []*time.Time{timeOrNil(te.Start), timeOrNil(te.End)}
+	}
 
 	return &cInfo, contentId, nil
 }
+
+// nil for a zero time, which is an open end of a time interval
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func CollectionQueryables(name string, p *data_provider.Provider, serveAddress string, checkOnly bool) (content *Queryables, contentId string, err error) {
+	// TODO: This calculation of contentId assumes an unchanging schema, writes through the provider keep it
+	hasher := fnv.New64()
+	hasher.Write([]byte(fmt.Sprintf("%v%v/queryables", serveAddress, name)))
+	contentId = fmt.Sprintf("%x", hasher.Sum64())
+	if checkOnly {
+		return nil, contentId, nil
+	}
+
+	qs, err := collectionProperties(name, p)
+	if err != nil {
+		return nil, "", err
+	}
+	return qs, contentId, nil
+}
+
+// The properties features of collection name may be sorted on, all of those it has
+func CollectionSortables(name string, p *data_provider.Provider, serveAddress string, checkOnly bool) (content *Sortables, contentId string, err error) {
+	// TODO: This calculation of contentId assumes an unchanging schema, writes through the provider keep it
+	hasher := fnv.New64()
+	hasher.Write([]byte(fmt.Sprintf("%v%v/sortables", serveAddress, name)))
+	contentId = fmt.Sprintf("%x", hasher.Sum64())
+	if checkOnly {
+		return nil, contentId, nil
+	}
+
+	qs, err := collectionProperties(name, p)
+	if err != nil {
+		return nil, "", err
+	}
+	return &Sortables{Queryables: *qs}, contentId, nil
+}
+
+// JSON Schema of the properties of collection name
+func collectionProperties(name string, p *data_provider.Provider) (*Queryables, error) {
+	cs, err := p.CollectionSchema(name)
+	if err != nil {
+		log.Printf("problem describing collection '%v': %v", name, err)
+		return nil, err
+	}
+
+	title := cs.Title
+	if title == "" {
+		title = name
+	}
+	qs := Queryables{
+		Schema:     JSONSchemaDialect,
+		Type:       "object",
+		Title:      title,
+		Properties: make(map[string]*QueryableProperty, len(cs.Properties)),
+	}
+	for _, pn := range cs.Properties {
+		qp := &QueryableProperty{Title: pn, Type: cs.PropertyTypes[pn]}
+		switch qp.Type {
+		case "":
+			// Unknown, any type
+		case data_provider.PropertyTypeDateTime:
+			qp.Type, qp.Format = "string", "date-time"
+		}
+		qs.Properties[pn] = qp
+	}
+
+	return &qs, nil
+}
@@ -1,90 +1,173 @@
 package wfs3
 
 import (
+	"context"
 	"fmt"
+	"hash"
 	"hash/fnv"
+	"strings"
+	"time"
 
-	"github.com/go-spatial/geom"
 	"github.com/go-spatial/geom/encoding/geojson"
 	"github.com/go-spatial/jivan/data_provider"
 )
 
-func FeatureData(cname string, fid uint64, p *data_provider.Provider, checkOnly bool) (content *Feature, contentId string, err error) {
-	// TODO: This calculation of contentId assumes an unchanging data set.
-	// 	When a changing data set is needed this will have to be updated, hopefully after data providers can tell us
-	// 	something about updates.
+// Returned by FeatureData() when there's no such feature
+type FeatureNotFound struct {
+	Collection string
+	Id         string
+}
+
+func (e *FeatureNotFound) Error() string {
+	return fmt.Sprintf("Invalid collection/fid: %v/%v", e.Collection, e.Id)
+}
+
+// The feature w/ the parts selected by sel & its geometry in crs
+func FeatureData(ctx context.Context, cname string, fid string, crs data_provider.CRS, sel data_provider.Selection, p *data_provider.Provider, checkOnly bool) (content *Feature, contentId string, err error) {
+	// TODO: This calculation of contentId only sees changes made through the provider (see hashRevision()).
+	// 	Changes made directly to the data backend will need data providers to tell us something about updates.
 	hasher := fnv.New64()
 	hasher.Write([]byte(fmt.Sprintf("%v%v", cname, fid)))
+	if crs.URI != data_provider.CRS84 {
+		hasher.Write([]byte(crs.URI))
+	}
+	hashRevision(hasher, p, cname)
+	hashSelection(hasher, sel)
 	contentId = fmt.Sprintf("%x", hasher.Sum64())
 
 	if checkOnly {
 		return nil, contentId, nil
 	}
 
-	pfs, err := p.GetFeatures(
-		[]data_provider.FeatureId{
-			{Collection: cname, FeaturePk: fid},
-		})
+	// Sources may fail in any number of ways for a collection they don't have
+	cNames, err := p.CollectionNames()
 	if err != nil {
 		return nil, "", err
 	}
+	validName := false
+	for _, cn := range cNames {
+		validName = validName || cn == cname
+	}
+	if !validName {
+		return nil, "", &FeatureNotFound{Collection: cname, Id: fid}
+	}
 
-	if len(pfs) != 1 {
-		return nil, "", fmt.Errorf("Invalid collection/fid: %v/%v", cname, fid)
+	pf, err := p.GetFeature(ctx, data_provider.FeatureId{Collection: cname, FeaturePk: fid}, sel)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if pf == nil {
+		return nil, "", &FeatureNotFound{Collection: cname, Id: fid}
+	}
+	if pf, err = crs.TransformFeature(pf); err != nil {
+		return nil, "", err
 	}
 
-	pf := pfs[0]
 	content = &Feature{
-		Feature: geojson.Feature{
-			ID: &pf.ID, Geometry: geojson.Geometry{Geometry: pf.Geometry}, Properties: pf.Properties,
-		},
+		Feature: geojson.Feature{Geometry: geojson.Geometry{Geometry: pf.Geometry}, Properties: pf.Properties},
+		ID:      pf.ID,
 	}
 
 	return content, contentId, nil
 }
 
-//
-func FeatureCollectionData(cName string, bbox *geom.Extent, startIdx, stopIdx uint, properties map[string]string, p *data_provider.Provider, checkOnly bool) (content *FeatureCollection, featureTotal uint, contentId string, err error) {
-	// TODO: This calculation of contentId assumes an unchanging data set.
-	// 	When a changing data set is needed this will have to be updated, hopefully after data providers can tell us
-	// 	something about updates.
+// The page of features described by q w/ their geometries in crs, along w/ the total number of
+// features matching its filters.  Features only have the parts selected by q.Select.
+func FeatureCollectionData(ctx context.Context, q data_provider.Query, crs data_provider.CRS, p *data_provider.Provider, checkOnly bool) (content *FeatureCollection, featureTotal uint, contentId string, err error) {
+	// TODO: This calculation of contentId only sees changes made through the provider (see hashRevision()).
+	// 	Changes made directly to the data backend will need data providers to tell us something about updates.
 	hasher := fnv.New64()
-	hasher.Write([]byte(cName))
+	hasher.Write([]byte(q.Collection))
+	if crs.URI != data_provider.CRS84 {
+		hasher.Write([]byte(crs.URI))
+	}
+	hasher.Write([]byte(fmt.Sprintf("offset=%v,limit=%v", q.Offset, q.Limit)))
+	for _, k := range q.SortBy {
+		hasher.Write([]byte(fmt.Sprintf("sortby=%v,%v", k.Property, k.Descending)))
+	}
+	if q.Filter != nil {
+		hasher.Write([]byte("filter=" + q.Filter.String()))
+	}
+	if q.Nearest != nil {
+		hasher.Write([]byte(fmt.Sprintf("near=%v,%v", q.Nearest[0], q.Nearest[1])))
+	}
+	hashFilters(hasher, q)
+	hashRevision(hasher, p, q.Collection)
+	hashSelection(hasher, q.Select)
 	contentId = fmt.Sprintf("%x", hasher.Sum64())
 
 	if checkOnly {
 		return nil, featureTotal, contentId, nil
 	}
 
-	// collection features filtered for matches in properties if it is non-nil, otherwise all
-	cfs, err := p.CollectionFeatures(cName, properties, bbox)
+	// The requested page of collection features filtered for matches in properties & bbox
+	cfs, featureTotal, err := p.QueryFeatures(ctx, q)
 	if err != nil {
 		return nil, featureTotal, "", err
 	}
 
-	featureTotal = uint(len(cfs))
-	originalStopIdx := stopIdx
-	if stopIdx > featureTotal {
-		stopIdx = featureTotal
-	}
-
-	if startIdx >= featureTotal || stopIdx < startIdx {
+	// An empty first page is fine, i.e. when nothing matches the filters
+	if q.Offset > 0 && q.Offset >= featureTotal {
 		return nil, featureTotal, "", fmt.Errorf(
-			"Invalid start/stop indices [%v, %v] for collection of length %v", startIdx, originalStopIdx, featureTotal)
+			"Invalid start/stop indices [%v, %v] for collection of length %v", q.Offset, q.Offset+q.Limit, featureTotal)
 	}
 
 	// Convert the provider features to geojson features.
-	gfs := make([]geojson.Feature, stopIdx-startIdx)
-	for i, pf := range cfs[startIdx:stopIdx] {
-		gfs[i] = geojson.Feature{
-			ID: &pf.ID, Geometry: geojson.Geometry{Geometry: pf.Geometry}, Properties: pf.Properties,
+	gfs := make([]Feature, len(cfs))
+	for i, pf := range cfs {
+		if pf, err = crs.TransformFeature(pf); err != nil {
+			return nil, featureTotal, "", err
+		}
+		gfs[i] = Feature{
+			Feature: geojson.Feature{Geometry: geojson.Geometry{Geometry: pf.Geometry}, Properties: pf.Properties},
+			ID:      pf.ID,
 		}
 	}
 
 	// Wrap the features up in a FeatureCollection
-	content = &FeatureCollection{
-		FeatureCollection: geojson.FeatureCollection{Features: gfs},
-	}
+	content = &FeatureCollection{Features: gfs}
 
 	return content, featureTotal, contentId, nil
 }
+
+// Adds q's extent, time & property filters to a content id hash, a query w/o them leaves it unchanged
+func hashFilters(hasher hash.Hash, q data_provider.Query) {
+	if q.Extent != nil {
+		hasher.Write([]byte(fmt.Sprintf("bbox=%v", *q.Extent)))
+	}
+	if q.Time != nil {
+		hasher.Write([]byte(fmt.Sprintf("datetime=%v/%v", hashTime(q.Time.Start), hashTime(q.Time.End))))
+	}
+	if q.Temporal.IsSet() {
+		hasher.Write([]byte(fmt.Sprintf("temporal=%q,%q,%q", q.Temporal.Instant, q.Temporal.Start, q.Temporal.End)))
+	}
+	for _, pf := range q.Filters {
+		hasher.Write([]byte(fmt.Sprintf("%v%v%q", pf.Property, pf.Op, pf.Values)))
+	}
+}
+
+// t for a content id, ".." for an unbounded end of an interval
+func hashTime(t time.Time) string {
+	if t.IsZero() {
+		return ".."
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// Adds the number of writes made to collection to a content id, ids from before a write differ
+func hashRevision(hasher hash.Hash, p *data_provider.Provider, collection string) {
+	if rev := p.CollectionRevision(collection); rev > 0 {
+		hasher.Write([]byte(fmt.Sprintf("revision=%v", rev)))
+	}
+}
+
+// Adds sel to a content id hash, a selection of everything leaves it unchanged
+func hashSelection(hasher hash.Hash, sel data_provider.Selection) {
+	if sel.Properties != nil {
+		hasher.Write([]byte(fmt.Sprintf("properties=%v", strings.Join(sel.Properties, ","))))
+	}
+	if sel.SkipGeometry {
+		hasher.Write([]byte("skipGeometry"))
+	}
+}
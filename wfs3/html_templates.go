@@ -194,9 +194,47 @@ var tmpl_collections = `
 	</ul>`
 
 var tmpl_collection = `
-<h2>{{ .data.Name }} <a href="{{ .config.Server.URLBasePath }}collections/{{ .data.Name }}"><img src="https://image.flaticon.com/icons/svg/136/136443.svg" width="50" height="50"/></a></h2>
+<link rel="stylesheet" href="https://openlayers.org/en/v4.6.5/css/ol.css" type="text/css">
+<script src="https://openlayers.org/en/v4.6.5/build/ol.js"></script>
+<h2>{{ if .data.Title }}{{ .data.Title }}{{ else }}{{ .data.Name }}{{ end }} <a href="{{ .config.Server.URLBasePath }}collections/{{ .data.Name }}"><img src="https://image.flaticon.com/icons/svg/136/136443.svg" width="50" height="50"/></a></h2>
 	<span>{{ .data.Description }}</span>
 	<div><a href="./{{ .data.Name }}/items?f=text/html">Browse Features</a></div>
+	{{ if .data.Extent }}{{ if .data.Extent.Bbox }}
+	<h2>Spatial Extent</h2>
+	<div>{{ range $i, $c := .data.Extent.Bbox }}{{ if $i }}, {{ end }}{{ $c }}{{ end }}</div>
+	<div id="map" class="map"></div>
+	<script>
+		var extent = ol.proj.transformExtent({{ .data.Extent.Bbox }}, 'EPSG:4326', 'EPSG:3857');
+		var vectorLayer = new ol.layer.Vector({
+			source: new ol.source.Vector({
+				features: [new ol.Feature(ol.geom.Polygon.fromExtent(extent))]
+			}),
+			style: styles['Polygon']
+		});
+
+		var map = new ol.Map({
+			layers: [
+				new ol.layer.Tile({
+					source: new ol.source.OSM()
+				}),
+				vectorLayer
+			],
+			target: 'map',
+			controls: ol.control.defaults({
+				attributionOptions: {
+					collapsible: false
+				}
+			}),
+			view: new ol.View({
+				zoom: -10
+			})
+		});
+		map.getView().fit(extent, map.getSize());
+	</script>
+	{{ end }}{{ if .data.Extent.Temporal }}
+	<h2>Temporal Extent</h2>
+	<div>{{ range $i, $t := .data.Extent.Temporal }}{{ if $i }} / {{ end }}{{ if $t }}{{ $t.Format "2006-01-02T15:04:05Z07:00" }}{{ else }}..{{ end }}{{ end }}</div>
+	{{ end }}{{ end }}
 	<h2>Links</h2>
 	<ul>
 		{{ range .data.Links }}
@@ -204,6 +242,34 @@ var tmpl_collection = `
 		{{ end }}
 	</ul>`
 
+var tmpl_queryables = `
+{{ range .data.Links }}
+	{{ if (eq .Rel "collection") }}
+		<h2><a href="{{ .Href }}">Collection</a></h2>
+	{{ end }}
+{{ end }}
+<h2>Queryables of {{ .data.Title }} <a href="{{ .data.Id }}"><img src="https://image.flaticon.com/icons/svg/136/136443.svg" width="50" height="50"/></a></h2>
+	<table>
+		<tr><th>Property</th><th>Type</th></tr>
+		{{ range $name, $p := .data.Properties }}
+		<tr><td>{{ $name }}</td><td>{{ if $p.Format }}{{ $p.Format }}{{ else if $p.Type }}{{ $p.Type }}{{ else }}any{{ end }}</td></tr>
+		{{ end }}
+	</table>`
+
+var tmpl_sortables = `
+{{ range .data.Links }}
+	{{ if (eq .Rel "collection") }}
+		<h2><a href="{{ .Href }}">Collection</a></h2>
+	{{ end }}
+{{ end }}
+<h2>Sortables of {{ .data.Title }} <a href="{{ .data.Id }}"><img src="https://image.flaticon.com/icons/svg/136/136443.svg" width="50" height="50"/></a></h2>
+	<table>
+		<tr><th>Property</th><th>Type</th></tr>
+		{{ range $name, $p := .data.Properties }}
+		<tr><td>{{ $name }}</td><td>{{ if $p.Format }}{{ $p.Format }}{{ else if $p.Type }}{{ $p.Type }}{{ else }}any{{ end }}</td></tr>
+		{{ end }}
+	</table>`
+
 var tmpl_collection_features = `
 <link rel="stylesheet" href="https://openlayers.org/en/v4.6.5/css/ol.css" type="text/css">
 <script src="https://openlayers.org/en/v4.6.5/build/ol.js"></script>
@@ -34,8 +34,9 @@ import (
 	"hash/fnv"
 	"log"
 
-	"github.com/go-spatial/jivan/config"
 	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-spatial/jivan/config"
+	"github.com/go-spatial/jivan/data_provider"
 )
 
 var openAPI3Schema *openapi3.Swagger
@@ -176,6 +177,70 @@ func GenerateOpenAPIDocument() {
 					},
 				},
 			},
+			"/collections/{name}/queryables": &openapi3.PathItem{
+				Summary:     "Queryable properties of a collection",
+				Description: "JSON Schema of the properties the features of the named collection may be filtered on",
+				Get: &openapi3.Operation{
+					OperationID: "getQueryables",
+					Parameters: openapi3.Parameters{
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Description:     "Name of collection to retrieve queryables for.",
+								Name:            "name",
+								In:              "path",
+								Required:        true,
+								Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+								AllowEmptyValue: false,
+							},
+						},
+					},
+					Responses: openapi3.Responses{
+						"200": &openapi3.ResponseRef{
+							Value: &openapi3.Response{
+								Content: openapi3.Content{
+									"application/json": &openapi3.ContentType{
+										Schema: &openapi3.SchemaRef{
+											Value: &QueryablesSchema,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/collections/{name}/sortables": &openapi3.PathItem{
+				Summary:     "Sortable properties of a collection",
+				Description: "JSON Schema of the properties the features of the named collection may be sorted on",
+				Get: &openapi3.Operation{
+					OperationID: "getSortables",
+					Parameters: openapi3.Parameters{
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Description:     "Name of collection to retrieve sortables for.",
+								Name:            "name",
+								In:              "path",
+								Required:        true,
+								Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+								AllowEmptyValue: false,
+							},
+						},
+					},
+					Responses: openapi3.Responses{
+						"200": &openapi3.ResponseRef{
+							Value: &openapi3.Response{
+								Content: openapi3.Content{
+									"application/json": &openapi3.ContentType{
+										Schema: &openapi3.SchemaRef{
+											Value: &QueryablesSchema,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
 			"/collections/{name}/items": &openapi3.PathItem{
 				Summary:     "Feature data for collection",
 				Description: "Provides paged access to data for all features in collection",
@@ -223,10 +288,127 @@ func GenerateOpenAPIDocument() {
 						},
 						&openapi3.ParameterRef{
 							Value: &openapi3.Parameter{
-								Name:        "<other>",
-								Description: "Any feature property name may be filtered on by including it as a query parameter",
+								Name:        "bbox-crs",
+								Description: "CRS of the bbox coordinates, CRS84 (lon/lat) if not given.",
 								In:          "query",
 								Required:    false,
+								Schema: &openapi3.SchemaRef{
+									Value: &crsParamSchema,
+								},
+								AllowEmptyValue: false,
+							},
+						},
+						crsParam,
+						propertiesParam,
+						skipGeometryParam,
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name: "sortby",
+								Description: "Comma separated properties to sort features on, each prefixed by '+' for ascending " +
+									"(the default) or '-' for descending order, i.e. '+name,-height'.  Features are then sorted by id.  " +
+									"The properties of a collection that may be sorted on are listed at /collections/{name}/sortables.",
+								In:       "query",
+								Required: false,
+								Schema: &openapi3.SchemaRef{
+									Value: &openapi3.Schema{
+										Type:  "array",
+										Items: &openapi3.SchemaRef{Value: &openapi3.Schema{Type: "string", Pattern: `^[+-]?[^,]+$`}},
+									},
+								},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name: "near",
+								Description: "Lon/lat point to sort features by distance from, nearest first instead of by sortby, " +
+									"i.e. '-77.03,38.89'.  Features then have their geodesic distance in meters as the '" +
+									data_provider.DistanceProperty + "' property.",
+								In:       "query",
+								Required: false,
+								Schema: &openapi3.SchemaRef{
+									Value: &openapi3.Schema{
+										Type:     "array",
+										MinItems: 2,
+										MaxItems: pint64(2),
+										Items:    &openapi3.SchemaRef{Value: openapi3.NewFloat64Schema()},
+									},
+								},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name: "filter",
+								Description: "CQL2 expression features must match, i.e. \"height > 10 AND name LIKE 'A%'\".  " +
+									"Supports comparison, LIKE, IN, BETWEEN & IS NULL predicates, AND, OR & NOT, the T_ temporal " +
+									"predicates, the S_INTERSECTS, S_DISJOINT, S_WITHIN, S_CONTAINS & S_EQUALS spatial predicates of the " +
+									"geometry & a WKT geometry or BBOX, & S_DWITHIN(geometry, <geometry>, <meters>).  " +
+									"The properties of a collection are listed at /collections/{name}/queryables.",
+								In:       "query",
+								Required: false,
+								Schema: &openapi3.SchemaRef{
+									Value: openapi3.NewStringSchema(),
+								},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name:        "filter-lang",
+								Description: "Language of the filter parameter, the text or JSON encoding of CQL2.",
+								In:          "query",
+								Required:    false,
+								Schema: &openapi3.SchemaRef{
+									Value: &openapi3.Schema{
+										Type:    "string",
+										Enum:    []interface{}{"cql2-text", "cql2-json"},
+										Default: "cql2-text",
+									},
+								},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name:        "filter-crs",
+								Description: "CRS of geometries in the filter parameter.",
+								In:          "query",
+								Required:    false,
+								Schema: &openapi3.SchemaRef{
+									Value: &openapi3.Schema{
+										Type:    "string",
+										Enum:    []interface{}{data_provider.CRS84},
+										Default: data_provider.CRS84,
+									},
+								},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name: "datetime",
+								Description: "Time instant or interval features must intersect, in ISO 8601: an instant " +
+									"('2018-02-12T23:20:50Z', '2018-02-12'), or two separated by '/' w/ '..' for an open end " +
+									"('2018-02-12T00:00:00Z/..') or a duration for one end ('2018-02-12/P1M').  Also accepted as 'time'.",
+								In:       "query",
+								Required: false,
+								Schema: &openapi3.SchemaRef{
+									Value: openapi3.NewStringSchema(),
+								},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name: "<other>",
+								Description: "Any feature property name may be filtered on by including it as a query parameter: " +
+									"'name=value' for equality ('*' in value is a wildcard, '\\*' a literal '*'), " +
+									"repeated for any of several values, or 'name!=value', 'name<value', 'name<=value', " +
+									"'name>value', 'name>=value' for comparisons.  Values are compared according to the property's type.  " +
+									"The properties of a collection are listed at /collections/{name}/queryables, others are rejected.",
+								In:       "query",
+								Required: false,
 								Schema: &openapi3.SchemaRef{
 									Value: openapi3.NewStringSchema(),
 								},
@@ -275,6 +457,9 @@ func GenerateOpenAPIDocument() {
 								AllowEmptyValue: false,
 							},
 						},
+						crsParam,
+						propertiesParam,
+						skipGeometryParam,
 					},
 					Responses: openapi3.Responses{
 						"200": &openapi3.ResponseRef{
@@ -291,9 +476,252 @@ func GenerateOpenAPIDocument() {
 					},
 				},
 			},
+			"/search": &openapi3.PathItem{
+				Summary:     "Search several collections",
+				Description: "Filters the features of several collections, keeping the matches as a result set paged through at /search/{resultSetId}.  Responds with the first page.",
+				Get: &openapi3.Operation{
+					OperationID: "getSearch",
+					Parameters: openapi3.Parameters{
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name:            "collections",
+								Description:     "Comma separated names of the collections to search, all collections if not given.",
+								In:              "query",
+								Required:        false,
+								Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name:            "limit",
+								Description:     "Maximum number of results to return per page.",
+								In:              "query",
+								Required:        false,
+								Schema:          &openapi3.SchemaRef{Value: openapi3.NewIntegerSchema()},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name:            "bbox",
+								Description:     "Bounding box to limit results.",
+								In:              "query",
+								Required:        false,
+								Schema:          &openapi3.SchemaRef{Value: &BBoxSchema},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name:            "datetime",
+								Description:     "Time instant or interval features must intersect, as for /collections/{name}/items.",
+								In:              "query",
+								Required:        false,
+								Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name:            "<other>",
+								Description:     "Property filters, as for /collections/{name}/items.",
+								In:              "query",
+								Required:        false,
+								Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+								AllowEmptyValue: false,
+							},
+						},
+					},
+					Responses: searchResponses,
+				},
+				Post: &openapi3.Operation{
+					OperationID: "postSearch",
+					RequestBody: &openapi3.RequestBodyRef{
+						Value: &openapi3.RequestBody{
+							Description: "The same filters as the GET parameters",
+							Required:    true,
+							Content: openapi3.Content{
+								"application/json": &openapi3.ContentType{
+									Schema: &openapi3.SchemaRef{Value: &SearchRequestSchema},
+								},
+							},
+						},
+					},
+					Responses: searchResponses,
+				},
+			},
+			"/search/{resultSetId}": &openapi3.PathItem{
+				Summary:     "Search results",
+				Description: "Provides paged access to a result set created at /search.  Result sets expire when unused for a while.",
+				Get: &openapi3.Operation{
+					OperationID: "getSearchResults",
+					Parameters: openapi3.Parameters{
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name:            "resultSetId",
+								Description:     "Id of the result set, from a /search response.",
+								In:              "path",
+								Required:        true,
+								Schema:          &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name:            "limit",
+								Description:     "Maximum number of results to return per page.",
+								In:              "query",
+								Required:        false,
+								Schema:          &openapi3.SchemaRef{Value: openapi3.NewIntegerSchema()},
+								AllowEmptyValue: false,
+							},
+						},
+						&openapi3.ParameterRef{
+							Value: &openapi3.Parameter{
+								Name:            "page",
+								Description:     "Page of results to return, from 0.",
+								In:              "query",
+								Required:        false,
+								Schema:          &openapi3.SchemaRef{Value: openapi3.NewIntegerSchema()},
+								AllowEmptyValue: false,
+							},
+						},
+					},
+					Responses: searchResponses,
+				},
+			},
+		},
+	}
+
+	// POSTs for features take the parameters of GETs, except for a filter which is in the body
+	items := openAPI3Schema.Paths["/collections/{name}/items"]
+	var postParams openapi3.Parameters
+	for _, p := range items.Get.Parameters {
+		switch p.Value.Name {
+		case "filter", "filter-lang", "filter-crs":
+		default:
+			postParams = append(postParams, p)
+		}
+	}
+	items.Post = &openapi3.Operation{
+		OperationID: "postCollectionFeatures",
+		Parameters:  postParams,
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Description: "A filter too long for the URL",
+				Required:    true,
+				Content: openapi3.Content{
+					"application/json": &openapi3.ContentType{
+						Schema: &openapi3.SchemaRef{Value: &ItemsRequestSchema},
+					},
+				},
+			},
+		},
+		Responses: items.Get.Responses,
+	}
+
+	// The nearest features take the parameters of items GETs, w/ point & k for near & limit
+	nearestParams := openapi3.Parameters{
+		&openapi3.ParameterRef{
+			Value: &openapi3.Parameter{
+				Name:        "point",
+				Description: "Lon/lat point to find the features nearest, i.e. '-77.03,38.89'.",
+				In:          "query",
+				Required:    true,
+				Schema: &openapi3.SchemaRef{
+					Value: &openapi3.Schema{
+						Type:     "array",
+						MinItems: 2,
+						MaxItems: pint64(2),
+						Items:    &openapi3.SchemaRef{Value: openapi3.NewFloat64Schema()},
+					},
+				},
+				AllowEmptyValue: false,
+			},
+		},
+		&openapi3.ParameterRef{
+			Value: &openapi3.Parameter{
+				Name:            "k",
+				Description:     "Number of features to return.",
+				In:              "query",
+				Required:        false,
+				Schema:          &openapi3.SchemaRef{Value: openapi3.NewIntegerSchema()},
+				AllowEmptyValue: false,
+			},
+		},
+	}
+	for _, p := range items.Get.Parameters {
+		switch p.Value.Name {
+		case "near", "limit", "page":
+		default:
+			nearestParams = append(nearestParams, p)
+		}
+	}
+	openAPI3Schema.Paths["/collections/{name}/nearest"] = &openapi3.PathItem{
+		Summary: "Features of a collection nearest a point",
+		Description: "Provides the features of the named collection nearest a point, nearest first w/ their geodesic distance " +
+			"in meters as the '" + data_provider.DistanceProperty + "' property",
+		Get: &openapi3.Operation{
+			OperationID: "getNearestFeatures",
+			Parameters:  nearestParams,
+			Responses:   items.Get.Responses,
 		},
 	}
 
+	// With transactions enabled a Feature POSTed to items is added to the collection, & single
+	// features may be replaced, updated or deleted
+	featureBody := func(description string) *openapi3.RequestBodyRef {
+		return &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Description: description,
+				Required:    true,
+				Content: openapi3.Content{
+					"application/geo+json": &openapi3.ContentType{
+						Schema: &openapi3.SchemaRef{
+							Ref: "http://geojson.org/schema/Feature.json",
+						},
+					},
+				},
+			},
+		}
+	}
+	items.Post.Description = "A body w/ a filter pages through matching features, a GeoJSON Feature (in CRS84) is added to " +
+		"the collection when transactions are enabled & its location is in the response's Location header"
+	items.Post.RequestBody.Value.Description = "A filter too long for the URL, or a feature to add"
+	items.Post.RequestBody.Value.Content["application/geo+json"] = featureBody("").Value.Content["application/geo+json"]
+	postResponses := openapi3.Responses{
+		"201": &openapi3.ResponseRef{Value: &openapi3.Response{Description: "Feature created"}},
+	}
+	for code, r := range items.Get.Responses {
+		postResponses[code] = r
+	}
+	items.Post.Responses = postResponses
+	feature := openAPI3Schema.Paths["/collections/{name}/items/{feature_id}"]
+	featureParams := feature.Get.Parameters[:2]
+	written := openapi3.Responses{
+		"204": &openapi3.ResponseRef{Value: &openapi3.Response{Description: "Feature written"}},
+	}
+	feature.Put = &openapi3.Operation{
+		OperationID: "replaceCollectionFeature",
+		Description: "Replaces the feature w/ a GeoJSON Feature in CRS84, properties it doesn't have are cleared",
+		Parameters:  featureParams,
+		RequestBody: featureBody("The replacement feature"),
+		Responses:   written,
+	}
+	feature.Patch = &openapi3.Operation{
+		OperationID: "updateCollectionFeature",
+		Description: "Updates the feature w/ the properties & geometry of a GeoJSON Feature in CRS84, a null property is cleared",
+		Parameters:  featureParams,
+		RequestBody: featureBody("The properties & geometry to change"),
+		Responses:   written,
+	}
+	feature.Delete = &openapi3.Operation{
+		OperationID: "deleteCollectionFeature",
+		Parameters:  featureParams,
+		Responses:   written,
+	}
+
 	schemaJSON, err := json.Marshal(openAPI3Schema)
 	if err != nil {
 		log.Printf("Problem marshalling openapi3 schema: %v", err)
@@ -305,3 +733,122 @@ func GenerateOpenAPIDocument() {
 	hasher.Write(openAPI3SchemaJSON)
 	openAPI3SchemaContentId = fmt.Sprintf("%x", hasher.Sum64())
 }
+
+// A CRS identifier, a collection lists those it supports
+var crsParamSchema = openapi3.Schema{
+	Type:    "string",
+	Format:  "uri",
+	Default: data_provider.CRS84,
+}
+
+// The 'crs' parameter of requests for features
+var crsParam = &openapi3.ParameterRef{
+	Value: &openapi3.Parameter{
+		Name: "crs",
+		Description: "CRS of the geometries in the response, one of those listed in the collection's 'crs'.  " +
+			"CRS84 (lon/lat) if not given.  EPSG:4326 coordinates are in lat/lon order.",
+		In:       "query",
+		Required: false,
+		Schema: &openapi3.SchemaRef{
+			Value: &crsParamSchema,
+		},
+		AllowEmptyValue: false,
+	},
+}
+
+// The 'properties' parameter of requests for features
+var propertiesParam = &openapi3.ParameterRef{
+	Value: &openapi3.Parameter{
+		Name: "properties",
+		Description: "Comma separated names of the properties features are returned w/, all of them if not given, " +
+			"none if empty.  The properties of a collection are listed at /collections/{name}/queryables.",
+		In:       "query",
+		Required: false,
+		Schema: &openapi3.SchemaRef{
+			Value: &openapi3.Schema{
+				Type:  "array",
+				Items: &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+			},
+		},
+		AllowEmptyValue: true,
+	},
+}
+
+// The 'skipGeometry' parameter of requests for features
+var skipGeometryParam = &openapi3.ParameterRef{
+	Value: &openapi3.Parameter{
+		Name:        "skipGeometry",
+		Description: "Return features w/o their geometries if true.",
+		In:          "query",
+		Required:    false,
+		Schema: &openapi3.SchemaRef{
+			Value: &openapi3.Schema{
+				Type:    "boolean",
+				Default: false,
+			},
+		},
+		AllowEmptyValue: false,
+	},
+}
+
+// A page of search results
+var searchResponses = openapi3.Responses{
+	"200": &openapi3.ResponseRef{
+		Value: &openapi3.Response{
+			Content: openapi3.Content{
+				"application/json": &openapi3.ContentType{
+					Schema: &openapi3.SchemaRef{
+						Ref: "http://geojson.org/schema/FeatureCollection.json",
+					},
+				},
+			},
+		},
+	},
+}
+
+// The JSON body of a POST to /search
+var SearchRequestSchema openapi3.Schema = openapi3.Schema{
+	Type: "object",
+	Properties: map[string]*openapi3.SchemaRef{
+		"collections": {
+			Value: &openapi3.Schema{
+				Type:  "array",
+				Items: &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+			},
+		},
+		"bbox": {
+			Value: &BBoxSchema,
+		},
+		"datetime": {
+			Value: openapi3.NewStringSchema(),
+		},
+		"properties": {
+			Value: openapi3.NewObjectSchema(),
+		},
+	},
+}
+
+// The JSON body of a POST to /collections/{name}/items
+var ItemsRequestSchema openapi3.Schema = openapi3.Schema{
+	Type: "object",
+	Properties: map[string]*openapi3.SchemaRef{
+		"filter-lang": {
+			Value: &openapi3.Schema{
+				Type:    "string",
+				Enum:    []interface{}{"cql2-json", "cql2-text"},
+				Default: "cql2-json",
+			},
+		},
+		"filter-crs": {
+			Value: &openapi3.Schema{
+				Type:    "string",
+				Enum:    []interface{}{data_provider.CRS84},
+				Default: data_provider.CRS84,
+			},
+		},
+		// A CQL2 JSON object, or a string for cql2-text
+		"filter": {
+			Value: &openapi3.Schema{},
+		},
+	},
+}
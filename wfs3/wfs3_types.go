@@ -29,9 +29,11 @@ package wfs3
 
 import (
 	"html/template"
+	"time"
 
 	"github.com/go-spatial/geom/encoding/geojson"
 	"github.com/go-spatial/jivan/config"
+	"github.com/go-spatial/jivan/data_provider"
 	"github.com/go-spatial/jivan/util"
 	"github.com/getkin/kin-openapi/openapi3"
 )
@@ -78,17 +80,26 @@ var RootContentSchema openapi3.Schema = openapi3.Schema{
 var maxItems int64 = 4
 
 type Bbox struct {
-	Crs  string    `json:"crs"`
-	Bbox []float64 `json:"bbox"`
+	Crs  string    `json:"crs,omitempty"`
+	Bbox []float64 `json:"bbox,omitempty"`
+	// Temporal reference system & [start, end] of the temporal extent, nil for an open end
+	Trs      string       `json:"trs,omitempty"`
+	Temporal []*time.Time `json:"temporal,omitempty"`
 }
 
+// Gregorian calendar w/ UTC
+const TrsGregorian = "http://www.opengis.net/def/uom/ISO-8601/0/Gregorian"
+
 var BboxSchema openapi3.Schema = openapi3.Schema{
-	Type:     "object",
-	Required: []string{"bbox"},
+	Type: "object",
 	Properties: map[string]*openapi3.SchemaRef{
 		"crs": {
-			// TODO: This is supposed to have an enum & default based on: http://www.opengis.net/def/crs/OGC/1.3/CRS84
-			Value: openapi3.NewStringSchema(),
+			// Extents are always given in lon/lat
+			Value: &openapi3.Schema{
+				Type:    "string",
+				Enum:    []interface{}{data_provider.CRS84},
+				Default: data_provider.CRS84,
+			},
 		},
 		"bbox": {
 			Value: &openapi3.Schema{
@@ -98,6 +109,23 @@ var BboxSchema openapi3.Schema = openapi3.Schema{
 				Items:    openapi3.NewSchemaRef("", openapi3.NewFloat64Schema().WithMin(-180).WithMax(180)),
 			},
 		},
+		"trs": {
+			Value: openapi3.NewStringSchema(),
+		},
+		"temporal": {
+			Value: &openapi3.Schema{
+				Type:     "array",
+				MinItems: 2,
+				MaxItems: pint64(2),
+				Items: &openapi3.SchemaRef{
+					Value: &openapi3.Schema{
+						Type:     "string",
+						Format:   "date-time",
+						Nullable: true,
+					},
+				},
+			},
+		},
 	},
 }
 
@@ -150,12 +178,15 @@ func (l *Link) ContentType(contentType string) {
 // --- @See https://raw.githubusercontent.com/opengeospatial/WFS_FES/master/core/openapi/schemas/collectionInfo.yaml
 //  for collectionInfo schema
 type CollectionInfo struct {
-	Name        string   `json:"name"`
-	Title       string   `json:"title,omitempty"`
-	Description string   `json:"description,omitempty"`
-	Links       []*Link  `json:"links"`
-	Extent      *Bbox    `json:"extent,omitempty"`
-	Crs         []string `json:"crs,omitempty"`
+	Name        string  `json:"name"`
+	Title       string  `json:"title,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Links       []*Link `json:"links"`
+	Extent      *Bbox   `json:"extent,omitempty"`
+	// CRSs the collection's features can be served in, the first is the default
+	Crs []string `json:"crs,omitempty"`
+	// CRS the features are stored in
+	StorageCrs string `json:"storageCrs,omitempty"`
 }
 
 func (ci *CollectionInfo) MarshalHTML(c config.Config) ([]byte, error) {
@@ -220,6 +251,9 @@ var CollectionInfoSchema openapi3.Schema = openapi3.Schema{
 				},
 			},
 		},
+		"storageCrs": {
+			Value: openapi3.NewStringSchema(),
+		},
 	},
 }
 
@@ -315,8 +349,91 @@ var ConformanceClassesSchema openapi3.Schema = openapi3.Schema{
 	},
 }
 
+// JSON Schema of the properties a collection's features may be filtered on
+// @See http://docs.opengeospatial.org/DRAFTS/19-079.html#queryables
+type Queryables struct {
+	Schema     string                        `json:"$schema"`
+	Id         string                        `json:"$id,omitempty"`
+	Type       string                        `json:"type"`
+	Title      string                        `json:"title,omitempty"`
+	Properties map[string]*QueryableProperty `json:"properties"`
+	// For the html page only, JSON Schema has no place for them
+	Links []*Link `json:"-"`
+}
+
+// Type is "" if the property's type isn't known, it may then have values of any type
+type QueryableProperty struct {
+	Title  string `json:"title,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Format string `json:"format,omitempty"`
+}
+
+// The JSON Schema version of Queryables
+const JSONSchemaDialect = "http://json-schema.org/draft-07/schema#"
+
+func (qs *Queryables) MarshalHTML(c config.Config) ([]byte, error) {
+	body := map[string]interface{}{"config": c, "data": qs}
+
+	content, err := util.RenderTemplate(tmpl_queryables, body)
+
+	if err != nil {
+		return content, err
+	}
+
+	data := map[string]interface{}{"config": c, "body": template.HTML(content), "links": qs.Links}
+
+	return util.RenderTemplate(tmpl_base, data)
+}
+
+// JSON Schema of the properties a collection's features may be sorted on, the same as Queryables
+// but for the html page.
+// @See http://docs.ogc.org/DRAFTS/22-033.html#sortables
+type Sortables struct {
+	Queryables
+}
+
+func (ss *Sortables) MarshalHTML(c config.Config) ([]byte, error) {
+	body := map[string]interface{}{"config": c, "data": ss}
+
+	content, err := util.RenderTemplate(tmpl_sortables, body)
+
+	if err != nil {
+		return content, err
+	}
+
+	data := map[string]interface{}{"config": c, "body": template.HTML(content), "links": ss.Links}
+
+	return util.RenderTemplate(tmpl_base, data)
+}
+
+var QueryablesSchema openapi3.Schema = openapi3.Schema{
+	Type:     "object",
+	Required: []string{"type", "properties"},
+	Properties: map[string]*openapi3.SchemaRef{
+		"$schema": {
+			Value: openapi3.NewStringSchema(),
+		},
+		"$id": {
+			Value: openapi3.NewStringSchema(),
+		},
+		"type": {
+			Value: openapi3.NewStringSchema(),
+		},
+		"title": {
+			Value: openapi3.NewStringSchema(),
+		},
+		"properties": {
+			Value: openapi3.NewObjectSchema(),
+		},
+	},
+}
+
 type FeatureCollection struct {
 	geojson.FeatureCollection
+	// Shadows geojson.FeatureCollection.Features for features w/ string ids
+	Features []Feature `json:"features"`
+	// Set for search results, the id to page through them w/
+	ResultSetId    string  `json:"resultSetId,omitempty"`
 	Links          []*Link `json:"links,omitempty"`
 	NumberMatched  uint    `json:"numberMatched,omitempty"`
 	NumberReturned uint    `json:"numberReturned,omitempty"`
@@ -338,6 +455,8 @@ func (fc *FeatureCollection) MarshalHTML(c config.Config) ([]byte, error) {
 
 type Feature struct {
 	geojson.Feature
+	// Shadows geojson.Feature.ID, feature ids are opaque strings
+	ID    string  `json:"id,omitempty"`
 	Links []*Link `json:"links,omitempty"`
 }
 